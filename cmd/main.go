@@ -2,92 +2,449 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"calleventhub/internal/anomaly"
+	"calleventhub/internal/anonymize"
 	"calleventhub/internal/config"
 	"calleventhub/internal/consumer"
+	"calleventhub/internal/fleet"
 	"calleventhub/internal/forwarder"
 	"calleventhub/internal/http"
 	"calleventhub/internal/logger"
+	"calleventhub/internal/mirror"
 	"calleventhub/internal/nats"
+	"calleventhub/internal/opsnotify"
+	"calleventhub/internal/preflight"
+	"calleventhub/internal/receipts"
+	"calleventhub/internal/report"
+	"calleventhub/internal/service"
+	"calleventhub/internal/sla"
 	"calleventhub/internal/store"
 
+	"github.com/fsnotify/fsnotify"
 	"go.uber.org/zap"
 )
 
+// version is set at build time: go build -ldflags "-X main.version=1.4.0"
+var version = "dev"
+
 func main() {
 	// Parse command line flags
 	configPath := flag.String("config", "config.yaml", "Path to configuration file")
+	configDir := flag.String("config-dir", "", "Directory of route files (*.yaml or *.json, e.g. one per tenant team) loaded with the configuration file; a broken file is rejected without affecting the others")
 	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
 	logFile := flag.String("log-file", "", "Path to log file (empty = stdout only, ignored if domain-logging is enabled)")
 	domainLogging := flag.Bool("domain-logging", true, "Enable domain-based logging (logs grouped by domain in logs/ directory)")
+	drainOnSigterm := flag.Bool("drain-on-sigterm", false, "On shutdown, fail readiness and wait for in-flight forwards before exiting")
+	drainTimeout := flag.Duration("drain-timeout", 25*time.Second, "Maximum time to wait for in-flight forwards when draining")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "Maximum time to wait for HTTP server shutdown")
+	stopTimeout := flag.Duration("stop-timeout", 2*time.Second, "Maximum time to wait for in-flight forwards on shutdown without draining")
+	exportFile := flag.String("export-stream", "", "Export stream messages to this file (JSON Lines) and exit")
+	importFile := flag.String("import-stream", "", "Import stream messages from an export file and exit")
+	exportStartSeq := flag.Uint64("export-start-seq", 0, "First stream sequence to export (0 = from the beginning)")
+	exportEndSeq := flag.Uint64("export-end-seq", 0, "Last stream sequence to export (0 = to the end)")
+	exportSince := flag.String("export-since", "", "Only export messages stored at or after this time (RFC3339)")
+	exportUntil := flag.String("export-until", "", "Only export messages stored at or before this time (RFC3339)")
+	exportAnonymize := flag.String("export-anonymize", "", "Anonymization profile applied to exported payloads (e.g. default)")
+	validateConfig := flag.Bool("validate-config", false, "Validate the configuration file, print warnings and exit (status 1 if invalid)")
+	preflightOnly := flag.Bool("preflight", false, "Run the startup checks (including endpoint probes), print the report and exit (status 1 if a check failed)")
+	verifyEndpoint := flag.String("verify-endpoint", "", "Send a backend (endpoint name or URL) the synthetic events of the contract test, print which it handled correctly and exit (status 1 if a case failed)")
+	verifyDomain := flag.String("verify-domain", "", "Route whose settings -verify-endpoint uses (required if the endpoint is not configured)")
+	encryptConfig := flag.String("encrypt-config", "", "Encrypt the configuration file to this path with the key from "+config.ConfigKeyEnv+" and exit")
+	decryptConfig := flag.Bool("decrypt-config", false, "Print the decrypted configuration file to stdout and exit")
+	putRoutes := flag.String("put-routes", "", "Validate a routes file and write it to the config_source key, e.g. the NATS KV bucket, and exit")
+	endpointOverrides := flag.String("endpoint-overrides", "endpoint-overrides.json", "File where endpoint rotation changes made via the API are saved (empty = not saved)")
+	signingSecrets := flag.String("signing-secrets", "signing-secrets.json", "File where signing secrets rotated via the API are saved (empty = not saved)")
+	instanceID := flag.String("instance-id", "", "Instance identifier reported to the fleet and sent to backends (default: hostname)")
+	serviceAction := flag.String("service", "", "Windows service management: install or uninstall (registers current flags)")
+	serviceName := flag.String("service-name", service.DefaultName, "Service name used for Windows SCM registration")
+	devMode := flag.Bool("dev", false, "Development mode: run without NATS, an in-process queue replaces JetStream (nothing is durable)")
+	roleFlag := flag.String("role", "", "What this instance runs: all, or a comma-separated list of ingest (accept and publish events), consumer (forward events) and dashboard (dashboard and /api); overrides role in the config (default all)")
 	flag.Parse()
 
+	// Check the configuration and exit, e.g. in CI before deploying it
+	if *validateConfig {
+		os.Exit(runValidateConfig(*configPath, *configDir))
+	}
+
+	// Encrypted config at rest: produce or read an encrypted file and exit
+	if *encryptConfig != "" || *decryptConfig {
+		if err := runConfigEncryption(*configPath, *encryptConfig); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Publish routes to the instances watching the config source and exit
+	if *putRoutes != "" {
+		os.Exit(runPutRoutes(*configPath, *putRoutes))
+	}
+
 	// Initialize logger
 	if err := logger.Init(*logLevel, *logFile, *domainLogging); err != nil {
 		panic(err)
 	}
 	defer logger.Sync()
 
-	logger.Logger.Info("Starting event-hub service")
+	// Check that this host can run the service and exit, e.g. before a deployment
+	if *preflightOnly {
+		os.Exit(runPreflight(*configPath, *configDir))
+	}
+
+	// Contract-test a backend endpoint and exit, e.g. while onboarding a customer
+	if *verifyEndpoint != "" {
+		os.Exit(runVerifyEndpoint(*configPath, *configDir, *verifyDomain, *verifyEndpoint, *instanceID, *signingSecrets))
+	}
+
+	// Handle service registration commands and exit
+	if *serviceAction != "" {
+		if err := manageService(*serviceAction, *serviceName); err != nil {
+			logger.Logger.Fatal("Service command failed", zap.String("action", *serviceAction), zap.Error(err))
+		}
+		logger.Logger.Info("Service command completed", zap.String("action", *serviceAction), zap.String("service", *serviceName))
+		return
+	}
+
+	// Attach to the init system (SCM on Windows, no-op elsewhere)
+	if err := service.Init(*serviceName); err != nil {
+		logger.Logger.Fatal("Failed to initialize service integration", zap.Error(err))
+	}
 
 	// Load configuration
-	cfg, err := config.Load(*configPath)
+	cfg, err := config.LoadDir(*configPath, *configDir, nil)
 	if err != nil {
 		logger.Logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
+	for _, warning := range cfg.Lint() {
+		logger.Logger.Warn("Configuration warning", zap.String("path", warning.Path), zap.String("warning", warning.Message))
+	}
+
+	// Ingest, forwarding and the dashboard can be scaled, deployed and restarted separately
+	// (requires restart to change)
+	roleValue := cfg.Role
+	if *roleFlag != "" {
+		roleValue = *roleFlag
+	}
+	role, err := config.ParseRole(roleValue)
+	if err != nil {
+		logger.Logger.Fatal("Invalid -role", zap.Error(err))
+	}
+	if *devMode && (!role.Ingest || !role.Consumer) {
+		logger.Logger.Fatal("Roles without both ingest and consumer share events through NATS, not available with -dev")
+	}
+	forwards := role.Consumer
+
+	logger.Logger.Info("Starting event-hub service", zap.String("role", role.String()))
+
+	// Identifies this instance in logs, to the fleet, to backends and in event records
+	*instanceID = resolveInstanceID(*instanceID, cfg)
+	logger.SetInstance(*instanceID)
+
+	// Without NATS, only the HTTP → forward pipeline runs; everything else needing a server is off
+	if *devMode {
+		logger.Logger.Warn("Development mode: events are queued in memory instead of NATS JetStream and lost on exit; " +
+			"preflight, spool, takeover, dedup ledger, delivery report, receipts, mirroring and fleet reporting are disabled")
+	}
+
+	// Refuse to start an instance that would look alive without being able to forward
+	if !cfg.Preflight.Disabled && !*devMode {
+		report := preflight.Run(cfg, logger.LogsDir())
+		logPreflight(report)
+		if report.Failed() {
+			logger.Logger.Fatal("Preflight checks failed, not starting", zap.String("summary", report.Summary()))
+		}
+	}
 
 	// Create NATS publisher
-	publisher, err := nats.NewPublisher(
+	publisher, err := newPublisher(
 		cfg.NATS.URL,
 		cfg.NATS.StreamName,
 		cfg.NATS.SubjectPattern,
+		*devMode,
 	)
 	if err != nil {
 		logger.Logger.Fatal("Failed to create NATS publisher", zap.Error(err))
 	}
 	defer publisher.Close()
+	publisher.SetCompression(cfg.NATS.Compression.Algorithm, cfg.NATS.Compression.ThresholdBytes)
 
-	// Create NATS consumer
-	natsConsumer, err := nats.NewConsumer(
-		cfg.NATS.URL,
-		cfg.NATS.StreamName,
-		cfg.NATS.SubjectPattern,
-		"event-hub-consumer",
-		cfg.NATS.AckWait,
-		cfg.NATS.MaxDeliveries,
-	)
-	if err != nil {
-		logger.Logger.Fatal("Failed to create NATS consumer", zap.Error(err))
+	// Disaster recovery: export or import the stream and exit
+	if *exportFile != "" || *importFile != "" {
+		if *devMode {
+			logger.Logger.Fatal("-export-stream and -import-stream need a NATS stream, not available with -dev")
+		}
+		rng := nats.ExportRange{StartSeq: *exportStartSeq, EndSeq: *exportEndSeq}
+		if err := parseTimeFlag(*exportSince, &rng.Since); err != nil {
+			logger.Logger.Fatal("Invalid -export-since", zap.Error(err))
+		}
+		if err := parseTimeFlag(*exportUntil, &rng.Until); err != nil {
+			logger.Logger.Fatal("Invalid -export-until", zap.Error(err))
+		}
+		var transform nats.PayloadTransform
+		if *exportAnonymize != "" {
+			anonymizer, err := anonymize.FromConfig(cfg, *exportAnonymize)
+			if err != nil {
+				logger.Logger.Fatal("Invalid -export-anonymize", zap.Error(err))
+			}
+			transform = anonymizer.Apply
+		}
+		if err := runStreamBackup(publisher, *exportFile, *importFile, rng, transform); err != nil {
+			logger.Logger.Fatal("Stream backup operation failed", zap.Error(err))
+		}
+		return
+	}
+
+	// Keep ingested events on disk during NATS outages (requires restart to change)
+	enableSpool(cfg, publisher)
+
+	// Wait for the instance being replaced to hand the consumer over (requires restart to change)
+	var consumerLock *nats.TakeoverLock
+	if forwards {
+		consumerLock = takeConsumer(cfg, publisher, "event-hub-consumer", *instanceID)
+	}
+	if consumerLock != nil {
+		defer consumerLock.Release()
+	}
+
+	// Create NATS consumer (ingest-only instances leave forwarding to the consumer instances)
+	var natsConsumer *nats.Consumer
+	if forwards {
+		natsConsumer, err = newConsumer(cfg, publisher, cfg.NATS.URL, cfg.NATS.SubjectPattern, "event-hub-consumer")
+		if err != nil {
+			logger.Logger.Fatal("Failed to create NATS consumer", zap.Error(err))
+		}
+		defer natsConsumer.Close()
+		enableLedger(cfg, natsConsumer, *devMode)
 	}
-	defer natsConsumer.Close()
 
 	// Create event store (keep last 10000 events)
 	eventStore := store.NewStore(10000)
+	eventStore.SetMemoryLimit(int64(cfg.Store.MaxMemoryMB) << 20)
+	eventStore.SetCompression(cfg.Store.Compress, cfg.Store.CompressThresholdBytes)
+
+	eventStore.SetInstance(*instanceID)
 
 	// Create forwarder
 	fwd := forwarder.NewForwarder(cfg, eventStore)
+	fwd.SetIdentity(*instanceID, version)
+	fwd.SetConfigDir(*configDir)
+	if *endpointOverrides != "" {
+		if err := fwd.LoadEndpointOverrides(*endpointOverrides); err != nil {
+			logger.Logger.Fatal("Failed to load endpoint overrides", zap.Error(err))
+		}
+	}
+	if *signingSecrets != "" {
+		if err := fwd.LoadSigningSecrets(*signingSecrets); err != nil {
+			logger.Logger.Fatal("Failed to load signing secrets", zap.Error(err))
+		}
+	}
 
-	// Create consumer service
-	consumerService := consumer.NewConsumerService(cfg, natsConsumer, fwd)
+	// Publish delivery receipts for downstream systems (requires restart to change)
+	if cfg.NATS.Receipts.Subject != "" && !*devMode {
+		receiptPublisher, err := receipts.NewPublisher(cfg.NATS.URL, cfg.NATS.Receipts.Subject)
+		if err != nil {
+			logger.Logger.Fatal("Failed to create receipt publisher", zap.Error(err))
+		}
+		defer receiptPublisher.Close()
+		fwd.SetReceipts(receiptPublisher)
+		logger.Logger.Info("Delivery receipts enabled", zap.String("subject", cfg.NATS.Receipts.Subject))
+	}
+
+	// Create consumer service; consumers of this instance, for the terminate API
+	var consumerServices []*consumer.ConsumerService
+	var natsConsumers []*nats.Consumer
+	if natsConsumer != nil {
+		consumerServices = append(consumerServices, consumer.NewConsumerService(cfg, natsConsumer, fwd))
+		natsConsumers = append(natsConsumers, natsConsumer)
+	}
+
+	if consumerLock != nil {
+		go handOver(consumerLock, consumerServices[0], *drainTimeout)
+	}
 
 	// Create HTTP handler
 	httpHandler := http.NewHandler(publisher, eventStore, cfg, fwd, *configPath)
+	httpHandler.SetIdentity(*instanceID, version)
 
-	// Create HTTP server
-	httpServer := http.NewServer(cfg.Server.Port, httpHandler)
+	// Replay the events an endpoint failed during an outage once it recovers (recovery_replay)
+	fwd.SetRecoveryHandler(httpHandler.ReplayRecovered)
 
-	// Start consumer service in background
-	consumerErrChan := make(chan error, 1)
-	go func() {
-		if err := consumerService.Start(); err != nil {
-			consumerErrChan <- err
+	// Count accepted, delivered and dead-lettered events per day for the monthly delivery
+	// report (requires restart to change)
+	if settings := cfg.NATS.DeliveryReport; settings.Enabled && !*devMode {
+		retention := time.Duration(settings.RetentionMonths) * 31 * 24 * time.Hour
+		counters, err := sla.Open(publisher.GetJetStream(), settings.Bucket, *instanceID, retention)
+		if err != nil {
+			logger.Logger.Warn("Failed to open delivery counters, events are not counted for the delivery report", zap.Error(err))
+		} else {
+			defer counters.Close()
+			fwd.SetDeliveryCounters(counters)
+			httpHandler.SetDeliveryCounters(counters)
 		}
-	}()
+	}
+
+	// Refuse ingest with 503 while publishing is slow or consumers fall behind (thresholds reload)
+	var backpressure *nats.Backpressure
+	if cfg.Server.Backpressure.Enabled() {
+		backpressure = nats.NewBackpressure(func() nats.BackpressureLimits {
+			limits := fwd.GetConfig().Server.Backpressure
+			return nats.BackpressureLimits{
+				MaxPublishLatency: time.Duration(limits.MaxPublishLatencyMs) * time.Millisecond,
+				MaxConsumerLag:    uint64(limits.MaxConsumerLag),
+			}
+		})
+		watchStream(backpressure, publisher, natsConsumer, "event-hub-consumer")
+		httpHandler.SetBackpressure(backpressure)
+	}
+
+	// In isolation mode every tenant gets its own stream, consumer and (optionally) NATS account
+	if cfg.Isolation.Enabled {
+		// Tenants' ops_url are read on every notification, so reloads can add or change them
+		opsNotifier := opsnotify.NewNotifier(*instanceID)
+		defer opsNotifier.Close()
+		fwd.SetOpsNotifier(opsNotifier)
+
+		tenantPublishers := make(map[string]*nats.Publisher)
+		for i := range cfg.Isolation.Tenants {
+			tenant := &cfg.Isolation.Tenants[i]
+			natsURL := cfg.NATS.URL
+			if tenant.NATSURL != "" {
+				natsURL = tenant.NATSURL
+			}
+
+			tenantPublisher, err := newPublisher(
+				natsURL,
+				tenant.StreamName(cfg.NATS.StreamName),
+				tenant.SubjectPattern(cfg.NATS.SubjectPattern),
+				*devMode,
+			)
+			if err != nil {
+				logger.Logger.Fatal("Failed to create tenant NATS publisher", zap.String("tenant", tenant.Name), zap.Error(err))
+			}
+			defer tenantPublisher.Close()
+			tenantPublisher.SetCompression(cfg.NATS.Compression.Algorithm, cfg.NATS.Compression.ThresholdBytes)
+			enableSpool(cfg, tenantPublisher)
+			tenantPublishers[tenant.Name] = tenantPublisher
+
+			tenantConsumerName := "event-hub-consumer-" + tenant.Name
+			var tenantConsumer *nats.Consumer
+			if forwards {
+				tenantLock := takeConsumer(cfg, tenantPublisher, tenantConsumerName, *instanceID)
+				if tenantLock != nil {
+					defer tenantLock.Release()
+				}
+
+				tenantConsumer, err = newConsumer(cfg, tenantPublisher, natsURL,
+					tenant.SubjectPattern(cfg.NATS.SubjectPattern), tenantConsumerName)
+				if err != nil {
+					logger.Logger.Fatal("Failed to create tenant NATS consumer", zap.String("tenant", tenant.Name), zap.Error(err))
+				}
+				defer tenantConsumer.Close()
+				enableLedger(cfg, tenantConsumer, *devMode)
+
+				tenantService := consumer.NewConsumerService(cfg, tenantConsumer, fwd)
+				if tenantLock != nil {
+					go handOver(tenantLock, tenantService, *drainTimeout)
+				}
+				consumerServices = append(consumerServices, tenantService)
+				natsConsumers = append(natsConsumers, tenantConsumer)
+			}
+			if backpressure != nil {
+				watchStream(backpressure, tenantPublisher, tenantConsumer, tenantConsumerName)
+			}
+			logger.Logger.Info("Tenant stream ready",
+				zap.String("tenant", tenant.Name),
+				zap.String("stream", tenant.StreamName(cfg.NATS.StreamName)),
+			)
+		}
+		httpHandler.SetTenantPublishers(tenantPublishers)
+	}
+	httpHandler.SetConsumers(natsConsumers)
+	httpHandler.SetConsumerServices(consumerServices)
+
+	// Mirror a sample of events to staging (requires restart to change)
+	if cfg.Mirror.Enabled && !*devMode {
+		var anonymizer *anonymize.Anonymizer
+		if cfg.Mirror.AnonymizeProfile != "" {
+			anonymizer, err = anonymize.FromConfig(cfg, cfg.Mirror.AnonymizeProfile)
+		} else if cfg.Mirror.Anonymize {
+			anonymizer, err = anonymize.FromConfig(cfg, "default")
+		}
+		if err != nil {
+			logger.Logger.Fatal("Failed to create mirror anonymizer", zap.Error(err))
+		}
+
+		eventMirror, err := mirror.NewMirror(cfg.Mirror, cfg.NATS.URL, anonymizer)
+		if err != nil {
+			logger.Logger.Fatal("Failed to create event mirror", zap.Error(err))
+		}
+		defer eventMirror.Close()
+		httpHandler.SetMirror(eventMirror)
+		logger.Logger.Info("Event mirroring enabled", zap.Float64("percentage", cfg.Mirror.Percentage))
+	}
+
+	// Publish config hash to the fleet for drift detection, and answer fleet stats requests
+	// (non-fatal if unavailable; the stats subject requires restart to change)
+	if !*devMode {
+		fleetReporter, err := fleet.NewReporter(cfg.NATS.URL, cfg.NATS.FleetSubject, *instanceID, 30*time.Second, fwd.GetConfig)
+		if err != nil {
+			logger.Logger.Warn("Failed to start fleet reporter", zap.Error(err))
+		} else {
+			if err := fleetReporter.EnableStats(cfg.NATS.FleetStatsSubject, eventStore.GetCounts); err != nil {
+				logger.Logger.Warn("Failed to answer fleet stats requests", zap.Error(err))
+			}
+			go fleetReporter.Start()
+			defer fleetReporter.Stop()
+			httpHandler.SetFleet(fleetReporter)
+		}
+	}
+
+	if backpressure != nil {
+		go backpressure.Start(2 * time.Second)
+		defer backpressure.Stop()
+	}
+
+	// Ingest rate spikes and silences per routed domain (checked every minute, follows reloads)
+	anomalies := anomaly.NewDetector(fwd.GetConfig)
+	go anomalies.Start()
+	defer anomalies.Stop()
+	httpHandler.SetAnomalies(anomalies)
+
+	// Daily failed-events reports to route contacts and digests to NATS (checked every minute, follows reloads)
+	reports := report.NewScheduler(eventStore, fwd.GetConfig)
+	go reports.Start()
+	defer reports.Stop()
+
+	// Create HTTP server
+	httpServer := http.NewServer(cfg.Server, httpHandler, role)
+
+	// Bind the listeners before reporting ready, so the init system does not start
+	// dependents (or a load balancer send requests) before the ports accept connections
+	if err := httpServer.Listen(); err != nil {
+		logger.Logger.Fatal("Failed to start HTTP server", zap.Error(err))
+	}
+
+	// Start consumer services in background
+	consumerErrChan := make(chan error, len(consumerServices))
+	for _, consumerService := range consumerServices {
+		go func(cs *consumer.ConsumerService) {
+			if err := cs.Start(); err != nil {
+				consumerErrChan <- err
+			}
+		}(consumerService)
+	}
 
 	// Start HTTP server in background
 	httpErrChan := make(chan error, 1)
@@ -97,14 +454,20 @@ func main() {
 		}
 	}()
 
-	// Start config file watcher in background
-	go watchConfigFile(*configPath, fwd, httpHandler)
+	// Reload as soon as the config file changes
+	go watchConfigFile(*configPath, *configDir, fwd, httpHandler)
+
+	// Reload when the routes change in Consul, etcd or the NATS KV bucket (config_source)
+	if cfg.ConfigSource.Enabled() {
+		go watchConfigSource(cfg.ConfigSource, cfg.NATS.URL, *configPath, fwd, httpHandler)
+	}
 
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	logger.Logger.Info("Service started successfully")
+	service.Ready()
 
 	// Wait for shutdown signal or error
 	select {
@@ -114,33 +477,467 @@ func main() {
 		logger.Logger.Error("HTTP server error", zap.Error(err))
 	case err := <-consumerErrChan:
 		logger.Logger.Error("Consumer service error", zap.Error(err))
+	case <-service.StopRequests():
+		logger.Logger.Info("Received stop request from service manager")
 	}
 
 	// Graceful shutdown
 	logger.Logger.Info("Initiating graceful shutdown")
+	service.Stopping()
 
-	// Stop accepting new HTTP requests
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if *drainOnSigterm {
+		// Fail readiness first so the load balancer stops routing new requests
+		httpHandler.SetDraining()
+
+		// Stop fetching and let in-flight forwards finish (ack/nak) before exiting
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), *drainTimeout)
+		drainConsumers(drainCtx, consumerServices)
+		stopConsumers(drainCtx, consumerServices)
+		cancelDrain()
+	} else {
+		// Stop fetching, hand fetched messages back to JetStream and give in-flight
+		// forwards a moment to finish; the subscriptions are closed afterwards
+		stopCtx, cancelStop := context.WithTimeout(context.Background(), *stopTimeout)
+		stopConsumers(stopCtx, consumerServices)
+		cancelStop()
+	}
 
-	// Stop consumer service (this will stop processing new messages)
-	consumerService.Stop()
+	// No more forwards - stop DNS refresh and close backend connections
+	fwd.Close()
 
-	// Drain NATS subscription (wait for in-flight messages to complete)
-	// The consumer will stop receiving new messages after Stop() is called
-	// Give it a moment to finish processing current messages
-	time.Sleep(2 * time.Second)
+	// Stop accepting new HTTP requests
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
 
 	// Shutdown HTTP server
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		logger.Logger.Error("Error during HTTP server shutdown", zap.Error(err))
 	}
 
+	// Flush any publishes accepted by in-flight ingest requests
+	if err := publisher.Flush(5 * time.Second); err != nil {
+		logger.Logger.Warn("Failed to flush NATS publisher", zap.Error(err))
+	}
+
 	logger.Logger.Info("Shutdown complete")
+	service.Stopped()
+}
+
+// runStreamBackup exports the stream to exportFile or imports importFile into it
+func runStreamBackup(publisher *nats.Publisher, exportFile, importFile string, rng nats.ExportRange, transform nats.PayloadTransform) error {
+	streamName := publisher.GetStreamName()
+
+	if exportFile != "" {
+		file, err := os.Create(exportFile)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer file.Close()
+
+		count, err := nats.ExportStream(publisher.GetJetStream(), streamName, rng, transform, file)
+		if err != nil {
+			return err
+		}
+		logger.Logger.Info("Stream exported", zap.String("stream", streamName), zap.String("file", exportFile), zap.Int("messages", count))
+		return nil
+	}
+
+	file, err := os.Open(importFile)
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer file.Close()
+
+	count, err := nats.ImportStream(publisher.GetJetStream(), streamName, file)
+	if err != nil {
+		return err
+	}
+	logger.Logger.Info("Stream imported", zap.String("stream", streamName), zap.String("file", importFile), zap.Int("messages", count))
+	return nil
+}
+
+// parseTimeFlag parses an optional RFC3339 flag value into dst
+func parseTimeFlag(value string, dst *time.Time) error {
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return err
+	}
+	*dst = t
+	return nil
+}
+
+// runValidateConfig validates and lints the configuration file, printing the result;
+// returns the process exit status
+func runValidateConfig(configPath, configDir string) int {
+	warnings, err := config.LintFile(configPath, configDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configPath, err)
+		return 1
+	}
+	for _, warning := range warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+	fmt.Printf("%s: valid (%d warnings)\n", configPath, len(warnings))
+	return 0
+}
+
+// runPutRoutes writes a routes file to the config source; returns the process exit status
+func runPutRoutes(configPath, routesPath string) int {
+	routes, err := os.ReadFile(routesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	key, err := config.PutSourceRoutes(configPath, routes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", routesPath, err)
+		return 1
+	}
+	fmt.Printf("%s: written to %s\n", routesPath, key)
+	return 0
+}
+
+// runPreflight runs the startup checks with endpoint probes and prints the report; returns
+// the process exit status
+func runPreflight(configPath, configDir string) int {
+	cfg, err := config.LoadDir(configPath, configDir, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configPath, err)
+		return 1
+	}
+	cfg.Preflight.ProbeEndpoints = true
+	report := preflight.Run(cfg, logger.LogsDir())
+	fmt.Print(report.String())
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
+
+// runVerifyEndpoint sends the contract test events to an endpoint with the settings of
+// its route (signed with the secrets saved at signingSecrets), prints the report and
+// returns the exit status
+func runVerifyEndpoint(configPath, configDir, domain, endpoint, instanceID, signingSecrets string) int {
+	cfg, err := config.LoadDir(configPath, configDir, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configPath, err)
+		return 1
+	}
+	fwd := forwarder.NewForwarder(cfg, nil)
+	defer fwd.Close()
+	fwd.SetIdentity(instanceID, version)
+	if signingSecrets != "" {
+		if err := fwd.LoadSigningSecrets(signingSecrets); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	report, err := fwd.VerifyEndpoint(context.Background(), domain, endpoint)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(report.String())
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// logPreflight logs each check of a startup report at a level matching its outcome
+func logPreflight(report *preflight.Report) {
+	for _, result := range report.Results {
+		fields := []zap.Field{zap.String("check", result.Check), zap.String("detail", result.Detail)}
+		switch result.Status {
+		case preflight.StatusFail:
+			logger.Logger.Error("Preflight check failed", append(fields, zap.String("hint", result.Hint))...)
+		case preflight.StatusWarn:
+			logger.Logger.Warn("Preflight check warning", append(fields, zap.String("hint", result.Hint))...)
+		default:
+			logger.Logger.Info("Preflight check passed", fields...)
+		}
+	}
+	logger.Logger.Info("Preflight checks completed", zap.String("summary", report.Summary()))
+}
+
+// runConfigEncryption encrypts the configuration file at configPath to output, or prints it
+// decrypted when output is empty. The key is read from the environment.
+func runConfigEncryption(configPath, output string) error {
+	key, err := config.ConfigKey()
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		plaintext, err := config.ReadFile(configPath)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(plaintext)
+		return err
+	}
+
+	plaintext, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if config.IsEncrypted(plaintext) {
+		return fmt.Errorf("%s is already encrypted", configPath)
+	}
+	// Refuse to encrypt a configuration that would not load
+	if _, err := config.Parse(plaintext); err != nil {
+		return err
+	}
+	encrypted, err := config.Encrypt(plaintext, key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, encrypted, 0600)
+}
+
+// watchStream adds a stream to the ingest backpressure checks, with its consumer if this
+// instance runs it, else with the lag of the durable consumer the consumer instances share
+func watchStream(backpressure *nats.Backpressure, publisher *nats.Publisher, c *nats.Consumer, consumerName string) {
+	if c != nil {
+		backpressure.Watch(publisher, c)
+		return
+	}
+	backpressure.WatchConsumer(publisher, consumerName)
+}
+
+// newPublisher connects a publisher to the stream, or with dev creates it on an in-process queue
+func newPublisher(url, streamName, subjectPattern string, dev bool) (*nats.Publisher, error) {
+	if dev {
+		return nats.NewDevPublisher(nats.NewDevQueue(streamName), subjectPattern), nil
+	}
+	return nats.NewPublisher(url, streamName, subjectPattern)
+}
+
+// newConsumer creates the durable consumer of the publisher's stream, or of its in-process
+// queue in dev mode
+func newConsumer(cfg *config.Config, publisher *nats.Publisher, url, subjectPattern, consumerName string) (*nats.Consumer, error) {
+	if queue := publisher.Dev(); queue != nil {
+		return nats.NewDevConsumer(queue, consumerName, cfg.NATS.AckWait, cfg.MaxDeliveryLimit(), cfg.NATS.MaxAckPending), nil
+	}
+	return nats.NewConsumer(
+		url,
+		publisher.GetStreamName(),
+		subjectPattern,
+		consumerName,
+		cfg.NATS.AckWait,
+		cfg.MaxDeliveryLimit(),
+		cfg.NATS.MaxAckPending,
+	)
+}
+
+// enableLedger turns on the dedup ledger of a consumer if configured (non-fatal if the bucket is unavailable)
+func enableLedger(cfg *config.Config, c *nats.Consumer, dev bool) {
+	if !cfg.NATS.DedupLedger.Enabled || dev {
+		return
+	}
+	if err := c.EnableLedger(cfg.NATS.DedupLedger.Bucket, cfg.NATS.DedupLedger.MaxRanges); err != nil {
+		logger.Logger.Warn("Failed to open dedup ledger, already-forwarded messages will not be skipped", zap.Error(err))
+	}
+}
+
+// enableSpool spools the publisher's ingested events in a directory of its stream when
+// server.spool is enabled
+func enableSpool(cfg *config.Config, publisher *nats.Publisher) {
+	settings := cfg.Server.Spool
+	if !settings.Enabled || publisher.Dev() != nil {
+		return
+	}
+	dir := filepath.Join(settings.Directory, publisher.GetStreamName())
+	spool, err := nats.NewSpool(dir, int64(settings.MaxMB)<<20, settings.Overflow == config.SpoolOverflowDropOldest)
+	if err != nil {
+		logger.Logger.Fatal("Failed to open ingest spool", zap.String("directory", dir), zap.Error(err))
+	}
+	publisher.SetSpool(spool)
+	logger.Logger.Info("Ingest spool enabled",
+		zap.String("directory", dir),
+		zap.Int("max_mb", settings.MaxMB),
+		zap.String("overflow", settings.Overflow),
+	)
+}
+
+// resolveInstanceID returns the instance ID: the -instance-id flag, else instance_id of the
+// configuration, else the hostname or, failing that, the machine ID
+func resolveInstanceID(flagValue string, cfg *config.Config) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if cfg.InstanceID != "" {
+		return cfg.InstanceID
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	if data, err := os.ReadFile("/etc/machine-id"); err == nil {
+		if id := strings.TrimSpace(string(data)); len(id) >= 12 {
+			return "machine-" + id[:12]
+		}
+	}
+	return fmt.Sprintf("pid-%d", os.Getpid())
+}
+
+// takeConsumer returns, with nats.takeover enabled, the lock on the durable consumer once any
+// other instance fetching from it has handed it over (nil if takeover is disabled)
+func takeConsumer(cfg *config.Config, publisher *nats.Publisher, consumerName, instanceID string) *nats.TakeoverLock {
+	takeover := cfg.NATS.Takeover
+	if !takeover.Enabled || publisher.Dev() != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(takeover.WaitSeconds)*time.Second)
+	defer cancel()
+	owner := fmt.Sprintf("%s/%d", instanceID, os.Getpid())
+	lock, err := nats.AcquireTakeover(ctx, publisher.GetJetStream(), takeover.Bucket, consumerName, owner, time.Duration(takeover.LeaseSeconds)*time.Second)
+	if err != nil {
+		logger.Logger.Fatal("Failed to take over NATS consumer", zap.String("consumer", consumerName), zap.Error(err))
+	}
+	return lock
+}
+
+// handOver waits until another instance asks for the consumer, then stops fetching, lets
+// in-flight forwards finish (up to timeout) and releases the lock. The instance keeps
+// serving HTTP until it is stopped.
+func handOver(lock *nats.TakeoverLock, cs *consumer.ConsumerService, timeout time.Duration) {
+	instance := <-lock.Requested()
+	logger.Logger.Warn("Handing NATS consumer over to new instance", zap.String("instance", instance))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := cs.Drain(ctx); err != nil {
+		logger.Logger.Warn("Drain deadline exceeded before handover, remaining messages will be redelivered", zap.Error(err))
+	}
+	lock.Release()
+}
+
+// drainConsumers drains all consumer services concurrently under a shared deadline
+func drainConsumers(ctx context.Context, services []*consumer.ConsumerService) {
+	var wg sync.WaitGroup
+	for _, consumerService := range services {
+		wg.Add(1)
+		go func(cs *consumer.ConsumerService) {
+			defer wg.Done()
+			if err := cs.Drain(ctx); err != nil {
+				logger.Logger.Warn("Drain deadline exceeded, remaining messages will be redelivered", zap.Error(err))
+			}
+		}(consumerService)
+	}
+	wg.Wait()
+}
+
+// stopConsumers stops all consumer services concurrently under a shared deadline
+func stopConsumers(ctx context.Context, services []*consumer.ConsumerService) {
+	var wg sync.WaitGroup
+	for _, consumerService := range services {
+		wg.Add(1)
+		go func(cs *consumer.ConsumerService) {
+			defer wg.Done()
+			cs.Stop(ctx)
+		}(consumerService)
+	}
+	wg.Wait()
+}
+
+// manageService installs or uninstalls the Windows service
+// The service is registered with all explicitly set flags except the service commands
+func manageService(action, name string) error {
+	switch action {
+	case "install":
+		var args []string
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "service" || f.Name == "service-name" {
+				return
+			}
+			args = append(args, fmt.Sprintf("-%s=%s", f.Name, f.Value.String()))
+		})
+		args = append(args, fmt.Sprintf("-service-name=%s", name))
+		return service.Install(name, args)
+	case "uninstall":
+		return service.Uninstall(name)
+	default:
+		return fmt.Errorf("unknown service action %q (expected install or uninstall)", action)
+	}
+}
+
+// configDebounce is how long the config watcher waits after the last change in the config
+// file's directory, so a file written in several steps is reloaded once
+const configDebounce = 200 * time.Millisecond
+
+// watchConfigFile reloads the configuration as soon as the config file, or a route file of
+// the config directory, changes. The file's directory is watched rather than the file, so
+// atomic replaces (a temporary file renamed over the config, as editors and configuration
+// management tools do) and symlink swaps (Kubernetes ConfigMaps) are seen too; a change is
+// reloaded if the files' content differs. Without file notifications, the files are polled
+// instead.
+func watchConfigFile(configPath, configDir string, fwd *forwarder.Forwarder, handler *http.Handler) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Logger.Warn("File notifications unavailable, polling the config file instead", zap.Error(err))
+		pollConfigFile(configPath, configDir, fwd, handler)
+		return
+	}
+	defer watcher.Close()
+
+	// The directory of the file, and of its target if it is a symlink, and the config directory
+	watchDirs := func() error {
+		if err := watcher.Add(filepath.Dir(configPath)); err != nil {
+			return err
+		}
+		if configDir != "" {
+			if err := watcher.Add(configDir); err != nil {
+				return err
+			}
+		}
+		if target, err := filepath.EvalSymlinks(configPath); err == nil {
+			return watcher.Add(filepath.Dir(target))
+		}
+		return nil
+	}
+	if err := watchDirs(); err != nil {
+		logger.Logger.Warn("Failed to watch config file, polling it instead", zap.String("path", configPath), zap.Error(err))
+		watcher.Close()
+		pollConfigFile(configPath, configDir, fwd, handler)
+		return
+	}
+
+	last := configDigest(configPath, configDir)
+	var debounce <-chan time.Time
+	for {
+		select {
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			debounce = time.After(configDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Logger.Warn("Config file watcher error", zap.String("path", configPath), zap.Error(err))
+		case <-debounce:
+			debounce = nil
+			// A symlink may point somewhere else now
+			watchDirs()
+
+			// Unchanged, or missing in the middle of a replace (its creation is seen later)
+			digest := configDigest(configPath, configDir)
+			if digest == "" || digest == last {
+				continue
+			}
+			last = digest
+			reloadConfigFile(configPath, fwd, handler)
+		}
+	}
 }
 
-// watchConfigFile watches the config file for changes and automatically reloads
-func watchConfigFile(configPath string, fwd *forwarder.Forwarder, handler *http.Handler) {
+// pollConfigFile checks the config file's modification time, and the route files of the
+// config directory, every 2 seconds and reloads them when they changed
+func pollConfigFile(configPath, configDir string, fwd *forwarder.Forwarder, handler *http.Handler) {
 	// Get initial file modification time
 	initialStat, err := os.Stat(configPath)
 	if err != nil {
@@ -148,6 +945,7 @@ func watchConfigFile(configPath string, fwd *forwarder.Forwarder, handler *http.
 		return
 	}
 	lastModTime := initialStat.ModTime()
+	lastDir := dirDigest(configDir)
 
 	// Check file every 2 seconds
 	ticker := time.NewTicker(2 * time.Second)
@@ -161,24 +959,107 @@ func watchConfigFile(configPath string, fwd *forwarder.Forwarder, handler *http.
 		}
 
 		// Check if file was modified
-		if stat.ModTime().After(lastModTime) {
+		dir := dirDigest(configDir)
+		if stat.ModTime().After(lastModTime) || dir != lastDir {
 			lastModTime = stat.ModTime()
-			logger.Logger.Info("Config file changed, reloading...", zap.String("path", configPath))
+			lastDir = dir
+			reloadConfigFile(configPath, fwd, handler)
+		}
+	}
+}
 
-			// Reload config
-			if err := fwd.ReloadConfig(configPath); err != nil {
-				logger.Logger.Error("Failed to auto-reload config", zap.String("path", configPath), zap.Error(err))
-				continue
-			}
+// reloadConfigFile reloads the changed config file and hands the new config to the handler
+func reloadConfigFile(configPath string, fwd *forwarder.Forwarder, handler *http.Handler) {
+	logger.Logger.Info("Config file changed, reloading...", zap.String("path", configPath))
 
-			// Update handler's config reference
-			// Note: We need to access handler's internal fields, so we'll use a method
-			handler.UpdateConfig(fwd.GetConfig())
+	// Reload config
+	if err := fwd.ReloadConfig(configPath); err != nil {
+		logger.Logger.Error("Failed to auto-reload config", zap.String("path", configPath), zap.Error(err))
+		return
+	}
 
-			logger.Logger.Info("Config auto-reloaded successfully",
-				zap.String("path", configPath),
-				zap.Int("route_count", len(fwd.GetConfig().Routes)),
-			)
+	// Update handler's config reference
+	// Note: We need to access handler's internal fields, so we'll use a method
+	handler.UpdateConfig(fwd.GetConfig())
+
+	logger.Logger.Info("Config auto-reloaded successfully",
+		zap.String("path", configPath),
+		zap.Int("route_count", len(fwd.GetConfig().Routes)),
+	)
+}
+
+// fileDigest returns the SHA-256 of a file's content (empty if it cannot be read)
+func fileDigest(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// configDigest returns the SHA-256 of the config file and the route files of the config
+// directory (empty if the config file cannot be read)
+func configDigest(configPath, configDir string) string {
+	digest := fileDigest(configPath)
+	if digest == "" {
+		return ""
+	}
+	return digest + dirDigest(configDir)
+}
+
+// dirDigest returns the SHA-256 of the names and content of the route files of the config
+// directory (empty without one)
+func dirDigest(configDir string) string {
+	if configDir == "" {
+		return ""
+	}
+	entries, _ := os.ReadDir(configDir)
+	hash := sha256.New()
+	for _, entry := range entries {
+		if entry.IsDir() || !config.IsDirFile(entry.Name()) {
+			continue
+		}
+		file := filepath.Join(configDir, entry.Name())
+		hash.Write([]byte(file))
+		hash.Write([]byte(fileDigest(file)))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// watchConfigSource waits for changes of the routes key of the config source and reloads the
+// configuration, like watchConfigFile does when the file changes
+func watchConfigSource(settings config.ConfigSourceConfig, natsURL, configPath string, fwd *forwarder.Forwarder, handler *http.Handler) {
+	source, err := config.NewSource(settings, natsURL)
+	if err != nil {
+		logger.Logger.Warn("Failed to watch config source", zap.Error(err))
+		return
+	}
+	ctx := context.Background()
+	_, version, _ := source.Get(ctx)
+
+	for {
+		current, err := source.Wait(ctx, version)
+		if err != nil {
+			logger.Logger.Warn("Failed to watch config source, retrying", zap.String("source", source.String()), zap.Error(err))
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		if current == version {
+			continue
 		}
+		version = current
+		logger.Logger.Info("Config source changed, reloading...", zap.String("source", source.String()))
+
+		if err := fwd.ReloadConfig(configPath); err != nil {
+			logger.Logger.Error("Failed to auto-reload config", zap.String("source", source.String()), zap.Error(err))
+			continue
+		}
+		handler.UpdateConfig(fwd.GetConfig())
+
+		logger.Logger.Info("Config auto-reloaded successfully",
+			zap.String("source", source.String()),
+			zap.Int("route_count", len(fwd.GetConfig().Routes)),
+		)
 	}
 }
@@ -0,0 +1,344 @@
+// Package event is the canonical model of the call events the hub ingests and forwards.
+// The fields common to PBX systems are typed; every other field is kept as the raw JSON
+// the PBX sent, so an event passes through the hub without losing or reformatting data.
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Event is a call event. A well-known field is only set when the event has it as a
+// non-empty string; otherwise (a number, null, an object...) it stays in Extra as sent.
+type Event struct {
+	Domain     string // Required: used for routing
+	CallID     string
+	HubEventID string // Given at ingest (empty for events published before hub event IDs existed)
+	State      string
+	Status     string
+	Direction  string
+
+	ActualHotline        string
+	Billsec              string
+	CRMContactID         string
+	Duration             string
+	FromNumber           string
+	Hotline              string
+	Network              string
+	Provider             string
+	ReceiveDest          string
+	SIPCallID            string
+	SIPHangupDisposition string
+	TimeEnded            string
+	TimeStarted          string
+	ToNumber             string
+
+	Extra map[string]json.RawMessage // Every other field, by name
+}
+
+// knownFields are the JSON names of the typed fields
+var knownFields = []string{
+	"domain", "call_id", "hub_event_id", "state", "status", "direction",
+	"actual_hotline", "billsec", "crm_contact_id", "duration", "from_number", "hotline", "network",
+	"provider", "receive_dest", "sip_call_id", "sip_hangup_disposition", "time_ended", "time_started",
+	"to_number",
+}
+
+// field returns the typed field of a JSON name (nil for other fields)
+func (e *Event) field(name string) *string {
+	switch name {
+	case "domain":
+		return &e.Domain
+	case "call_id":
+		return &e.CallID
+	case "hub_event_id":
+		return &e.HubEventID
+	case "state":
+		return &e.State
+	case "status":
+		return &e.Status
+	case "direction":
+		return &e.Direction
+	case "actual_hotline":
+		return &e.ActualHotline
+	case "billsec":
+		return &e.Billsec
+	case "crm_contact_id":
+		return &e.CRMContactID
+	case "duration":
+		return &e.Duration
+	case "from_number":
+		return &e.FromNumber
+	case "hotline":
+		return &e.Hotline
+	case "network":
+		return &e.Network
+	case "provider":
+		return &e.Provider
+	case "receive_dest":
+		return &e.ReceiveDest
+	case "sip_call_id":
+		return &e.SIPCallID
+	case "sip_hangup_disposition":
+		return &e.SIPHangupDisposition
+	case "time_ended":
+		return &e.TimeEnded
+	case "time_started":
+		return &e.TimeStarted
+	case "to_number":
+		return &e.ToNumber
+	}
+	return nil
+}
+
+// Parse decodes a JSON event
+func Parse(data []byte) (*Event, error) {
+	e := &Event{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// UnmarshalJSON decodes a JSON object into the typed fields and Extra
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if fields == nil {
+		return errors.New("event must be a JSON object")
+	}
+	*e = Event{}
+	for name, raw := range fields {
+		p := e.field(name)
+		if p == nil || len(raw) == 0 || raw[0] != '"' {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil && s != "" {
+			*p = s
+			delete(fields, name)
+		}
+	}
+	e.Extra = fields
+	return nil
+}
+
+// MarshalJSON encodes the event as one JSON object, fields in name order. Values in Extra
+// are written byte for byte as received; json.Marshal of an Event reformats them (it escapes
+// HTML characters), so call MarshalJSON to keep them.
+func (e Event) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]json.RawMessage, len(e.Extra)+len(knownFields))
+	for name, raw := range e.Extra {
+		if !json.Valid(raw) {
+			return nil, fmt.Errorf("field %s: invalid JSON", name)
+		}
+		fields[name] = raw
+	}
+	for _, name := range knownFields {
+		if value := *e.field(name); value != "" {
+			raw, err := marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = raw
+		}
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(fields[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshal encodes a value like json.Marshal, without escaping <, > and &
+func marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	// Encode ends the value with a newline
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Get returns the value of a field as decoded JSON (string, float64, bool, map, slice), or
+// nil if the event does not have it. Dotted names address nested objects, e.g. caller.number.
+// Its signature matches the lookups of templates.
+func (e *Event) Get(name string) interface{} {
+	if value, ok := e.get(name); ok {
+		return value
+	}
+	first, rest, dotted := strings.Cut(name, ".")
+	if !dotted {
+		return nil
+	}
+	current, _ := e.get(first)
+	for _, key := range strings.Split(rest, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+// get returns a top-level field
+func (e *Event) get(name string) (interface{}, bool) {
+	if p := e.field(name); p != nil && *p != "" {
+		return *p, true
+	}
+	raw, ok := e.Extra[name]
+	if !ok {
+		return nil, false
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Text returns a field as text: strings as-is, numbers without trailing zeros, booleans as
+// true/false, objects and arrays as JSON, and "" if the event does not have it
+func (e *Event) Text(name string) string {
+	switch v := e.Get(name).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// Set sets a top-level field. Non-empty strings of well-known fields are set on the typed
+// field; any other value is encoded to Extra.
+func (e *Event) Set(name string, value interface{}) error {
+	if p := e.field(name); p != nil {
+		if s, ok := value.(string); ok && s != "" {
+			*p = s
+			delete(e.Extra, name)
+			return nil
+		}
+		*p = ""
+	}
+	raw, err := marshal(value)
+	if err != nil {
+		return err
+	}
+	if e.Extra == nil {
+		e.Extra = make(map[string]json.RawMessage)
+	}
+	e.Extra[name] = raw
+	return nil
+}
+
+// SetPath sets a field like Set, where dotted names address nested objects as in Get:
+// caller.number sets number in the caller object, which is added if the event has none. A
+// top-level field whose name has dots is set as is.
+func (e *Event) SetPath(name string, value interface{}) error {
+	first, rest, dotted := strings.Cut(name, ".")
+	if _, ok := e.get(name); ok || !dotted {
+		return e.Set(name, value)
+	}
+	current, _ := e.get(first)
+	if current == nil {
+		current = map[string]interface{}{}
+	}
+	object, ok := current.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s is not an object", first)
+	}
+	parent := object
+	keys := strings.Split(rest, ".")
+	for i, key := range keys[:len(keys)-1] {
+		child, ok := parent[key].(map[string]interface{})
+		if !ok {
+			if parent[key] != nil {
+				return fmt.Errorf("%s.%s is not an object", first, strings.Join(keys[:i+1], "."))
+			}
+			child = map[string]interface{}{}
+			parent[key] = child
+		}
+		parent = child
+	}
+	parent[keys[len(keys)-1]] = value
+	return e.Set(first, object)
+}
+
+// Delete removes a field. Dotted names address nested objects as in Get; a field the
+// event does not have is ignored.
+func (e *Event) Delete(name string) {
+	if _, ok := e.get(name); ok {
+		if p := e.field(name); p != nil {
+			*p = ""
+		}
+		delete(e.Extra, name)
+		return
+	}
+	first, rest, dotted := strings.Cut(name, ".")
+	if !dotted {
+		return
+	}
+	current, _ := e.get(first)
+	object, ok := current.(map[string]interface{})
+	if !ok {
+		return
+	}
+	parent := object
+	keys := strings.Split(rest, ".")
+	for _, key := range keys[:len(keys)-1] {
+		if parent, ok = parent[key].(map[string]interface{}); !ok {
+			return
+		}
+	}
+	if _, ok := parent[keys[len(keys)-1]]; !ok {
+		return
+	}
+	delete(parent, keys[len(keys)-1])
+	e.Set(first, object)
+}
+
+// Clone returns a copy of the event that can be changed without affecting e
+func (e *Event) Clone() *Event {
+	c := *e
+	if e.Extra != nil {
+		c.Extra = make(map[string]json.RawMessage, len(e.Extra))
+		for name, raw := range e.Extra {
+			c.Extra[name] = raw
+		}
+	}
+	return &c
+}
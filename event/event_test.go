@@ -0,0 +1,184 @@
+package event
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func roundTrip(t *testing.T, in string) (*Event, string) {
+	t.Helper()
+	e, err := Parse([]byte(in))
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", in, err)
+	}
+	out, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	return e, string(out)
+}
+
+// Fields the hub does not know are written back as the PBX sent them
+func TestUnknownFieldsKeptByteForByte(t *testing.T) {
+	in := `{"amount":1.50,"big":12345678901234567890123,"call_id":"c1","domain":"tenant1.example.com",` +
+		`"escaped":"é \/","html":"<b>&</b>","nested":{"b" : [1, 2.0], "a":null},"note":"é"}`
+	e, out := roundTrip(t, in)
+	if out != in {
+		t.Fatalf("round trip changed the event:\n got %s\nwant %s", out, in)
+	}
+	if e.Domain != "tenant1.example.com" || e.CallID != "c1" {
+		t.Fatalf("typed fields not set: %+v", e)
+	}
+	if string(e.Extra["nested"]) != `{"b" : [1, 2.0], "a":null}` {
+		t.Fatalf("Extra[nested] = %s", e.Extra["nested"])
+	}
+}
+
+// A well-known field is only typed when it is a non-empty string; anything else stays in
+// Extra, so it is forwarded as sent
+func TestWellKnownFieldsOtherThanStrings(t *testing.T) {
+	in := `{"billsec":125,"call_id":"","domain":"tenant1.example.com","duration":"","hotline":null,"state":{"code":3},"to_number":84912345678}`
+	e, out := roundTrip(t, in)
+	if out != in {
+		t.Fatalf("round trip changed the event:\n got %s\nwant %s", out, in)
+	}
+	if e.Billsec != "" || e.CallID != "" || e.Duration != "" || e.Hotline != "" || e.State != "" || e.ToNumber != "" {
+		t.Fatalf("non-string values set on typed fields: %+v", e)
+	}
+	for _, name := range []string{"billsec", "call_id", "duration", "hotline", "state", "to_number"} {
+		if _, ok := e.Extra[name]; !ok {
+			t.Errorf("%s not kept in Extra", name)
+		}
+	}
+	if got := e.Get("billsec"); got != float64(125) {
+		t.Errorf("Get(billsec) = %#v, want 125", got)
+	}
+	if got := e.Get("hotline"); got != nil {
+		t.Errorf("Get(hotline) = %#v, want nil", got)
+	}
+	if got := e.Text("to_number"); got != "84912345678" {
+		t.Errorf("Text(to_number) = %q", got)
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	e, err := Parse([]byte(`{"domain":"tenant1.example.com","caller":{"number":"0912345678","tags":["vip"],"agent":{"id":7}},"a.b":"literal"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want interface{}
+	}{
+		{"domain", "tenant1.example.com"},
+		{"caller.number", "0912345678"},
+		{"caller.agent.id", float64(7)},
+		{"caller.tags", []interface{}{"vip"}},
+		{"a.b", "literal"}, // A top-level name with a dot wins
+		{"caller.missing", nil},
+		{"caller.number.digits", nil},
+		{"domain.name", nil},
+		{"missing.field", nil},
+	}
+	for _, tt := range tests {
+		if got := e.Get(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Get(%s) = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	e, err := Parse([]byte(`{"domain":"tenant1.example.com","caller":{"number":"0912345678"},"count":3,"a.b":"literal"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]interface{}{
+		"caller.number":       "+84912345678",
+		"caller.agent.id":     float64(7),
+		"routing.queue":       "support",
+		"a.b":                 "changed",
+		"domain":              "tenant2.example.com",
+		"crm.contact.numbers": []interface{}{"1", "2"},
+	} {
+		if err := e.SetPath(name, value); err != nil {
+			t.Fatalf("SetPath(%s): %v", name, err)
+		}
+	}
+	if err := e.SetPath("count.total", 1); err == nil {
+		t.Error("SetPath(count.total) on a number succeeded")
+	}
+	if err := e.SetPath("caller.number.digits", "1"); err == nil {
+		t.Error("SetPath(caller.number.digits) on a string succeeded")
+	}
+
+	out, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"a.b":"changed","caller":{"agent":{"id":7},"number":"+84912345678"},"count":3,` +
+		`"crm":{"contact":{"numbers":["1","2"]}},"domain":"tenant2.example.com","routing":{"queue":"support"}}`
+	if string(out) != want {
+		t.Fatalf("after SetPath:\n got %s\nwant %s", out, want)
+	}
+}
+
+// Set moves a well-known field between its typed field and Extra with the type of the value
+func TestSetMovesWellKnownFields(t *testing.T) {
+	e, err := Parse([]byte(`{"domain":"tenant1.example.com","billsec":125}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.Set("billsec", "125")
+	if e.Billsec != "125" {
+		t.Fatalf("Billsec = %q after setting a string", e.Billsec)
+	}
+	if _, ok := e.Extra["billsec"]; ok {
+		t.Fatal("billsec still in Extra after setting a string")
+	}
+
+	e.Set("billsec", 90)
+	if e.Billsec != "" || string(e.Extra["billsec"]) != "90" {
+		t.Fatalf("after setting a number: Billsec = %q, Extra[billsec] = %s", e.Billsec, e.Extra["billsec"])
+	}
+
+	e.Set("billsec", "")
+	if e.Billsec != "" || string(e.Extra["billsec"]) != `""` {
+		t.Fatalf("after setting \"\": Billsec = %q, Extra[billsec] = %s", e.Billsec, e.Extra["billsec"])
+	}
+
+	e.Set("note", "<b>")
+	e.Delete("domain")
+	out, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"billsec":"","note":"<b>"}`; string(out) != want {
+		t.Fatalf("got %s, want %s", out, want)
+	}
+
+	// Set values read back as Parse would read the marshalled event
+	var parsed Event
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&parsed, e) {
+		t.Fatalf("parsed %+v, want %+v", parsed, e)
+	}
+}
+
+func TestParseRejectsNonObjects(t *testing.T) {
+	for _, in := range []string{`null`, `[]`, `"event"`, `{"domain":`} {
+		if _, err := Parse([]byte(in)); err == nil {
+			t.Errorf("Parse(%s) succeeded", in)
+		}
+	}
+}
+
+func TestMarshalRejectsInvalidExtra(t *testing.T) {
+	e := &Event{Domain: "tenant1.example.com", Extra: map[string]json.RawMessage{"bad": json.RawMessage(`{`)}}
+	if _, err := e.MarshalJSON(); err == nil {
+		t.Fatal("MarshalJSON succeeded with invalid JSON in Extra")
+	}
+}
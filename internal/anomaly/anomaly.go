@@ -0,0 +1,258 @@
+package anomaly
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"calleventhub/internal/clock"
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// Anomaly kinds
+const (
+	KindSpike   = "spike"   // Far more events than usual (a PBX loop or misconfiguration)
+	KindDrop    = "drop"    // Far fewer events than usual
+	KindSilence = "silence" // No events at all for silence_minutes (the PBX stopped sending)
+)
+
+// Kinds lists the anomaly kinds, for exporting one gauge per kind
+var Kinds = []string{KindSpike, KindDrop, KindSilence}
+
+// State is the ingest rate of one domain and the anomaly it is in, if any
+type State struct {
+	Domain            string    `json:"domain"`
+	Anomaly           string    `json:"anomaly,omitempty"` // KindSpike, KindDrop, KindSilence or empty
+	AnomalySince      time.Time `json:"anomaly_since"`
+	RecentPerMinute   float64   `json:"recent_per_minute"`   // Over the last window_minutes
+	BaselinePerMinute float64   `json:"baseline_per_minute"` // Over the baseline_minutes before them
+	BaselineReady     bool      `json:"baseline_ready"`      // Enough history to compare rates
+	LastEventAt       time.Time `json:"last_event_at"`
+}
+
+// domainRate counts a domain's ingested events per minute
+type domainRate struct {
+	counts   []int     // Ring of events per minute
+	minutes  []int64   // Minute number each slot of counts holds
+	since    time.Time // Tracked since (startup, or when the route was added or the windows changed)
+	lastSeen time.Time // Last event (zero if none since tracked)
+	state    State     // As of the last check
+}
+
+// Detector raises alerts when a domain's ingest rate deviates from its trailing baseline,
+// and when a routed domain sends nothing for too long. Alerts are logged when raised and
+// cleared, and reported by States. Each instance only sees the events it ingests.
+type Detector struct {
+	getConfig func() *config.Config
+	clock     clock.Clock
+	stopChan  chan struct{}
+
+	mu      sync.Mutex
+	domains map[string]*domainRate // Routed domains
+}
+
+// NewDetector creates a detector for the routed domains; getConfig returns the current
+// configuration, so thresholds and routes follow config reloads
+func NewDetector(getConfig func() *config.Config) *Detector {
+	d := &Detector{
+		getConfig: getConfig,
+		stopChan:  make(chan struct{}),
+	}
+	d.SetClock(clock.Real)
+	return d
+}
+
+// SetClock sets the time source of the rate windows (the system clock by default); call it
+// before Start. Tracking restarts at the clock's current time.
+func (d *Detector) SetClock(c clock.Clock) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock = c
+	d.domains = make(map[string]*domainRate)
+	if cfg := d.getConfig(); cfg != nil {
+		d.syncDomains(cfg, c.Now())
+	}
+}
+
+// Start checks the rates every minute until Stop is called
+func (d *Detector) Start() {
+	ticker := d.clock.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C():
+			d.check(now)
+		case <-d.stopChan:
+			return
+		}
+	}
+}
+
+// Stop stops the detector
+func (d *Detector) Stop() {
+	close(d.stopChan)
+}
+
+// Observe counts an ingested event of a domain; events of unrouted domains are ignored
+func (d *Detector) Observe(domain string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.clock.Now()
+	minute := now.Unix() / 60
+
+	rate, ok := d.domains[domain]
+	if !ok {
+		return
+	}
+	slot := int(minute % int64(len(rate.counts)))
+	if rate.minutes[slot] != minute {
+		rate.minutes[slot], rate.counts[slot] = minute, 0
+	}
+	rate.counts[slot]++
+	rate.lastSeen = now
+}
+
+// States returns the rates of the domains accepted by include, ordered by domain
+func (d *Detector) States(include func(domain string) bool) []State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	states := make([]State, 0, len(d.domains))
+	for domain, rate := range d.domains {
+		if include(domain) {
+			states = append(states, rate.state)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Domain < states[j].Domain })
+	return states
+}
+
+// syncDomains tracks the routed domains, with rings sized for the configured windows;
+// caller must hold d.mu unless d is not shared yet
+func (d *Detector) syncDomains(cfg *config.Config, now time.Time) {
+	settings := cfg.Server.Anomalies
+	size := settings.BaselineMinutes + settings.WindowMinutes
+	routed := make(map[string]bool, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		routed[route.Domain] = true
+		rate, ok := d.domains[route.Domain]
+		if ok && len(rate.counts) == size {
+			continue
+		}
+		fresh := &domainRate{counts: make([]int, size), minutes: make([]int64, size), since: now}
+		fresh.state.Domain = route.Domain
+		if ok {
+			// Windows changed - the history no longer fits, keep the silence tracking
+			fresh.lastSeen, fresh.state = rate.lastSeen, rate.state
+			if rate.lastSeen.IsZero() {
+				fresh.since = rate.since
+			}
+		}
+		d.domains[route.Domain] = fresh
+	}
+	for domain, rate := range d.domains {
+		if !routed[domain] {
+			if rate.state.Anomaly != "" {
+				logger.Logger.Info("Domain ingest anomaly cleared, route removed", zap.String("domain", domain))
+			}
+			delete(d.domains, domain)
+		}
+	}
+}
+
+// check compares every domain's recent rate with its baseline and raises or clears alerts
+func (d *Detector) check(now time.Time) {
+	cfg := d.getConfig()
+	if cfg == nil {
+		return
+	}
+	settings := cfg.Server.Anomalies
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.syncDomains(cfg, now)
+	if settings.Disabled {
+		for _, rate := range d.domains {
+			rate.state.Anomaly, rate.state.AnomalySince = "", time.Time{}
+		}
+		return
+	}
+
+	// Only complete minutes are compared: the window ends with the previous minute
+	current := now.Unix() / 60
+	windowStart := current - int64(settings.WindowMinutes)
+	baselineStart := windowStart - int64(settings.BaselineMinutes)
+	history := time.Duration(settings.BaselineMinutes+settings.WindowMinutes) * time.Minute
+	silence := time.Duration(settings.SilenceMinutes) * time.Minute
+
+	for domain, rate := range d.domains {
+		state := &rate.state
+		state.RecentPerMinute = float64(rate.sum(windowStart, current)) / float64(settings.WindowMinutes)
+		state.BaselinePerMinute = float64(rate.sum(baselineStart, windowStart)) / float64(settings.BaselineMinutes)
+		state.BaselineReady = now.Sub(rate.since) >= history+time.Minute
+		state.LastEventAt = rate.lastSeen
+
+		lastSeen := rate.lastSeen
+		if lastSeen.IsZero() {
+			lastSeen = rate.since
+		}
+
+		kind := ""
+		switch {
+		case silence > 0 && now.Sub(lastSeen) >= silence:
+			kind = KindSilence
+		case !state.BaselineReady:
+		case state.RecentPerMinute > settings.Factor*maxFloat(state.BaselinePerMinute, settings.MinEventsPerMinute):
+			kind = KindSpike
+		case state.BaselinePerMinute >= settings.MinEventsPerMinute && state.RecentPerMinute < state.BaselinePerMinute/settings.Factor:
+			kind = KindDrop
+		}
+		d.update(domain, state, kind, now)
+	}
+}
+
+// update logs when a domain's anomaly is raised, changes or is cleared
+func (d *Detector) update(domain string, state *State, kind string, now time.Time) {
+	if kind == state.Anomaly {
+		return
+	}
+	previous := state.Anomaly
+	state.Anomaly = kind
+	fields := []zap.Field{
+		zap.String("domain", domain),
+		zap.Float64("recent_per_minute", state.RecentPerMinute),
+		zap.Float64("baseline_per_minute", state.BaselinePerMinute),
+		zap.Time("last_event_at", state.LastEventAt),
+	}
+	if kind == "" {
+		state.AnomalySince = time.Time{}
+		logger.LogWithDomain(zapcore.InfoLevel, "Domain ingest anomaly cleared", append(fields, zap.String("anomaly", previous))...)
+		return
+	}
+	state.AnomalySince = now
+	logger.LogWithDomain(zapcore.WarnLevel, "Domain ingest anomaly", append(fields, zap.String("anomaly", kind))...)
+}
+
+// sum returns the events counted in the minutes [from, to)
+func (r *domainRate) sum(from, to int64) int {
+	total := 0
+	for i, minute := range r.minutes {
+		if minute >= from && minute < to {
+			total += r.counts[i]
+		}
+	}
+	return total
+}
+
+// maxFloat returns the larger of a and b
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
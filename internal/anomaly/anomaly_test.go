@@ -0,0 +1,103 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"calleventhub/internal/clock"
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+const domain = "tenant1.example.com"
+
+// newTestDetector creates a detector on a fake clock with a 2 minute window, a 10 minute
+// baseline and a 30 minute silence alert
+func newTestDetector(t *testing.T) (*Detector, *clock.Fake) {
+	t.Helper()
+	logger.Logger = zap.NewNop()
+
+	cfg, err := config.Parse([]byte(`
+nats: {url: "nats://localhost:4222", stream_name: CALL_EVENTS, subject_pattern: "events.>", ack_wait_seconds: 30, max_deliveries: 5}
+server:
+  port: 8080
+  anomalies: {window_minutes: 2, baseline_minutes: 10, factor: 5, min_events_per_minute: 1, silence_minutes: 30}
+routes:
+  - domain: tenant1.example.com
+    endpoints: ["https://tenant1.example.com/events"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	d := NewDetector(func() *config.Config { return cfg })
+	d.SetClock(fake)
+	return d, fake
+}
+
+// minutes advances the fake clock minute by minute, observing perMinute events in each
+// and checking the rates at every minute like the detector's ticker
+func minutes(d *Detector, fake *clock.Fake, n, perMinute int) {
+	for i := 0; i < n; i++ {
+		for j := 0; j < perMinute; j++ {
+			d.Observe(domain)
+		}
+		fake.Advance(time.Minute)
+		d.check(fake.Now())
+	}
+}
+
+func state(d *Detector) State {
+	return d.States(func(string) bool { return true })[0]
+}
+
+func TestSilence(t *testing.T) {
+	d, fake := newTestDetector(t)
+
+	minutes(d, fake, 29, 0)
+	if s := state(d); s.Anomaly != "" {
+		t.Fatalf("anomaly %q after 29 silent minutes", s.Anomaly)
+	}
+	minutes(d, fake, 1, 0)
+	s := state(d)
+	if s.Anomaly != KindSilence {
+		t.Fatalf("anomaly %q after 30 silent minutes, want %q", s.Anomaly, KindSilence)
+	}
+	if !s.AnomalySince.Equal(fake.Now()) {
+		t.Fatalf("anomaly since %s, want %s", s.AnomalySince, fake.Now())
+	}
+
+	minutes(d, fake, 1, 1)
+	if s := state(d); s.Anomaly != "" || !s.LastEventAt.Equal(fake.Now().Add(-time.Minute)) {
+		t.Fatalf("silence not cleared by an event: %+v", s)
+	}
+}
+
+func TestSpike(t *testing.T) {
+	d, fake := newTestDetector(t)
+
+	// A burst before the baseline has 10 minutes of history is not compared
+	minutes(d, fake, 2, 50)
+	if s := state(d); s.BaselineReady || s.Anomaly != "" {
+		t.Fatalf("burst compared without a baseline: %+v", s)
+	}
+
+	minutes(d, fake, 13, 2)
+	if s := state(d); !s.BaselineReady || s.Anomaly != "" || s.RecentPerMinute != 2 || s.BaselinePerMinute != 2 {
+		t.Fatalf("steady rate: %+v", s)
+	}
+
+	minutes(d, fake, 2, 20)
+	s := state(d)
+	if s.Anomaly != KindSpike || s.RecentPerMinute != 20 {
+		t.Fatalf("10x the baseline: %+v, want a spike", s)
+	}
+
+	// The window moves past the burst
+	minutes(d, fake, 2, 2)
+	if s := state(d); s.Anomaly != "" {
+		t.Fatalf("spike not cleared once the rate is back: %+v", s)
+	}
+}
@@ -0,0 +1,101 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"calleventhub/internal/config"
+)
+
+// Anonymizer applies an anonymization profile to event payloads
+// It is safe for concurrent use.
+type Anonymizer struct {
+	hashFields  []string
+	maskFields  []string
+	stripFields []string
+	keepDigits  int
+	salt        []byte
+}
+
+// New creates an anonymizer for a profile
+func New(profile config.AnonymizeProfile, salt string) *Anonymizer {
+	keepDigits := profile.KeepDigits
+	if keepDigits == 0 {
+		keepDigits = 3
+	}
+	return &Anonymizer{
+		hashFields:  profile.HashFields,
+		maskFields:  profile.MaskFields,
+		stripFields: profile.StripFields,
+		keepDigits:  keepDigits,
+		salt:        []byte(salt),
+	}
+}
+
+// FromConfig creates an anonymizer for a named profile in the configuration
+func FromConfig(cfg *config.Config, name string) (*Anonymizer, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("configuration not available")
+	}
+	profile, ok := cfg.GetAnonymizeProfile(name)
+	if !ok {
+		return nil, fmt.Errorf("anonymization profile %q is not defined", name)
+	}
+	return New(profile, cfg.Anonymization.Salt), nil
+}
+
+// Apply anonymizes a JSON event payload
+func (a *Anonymizer) Apply(eventJSON []byte) ([]byte, error) {
+	var eventMap map[string]interface{}
+	if err := json.Unmarshal(eventJSON, &eventMap); err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+
+	a.ApplyMap(eventMap)
+
+	return json.Marshal(eventMap)
+}
+
+// ApplyMap anonymizes an event map in place
+func (a *Anonymizer) ApplyMap(eventMap map[string]interface{}) {
+	for _, field := range a.stripFields {
+		delete(eventMap, field)
+	}
+
+	for _, field := range a.hashFields {
+		if value, ok := eventMap[field]; ok && !isEmpty(value) {
+			eventMap[field] = a.hash(fmt.Sprintf("%v", value))
+		}
+	}
+
+	for _, field := range a.maskFields {
+		if value, ok := eventMap[field]; ok && !isEmpty(value) {
+			eventMap[field] = mask(fmt.Sprintf("%v", value), a.keepDigits)
+		}
+	}
+}
+
+// hash returns a stable keyed hash so anonymized events remain correlatable
+func (a *Anonymizer) hash(value string) string {
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(value))
+	return "anon-" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// mask replaces all but the last keep characters with '*'
+func mask(value string, keep int) string {
+	runes := []rune(value)
+	if len(runes) <= keep {
+		return strings.Repeat("*", len(runes))
+	}
+	return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+}
+
+// isEmpty reports whether a field value carries no data
+func isEmpty(value interface{}) bool {
+	return value == nil || value == ""
+}
@@ -1,10 +1,25 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
 	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"calleventhub/event"
+	"calleventhub/internal/schema"
+	"calleventhub/internal/transform"
 )
 
 // Config represents the application configuration
@@ -12,13 +27,491 @@ type Config struct {
 	Server ServerConfig `yaml:"server"`
 	NATS   NATSConfig   `yaml:"nats"`
 	Routes []Route      `yaml:"routes"`
+
+	// Where the routes are loaded from instead of routes (requires restart to change)
+	ConfigSource ConfigSourceConfig `yaml:"config_source"`
+
+	// Where events of domains without a route go (nil = they fail)
+	DefaultRoute *Route `yaml:"default_route"`
+
+	// Named endpoint lists that routes reference with endpoint_groups
+	EndpointGroups map[string][]Endpoint `yaml:"endpoint_groups"`
+
+	// Files of the config directory whose routes failed to load (see LoadDir)
+	Rejected []RejectedFile `yaml:"-"`
+
+	// Content of the config directory files loaded, by name, used again if a later version
+	// is rejected
+	dirFiles map[string][]byte
+
+	// What to do when several routes have the same domain (DuplicateRoutesReject by default)
+	DuplicateRoutes string `yaml:"duplicate_routes"`
+
+	Isolation     IsolationConfig     `yaml:"isolation"`
+	Mirror        MirrorConfig        `yaml:"mirror"`
+	Residency     ResidencyConfig     `yaml:"residency"`
+	Anonymization AnonymizationConfig `yaml:"anonymization"`
+	DNS           DNSConfig           `yaml:"dns"`
+	Outbound      OutboundConfig      `yaml:"outbound"`
+
+	RecoveryReplay RecoveryReplayConfig `yaml:"recovery_replay"`
+
+	// User-Agent of forwarded HTTP requests; {version} is replaced by the hub's version
+	UserAgent string `yaml:"user_agent"`
+
+	// Stable name of this instance in logs, event records, metrics and the fleet, unless the
+	// -instance-id flag is set (default: the hostname); requires restart to change
+	InstanceID string `yaml:"instance_id"`
+
+	// What this instance runs: all (default), or a list of ingest, consumer and dashboard,
+	// unless the -role flag is set; requires restart to change
+	Role string `yaml:"role"`
+
+	EndpointSecurity EndpointSecurityConfig `yaml:"endpoint_security"`
+
+	Correlation CorrelationConfig `yaml:"correlation"`
+
+	Store StoreConfig `yaml:"store"`
+	Logs  LogsConfig  `yaml:"logs"`
+
+	Reports ReportsConfig `yaml:"reports"`
+
+	Preflight PreflightConfig `yaml:"preflight"`
+}
+
+// PreflightConfig controls the checks run at startup, before the service starts ingesting
+// and forwarding (requires restart to change)
+type PreflightConfig struct {
+	Disabled       bool `yaml:"disabled"`        // Start without checking
+	ProbeEndpoints bool `yaml:"probe_endpoints"` // Also connect to every endpoint; failures are only warnings
+	TimeoutSeconds int  `yaml:"timeout_seconds"` // Per check (default 5)
+}
+
+// ReportsConfig schedules reports emailed to the contacts of each route
+type ReportsConfig struct {
+	SMTP         SMTPConfig               `yaml:"smtp"`
+	FailedEvents FailedEventsReportConfig `yaml:"failed_events"`
+	Digest       DigestConfig             `yaml:"digest"`
+}
+
+// SMTPConfig is the mail server reports are sent through. STARTTLS is used when the
+// server offers it; credentials are only sent over TLS.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"` // Default 587
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// FailedEventsReportConfig emails each route's contacts a CSV of the events of their
+// domain that failed for good (or were quarantined) the previous day
+type FailedEventsReportConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Time      string `yaml:"time"`       // Local time of day the report is sent, "15:04" (default "07:00")
+	SendEmpty bool   `yaml:"send_empty"` // Also send when a domain had no failures
+}
+
+// DigestConfig publishes each domain's end-of-day summary of the previous day (counts,
+// failure reasons, slowest endpoints) to NATS for reporting systems
+type DigestConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Time          string `yaml:"time"`           // Local time of day digests are published, "15:04" (default "00:05")
+	SubjectPrefix string `yaml:"subject_prefix"` // Published to <prefix>.<domain> (default "hub.digest")
+	TopEndpoints  int    `yaml:"top_endpoints"`  // Slowest endpoints listed (default 5)
+}
+
+// duplicate_routes values
+const (
+	DuplicateRoutesReject = "reject" // Refuse the configuration
+	DuplicateRoutesMerge  = "merge"  // Append the endpoints of later routes to the first route of the domain
+)
+
+// StoreConfig bounds the memory taken by the in-memory event store (the last 10000
+// forwarded, failed and quarantined events served by the API)
+type StoreConfig struct {
+	MaxMemoryMB            int  `yaml:"max_memory_mb"`            // Evict the oldest events when their bodies take more (0 = no limit)
+	Compress               bool `yaml:"compress"`                 // Keep event bodies snappy-compressed in memory
+	CompressThresholdBytes int  `yaml:"compress_threshold_bytes"` // Only compress bodies larger than this (default 512)
+}
+
+// LogsConfig is how long domain log files are kept and whether the files of past days are
+// archived; a route's quota overrides both for its domain
+type LogsConfig struct {
+	RetentionDays int  `yaml:"retention_days"` // Files of days more than this ago are deleted (default 30)
+	Archive       bool `yaml:"archive"`        // Gzip the files of past days (YYYY-MM-DD.log.gz)
+}
+
+// CorrelationConfig links the call legs of transferred and bridged calls, which
+// have different call_ids, into one logical call with a shared correlation_id
+type CorrelationConfig struct {
+	Keys       []string `yaml:"keys"`         // Fields whose equal values link legs (e.g. sip_call_id, bridge_id)
+	CallIDRefs []string `yaml:"call_id_refs"` // Fields holding another leg's call_id (e.g. transferred_from)
+	MaxCalls   int      `yaml:"max_calls"`    // call_ids remembered for linking (default 10000)
+}
+
+// Enabled reports whether any correlation fields are configured
+func (c *CorrelationConfig) Enabled() bool {
+	return len(c.Keys) > 0 || len(c.CallIDRefs) > 0
+}
+
+// EndpointSecurityConfig guards against endpoints that point at internal services (SSRF).
+// Addresses are checked when the config is loaded and again on every connection,
+// after DNS resolution, so a hostname cannot later be re-pointed at a blocked range.
+type EndpointSecurityConfig struct {
+	BlockPrivateNetworks bool     `yaml:"block_private_networks"` // Block loopback, private, link-local and unspecified addresses
+	AllowedNetworks      []string `yaml:"allowed_networks"`       // CIDRs allowed even when blocked (e.g. an internal receiver)
+}
+
+// carrierGradeNAT is the shared address space (RFC 6598), not covered by net.IP.IsPrivate
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// ErrBlockedNetwork is wrapped by CheckIP errors so callers can tell blocked addresses from other failures
+var ErrBlockedNetwork = errors.New("blocked network")
+
+// CheckIP returns an error if connecting to ip is not allowed
+func (s *EndpointSecurityConfig) CheckIP(ip net.IP) error {
+	if !s.BlockPrivateNetworks {
+		return nil
+	}
+	for _, cidr := range s.AllowedNetworks {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || carrierGradeNAT.Contains(ip) {
+		return fmt.Errorf("address %s is in a %w", ip, ErrBlockedNetwork)
+	}
+	return nil
+}
+
+// validateEndpoint checks an endpoint's settings for its type
+func (c *Config) validateEndpoint(endpoint Endpoint) error {
+	sink := endpoint.sink()
+	if sink == nil {
+		return c.validateEndpointURL(endpoint.URL)
+	}
+	if err := sink.validate(); err != nil {
+		return err
+	}
+	if sink.address() == "" {
+		return nil
+	}
+	return c.validateHost(endpoint.Name(), sink.address())
+}
+
+// validateTimeout checks the request timeout of an endpoint of a route with routeTimeoutMs:
+// a request still running when ack_wait expires would be sent again by the redelivery.
+// fallback is the time the route's fallback endpoints may take after the endpoint failed
+// (zero for the fallback and stale endpoints themselves).
+func (c *Config) validateTimeout(endpoint Endpoint, routeTimeoutMs int, fallback time.Duration) error {
+	if endpoint.TimeoutMs < 0 {
+		return fmt.Errorf("endpoint %q: timeout_ms must not be negative", endpoint.Name())
+	}
+	if !endpoint.hasTimeout() {
+		if endpoint.TimeoutMs != 0 {
+			return fmt.Errorf("endpoint %q: timeout_ms only applies to HTTP and Event Hubs endpoints", endpoint.Name())
+		}
+		return nil
+	}
+	timeout := endpoint.Timeout(routeTimeoutMs)
+	if timeout >= time.Duration(c.NATS.AckWait)*time.Second {
+		return fmt.Errorf("endpoint %q: timeout of %s must be shorter than nats ack_wait_seconds (%d)", endpoint.Name(), timeout, c.NATS.AckWait)
+	}
+	if fallback > 0 && timeout+fallback >= time.Duration(c.NATS.AckWait)*time.Second {
+		return fmt.Errorf("endpoint %q: timeout of %s plus %s for the fallback_endpoints tried after it must be shorter than nats ack_wait_seconds (%d)", endpoint.Name(), timeout, fallback, c.NATS.AckWait)
+	}
+	return nil
+}
+
+// fallbackTimeout returns the longest time the route's fallback endpoints take, tried one
+// after another when every endpoint failed
+func (r *Route) fallbackTimeout() time.Duration {
+	var total time.Duration
+	for _, endpoint := range r.FallbackEndpoints {
+		if endpoint.hasTimeout() {
+			total += endpoint.Timeout(r.TimeoutMs)
+		}
+	}
+	return total
+}
+
+// validateHost checks the host of a non-HTTP sink's address against endpoint_security
+func (c *Config) validateHost(name, address string) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", name, err)
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if err := c.EndpointSecurity.CheckIP(ip); err != nil {
+			return fmt.Errorf("endpoint %q: %w", name, err)
+		}
+	}
+	if c.EndpointSecurity.BlockPrivateNetworks && strings.EqualFold(u.Hostname(), "localhost") {
+		return fmt.Errorf("endpoint %q: localhost is blocked", name)
+	}
+	return nil
+}
+
+// validateEndpointURL checks that an HTTP endpoint is an absolute http(s) URL and,
+// if it names an IP address directly, that the address is allowed
+func (c *Config) validateEndpointURL(endpoint string) error {
+	target := endpoint
+	if transform.HasExpressions(endpoint) {
+		// Check the static parts of URL templates
+		t, err := transform.Parse(endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint: %w", err)
+		}
+		target = t.Placeholder("x")
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("endpoint %q must use http or https", endpoint)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("endpoint %q has no host", endpoint)
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if err := c.EndpointSecurity.CheckIP(ip); err != nil {
+			return fmt.Errorf("endpoint %q: %w", endpoint, err)
+		}
+	}
+	if c.EndpointSecurity.BlockPrivateNetworks && strings.EqualFold(u.Hostname(), "localhost") {
+		return fmt.Errorf("endpoint %q: localhost is blocked", endpoint)
+	}
+	return nil
+}
+
+// OutboundConfig selects the local source of outbound forwards so receivers can
+// allowlist a stable IP on multi-homed hosts. Set at most one of the fields.
+type OutboundConfig struct {
+	SourceAddress   string `yaml:"source_address" json:"source_address,omitempty"`     // Local IP to send from
+	SourceInterface string `yaml:"source_interface" json:"source_interface,omitempty"` // Network interface to send from (e.g. eth1)
+}
+
+func (o *OutboundConfig) validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.SourceAddress != "" && o.SourceInterface != "" {
+		return fmt.Errorf("set either source_address or source_interface, not both")
+	}
+	if o.SourceAddress != "" && net.ParseIP(o.SourceAddress) == nil {
+		return fmt.Errorf("invalid source_address %q", o.SourceAddress)
+	}
+	return nil
+}
+
+// DNSConfig controls how endpoint hostnames are resolved for outbound requests
+type DNSConfig struct {
+	CacheTTLSeconds int                 `yaml:"cache_ttl_seconds"` // Reuse resolved addresses this long before re-resolving (default 30)
+	RefreshSeconds  int                 `yaml:"refresh_seconds"`   // Re-resolve known hosts in the background (0 = only on use)
+	Overrides       map[string][]string `yaml:"overrides"`         // Hostname -> static IP addresses, bypasses DNS
+}
+
+// RecoveryReplayConfig replays, when an endpoint delivers again after an outage, the events
+// that failed against it during the outage (like POST /api/endpoints/replay)
+type RecoveryReplayConfig struct {
+	Enabled          bool `yaml:"enabled"`
+	UnhealthyAfter   int  `yaml:"unhealthy_after"`    // Failed deliveries in a row that start an outage (default 5)
+	MaxEvents        int  `yaml:"max_events"`         // Events replayed per recovery, oldest first (default 1000)
+	MaxWindowMinutes int  `yaml:"max_window_minutes"` // Only the last minutes of longer outages are replayed (default 60)
+}
+
+// AnonymizationConfig defines named anonymization profiles that destinations
+// (mirror, stream export) refer to. The built-in "default" profile always exists.
+type AnonymizationConfig struct {
+	Salt     string                      `yaml:"salt"` // Key for hashed fields; set it so hashes cannot be reversed by brute force
+	Profiles map[string]AnonymizeProfile `yaml:"profiles"`
+}
+
+// AnonymizeProfile lists the transforms applied to event fields
+type AnonymizeProfile struct {
+	HashFields  []string `yaml:"hash_fields"`  // Replaced with a stable keyed hash (still correlatable)
+	MaskFields  []string `yaml:"mask_fields"`  // All but the last keep_digits characters masked
+	StripFields []string `yaml:"strip_fields"` // Removed entirely
+	KeepDigits  int      `yaml:"keep_digits"`  // Characters left visible by mask_fields (default 3)
+}
+
+// DefaultAnonymizeProfile hashes call identifiers, masks phone numbers and strips CRM contact IDs
+var DefaultAnonymizeProfile = AnonymizeProfile{
+	HashFields:  []string{"call_id", "sip_call_id"},
+	MaskFields:  []string{"from_number", "to_number", "hotline", "actual_hotline", "receive_dest"},
+	StripFields: []string{"crm_contact_id"},
+	KeepDigits:  3,
+}
+
+// GetAnonymizeProfile returns the named profile ("default" is built in unless overridden)
+func (c *Config) GetAnonymizeProfile(name string) (AnonymizeProfile, bool) {
+	if profile, ok := c.Anonymization.Profiles[name]; ok {
+		return profile, true
+	}
+	if name == "default" {
+		return DefaultAnonymizeProfile, true
+	}
+	return AnonymizeProfile{}, false
+}
+
+// MirrorConfig copies a sample of ingested events to a staging environment
+// Events go to a staging hub over HTTP (url) and/or a core NATS subject (subject)
+type MirrorConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Percentage float64  `yaml:"percentage"` // 0-100, sampled per call_id so whole calls are mirrored
+	URL        string   `yaml:"url"`        // e.g. https://staging-hub.example.com/events
+	Subject    string   `yaml:"subject"`    // e.g. staging.call.signal.events
+	Anonymize  bool     `yaml:"anonymize"`  // Apply the "default" anonymization profile
+	Domains    []string `yaml:"domains"`    // Only mirror these domains (empty = all)
+
+	AnonymizeProfile string `yaml:"anonymize_profile"` // Apply a named anonymization profile instead
+
+	Region string `yaml:"region"` // residency region of the mirror target; it may only copy domains of that region
 }
 
 // ServerConfig holds HTTP server configuration
 type ServerConfig struct {
-	Port         int `yaml:"port"`
-	ReadTimeout  int `yaml:"read_timeout_seconds"`
-	WriteTimeout int `yaml:"write_timeout_seconds"`
+	Host         string `yaml:"host"` // Interface port listens on (default all)
+	Port         int    `yaml:"port"`
+	ReadTimeout  int    `yaml:"read_timeout_seconds"`
+	WriteTimeout int    `yaml:"write_timeout_seconds"`
+
+	Ingest IngestListenerConfig `yaml:"ingest"`
+
+	Spool IngestSpoolConfig `yaml:"spool"`
+
+	Backpressure BackpressureConfig `yaml:"backpressure"`
+
+	Auth AuthConfig `yaml:"auth"`
+
+	Readiness ReadinessConfig `yaml:"readiness"`
+
+	Duplicates DuplicateDetectionConfig `yaml:"duplicates"`
+
+	Anomalies AnomalyConfig `yaml:"anomalies"`
+
+	StatusPage StatusPageConfig `yaml:"status_page"`
+
+	ShareLinks ShareLinksConfig `yaml:"share_links"`
+
+	// Field names normalized on every event at ingest, before it is routed
+	// (default Domain -> domain, CallID -> call_id); routes add their own field_map
+	FieldMap FieldMap `yaml:"field_map"`
+}
+
+// IngestListenerConfig serves POST /events on a listener of its own, e.g. exposed to PBXs
+// while server.port (dashboard and APIs) stays on an internal interface. /health and /ready
+// are served on both for load balancer checks. Listeners are not changed by config reloads.
+type IngestListenerConfig struct {
+	Host string `yaml:"host"` // Interface to listen on (default all)
+	Port int    `yaml:"port"` // 0 = /events is served on server.port
+}
+
+// Enabled reports whether ingest has a listener of its own
+func (c IngestListenerConfig) Enabled() bool {
+	return c.Port > 0
+}
+
+// IngestSpoolConfig lets POST /events accept events during short NATS outages: they are
+// kept in files on disk, one directory per stream, and published in arrival order once the
+// stream accepts events again. Requires restart to change.
+type IngestSpoolConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Directory string `yaml:"directory"` // Default "spool"
+	MaxMB     int    `yaml:"max_mb"`    // Bound of the spooled events of each stream (default 100)
+	Overflow  string `yaml:"overflow"`  // When full: SpoolOverflowReject (default) or SpoolOverflowDropOldest
+}
+
+// server.spool.overflow values
+const (
+	SpoolOverflowReject     = "reject"      // Answer 503 with Retry-After, so the PBX keeps the event
+	SpoolOverflowDropOldest = "drop_oldest" // Delete the oldest spooled events to make room
+)
+
+// ShareLinksConfig lets admins issue signed, time-limited links to one call's timeline or a
+// slice of a domain's logs, readable without an API token (see POST /api/share)
+type ShareLinksConfig struct {
+	Secret            string `yaml:"secret"`              // HMAC key signing the links, at least 32 characters (empty = off); changing it revokes all links
+	DefaultTTLSeconds int    `yaml:"default_ttl_seconds"` // Link lifetime when the request sets none (default 86400)
+	MaxTTLSeconds     int    `yaml:"max_ttl_seconds"`     // Longest lifetime a link can be issued with (default 604800)
+}
+
+// minShareSecretLength is the shortest share_links secret accepted
+const minShareSecretLength = 32
+
+// StatusPageConfig serves GET /status without authentication, for customers during
+// incidents: pipeline health and a green/yellow/red forwarding status per domain, no call data
+type StatusPageConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	Domains       []string `yaml:"domains"`        // Domains listed (empty = all routed domains)
+	WindowSeconds int      `yaml:"window_seconds"` // Only endpoints used this recently count (default 300)
+}
+
+// AnomalyConfig raises alerts when a routed domain's ingest rate deviates from its trailing
+// baseline - spikes (a PBX loop or misconfiguration) and drops - or stops altogether
+type AnomalyConfig struct {
+	Disabled           bool    `yaml:"disabled"`
+	WindowMinutes      int     `yaml:"window_minutes"`        // Recent rate averaged over this many minutes (default 5)
+	BaselineMinutes    int     `yaml:"baseline_minutes"`      // Compared with the rate of this many minutes before (default 60)
+	Factor             float64 `yaml:"factor"`                // Alert when the recent rate is this many times above or below it (default 5)
+	MinEventsPerMinute float64 `yaml:"min_events_per_minute"` // Rates below this are too low to compare (default 1)
+	SilenceMinutes     int     `yaml:"silence_minutes"`       // Alert when a domain sent nothing for this long (default 120)
+}
+
+// DuplicateDetectionConfig flags ingested events whose call_id and state were already
+// received within a short window, which means the PBX sent the same event again
+type DuplicateDetectionConfig struct {
+	Disabled      bool `yaml:"disabled"`
+	WindowSeconds int  `yaml:"window_seconds"` // Default 10
+}
+
+// ReadinessConfig decides when GET /ready reports NotReady so load balancers stop sending
+// traffic. Draining and a consumer that stopped fetching always make the instance NotReady.
+type ReadinessConfig struct {
+	MaxNATSDownSeconds         int `yaml:"max_nats_down_seconds"`         // NotReady once NATS has been disconnected this long (0 = immediately)
+	MaxConsumerLag             int `yaml:"max_consumer_lag"`              // NotReady when a consumer is further behind (0 = not checked)
+	MaxFailingEndpointsPercent int `yaml:"max_failing_endpoints_percent"` // NotReady when more endpoints failed their last delivery (0 = not checked)
+	EndpointWindowSeconds      int `yaml:"endpoint_window_seconds"`       // Only endpoints used this recently count (default 300)
+}
+
+// AuthConfig requires an API token on every API call without isolating streams (see
+// IsolationConfig). Tokens are scoped to domains, so customers can be handed a dashboard
+// URL that only shows their own events, logs and stats.
+type AuthConfig struct {
+	Enabled    bool       `yaml:"enabled"`
+	AdminToken string     `yaml:"admin_token"` // Token with access to all domains and admin operations
+	Tokens     []APIToken `yaml:"tokens"`
+}
+
+// APIToken grants access to the data of a set of domains
+type APIToken struct {
+	Name    string   `yaml:"name" json:"name"`
+	Token   string   `yaml:"token" json:"-"`
+	Domains []string `yaml:"domains" json:"domains"`
+}
+
+// BackpressureConfig makes POST /events answer 503 with Retry-After while JetStream
+// publishes are slow or the consumer is far behind, so PBXs back off
+type BackpressureConfig struct {
+	MaxPublishLatencyMs int `yaml:"max_publish_latency_ms"` // Average publish latency over the last check interval (0 = not checked)
+	MaxConsumerLag      int `yaml:"max_consumer_lag"`       // Stream messages not yet delivered to the consumer (0 = not checked)
+	RetryAfterSeconds   int `yaml:"retry_after_seconds"`    // Retry-After sent with the 503 (default 5)
+}
+
+// Enabled reports whether any backpressure threshold is set
+func (b *BackpressureConfig) Enabled() bool {
+	return b.MaxPublishLatencyMs > 0 || b.MaxConsumerLag > 0
+}
+
+// RetryAfter returns the Retry-After delay in seconds
+func (b *BackpressureConfig) RetryAfter() int {
+	if b.RetryAfterSeconds > 0 {
+		return b.RetryAfterSeconds
+	}
+	return 5
 }
 
 // NATSConfig holds NATS connection configuration
@@ -28,69 +521,1449 @@ type NATSConfig struct {
 	SubjectPattern string `yaml:"subject_pattern"`
 	AckWait        int    `yaml:"ack_wait_seconds"`
 	MaxDeliveries  int    `yaml:"max_deliveries"`
+	MaxAckPending  int    `yaml:"max_ack_pending"` // Messages delivered and not yet acknowledged per consumer (0 = JetStream default, -1 = unlimited)
+
+	Compression CompressionConfig `yaml:"compression"`
+
+	// Core NATS subject where instances publish their config hash (drift detection)
+	FleetSubject string `yaml:"fleet_subject"`
+	// Core NATS subject where instances answer requests for their stats (/api/fleet/stats)
+	FleetStatsSubject string `yaml:"fleet_stats_subject"`
+
+	// Default redelivery delays for failed forwards (nil = rely on ack_wait)
+	RetryPolicy *RetryPolicy `yaml:"retry_policy"`
+
+	DedupLedger LedgerConfig `yaml:"dedup_ledger"`
+
+	Lag LagConfig `yaml:"lag"`
+
+	DomainCircuit DomainCircuitConfig `yaml:"domain_circuit"`
+
+	Receipts ReceiptsConfig `yaml:"receipts"`
+
+	Takeover TakeoverConfig `yaml:"takeover"`
+
+	DeliveryReport DeliveryReportConfig `yaml:"delivery_report"`
 }
 
-// Route maps a domain to backend endpoints
-type Route struct {
-	Domain    string   `yaml:"domain" json:"domain"`
-	Endpoints []string `yaml:"endpoints" json:"endpoints"`
+// DeliveryReportConfig keeps per-domain daily counts of accepted, delivered and dead-lettered
+// events in a JetStream KV bucket, for the monthly delivery report (/api/reports/delivery).
+// Unlike the event store, the counts survive restarts and add up across instances. Requires
+// restart to change.
+type DeliveryReportConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	Bucket          string `yaml:"bucket"`           // KV bucket (default "event-hub-delivery")
+	RetentionMonths int    `yaml:"retention_months"` // Months of counts kept (default 13)
 }
 
-// Load reads and parses the configuration file
-func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+// TakeoverConfig lets one instance at a time fetch from each durable consumer, coordinated
+// through a lock in a JetStream KV bucket. A new instance (blue/green deploy) asks the holder
+// to hand over and binds the consumer only once the holder has stopped fetching and finished
+// its in-flight forwards. Requires restart to change.
+type TakeoverConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Bucket       string `yaml:"bucket"`        // KV bucket (default "event-hub-takeover")
+	LeaseSeconds int    `yaml:"lease_seconds"` // A lock not renewed for this long is free, e.g. after a crash (default 15)
+	WaitSeconds  int    `yaml:"wait_seconds"`  // How long a new instance waits for the handover before giving up (default 120)
+}
+
+// defaultMaxAckPending is the JetStream server's max_ack_pending for consumers that do not set it
+const defaultMaxAckPending = 1000
+
+// ReceiptsConfig publishes a delivery receipt (call_id, endpoint, status, latency) to a core
+// NATS subject after every forward attempt, for systems that consume delivery outcomes
+type ReceiptsConfig struct {
+	Subject string `yaml:"subject"` // e.g. event-hub.receipts (empty = off, requires restart to change)
+}
+
+// LagConfig controls per-domain lag tracking: alarms when a domain falls behind, and the
+// worker pool (messages processed concurrently per consumer) sized from the backlog
+type LagConfig struct {
+	AlarmPending       int  `yaml:"alarm_pending"`        // Alarm when a domain has more pending messages (0 = off)
+	AlarmAgeSeconds    int  `yaml:"alarm_age_seconds"`    // Alarm when a domain's oldest pending message is older (0 = off)
+	DrainTargetSeconds int  `yaml:"drain_target_seconds"` // Time a backlog should drain in when suggesting workers (default 60)
+	MinWorkers         int  `yaml:"min_workers"`          // Lower bound when auto-scaling (default 1)
+	MaxWorkers         int  `yaml:"max_workers"`          // Worker pool size; 0 = unlimited (one goroutine per message)
+	AutoScale          bool `yaml:"auto_scale"`           // Resize the pool to the suggested worker count within the bounds
+}
+
+// DomainCircuitConfig pauses forwarding for a domain whose deliveries keep failing. While
+// the circuit is open, the domain's messages are held (kept in progress) instead of spending
+// their deliveries, and one event is forwarded every probe_seconds to detect the recovery.
+type DomainCircuitConfig struct {
+	Enabled        bool `yaml:"enabled"`
+	FailurePercent int  `yaml:"failure_percent"` // Open when this share of the last min_events forwards failed (default 80)
+	MinEvents      int  `yaml:"min_events"`      // Forwards the failure share is computed over (default 20)
+	ProbeSeconds   int  `yaml:"probe_seconds"`   // Forward one event this often while open (default 30)
+	MaxParked      int  `yaml:"max_parked"`      // Messages held per open domain; more are redelivered after probe_seconds (default 100)
+}
+
+// LedgerConfig keeps a persistent record of acknowledged stream sequences per consumer
+// in a JetStream KV bucket, so messages delivered again after disaster recovery
+// (consumer recreated, stream restored) are skipped instead of forwarded twice
+type LedgerConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Bucket    string `yaml:"bucket"`     // KV bucket (default "event-hub-ledger")
+	MaxRanges int    `yaml:"max_ranges"` // Sequence ranges kept per stream; each failed event splits a range (default 10000)
+}
+
+// RetryPolicy computes how long JetStream waits before redelivering a failed event
+// Either list explicit delays per attempt, or configure exponential backoff
+type RetryPolicy struct {
+	BackoffSeconds      []int   `yaml:"backoff_seconds" json:"backoff_seconds,omitempty"` // Delay after attempt 1, 2, ...; last value repeats
+	InitialDelaySeconds int     `yaml:"initial_delay_seconds" json:"initial_delay_seconds,omitempty"`
+	Multiplier          float64 `yaml:"multiplier" json:"multiplier,omitempty"` // Default 2
+	MaxDelaySeconds     int     `yaml:"max_delay_seconds" json:"max_delay_seconds,omitempty"`
+}
+
+// Delay returns the redelivery delay after the given (1-based) failed delivery attempt
+// Returns 0 when the policy does not define a delay
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	if p == nil || attempt < 1 {
+		return 0
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	if len(p.BackoffSeconds) > 0 {
+		idx := attempt - 1
+		if idx >= len(p.BackoffSeconds) {
+			idx = len(p.BackoffSeconds) - 1
+		}
+		return time.Duration(p.BackoffSeconds[idx]) * time.Second
 	}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+	if p.InitialDelaySeconds <= 0 {
+		return 0
 	}
 
-	return &cfg, nil
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	seconds := float64(p.InitialDelaySeconds) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelaySeconds > 0 && seconds > float64(p.MaxDelaySeconds) {
+		seconds = float64(p.MaxDelaySeconds)
+	}
+	return time.Duration(seconds * float64(time.Second))
 }
 
-// Validate checks that the configuration is valid
-func (c *Config) Validate() error {
-	if c.Server.Port <= 0 {
-		return fmt.Errorf("server port must be positive")
+// validate checks the retry policy values
+func (p *RetryPolicy) validate() error {
+	if p == nil {
+		return nil
 	}
-
-	if c.NATS.URL == "" {
-		return fmt.Errorf("nats url is required")
+	for _, d := range p.BackoffSeconds {
+		if d < 0 {
+			return fmt.Errorf("backoff_seconds must not be negative")
+		}
+	}
+	if p.InitialDelaySeconds < 0 || p.MaxDelaySeconds < 0 {
+		return fmt.Errorf("retry delays must not be negative")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("multiplier must be at least 1")
 	}
+	return nil
+}
 
-	if c.NATS.StreamName == "" {
-		return fmt.Errorf("nats stream_name is required")
+// CompressionConfig holds NATS payload compression configuration
+type CompressionConfig struct {
+	Algorithm      string `yaml:"algorithm"`       // "gzip", "snappy" or empty to disable
+	ThresholdBytes int    `yaml:"threshold_bytes"` // Only payloads larger than this are compressed
+}
+
+// Route maps a domain to backend endpoints
+type Route struct {
+	Domain        string     `yaml:"domain" json:"domain"`
+	Enabled       *bool      `yaml:"enabled" json:"enabled,omitempty"` // false pauses the route: events are acknowledged and skipped (default true)
+	Endpoints     []Endpoint `yaml:"endpoints" json:"endpoints"`
+	MaxConcurrent int        `yaml:"max_concurrent" json:"max_concurrent,omitempty"` // Max events forwarded at once (0 = unlimited)
+
+	EndpointGroups []string `yaml:"endpoint_groups" json:"endpoint_groups,omitempty"` // Groups of endpoint_groups whose endpoints are added to endpoints
+
+	RetryPolicy *RetryPolicy    `yaml:"retry_policy" json:"retry_policy,omitempty"` // Overrides nats.retry_policy for this route
+	Outbound    *OutboundConfig `yaml:"outbound" json:"outbound,omitempty"`         // Overrides the global outbound source for this route
+
+	MaxDeliveries          int `yaml:"max_deliveries" json:"max_deliveries,omitempty"`                     // Overrides nats.max_deliveries: deliveries of an event before it is given up
+	RedeliveryDelaySeconds int `yaml:"redelivery_delay_seconds" json:"redelivery_delay_seconds,omitempty"` // Wait before a failed event is delivered again, instead of nats.ack_wait_seconds
+
+	MaxRequestBytes  int64 `yaml:"max_request_bytes" json:"max_request_bytes,omitempty"`   // Reject outbound bodies larger than this (0 = unlimited)
+	MaxResponseBytes int64 `yaml:"max_response_bytes" json:"max_response_bytes,omitempty"` // Read at most this much of a response (default 64KB)
+	TimeoutMs        int   `yaml:"timeout_ms" json:"timeout_ms,omitempty"`                 // Request timeout of its HTTP and Event Hubs endpoints that set none (default 3000)
+
+	Headers   map[string]string `yaml:"headers" json:"headers,omitempty"`     // Extra request headers (templates) for HTTP-based endpoints
+	Transform map[string]string `yaml:"transform" json:"transform,omitempty"` // Payload fields set from templates before forwarding
+
+	RenameFields RenameFields `yaml:"rename_fields" json:"rename_fields,omitempty"` // Payload fields renamed before forwarding (source: target), after transforms
+	DropFields   []string     `yaml:"drop_fields" json:"drop_fields,omitempty"`     // Payload fields removed before forwarding, after transforms and renames
+
+	SchemaFile string         `yaml:"schema_file" json:"schema_file,omitempty"` // JSON Schema the forwarded payload must match
+	schema     *schema.Schema // Compiled schema_file, set by Load
+
+	Encoding *EncodingConfig `yaml:"encoding" json:"encoding,omitempty"` // How HTTP endpoints receive the payload (default JSON)
+
+	MaxEventAgeSeconds int        `yaml:"max_event_age_seconds" json:"max_event_age_seconds,omitempty"` // Events older than this since ingest are stale (0 = no limit)
+	StaleEndpoints     []Endpoint `yaml:"stale_endpoints" json:"stale_endpoints,omitempty"`             // Where stale events go instead of endpoints (empty = not forwarded)
+
+	FallbackEndpoints []Endpoint `yaml:"fallback_endpoints" json:"fallback_endpoints,omitempty"` // Tried in order when all endpoints of an event failed
+
+	Delivery string `yaml:"delivery" json:"delivery,omitempty"` // at_least_once (default) or at_most_once
+
+	Mode string `yaml:"mode" json:"mode,omitempty"` // fan_out (default: every endpoint) or load_balance (one endpoint per event)
+
+	Contacts []string `yaml:"contacts" json:"contacts,omitempty"` // Email addresses that receive the domain's reports
+
+	AllowedSources []string `yaml:"allowed_sources" json:"allowed_sources,omitempty"` // CIDRs that may submit the domain's events to /events (empty = any)
+
+	Hedging *HedgingConfig `yaml:"hedging" json:"hedging,omitempty"` // Second request to slow HTTP endpoints (latency-critical routes)
+
+	Region string `yaml:"region" json:"region,omitempty"` // residency region the domain's data must stay in (see ResidencyConfig)
+
+	FieldMap FieldMap `yaml:"field_map" json:"field_map,omitempty"` // Field names normalized at ingest, after server.field_map (the domain cannot be remapped)
+
+	Success *SuccessConfig `yaml:"success" json:"success,omitempty"` // Which HTTP responses mean delivered (default any 2xx)
+
+	Quota *QuotaConfig `yaml:"quota" json:"quota,omitempty"` // Resources the domain may use on an instance (default: the global settings)
+
+	Signing *SigningConfig `yaml:"signing" json:"signing,omitempty"` // HMAC signature of HTTP deliveries, so backends can authenticate them
+
+	Match MatchRules `yaml:"match" json:"match,omitempty"` // Events with given field values go to other endpoints (first matching rule wins)
+
+	File string `yaml:"-" json:"file,omitempty"` // Config directory file defining the route, set by LoadDir (empty = the config file)
+}
+
+// MatchRules are the match rules of a route, tried in order
+type MatchRules []MatchRule
+
+// MatchRule sends the events of a route whose fields all have the given values (e.g.
+// direction: outbound) to its own endpoints instead of the route's endpoints
+type MatchRule struct {
+	When      map[string]string `yaml:"when" json:"when"`           // Field name -> value; numbers and booleans are compared as text
+	Endpoints []Endpoint        `yaml:"endpoints" json:"endpoints"` // Replace the route's endpoints for matching events
+}
+
+// Matches reports whether every condition of the rule holds for the event
+func (m *MatchRule) Matches(ev *event.Event) bool {
+	for name, want := range m.When {
+		if ev.Get(name) == nil || ev.Text(name) != want {
+			return false
+		}
 	}
+	return true
+}
 
-	if c.NATS.SubjectPattern == "" {
-		return fmt.Errorf("nats subject_pattern is required")
+// Endpoints returns the endpoints of the first rule the event matches (false if none
+// does, and the route's endpoints apply)
+func (rules MatchRules) Endpoints(ev *event.Event) ([]Endpoint, bool) {
+	for i := range rules {
+		if rules[i].Matches(ev) {
+			return rules[i].Endpoints, true
+		}
 	}
+	return nil, false
+}
 
-	if c.NATS.AckWait <= 0 {
-		return fmt.Errorf("nats ack_wait_seconds must be positive")
+// validate checks the match rules of a route
+func (m *MatchRule) validate() error {
+	if len(m.When) == 0 {
+		return fmt.Errorf("match rules need at least one when condition")
+	}
+	if len(m.Endpoints) == 0 {
+		return fmt.Errorf("match rules need endpoints")
 	}
+	if _, ok := m.When["domain"]; ok {
+		return fmt.Errorf("match rules cannot test domain (the route is chosen by it)")
+	}
+	return nil
+}
 
-	if c.NATS.MaxDeliveries <= 0 {
-		return fmt.Errorf("nats max_deliveries must be positive")
+// SigningConfig signs the body of every HTTP delivery of a route with HMAC-SHA256. The secret
+// can be rotated via the API; during the overlap window deliveries carry the signatures of
+// both the new and the old secret, so backends switch keys without rejecting webhooks.
+type SigningConfig struct {
+	Secret         string `yaml:"secret" json:"-"`                                  // Shared with the backend (empty = only secrets rotated via the API)
+	Header         string `yaml:"header" json:"header,omitempty"`                   // Request header of the signature (default X-Hub-Signature)
+	OverlapSeconds int    `yaml:"overlap_seconds" json:"overlap_seconds,omitempty"` // How long a rotated-out secret still signs deliveries (default 86400)
+}
+
+// Signing defaults
+const (
+	defaultSigningHeader         = "X-Hub-Signature"
+	defaultSigningOverlapSeconds = 86400
+)
+
+// HeaderName returns the request header of the signature
+func (s *SigningConfig) HeaderName() string {
+	if s.Header != "" {
+		return s.Header
 	}
+	return defaultSigningHeader
+}
 
-	// Validate that ack_wait is greater than backend timeout (3 seconds)
-	if c.NATS.AckWait <= 3 {
-		return fmt.Errorf("nats ack_wait_seconds (%d) must be greater than backend timeout (3 seconds)", c.NATS.AckWait)
+// Overlap returns how long a rotated-out secret still signs deliveries
+func (s *SigningConfig) Overlap() time.Duration {
+	if s.OverlapSeconds > 0 {
+		return time.Duration(s.OverlapSeconds) * time.Second
 	}
+	return defaultSigningOverlapSeconds * time.Second
+}
 
-	return nil
+// QuotaConfig bounds what one domain keeps on an instance; unset fields fall back to the
+// global settings
+type QuotaConfig struct {
+	MaxStoredEvents  int   `yaml:"max_stored_events" json:"max_stored_events,omitempty"`   // Forwarded and failed events each kept in the event store (0 = only the store's limits)
+	LogRetentionDays int   `yaml:"log_retention_days" json:"log_retention_days,omitempty"` // Days of log files kept (0 = logs.retention_days)
+	Archive          *bool `yaml:"archive" json:"archive,omitempty"`                       // Gzip the log files of past days (default logs.archive)
+}
+
+// DomainLimits returns the max_stored_events of every route that sets one, by domain
+func (c *Config) DomainLimits() map[string]int {
+	limits := make(map[string]int)
+	for _, route := range c.Routes {
+		if route.Quota != nil && route.Quota.MaxStoredEvents > 0 {
+			limits[route.Domain] = route.Quota.MaxStoredEvents
+		}
+	}
+	return limits
+}
+
+// LogRetention returns the log retention days and archiving of each route with a quota
+// that changes them, by domain
+func (c *Config) LogRetention() map[string]LogsConfig {
+	policies := make(map[string]LogsConfig)
+	for _, route := range c.Routes {
+		quota := route.Quota
+		if quota == nil || (quota.LogRetentionDays == 0 && quota.Archive == nil) {
+			continue
+		}
+		policy := c.Logs
+		if quota.LogRetentionDays > 0 {
+			policy.RetentionDays = quota.LogRetentionDays
+		}
+		if quota.Archive != nil {
+			policy.Archive = *quota.Archive
+		}
+		policies[route.Domain] = policy
+	}
+	return policies
+}
+
+// HedgingConfig sends a second, identical request to an HTTP endpoint that has not answered
+// after its recent P95 latency, and keeps whichever answers first. Every hedged event may reach
+// the backend twice, so it requires backends that deduplicate on X-Call-ID (and state).
+type HedgingConfig struct {
+	Enabled    bool `yaml:"enabled" json:"enabled"`
+	Idempotent bool `yaml:"idempotent" json:"idempotent"` // Must be set: confirms every endpoint of the route tolerates duplicate requests
+
+	MinDelayMs     int `yaml:"min_delay_ms" json:"min_delay_ms,omitempty"`         // Never hedge earlier than this (default 50)
+	InitialDelayMs int `yaml:"initial_delay_ms" json:"initial_delay_ms,omitempty"` // Delay until enough latencies were measured (default 500)
+}
+
+// Hedging defaults
+const (
+	defaultHedgeMinDelayMs     = 50
+	defaultHedgeInitialDelayMs = 500
+)
+
+// Active reports whether requests of the route are hedged
+func (h *HedgingConfig) Active() bool {
+	return h != nil && h.Enabled
+}
+
+// MinDelay returns the shortest hedge delay
+func (h *HedgingConfig) MinDelay() time.Duration {
+	if h.MinDelayMs > 0 {
+		return time.Duration(h.MinDelayMs) * time.Millisecond
+	}
+	return defaultHedgeMinDelayMs * time.Millisecond
+}
+
+// InitialDelay returns the hedge delay used before an endpoint's P95 latency is known
+func (h *HedgingConfig) InitialDelay() time.Duration {
+	if h.InitialDelayMs > 0 {
+		return time.Duration(h.InitialDelayMs) * time.Millisecond
+	}
+	return defaultHedgeInitialDelayMs * time.Millisecond
+}
+
+// validate checks the hedging settings of a route
+func (h *HedgingConfig) validate(route *Route) error {
+	if !h.Active() {
+		return nil
+	}
+	if !h.Idempotent {
+		return fmt.Errorf("hedging sends some events twice and requires idempotent: true (endpoints must deduplicate on X-Call-ID)")
+	}
+	if route.AtMostOnce() {
+		return fmt.Errorf("hedging cannot be combined with delivery at_most_once, which must never send an event twice")
+	}
+	if h.MinDelayMs < 0 || h.InitialDelayMs < 0 {
+		return fmt.Errorf("hedging delays must not be negative")
+	}
+	return nil
+}
+
+// Delivery guarantees of a route
+const (
+	DeliveryAtLeastOnce = "at_least_once" // Failed events are redelivered (default)
+	DeliveryAtMostOnce  = "at_most_once"  // Events are acknowledged before forwarding and never retried
+)
+
+// Disabled reports whether the route is paused (enabled: false), so its events are
+// acknowledged without being forwarded
+func (r *Route) Disabled() bool {
+	return r.Enabled != nil && !*r.Enabled
+}
+
+// MaxDeliveries returns how many times an event of the domain is delivered before it is
+// given up: its route's max_deliveries, or nats.max_deliveries
+func (c *Config) MaxDeliveries(domain string) int {
+	if route := c.RouteFor(domain); route != nil && route.MaxDeliveries > 0 {
+		return route.MaxDeliveries
+	}
+	return c.NATS.MaxDeliveries
+}
+
+// MaxDeliveryLimit returns the highest max_deliveries of nats and the routes: the limit of
+// the durable consumer, within which each route gives up after its own
+func (c *Config) MaxDeliveryLimit() int {
+	limit := c.NATS.MaxDeliveries
+	for _, route := range c.AllRoutes() {
+		if route.MaxDeliveries > limit {
+			limit = route.MaxDeliveries
+		}
+	}
+	return limit
+}
+
+// RedeliveryDelay returns how long a failed event of the domain waits before it is delivered
+// again when no retry policy applies: its route's redelivery_delay_seconds, or
+// nats.ack_wait_seconds
+func (c *Config) RedeliveryDelay(domain string) time.Duration {
+	if route := c.RouteFor(domain); route != nil && route.RedeliveryDelaySeconds > 0 {
+		return time.Duration(route.RedeliveryDelaySeconds) * time.Second
+	}
+	return time.Duration(c.NATS.AckWait) * time.Second
+}
+
+// AtMostOnce reports whether the route prefers losing an event over sending it twice
+func (r *Route) AtMostOnce() bool {
+	return r.Delivery == DeliveryAtMostOnce
+}
+
+// Forwarding modes of a route
+const (
+	ModeFanOut      = "fan_out"      // Every event goes to all endpoints (default)
+	ModeLoadBalance = "load_balance" // Every event goes to one endpoint, in weighted round-robin
+)
+
+// LoadBalanced reports whether each event goes to only one of the route's endpoints
+func (r *Route) LoadBalanced() bool {
+	return r.Mode == ModeLoadBalance
+}
+
+// AllowsSource reports whether events of the route's domain may be submitted from ip
+func (r *Route) AllowsSource(ip net.IP) bool {
+	if len(r.AllowedSources) == 0 {
+		return true
+	}
+	for _, cidr := range r.AllowedSources {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllEndpoints returns the route's endpoints followed by those of its match rules and its
+// stale endpoints
+func (r *Route) AllEndpoints() []Endpoint {
+	if len(r.StaleEndpoints) == 0 {
+		return r.ForwardEndpoints()
+	}
+	all := append([]Endpoint(nil), r.ForwardEndpoints()...)
+	return append(all, r.StaleEndpoints...)
+}
+
+// ForwardEndpoints returns the route's endpoints followed by those of its match rules and
+// its fallback endpoints
+func (r *Route) ForwardEndpoints() []Endpoint {
+	if len(r.Match) == 0 && len(r.FallbackEndpoints) == 0 {
+		return r.Endpoints
+	}
+	all := append([]Endpoint(nil), r.Endpoints...)
+	for _, rule := range r.Match {
+		all = append(all, rule.Endpoints...)
+	}
+	return append(all, r.FallbackEndpoints...)
+}
+
+// Payload encodings for HTTP endpoints
+const (
+	EncodingJSON      = "json"
+	EncodingForm      = "form"
+	EncodingXML       = "xml"
+	EncodingMultipart = "multipart"
+)
+
+// EncodingConfig selects how a route's HTTP endpoints receive the payload, for
+// backends that do not accept JSON. Other sink types always receive JSON.
+type EncodingConfig struct {
+	Format      string `yaml:"format" json:"format"`                       // json (default), form, xml or multipart
+	FormKeys    string `yaml:"form_keys" json:"form_keys,omitempty"`       // Nested field names for form/multipart: dotted ("caller.number", default) or brackets ("caller[number]")
+	XMLTemplate string `yaml:"xml_template" json:"xml_template,omitempty"` // Body template for xml; values are XML-escaped
+	FileField   string `yaml:"file_field" json:"file_field,omitempty"`     // multipart: also attach the JSON payload as a file part with this name
+	ContentType string `yaml:"content_type" json:"content_type,omitempty"` // Overrides the format's Content-Type (e.g. text/xml)
+}
+
+func (e *EncodingConfig) validate() error {
+	if e == nil {
+		return nil
+	}
+	switch e.Format {
+	case "", EncodingJSON, EncodingForm, EncodingMultipart:
+	case EncodingXML:
+		if e.XMLTemplate == "" {
+			return fmt.Errorf("xml format requires xml_template")
+		}
+		if _, err := transform.Parse(e.XMLTemplate); err != nil {
+			return fmt.Errorf("xml_template: %w", err)
+		}
+	default:
+		return fmt.Errorf("format must be json, form, xml or multipart, got %q", e.Format)
+	}
+	switch e.FormKeys {
+	case "", "dotted", "brackets":
+	default:
+		return fmt.Errorf("form_keys must be dotted or brackets, got %q", e.FormKeys)
+	}
+	if e.FileField != "" && e.Format != EncodingMultipart {
+		return fmt.Errorf("file_field is only used with the multipart format")
+	}
+	return nil
+}
+
+// Schema returns the route's compiled target schema (nil if none)
+func (r *Route) Schema() *schema.Schema {
+	return r.schema
+}
+
+// loadSchemas reads and compiles the schema files of the routes and the default route
+func (c *Config) loadSchemas() error {
+	routes := make([]*Route, 0, len(c.Routes)+1)
+	for i := range c.Routes {
+		routes = append(routes, &c.Routes[i])
+	}
+	if c.DefaultRoute != nil {
+		routes = append(routes, c.DefaultRoute)
+	}
+	for _, route := range routes {
+		if route.SchemaFile == "" {
+			continue
+		}
+		data, err := os.ReadFile(route.SchemaFile)
+		if err != nil {
+			return fmt.Errorf("route %s: failed to read schema_file: %w", route.Domain, err)
+		}
+		if route.schema, err = schema.Compile(data); err != nil {
+			return fmt.Errorf("route %s: invalid schema_file %s: %w", route.Domain, route.SchemaFile, err)
+		}
+	}
+	return nil
+}
+
+// validateTemplates checks the route's header and transform templates, and drop_fields
+func (r *Route) validateTemplates() error {
+	for name, value := range r.Headers {
+		if name == "" || strings.ContainsAny(name, " :\t\r\n") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if _, err := transform.Parse(value); err != nil {
+			return fmt.Errorf("header %s: %w", name, err)
+		}
+	}
+	for field, value := range r.Transform {
+		if field == "" {
+			return fmt.Errorf("transform field name must not be empty")
+		}
+		if _, err := transform.Parse(value); err != nil {
+			return fmt.Errorf("transform %s: %w", field, err)
+		}
+	}
+	for _, field := range r.DropFields {
+		if !validFieldPath(field) {
+			return fmt.Errorf("invalid drop_fields entry %q", field)
+		}
+	}
+	return nil
+}
+
+// IsolationConfig enables multi-tenant isolation: each tenant gets its own
+// stream and consumer, and every API call must carry a tenant-scoped token
+type IsolationConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	AdminToken string   `yaml:"admin_token"` // Optional token with access to all tenants
+	Tenants    []Tenant `yaml:"tenants"`
+
+	OpsNotifications OpsNotificationsConfig `yaml:"ops_notifications"`
+}
+
+// OpsNotificationsConfig tunes the notifications posted to the ops_url of a tenant when
+// one of its events dead-letters (fails for good or is quarantined) or one of its
+// endpoints' circuit opens (fails delivery after delivery)
+type OpsNotificationsConfig struct {
+	CircuitFailures    int `yaml:"circuit_failures"`     // Consecutive failed deliveries that open an endpoint's circuit (default 5)
+	MinIntervalSeconds int `yaml:"min_interval_seconds"` // At most one dead_letter notification per domain this often (default 60)
+}
+
+// Tenant groups domains that share an isolated stream, consumer and API token
+type Tenant struct {
+	Name    string   `yaml:"name" json:"name"`
+	Token   string   `yaml:"token" json:"-"`
+	Domains []string `yaml:"domains" json:"domains"`
+	NATSURL string   `yaml:"nats_url" json:"-"` // Optional: connect with the tenant's own NATS account
+	OpsURL  string   `yaml:"ops_url" json:"-"`  // Optional: receives dead_letter and circuit_open notifications
+}
+
+// tenantNamePattern restricts tenant names to characters valid in NATS subjects and stream names
+var tenantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// StreamName returns the tenant's stream name derived from the base stream name
+func (t *Tenant) StreamName(base string) string {
+	return fmt.Sprintf("%s-%s", base, t.Name)
+}
+
+// SubjectPattern returns the tenant's subject pattern derived from the base pattern
+func (t *Tenant) SubjectPattern(base string) string {
+	return fmt.Sprintf("tenant.%s.%s", t.Name, base)
+}
+
+// HasDomain reports whether the domain belongs to the tenant
+func (t *Tenant) HasDomain(domain string) bool {
+	for _, d := range t.Domains {
+		if d == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads and parses the configuration file
+func Load(path string) (*Config, error) {
+	data, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses and validates the contents of a configuration file, applying defaults and
+// expanding environment variable references (see expandEnv). With a config_source, the
+// routes are read from it.
+func Parse(data []byte) (*Config, error) {
+	return parse(data, nil)
+}
+
+// parse parses a configuration file like Parse, with the config_source routes document
+// routes instead of the key's value if routes is not nil
+func parse(data, routes []byte) (*Config, error) {
+	doc, err := parseDocument(data, routes)
+	if err != nil {
+		return nil, err
+	}
+	return decode(doc)
+}
+
+// parseDocument parses a configuration file into its YAML document, with environment
+// variables expanded and the config_source routes loaded (see parse)
+func parseDocument(data, routes []byte) (*yaml.Node, error) {
+	if err := checkJSON(data); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if doc.Kind != 0 {
+		if err := expandEnv(&doc); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+		if err := loadSourceRoutes(&doc, routes); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+	return &doc, nil
+}
+
+// decode decodes, validates and completes a configuration document from parseDocument
+func decode(doc *yaml.Node) (*Config, error) {
+	var cfg Config
+	if doc.Kind != 0 {
+		if err := doc.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
+	if err := cfg.expandEndpointGroups(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	if err := cfg.mergeRoutes(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	if err := cfg.loadSchemas(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	cfg.setDefaults()
+	return &cfg, nil
+}
+
+// setDefaults fills in defaults of optional settings after validation
+func (c *Config) setDefaults() {
+	if c.UserAgent == "" {
+		c.UserAgent = "event-hub/{version}"
+	}
+
+	if c.Preflight.TimeoutSeconds == 0 {
+		c.Preflight.TimeoutSeconds = 5
+	}
+
+	if c.Logs.RetentionDays == 0 {
+		c.Logs.RetentionDays = 30
+	}
+
+	if c.Server.Spool.Directory == "" {
+		c.Server.Spool.Directory = "spool"
+	}
+	if c.Server.Spool.MaxMB == 0 {
+		c.Server.Spool.MaxMB = 100
+	}
+	if c.Server.Spool.Overflow == "" {
+		c.Server.Spool.Overflow = SpoolOverflowReject
+	}
+
+	if c.NATS.FleetSubject == "" {
+		c.NATS.FleetSubject = "event-hub.fleet.config"
+	}
+	if c.NATS.FleetStatsSubject == "" {
+		c.NATS.FleetStatsSubject = "event-hub.fleet.stats"
+	}
+
+	if c.NATS.DedupLedger.Bucket == "" {
+		c.NATS.DedupLedger.Bucket = "event-hub-ledger"
+	}
+
+	if c.NATS.DeliveryReport.Bucket == "" {
+		c.NATS.DeliveryReport.Bucket = "event-hub-delivery"
+	}
+	if c.NATS.DeliveryReport.RetentionMonths == 0 {
+		c.NATS.DeliveryReport.RetentionMonths = 13
+	}
+
+	if c.NATS.Takeover.Bucket == "" {
+		c.NATS.Takeover.Bucket = "event-hub-takeover"
+	}
+	if c.NATS.Takeover.LeaseSeconds == 0 {
+		c.NATS.Takeover.LeaseSeconds = 15
+	}
+	if c.NATS.Takeover.WaitSeconds == 0 {
+		c.NATS.Takeover.WaitSeconds = 120
+	}
+
+	if c.Server.FieldMap == nil {
+		c.Server.FieldMap = defaultFieldMap
+	}
+
+	if c.Server.Duplicates.WindowSeconds == 0 {
+		c.Server.Duplicates.WindowSeconds = 10
+	}
+
+	if c.Server.Readiness.EndpointWindowSeconds == 0 {
+		c.Server.Readiness.EndpointWindowSeconds = 300
+	}
+
+	share := &c.Server.ShareLinks
+	if share.MaxTTLSeconds == 0 {
+		share.MaxTTLSeconds = 7 * 86400
+	}
+	if share.DefaultTTLSeconds == 0 {
+		share.DefaultTTLSeconds = 86400
+		if share.MaxTTLSeconds < share.DefaultTTLSeconds {
+			share.DefaultTTLSeconds = share.MaxTTLSeconds
+		}
+	}
+	if c.Server.StatusPage.WindowSeconds == 0 {
+		c.Server.StatusPage.WindowSeconds = 300
+	}
+
+	anomalies := &c.Server.Anomalies
+	if anomalies.WindowMinutes == 0 {
+		anomalies.WindowMinutes = 5
+	}
+	if anomalies.BaselineMinutes == 0 {
+		anomalies.BaselineMinutes = 60
+	}
+	if anomalies.Factor == 0 {
+		anomalies.Factor = 5
+	}
+	if anomalies.MinEventsPerMinute == 0 {
+		anomalies.MinEventsPerMinute = 1
+	}
+	if anomalies.SilenceMinutes == 0 {
+		anomalies.SilenceMinutes = 120
+	}
+
+	if c.NATS.Lag.DrainTargetSeconds == 0 {
+		c.NATS.Lag.DrainTargetSeconds = 60
+	}
+	if c.NATS.Lag.MinWorkers == 0 {
+		c.NATS.Lag.MinWorkers = 1
+	}
+
+	circuit := &c.NATS.DomainCircuit
+	if circuit.FailurePercent == 0 {
+		circuit.FailurePercent = 80
+	}
+	if circuit.MinEvents == 0 {
+		circuit.MinEvents = 20
+	}
+	if circuit.ProbeSeconds == 0 {
+		circuit.ProbeSeconds = 30
+	}
+	if circuit.MaxParked == 0 {
+		circuit.MaxParked = 100
+	}
+
+	recovery := &c.RecoveryReplay
+	if recovery.UnhealthyAfter == 0 {
+		recovery.UnhealthyAfter = 5
+	}
+	if recovery.MaxEvents == 0 {
+		recovery.MaxEvents = 1000
+	}
+	if recovery.MaxWindowMinutes == 0 {
+		recovery.MaxWindowMinutes = 60
+	}
+
+	if c.Reports.SMTP.Port == 0 {
+		c.Reports.SMTP.Port = 587
+	}
+	if c.Reports.FailedEvents.Time == "" {
+		c.Reports.FailedEvents.Time = "07:00"
+	}
+	if c.Reports.Digest.Time == "" {
+		c.Reports.Digest.Time = "00:05"
+	}
+	if c.Reports.Digest.SubjectPrefix == "" {
+		c.Reports.Digest.SubjectPrefix = "hub.digest"
+	}
+	if c.Reports.Digest.TopEndpoints == 0 {
+		c.Reports.Digest.TopEndpoints = 5
+	}
+
+	if c.Isolation.OpsNotifications.CircuitFailures == 0 {
+		c.Isolation.OpsNotifications.CircuitFailures = 5
+	}
+	if c.Isolation.OpsNotifications.MinIntervalSeconds == 0 {
+		c.Isolation.OpsNotifications.MinIntervalSeconds = 60
+	}
+}
+
+// Validate checks that the configuration is valid
+func (c *Config) Validate() error {
+	if _, err := ParseRole(c.Role); err != nil {
+		return fmt.Errorf("role: %w", err)
+	}
+	if err := c.ConfigSource.validate(); err != nil {
+		return fmt.Errorf("config_source: %w", err)
+	}
+	if c.Server.Port <= 0 {
+		return fmt.Errorf("server port must be positive")
+	}
+	if ingest := c.Server.Ingest; ingest.Port < 0 {
+		return fmt.Errorf("server ingest port must not be negative")
+	} else if ingest.Port == c.Server.Port && (ingest.Host == c.Server.Host || ingest.Host == "" || c.Server.Host == "") {
+		return fmt.Errorf("server ingest port must differ from server port")
+	}
+
+	if c.Server.Duplicates.WindowSeconds < 0 {
+		return fmt.Errorf("server duplicates window_seconds must not be negative")
+	}
+
+	if c.Server.StatusPage.WindowSeconds < 0 {
+		return fmt.Errorf("server status_page window_seconds must not be negative")
+	}
+
+	share := c.Server.ShareLinks
+	if share.Secret != "" && len(share.Secret) < minShareSecretLength {
+		return fmt.Errorf("server share_links secret must be at least %d characters", minShareSecretLength)
+	}
+	if share.DefaultTTLSeconds < 0 || share.MaxTTLSeconds < 0 {
+		return fmt.Errorf("server share_links ttl must not be negative")
+	}
+	if share.DefaultTTLSeconds > share.MaxTTLSeconds {
+		return fmt.Errorf("server share_links default_ttl_seconds must not exceed max_ttl_seconds")
+	}
+
+	anomalies := c.Server.Anomalies
+	if anomalies.WindowMinutes < 0 || anomalies.BaselineMinutes < 0 || anomalies.MinEventsPerMinute < 0 || anomalies.SilenceMinutes < 0 {
+		return fmt.Errorf("server anomalies settings must not be negative")
+	}
+	if anomalies.Factor != 0 && anomalies.Factor <= 1 {
+		return fmt.Errorf("server anomalies factor must be greater than 1")
+	}
+
+	readiness := c.Server.Readiness
+	if readiness.MaxNATSDownSeconds < 0 || readiness.MaxConsumerLag < 0 || readiness.EndpointWindowSeconds < 0 || readiness.MaxFailingEndpointsPercent < 0 {
+		return fmt.Errorf("server readiness settings must not be negative")
+	}
+	if readiness.MaxFailingEndpointsPercent > 100 {
+		return fmt.Errorf("server readiness max_failing_endpoints_percent must be at most 100")
+	}
+
+	if c.Server.Backpressure.MaxPublishLatencyMs < 0 || c.Server.Backpressure.MaxConsumerLag < 0 || c.Server.Backpressure.RetryAfterSeconds < 0 {
+		return fmt.Errorf("server backpressure settings must not be negative")
+	}
+
+	if c.NATS.URL == "" {
+		return fmt.Errorf("nats url is required")
+	}
+
+	if c.NATS.StreamName == "" {
+		return fmt.Errorf("nats stream_name is required")
+	}
+
+	if c.NATS.SubjectPattern == "" {
+		return fmt.Errorf("nats subject_pattern is required")
+	}
+
+	if c.NATS.AckWait <= 0 {
+		return fmt.Errorf("nats ack_wait_seconds must be positive")
+	}
+
+	if c.NATS.MaxDeliveries <= 0 {
+		return fmt.Errorf("nats max_deliveries must be positive")
+	}
+
+	switch c.NATS.Compression.Algorithm {
+	case "", "gzip", "snappy":
+	default:
+		return fmt.Errorf("nats compression algorithm must be gzip or snappy, got %q", c.NATS.Compression.Algorithm)
+	}
+
+	if c.NATS.Compression.ThresholdBytes < 0 {
+		return fmt.Errorf("nats compression threshold_bytes must not be negative")
+	}
+
+	// Validate that ack_wait is greater than the default backend timeout (3 seconds); routes
+	// and endpoints with a timeout_ms are checked against it below
+	if c.NATS.AckWait <= 3 {
+		return fmt.Errorf("nats ack_wait_seconds (%d) must be greater than backend timeout (3 seconds)", c.NATS.AckWait)
+	}
+
+	if c.Store.MaxMemoryMB < 0 || c.Store.CompressThresholdBytes < 0 {
+		return fmt.Errorf("store settings must not be negative")
+	}
+	if c.Logs.RetentionDays < 0 {
+		return fmt.Errorf("logs retention_days must not be negative")
+	}
+
+	switch c.Server.Spool.Overflow {
+	case "", SpoolOverflowReject, SpoolOverflowDropOldest:
+	default:
+		return fmt.Errorf("server spool overflow must be %s or %s", SpoolOverflowReject, SpoolOverflowDropOldest)
+	}
+	if c.Server.Spool.MaxMB < 0 {
+		return fmt.Errorf("server spool max_mb must not be negative")
+	}
+
+	if c.Preflight.TimeoutSeconds < 0 {
+		return fmt.Errorf("preflight timeout_seconds must not be negative")
+	}
+
+	if c.NATS.MaxAckPending < -1 {
+		return fmt.Errorf("nats max_ack_pending must be -1 (unlimited), 0 (JetStream default) or positive")
+	}
+
+	if c.NATS.DedupLedger.MaxRanges < 0 {
+		return fmt.Errorf("nats dedup_ledger max_ranges must not be negative")
+	}
+
+	if c.NATS.Takeover.LeaseSeconds < 0 || c.NATS.Takeover.WaitSeconds < 0 {
+		return fmt.Errorf("nats takeover lease_seconds and wait_seconds must not be negative")
+	}
+
+	if c.NATS.DeliveryReport.RetentionMonths < 0 {
+		return fmt.Errorf("nats delivery_report retention_months must not be negative")
+	}
+
+	lag := c.NATS.Lag
+	if lag.AlarmPending < 0 || lag.AlarmAgeSeconds < 0 || lag.DrainTargetSeconds < 0 || lag.MinWorkers < 0 || lag.MaxWorkers < 0 {
+		return fmt.Errorf("nats lag settings must not be negative")
+	}
+	if lag.AutoScale && lag.MaxWorkers == 0 {
+		return fmt.Errorf("nats lag auto_scale requires max_workers")
+	}
+	if lag.MaxWorkers > 0 && lag.MinWorkers > lag.MaxWorkers {
+		return fmt.Errorf("nats lag min_workers (%d) must not exceed max_workers (%d)", lag.MinWorkers, lag.MaxWorkers)
+	}
+
+	circuit := c.NATS.DomainCircuit
+	if circuit.FailurePercent < 0 || circuit.FailurePercent > 100 {
+		return fmt.Errorf("nats domain_circuit failure_percent must be between 1 and 100")
+	}
+	if circuit.MinEvents < 0 || circuit.ProbeSeconds < 0 || circuit.MaxParked < 0 {
+		return fmt.Errorf("nats domain_circuit settings must not be negative")
+	}
+
+	if err := c.NATS.RetryPolicy.validate(); err != nil {
+		return fmt.Errorf("nats retry_policy: %w", err)
+	}
+
+	switch c.DuplicateRoutes {
+	case "", DuplicateRoutesReject, DuplicateRoutesMerge:
+	default:
+		return fmt.Errorf("duplicate_routes must be reject or merge, got %q", c.DuplicateRoutes)
+	}
+	routeIndex := make(map[string]int)
+	for i, route := range c.Routes {
+		if first, ok := routeIndex[route.Domain]; ok {
+			return fmt.Errorf("route %s: routes[%d] and routes[%d] have the same domain; combine them or set duplicate_routes: merge", route.Domain, first, i)
+		}
+		routeIndex[route.Domain] = i
+	}
+
+	if route := c.DefaultRoute; route != nil {
+		switch {
+		case route.Domain != "":
+			return fmt.Errorf("default_route: domain must not be set, the route is used for every domain without one")
+		case len(route.Endpoints) == 0:
+			return fmt.Errorf("default_route: endpoints are required")
+		case len(route.AllowedSources) > 0 || len(route.FieldMap) > 0 || route.Quota != nil || len(route.Contacts) > 0 || route.Region != "":
+			return fmt.Errorf("default_route: allowed_sources, field_map, quota, contacts and region can only be set on the routes of domains")
+		}
+	}
+
+	fileSinkDirs := make(map[string]*FileSink)
+	for _, route := range c.AllRoutes() {
+		for _, endpoint := range route.AllEndpoints() {
+			if endpoint.Type != EndpointFile || endpoint.File == nil {
+				continue
+			}
+			// Sinks sharing a directory share its uploader, so they must agree on upload settings
+			if other, ok := fileSinkDirs[endpoint.File.Directory]; ok && !other.sameUpload(endpoint.File) {
+				return fmt.Errorf("route %s: file endpoints using directory %s must have the same sftp and upload settings", route.Domain, endpoint.File.Directory)
+			}
+			fileSinkDirs[endpoint.File.Directory] = endpoint.File
+		}
+	}
+
+	for _, route := range c.AllRoutes() {
+		if route.MaxConcurrent < 0 {
+			return fmt.Errorf("route %s: max_concurrent must not be negative", route.Domain)
+		}
+		if route.MaxDeliveries < 0 || route.RedeliveryDelaySeconds < 0 {
+			return fmt.Errorf("route %s: max_deliveries and redelivery_delay_seconds must not be negative", route.Domain)
+		}
+		if err := route.RetryPolicy.validate(); err != nil {
+			return fmt.Errorf("route %s retry_policy: %w", route.Domain, err)
+		}
+		if route.MaxRequestBytes < 0 || route.MaxResponseBytes < 0 {
+			return fmt.Errorf("route %s: max_request_bytes and max_response_bytes must not be negative", route.Domain)
+		}
+		if err := route.Outbound.validate(); err != nil {
+			return fmt.Errorf("route %s outbound: %w", route.Domain, err)
+		}
+		if err := route.validateTemplates(); err != nil {
+			return fmt.Errorf("route %s: %w", route.Domain, err)
+		}
+		if err := route.Encoding.validate(); err != nil {
+			return fmt.Errorf("route %s encoding: %w", route.Domain, err)
+		}
+		if route.MaxEventAgeSeconds < 0 {
+			return fmt.Errorf("route %s: max_event_age_seconds must not be negative", route.Domain)
+		}
+		if len(route.StaleEndpoints) > 0 && route.MaxEventAgeSeconds == 0 {
+			return fmt.Errorf("route %s: stale_endpoints requires max_event_age_seconds", route.Domain)
+		}
+		switch route.Delivery {
+		case "", DeliveryAtLeastOnce, DeliveryAtMostOnce:
+		default:
+			return fmt.Errorf("route %s: delivery must be %s or %s", route.Domain, DeliveryAtLeastOnce, DeliveryAtMostOnce)
+		}
+		switch route.Mode {
+		case "", ModeFanOut, ModeLoadBalance:
+		default:
+			return fmt.Errorf("route %s: mode must be %s or %s", route.Domain, ModeFanOut, ModeLoadBalance)
+		}
+		if err := route.Hedging.validate(&route); err != nil {
+			return fmt.Errorf("route %s: %w", route.Domain, err)
+		}
+		if err := route.FieldMap.validate(); err != nil {
+			return fmt.Errorf("route %s: %w", route.Domain, err)
+		}
+		if err := route.RenameFields.validate(); err != nil {
+			return fmt.Errorf("route %s: %w", route.Domain, err)
+		}
+		if err := route.Success.validate(); err != nil {
+			return fmt.Errorf("route %s success: %w", route.Domain, err)
+		}
+		if q := route.Quota; q != nil && (q.MaxStoredEvents < 0 || q.LogRetentionDays < 0) {
+			return fmt.Errorf("route %s: quota settings must not be negative", route.Domain)
+		}
+		if route.Signing != nil && route.Signing.OverlapSeconds < 0 {
+			return fmt.Errorf("route %s: signing overlap_seconds must not be negative", route.Domain)
+		}
+		for i := range route.Match {
+			if err := route.Match[i].validate(); err != nil {
+				return fmt.Errorf("route %s match[%d]: %w", route.Domain, i, err)
+			}
+		}
+		for _, target := range route.FieldMap {
+			if target == "domain" {
+				return fmt.Errorf("route %s: field_map cannot set domain (the route is chosen by it); use server.field_map", route.Domain)
+			}
+		}
+		if route.TimeoutMs < 0 {
+			return fmt.Errorf("route %s: timeout_ms must not be negative", route.Domain)
+		}
+		// Fallback endpoints follow the endpoints and match rule endpoints once they all failed
+		primaries := len(route.ForwardEndpoints()) - len(route.FallbackEndpoints)
+		fallback := route.fallbackTimeout()
+		for i, endpoint := range route.AllEndpoints() {
+			var after time.Duration
+			if i < primaries {
+				after = fallback
+			}
+			if err := c.validateTimeout(endpoint, route.TimeoutMs, after); err != nil {
+				return fmt.Errorf("route %s: %w", route.Domain, err)
+			}
+			if err := c.validateEndpoint(endpoint); err != nil {
+				return fmt.Errorf("route %s: %w", route.Domain, err)
+			}
+			if endpoint.Weight < 0 || endpoint.Weight > 100 {
+				return fmt.Errorf("route %s: endpoint %s weight must be between 0 and 100", route.Domain, endpoint.Name())
+			}
+		}
+	}
+
+	if err := c.Server.FieldMap.validate(); err != nil {
+		return fmt.Errorf("server %w", err)
+	}
+
+	if c.Correlation.MaxCalls < 0 {
+		return fmt.Errorf("correlation max_calls must not be negative")
+	}
+	for _, field := range append(append([]string(nil), c.Correlation.Keys...), c.Correlation.CallIDRefs...) {
+		if field == "" || field == "call_id" {
+			return fmt.Errorf("correlation fields must be set and must not be call_id")
+		}
+	}
+
+	if c.Mirror.Enabled {
+		if c.Mirror.Percentage <= 0 || c.Mirror.Percentage > 100 {
+			return fmt.Errorf("mirror percentage must be between 0 and 100")
+		}
+		if c.Mirror.URL == "" && c.Mirror.Subject == "" {
+			return fmt.Errorf("mirror requires url or subject")
+		}
+		if c.Mirror.AnonymizeProfile != "" {
+			if _, ok := c.GetAnonymizeProfile(c.Mirror.AnonymizeProfile); !ok {
+				return fmt.Errorf("mirror anonymize_profile %q is not defined", c.Mirror.AnonymizeProfile)
+			}
+		}
+	}
+
+	if c.Reports.FailedEvents.Enabled {
+		if c.Reports.SMTP.Host == "" || c.Reports.SMTP.From == "" {
+			return fmt.Errorf("reports failed_events requires smtp host and from")
+		}
+		if c.Reports.FailedEvents.Time != "" {
+			if _, err := time.Parse("15:04", c.Reports.FailedEvents.Time); err != nil {
+				return fmt.Errorf("reports failed_events time must be HH:MM")
+			}
+		}
+	}
+	if c.Reports.Digest.Time != "" {
+		if _, err := time.Parse("15:04", c.Reports.Digest.Time); err != nil {
+			return fmt.Errorf("reports digest time must be HH:MM")
+		}
+	}
+	if strings.ContainsAny(c.Reports.Digest.SubjectPrefix, " *>") || strings.HasSuffix(c.Reports.Digest.SubjectPrefix, ".") {
+		return fmt.Errorf("reports digest subject_prefix %q is not a valid NATS subject", c.Reports.Digest.SubjectPrefix)
+	}
+	if c.Reports.Digest.TopEndpoints < 0 {
+		return fmt.Errorf("reports digest top_endpoints must not be negative")
+	}
+	for _, route := range c.Routes {
+		for _, contact := range route.Contacts {
+			if _, err := mail.ParseAddress(contact); err != nil {
+				return fmt.Errorf("route %s: invalid contact %q", route.Domain, contact)
+			}
+		}
+		for _, cidr := range route.AllowedSources {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("route %s: invalid allowed_sources CIDR %q", route.Domain, cidr)
+			}
+		}
+	}
+
+	if err := c.Outbound.validate(); err != nil {
+		return fmt.Errorf("outbound: %w", err)
+	}
+
+	for _, cidr := range c.EndpointSecurity.AllowedNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("endpoint_security allowed_networks: invalid CIDR %q", cidr)
+		}
+	}
+
+	recovery := c.RecoveryReplay
+	if recovery.UnhealthyAfter < 0 || recovery.MaxEvents < 0 || recovery.MaxWindowMinutes < 0 {
+		return fmt.Errorf("recovery_replay settings must not be negative")
+	}
+
+	if c.DNS.CacheTTLSeconds < 0 || c.DNS.RefreshSeconds < 0 {
+		return fmt.Errorf("dns cache_ttl_seconds and refresh_seconds must not be negative")
+	}
+	for host, addrs := range c.DNS.Overrides {
+		if len(addrs) == 0 {
+			return fmt.Errorf("dns override %s: at least one address is required", host)
+		}
+		for _, addr := range addrs {
+			if net.ParseIP(addr) == nil {
+				return fmt.Errorf("dns override %s: invalid IP address %q", host, addr)
+			}
+		}
+	}
+
+	for name, profile := range c.Anonymization.Profiles {
+		if profile.KeepDigits < 0 {
+			return fmt.Errorf("anonymization profile %s: keep_digits must not be negative", name)
+		}
+	}
+
+	if c.Isolation.Enabled {
+		if err := c.validateIsolation(); err != nil {
+			return err
+		}
+	}
+
+	if c.Server.Auth.Enabled {
+		if err := c.validateAuth(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.validateResidency(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// mergeRoutes combines routes sharing a domain into the first of them when duplicate_routes
+// is merge. Later routes may only add endpoints: any other setting is an error, since it
+// could not apply to the domain's events.
+func (c *Config) mergeRoutes() error {
+	if c.DuplicateRoutes != DuplicateRoutesMerge {
+		return nil
+	}
+
+	merged := make([]Route, 0, len(c.Routes))
+	index := make(map[string]int)
+	for i, route := range c.Routes {
+		first, ok := index[route.Domain]
+		if !ok {
+			index[route.Domain] = len(merged)
+			merged = append(merged, route)
+			continue
+		}
+
+		extra := route
+		extra.Domain, extra.Endpoints, extra.StaleEndpoints, extra.EndpointGroups = "", nil, nil, nil
+		if !reflect.DeepEqual(extra, Route{}) {
+			return fmt.Errorf("route %s: routes[%d] repeats the domain with settings other than endpoints, endpoint_groups and stale_endpoints, which cannot be merged", route.Domain, i)
+		}
+		target := &merged[first]
+		target.Endpoints = appendNewEndpoints(target.Endpoints, route.Endpoints)
+		target.EndpointGroups = append(target.EndpointGroups, route.EndpointGroups...)
+		target.StaleEndpoints = appendNewEndpoints(target.StaleEndpoints, route.StaleEndpoints)
+	}
+	c.Routes = merged
+	return nil
+}
+
+// appendNewEndpoints appends the endpoints not already in list
+func appendNewEndpoints(list, endpoints []Endpoint) []Endpoint {
+	for _, endpoint := range endpoints {
+		found := false
+		for _, existing := range list {
+			if existing.Name() == endpoint.Name() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, endpoint)
+		}
+	}
+	return list
+}
+
+// validateAuth checks API tokens when auth is enabled
+func (c *Config) validateAuth() error {
+	if c.Isolation.Enabled {
+		return fmt.Errorf("server auth cannot be combined with isolation, which has its own tenant tokens")
+	}
+
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for _, token := range c.Server.Auth.Tokens {
+		if token.Name == "" {
+			return fmt.Errorf("server auth: token name is required")
+		}
+		if names[token.Name] {
+			return fmt.Errorf("server auth: duplicate token name: %s", token.Name)
+		}
+		names[token.Name] = true
+
+		if token.Token == "" {
+			return fmt.Errorf("server auth token %s: token is required", token.Name)
+		}
+		if tokens[token.Token] || token.Token == c.Server.Auth.AdminToken {
+			return fmt.Errorf("server auth token %s: token must be unique", token.Name)
+		}
+		tokens[token.Token] = true
+
+		if len(token.Domains) == 0 {
+			return fmt.Errorf("server auth token %s: at least one domain is required", token.Name)
+		}
+	}
+
+	if c.Server.Auth.AdminToken == "" && len(c.Server.Auth.Tokens) == 0 {
+		return fmt.Errorf("server auth requires an admin_token or at least one token")
+	}
+
+	return nil
+}
+
+// validateIsolation checks tenant definitions when isolation mode is enabled
+func (c *Config) validateIsolation() error {
+	if len(c.Isolation.Tenants) == 0 {
+		return fmt.Errorf("isolation requires at least one tenant")
+	}
+
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	domainOwners := make(map[string]string)
+	for _, tenant := range c.Isolation.Tenants {
+		if !tenantNamePattern.MatchString(tenant.Name) {
+			return fmt.Errorf("tenant name %q must contain only letters, digits, '-' or '_'", tenant.Name)
+		}
+		if names[tenant.Name] {
+			return fmt.Errorf("duplicate tenant name: %s", tenant.Name)
+		}
+		names[tenant.Name] = true
+
+		if tenant.Token == "" {
+			return fmt.Errorf("tenant %s: token is required", tenant.Name)
+		}
+		if tokens[tenant.Token] || tenant.Token == c.Isolation.AdminToken {
+			return fmt.Errorf("tenant %s: token must be unique", tenant.Name)
+		}
+		tokens[tenant.Token] = true
+
+		if tenant.OpsURL != "" {
+			if err := c.validateEndpointURL(tenant.OpsURL); err != nil {
+				return fmt.Errorf("tenant %s: ops_url: %w", tenant.Name, err)
+			}
+		}
+
+		for _, domain := range tenant.Domains {
+			if owner, exists := domainOwners[domain]; exists {
+				return fmt.Errorf("domain %s is assigned to both tenant %s and %s", domain, owner, tenant.Name)
+			}
+			domainOwners[domain] = tenant.Name
+		}
+	}
+
+	if c.Isolation.OpsNotifications.CircuitFailures < 0 || c.Isolation.OpsNotifications.MinIntervalSeconds < 0 {
+		return fmt.Errorf("isolation.ops_notifications values must not be negative")
+	}
+
+	// Every routed domain must belong to a tenant, otherwise its events could not be ingested
+	for _, route := range c.Routes {
+		if _, ok := domainOwners[route.Domain]; !ok {
+			return fmt.Errorf("route domain %s is not assigned to any tenant", route.Domain)
+		}
+	}
+
+	return nil
+}
+
+// TenantForDomain returns the tenant owning the domain, or nil if none does
+func (c *Config) TenantForDomain(domain string) *Tenant {
+	for i := range c.Isolation.Tenants {
+		if c.Isolation.Tenants[i].HasDomain(domain) {
+			return &c.Isolation.Tenants[i]
+		}
+	}
+	return nil
+}
+
+// Hash returns a short fingerprint of the active configuration
+// Instances running identical configuration produce identical hashes
+func (c *Config) Hash() string {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// GetRoute returns the route for a given domain, or nil if none is configured
+func (c *Config) GetRoute(domain string) *Route {
+	for i := range c.Routes {
+		if c.Routes[i].Domain == domain {
+			return &c.Routes[i]
+		}
+	}
+	return nil
+}
+
+// RouteFor returns the route that forwards the events of a domain: its route, or the default
+// route if no route has the domain (nil without default_route)
+func (c *Config) RouteFor(domain string) *Route {
+	if route := c.GetRoute(domain); route != nil {
+		return route
+	}
+	return c.DefaultRoute
+}
+
+// DefaultRouteName names the default route where routes are listed by domain, e.g. in
+// validation errors and the preflight report
+const DefaultRouteName = "default_route"
+
+// AllRoutes returns the routes, followed by the default route (named DefaultRouteName) if set
+func (c *Config) AllRoutes() []Route {
+	if c.DefaultRoute == nil {
+		return c.Routes
+	}
+	route := *c.DefaultRoute
+	route.Domain = DefaultRouteName
+	return append(c.Routes[:len(c.Routes):len(c.Routes)], route)
 }
 
 // GetEndpoints returns the list of endpoints for a given domain
-func (c *Config) GetEndpoints(domain string) []string {
+func (c *Config) GetEndpoints(domain string) []Endpoint {
 	for _, route := range c.Routes {
 		if route.Domain == domain {
 			return route.Endpoints
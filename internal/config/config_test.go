@@ -0,0 +1,26 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// Fallback endpoints are tried one after another once the endpoints failed, so the
+// endpoint's timeout plus theirs must fit in ack_wait
+func TestFallbackTimeoutsCheckedAgainstAckWait(t *testing.T) {
+	const route = `
+nats: {url: "nats://localhost:4222", stream_name: CALL_EVENTS, subject_pattern: "events.>", ack_wait_seconds: 10, max_deliveries: 5}
+server: {port: 8080}
+routes:
+  - domain: tenant1.example.com
+    timeout_ms: 4000
+    endpoints: ["https://tenant1-eu.example.com/events"]
+    fallback_endpoints: `
+	if _, err := Parse([]byte(route + `["https://tenant1-us.example.com/events"]`)); err != nil {
+		t.Fatalf("4s endpoint plus a 4s fallback rejected with a 10s ack_wait: %v", err)
+	}
+	_, err := Parse([]byte(route + `["https://tenant1-us.example.com/events", "https://tenant1-ap.example.com/events"]`))
+	if err == nil || !strings.Contains(err.Error(), "fallback_endpoints") {
+		t.Fatalf("4s endpoint plus 8s of fallbacks with a 10s ack_wait: got %v, want a fallback_endpoints error", err)
+	}
+}
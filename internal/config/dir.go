@@ -0,0 +1,197 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RejectedFile is a file of the config directory whose routes could not be loaded
+type RejectedFile struct {
+	File  string // Name in the directory
+	Error string
+	Kept  bool // The routes of the version loaded before are used instead
+}
+
+// LoadDir loads the configuration file at path like Load, adding the routes of the *.yaml
+// and *.json files of dir (conf.d style, e.g. one file per tenant team) if dir is not empty. The files
+// hold only routes. A file that does not parse, or whose routes do not validate together
+// with the others (e.g. a domain already routed by another file), is rejected without
+// affecting the other files and listed in Rejected. If previous, the configuration being
+// replaced, loaded another version of a rejected file, that version is kept.
+func LoadDir(path, dir string, previous *Config) (*Config, error) {
+	data, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return Parse(data)
+	}
+
+	doc, err := parseDocument(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ConfigSource.Enabled() {
+		return nil, fmt.Errorf("invalid configuration: routes cannot be loaded from both config_source and a config directory")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && IsDirFile(name) {
+			names = append(names, name)
+		}
+	}
+	var loaded map[string][]byte
+	if previous != nil {
+		loaded = previous.dirFiles
+	}
+	contents := make(map[string][]byte, len(names))
+	readErrors := make(map[string]error)
+	for _, name := range names {
+		contents[name], readErrors[name] = ReadFile(filepath.Join(dir, name))
+	}
+	// Unchanged files are checked first, so a changed file cannot take their domains
+	unchanged := func(name string) bool {
+		old, ok := loaded[name]
+		return ok && readErrors[name] == nil && bytes.Equal(old, contents[name])
+	}
+	order := append([]string(nil), names...)
+	sort.SliceStable(order, func(i, j int) bool {
+		return unchanged(order[i]) && !unchanged(order[j])
+	})
+
+	routes := routesNode(doc)
+	base := routes.Content
+	accepted := base
+	files := make(map[string][]byte)
+	added := make(map[string][]*yaml.Node)
+	add := func(name string, content []byte) error {
+		nodes, err := parseRoutesFile(content)
+		if err != nil {
+			return err
+		}
+		routes.Content = append(accepted[:len(accepted):len(accepted)], nodes...)
+		if _, err := decode(doc); err != nil {
+			routes.Content = accepted
+			return err
+		}
+		accepted = routes.Content
+		files[name] = content
+		added[name] = nodes
+		return nil
+	}
+
+	var rejected []RejectedFile
+	for _, name := range order {
+		err := readErrors[name]
+		if err == nil {
+			err = add(name, contents[name])
+		}
+		if err == nil {
+			continue
+		}
+		rejection := RejectedFile{File: name, Error: err.Error()}
+		if old, ok := loaded[name]; ok && !unchanged(name) {
+			rejection.Kept = add(name, old) == nil
+		}
+		rejected = append(rejected, rejection)
+	}
+
+	// The routes are in file name order, whatever order they were checked in
+	owners := make(map[string]string)
+	routes.Content = base
+	for _, name := range names {
+		for _, node := range added[name] {
+			var route struct {
+				Domain string `yaml:"domain"`
+			}
+			node.Decode(&route)
+			if cfg.GetRoute(route.Domain) == nil && owners[route.Domain] == "" {
+				owners[route.Domain] = name
+			}
+		}
+		routes.Content = append(routes.Content, added[name]...)
+	}
+	if cfg, err = decode(doc); err != nil {
+		return nil, err
+	}
+	for i := range cfg.Routes {
+		cfg.Routes[i].File = owners[cfg.Routes[i].Domain]
+	}
+	cfg.Rejected = rejected
+	cfg.dirFiles = files
+	return cfg, nil
+}
+
+// IsDirFile reports whether a file of a config directory, by its name, holds routes: a
+// YAML or JSON file that is not hidden (e.g. an editor's swap file)
+func IsDirFile(name string) bool {
+	ext := filepath.Ext(name)
+	return (ext == ".yaml" || ext == ".json") && !strings.HasPrefix(name, ".")
+}
+
+// RejectedError returns the rejected config directory files as an error, or nil if none was
+func (c *Config) RejectedError() error {
+	if len(c.Rejected) == 0 {
+		return nil
+	}
+	files := make([]string, len(c.Rejected))
+	for i, rejected := range c.Rejected {
+		files[i] = rejected.File + ": " + rejected.Error
+	}
+	return fmt.Errorf("rejected config directory files: %s", strings.Join(files, "; "))
+}
+
+// parseRoutesFile parses a config directory file into its route nodes
+func parseRoutesFile(content []byte) ([]*yaml.Node, error) {
+	node, err := parseRoutesDocument(content, "a config directory file")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case node.Kind == yaml.SequenceNode:
+		return node.Content, nil
+	case node.Tag == "!!null":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("line %d: routes must be a list", node.Line)
+}
+
+// routesNode returns the routes list of a decoded configuration document, adding it if
+// the file has none
+func routesNode(doc *yaml.Node) *yaml.Node {
+	routes := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "routes" {
+			continue
+		}
+		if root.Content[i+1].Kind == yaml.SequenceNode {
+			return root.Content[i+1]
+		}
+		// routes: with no value
+		root.Content[i+1] = routes
+		return routes
+	}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "routes"}, routes)
+	return routes
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Errors of the route edits of a configuration file
+var (
+	ErrRouteExists     = errors.New("route already exists")
+	ErrRouteNotFound   = errors.New("route not found")
+	ErrRouteDuplicated = errors.New("route is defined by several entries of routes")
+)
+
+// AddRoute appends a route to the routes of a configuration file. route is the route's
+// mapping in YAML or JSON; the rest of the file, comments included, is kept.
+func AddRoute(data, route []byte) ([]byte, error) {
+	return editRoutes(data, func(routes *yaml.Node) error {
+		node, domain, err := parseRoute(route)
+		if err != nil {
+			return err
+		}
+		if len(findRoutes(routes, domain)) > 0 {
+			return fmt.Errorf("%w: %s", ErrRouteExists, domain)
+		}
+		routes.Content = append(routes.Content, node)
+		return nil
+	})
+}
+
+// ReplaceRoute replaces the route of a domain in a configuration file (see AddRoute). The
+// new route may change the domain, unless another route has it.
+func ReplaceRoute(data []byte, domain string, route []byte) ([]byte, error) {
+	return editRoutes(data, func(routes *yaml.Node) error {
+		node, newDomain, err := parseRoute(route)
+		if err != nil {
+			return err
+		}
+		i, err := findRoute(routes, domain)
+		if err != nil {
+			return err
+		}
+		if newDomain != domain && len(findRoutes(routes, newDomain)) > 0 {
+			return fmt.Errorf("%w: %s", ErrRouteExists, newDomain)
+		}
+		// Comments of the entry stay with it
+		old := routes.Content[i]
+		node.HeadComment, node.LineComment, node.FootComment = old.HeadComment, old.LineComment, old.FootComment
+		routes.Content[i] = node
+		return nil
+	})
+}
+
+// DeleteRoute removes the route of a domain from a configuration file
+func DeleteRoute(data []byte, domain string) ([]byte, error) {
+	return editRoutes(data, func(routes *yaml.Node) error {
+		i, err := findRoute(routes, domain)
+		if err != nil {
+			return err
+		}
+		routes.Content = append(routes.Content[:i], routes.Content[i+1:]...)
+		return nil
+	})
+}
+
+// editRoutes applies edit to the routes sequence of a configuration file (created if the
+// file has none) and returns the edited file
+func editRoutes(data []byte, edit func(routes *yaml.Node) error) ([]byte, error) {
+	if err := checkJSON(data); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if doc.Kind != yaml.DocumentNode || root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file is not a YAML or JSON mapping")
+	}
+
+	var routes *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "routes" {
+			routes = root.Content[i+1]
+			break
+		}
+	}
+	if routes == nil || (routes.Kind == yaml.ScalarNode && routes.Tag == "!!null") {
+		if routes == nil {
+			routes = &yaml.Node{}
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "routes"}, routes)
+		}
+		*routes = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+	if routes.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("routes is not a list")
+	}
+	if err := edit(routes); err != nil {
+		return nil, err
+	}
+
+	// A JSON file stays JSON, e.g. for the provisioning that generates it
+	if isJSON(data) {
+		return encodeJSON(&doc)
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseRoute parses a route mapping into a block-style node and returns its domain
+func parseRoute(route []byte) (*yaml.Node, string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(route, &doc); err != nil {
+		return nil, "", fmt.Errorf("invalid route: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, "", fmt.Errorf("invalid route: not an object")
+	}
+	node := doc.Content[0]
+	blockStyle(node)
+	domain := ""
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "domain" {
+			domain = node.Content[i+1].Value
+		}
+	}
+	if domain == "" {
+		return nil, "", fmt.Errorf("invalid route: domain is required")
+	}
+	return node, domain, nil
+}
+
+// blockStyle clears the flow style of JSON input, so it is written like the rest of the file
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// findRoute returns the index of a domain's only route entry
+func findRoute(routes *yaml.Node, domain string) (int, error) {
+	found := findRoutes(routes, domain)
+	switch len(found) {
+	case 0:
+		return 0, fmt.Errorf("%w: %s", ErrRouteNotFound, domain)
+	case 1:
+		return found[0], nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrRouteDuplicated, domain)
+	}
+}
+
+// findRoutes returns the indexes of a domain's route entries
+func findRoutes(routes *yaml.Node, domain string) []int {
+	var found []int
+	for i, entry := range routes.Content {
+		if entry.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(entry.Content); j += 2 {
+			if entry.Content[j].Value == "domain" && entry.Content[j+1].Value == domain {
+				found = append(found, i)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// WriteFile replaces a configuration file atomically with plaintext, encrypted with the
+// key from the environment if the file was encrypted
+func WriteFile(path string, plaintext []byte) error {
+	// Replace the file a symlink points at, not the symlink
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	data := plaintext
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if IsEncrypted(current) {
+		key, err := ConfigKey()
+		if err != nil {
+			return err
+		}
+		if data, err = Encrypt(plaintext, key); err != nil {
+			return err
+		}
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
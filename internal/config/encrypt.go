@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Encrypted configuration files start with this line, followed by the base64 of the
+// AES-256-GCM nonce and ciphertext. They are decrypted in memory when loaded.
+const encryptedHeader = "# event-hub encrypted config v1\n"
+
+// Environment variables holding the config encryption key (base64 of 32 bytes), directly
+// or in a file (e.g. written by a KMS or secrets agent, or a systemd credential)
+const (
+	ConfigKeyEnv     = "EVENT_HUB_CONFIG_KEY"
+	ConfigKeyFileEnv = "EVENT_HUB_CONFIG_KEY_FILE"
+)
+
+// ReadFile reads a configuration file, decrypting it if it is encrypted
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	key, err := ConfigKey()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := Decrypt(data, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt config file: %w", err)
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted reports whether configuration data was produced by Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedHeader))
+}
+
+// ConfigKey returns the config encryption key from the environment
+func ConfigKey() ([]byte, error) {
+	encoded := os.Getenv(ConfigKeyEnv)
+	if path := os.Getenv(ConfigKeyFileEnv); encoded == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config key file: %w", err)
+		}
+		encoded = string(data)
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("config file is encrypted but neither %s nor %s is set", ConfigKeyEnv, ConfigKeyFileEnv)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("config key must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+// Encrypt encrypts configuration data with a 32-byte key
+func Encrypt(plaintext, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(encryptedHeader))
+
+	var out bytes.Buffer
+	out.WriteString(encryptedHeader)
+	encoded := base64.StdEncoding.EncodeToString(sealed)
+	for len(encoded) > 76 {
+		out.WriteString(encoded[:76] + "\n")
+		encoded = encoded[76:]
+	}
+	out.WriteString(encoded + "\n")
+	return out.Bytes(), nil
+}
+
+// Decrypt decrypts data produced by Encrypt
+func Decrypt(data, key []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, errors.New("not an encrypted config file")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	body := strings.Join(strings.Fields(string(data[len(encryptedHeader):])), "")
+	sealed, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encoding: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("file too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(encryptedHeader))
+	if err != nil {
+		return nil, errors.New("wrong key or corrupted file")
+	}
+	return plaintext, nil
+}
+
+// newGCM creates an AES-256-GCM cipher
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("config key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,619 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"calleventhub/internal/transform"
+)
+
+// Endpoint types
+const (
+	EndpointHTTP      = "http"
+	EndpointMQTT      = "mqtt"
+	EndpointEventHubs = "eventhubs"
+	EndpointRedis     = "redis"
+	EndpointFile      = "file"
+)
+
+// Endpoint is a forwarding destination. In YAML it is either a plain URL string
+// (HTTP webhook, the original format) or a mapping with a type and the
+// settings of that sink type:
+//
+//	endpoints:
+//	  - "https://backend.example.com/webhook"
+//	  - type: mqtt
+//	    broker: "ssl://broker.example.com:8883"
+//	    topic: "pbx/{domain}/{state}"
+//	  - url: "https://standby.example.com/webhook"
+//	    disabled: true
+//	  - url: "https://crm.example.com/webhook"
+//	    timeout_ms: 10000
+//
+// Every mapping may set disabled and weight; HTTP and Event Hubs endpoints also timeout_ms.
+type Endpoint struct {
+	Type      string
+	URL       string         // http
+	MQTT      *MQTTSink      // mqtt
+	EventHubs *EventHubsSink // eventhubs
+	Redis     *RedisSink     // redis
+	File      *FileSink      // file
+
+	Disabled  bool // Out of rotation: receives no events
+	Weight    int  // Percentage of the route's events it receives, sampled per call_id (0 = all); its share in load_balance mode
+	TimeoutMs int  // Request timeout of HTTP-based endpoints (0 = the route's timeout_ms)
+}
+
+// endpointState holds the rotation and timeout settings shared by all endpoint types
+type endpointState struct {
+	Disabled  bool `yaml:"disabled,omitempty" json:"disabled,omitempty"`
+	Weight    int  `yaml:"weight,omitempty" json:"weight,omitempty"`
+	TimeoutMs int  `yaml:"timeout_ms,omitempty" json:"timeout_ms,omitempty"`
+}
+
+// Receives reports whether the endpoint gets an event of the given call
+func (e Endpoint) Receives(callID string, eventJSON []byte) bool {
+	if e.Disabled {
+		return false
+	}
+	if e.Weight <= 0 || e.Weight >= 100 {
+		return true
+	}
+	key := []byte(callID)
+	if callID == "" {
+		key = eventJSON
+	}
+	sum := sha256.Sum256(append([]byte(e.Name()+"\x00"), key...))
+	return binary.BigEndian.Uint64(sum[:8])%100 < uint64(e.Weight)
+}
+
+// BalanceWeight is the endpoint's relative share of the events of a load_balance route
+// (weight 0 counts as 1)
+func (e Endpoint) BalanceWeight() int {
+	if e.Weight <= 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+// DefaultTimeoutMs is the request timeout of HTTP-based endpoints that set no timeout_ms
+const DefaultTimeoutMs = 3000
+
+// Timeout returns the request timeout of the endpoint: its timeout_ms, else routeTimeoutMs
+// (the route's timeout_ms), else DefaultTimeoutMs
+func (e Endpoint) Timeout(routeTimeoutMs int) time.Duration {
+	ms := e.TimeoutMs
+	if ms == 0 {
+		ms = routeTimeoutMs
+	}
+	if ms == 0 {
+		ms = DefaultTimeoutMs
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// hasTimeout reports whether the endpoint type honors timeout_ms
+func (e Endpoint) hasTimeout() bool {
+	return e.Type == "" || e.Type == EndpointHTTP || e.Type == EndpointEventHubs
+}
+
+// state returns the rotation and timeout settings of the endpoint
+func (e Endpoint) state() endpointState {
+	return endpointState{Disabled: e.Disabled, Weight: e.Weight, TimeoutMs: e.TimeoutMs}
+}
+
+// sinkSettings is implemented by the settings of non-HTTP endpoint types
+type sinkSettings interface {
+	name() string
+	validate() error
+	address() string        // URL whose host is checked against endpoint_security
+	redacted() sinkSettings // Copy without credentials, for API output
+}
+
+// MQTTSink publishes events to an MQTT broker
+type MQTTSink struct {
+	Broker   string     `yaml:"broker" json:"broker"`                         // e.g. tcp://broker:1883, ssl://broker:8883
+	Topic    string     `yaml:"topic" json:"topic"`                           // Template: {domain}, {call_id}, {state}, {status}, {direction}
+	QoS      byte       `yaml:"qos" json:"qos"`                               // 0, 1 or 2
+	Retained bool       `yaml:"retained,omitempty" json:"retained,omitempty"` // Publish with the retain flag
+	ClientID string     `yaml:"client_id,omitempty" json:"client_id,omitempty"`
+	Username string     `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string     `yaml:"password,omitempty" json:"password,omitempty"`
+	TLS      *TLSConfig `yaml:"tls,omitempty" json:"tls,omitempty"`
+}
+
+// TLSConfig holds client TLS settings for non-HTTP sinks
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty" json:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
+}
+
+// Name identifies the endpoint in logs, the event store and the API (never includes credentials)
+func (e Endpoint) Name() string {
+	if sink := e.sink(); sink != nil {
+		return sink.name()
+	}
+	return e.URL
+}
+
+// Address returns the URL the endpoint connects to (its URL for HTTP, e.g. the broker for
+// MQTT), or "" for a file sink without SFTP upload
+func (e Endpoint) Address() string {
+	if sink := e.sink(); sink != nil {
+		return sink.address()
+	}
+	return e.URL
+}
+
+// sink returns the settings of a non-HTTP endpoint, or nil for HTTP
+func (e *Endpoint) sink() sinkSettings {
+	switch e.Type {
+	case EndpointMQTT:
+		return e.MQTT
+	case EndpointEventHubs:
+		return e.EventHubs
+	case EndpointRedis:
+		return e.Redis
+	case EndpointFile:
+		return e.File
+	}
+	return nil
+}
+
+// newSink allocates the settings for a sink type and attaches them to e
+func (e *Endpoint) newSink(sinkType string) (sinkSettings, error) {
+	*e = Endpoint{Type: sinkType}
+	switch sinkType {
+	case EndpointMQTT:
+		e.MQTT = &MQTTSink{}
+	case EndpointEventHubs:
+		e.EventHubs = &EventHubsSink{}
+	case EndpointRedis:
+		e.Redis = &RedisSink{}
+	case EndpointFile:
+		e.File = &FileSink{}
+	default:
+		return nil, fmt.Errorf("unknown endpoint type %q", sinkType)
+	}
+	return e.sink(), nil
+}
+
+// UnmarshalYAML accepts a URL string or a typed mapping
+func (e *Endpoint) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*e = Endpoint{Type: EndpointHTTP, URL: node.Value}
+		return nil
+	}
+
+	var header struct {
+		Type          string `yaml:"type"`
+		URL           string `yaml:"url"`
+		endpointState `yaml:",inline"`
+	}
+	if err := node.Decode(&header); err != nil {
+		return err
+	}
+
+	if header.Type == "" || header.Type == EndpointHTTP {
+		*e = Endpoint{Type: EndpointHTTP, URL: header.URL}
+	} else {
+		sink, err := e.newSink(header.Type)
+		if err != nil {
+			return err
+		}
+		if err := node.Decode(&typedSink{Type: header.Type, Sink: sink}); err != nil {
+			return err
+		}
+	}
+	e.Disabled, e.Weight, e.TimeoutMs = header.Disabled, header.Weight, header.TimeoutMs
+	return nil
+}
+
+// MarshalYAML writes HTTP endpoints as plain URLs and other sinks as typed mappings
+// (HTTP endpoints out of rotation or weighted as a mapping with a url)
+func (e Endpoint) MarshalYAML() (interface{}, error) {
+	if sink := e.sink(); sink != nil {
+		return typedSink{Type: e.Type, Sink: sink, State: e.state()}, nil
+	}
+	if e.state() != (endpointState{}) {
+		return struct {
+			URL           string `yaml:"url"`
+			endpointState `yaml:",inline"`
+		}{e.URL, e.state()}, nil
+	}
+	return e.URL, nil
+}
+
+// MarshalJSON mirrors MarshalYAML; credentials are omitted
+func (e Endpoint) MarshalJSON() ([]byte, error) {
+	sink := e.sink()
+	if sink == nil {
+		if e.state() == (endpointState{}) {
+			return json.Marshal(e.URL)
+		}
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			URL  string `json:"url"`
+			endpointState
+		}{e.Type, e.URL, e.state()})
+	}
+
+	data, err := json.Marshal(sink.redacted())
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["type"], _ = json.Marshal(e.Type)
+	if e.Disabled {
+		fields["disabled"], _ = json.Marshal(true)
+	}
+	if e.Weight != 0 {
+		fields["weight"], _ = json.Marshal(e.Weight)
+	}
+	if e.TimeoutMs != 0 {
+		fields["timeout_ms"], _ = json.Marshal(e.TimeoutMs)
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON accepts a URL string or a typed object (credentials included)
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		*e = Endpoint{Type: EndpointHTTP, URL: raw}
+		return nil
+	}
+
+	var header struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+		endpointState
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+
+	if header.Type == "" || header.Type == EndpointHTTP {
+		*e = Endpoint{Type: EndpointHTTP, URL: header.URL}
+	} else {
+		sink, err := e.newSink(header.Type)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, sink); err != nil {
+			return err
+		}
+	}
+	e.Disabled, e.Weight, e.TimeoutMs = header.Disabled, header.Weight, header.TimeoutMs
+	return nil
+}
+
+// typedSink (de)serializes a sink's settings inline next to its type
+type typedSink struct {
+	Type  string
+	Sink  interface{}
+	State endpointState // Written after the settings; read by Endpoint.UnmarshalYAML
+}
+
+func (t typedSink) MarshalYAML() (interface{}, error) {
+	var node yaml.Node
+	if err := node.Encode(t.Sink); err != nil {
+		return nil, err
+	}
+	typeKey := &yaml.Node{Kind: yaml.ScalarNode, Value: "type"}
+	typeValue := &yaml.Node{Kind: yaml.ScalarNode, Value: t.Type}
+	node.Content = append([]*yaml.Node{typeKey, typeValue}, node.Content...)
+	if t.State != (endpointState{}) {
+		var state yaml.Node
+		if err := state.Encode(t.State); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, state.Content...)
+	}
+	return &node, nil
+}
+
+func (t *typedSink) UnmarshalYAML(node *yaml.Node) error {
+	// Drop the type and rotation keys, which are not part of the sink settings
+	stripped := *node
+	stripped.Content = nil
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		switch node.Content[i].Value {
+		case "type", "disabled", "weight", "timeout_ms":
+			continue
+		}
+		stripped.Content = append(stripped.Content, node.Content[i], node.Content[i+1])
+	}
+	return stripped.Decode(t.Sink)
+}
+
+func (s *MQTTSink) name() string {
+	return fmt.Sprintf("mqtt:%s/%s", strings.TrimSuffix(s.Broker, "/"), s.Topic)
+}
+
+func (s *MQTTSink) address() string {
+	return s.Broker
+}
+
+func (s *MQTTSink) redacted() sinkSettings {
+	c := *s
+	c.Password = ""
+	return &c
+}
+
+// validate checks an MQTT sink's settings
+func (s *MQTTSink) validate() error {
+	if s.Broker == "" {
+		return fmt.Errorf("mqtt endpoint requires broker")
+	}
+	u, err := url.Parse(s.Broker)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("mqtt broker %q must be a URL like tcp://host:1883", s.Broker)
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+	default:
+		return fmt.Errorf("mqtt broker %q has unsupported scheme %q", s.Broker, u.Scheme)
+	}
+	if s.Topic == "" {
+		return fmt.Errorf("mqtt endpoint requires topic")
+	}
+	if _, err := transform.Parse(s.Topic); err != nil {
+		return fmt.Errorf("mqtt topic: %w", err)
+	}
+	if s.QoS > 2 {
+		return fmt.Errorf("mqtt qos must be 0, 1 or 2")
+	}
+	return nil
+}
+
+// EventHubsSink sends events to an Azure Event Hub. Authenticate with either a
+// SAS connection string or Azure AD client credentials (namespace + event_hub).
+type EventHubsSink struct {
+	ConnectionString string `yaml:"connection_string,omitempty" json:"connection_string,omitempty"` // Endpoint=sb://...;SharedAccessKeyName=...;SharedAccessKey=...[;EntityPath=...]
+	Namespace        string `yaml:"namespace,omitempty" json:"namespace,omitempty"`                 // e.g. myns.servicebus.windows.net
+	EventHub         string `yaml:"event_hub,omitempty" json:"event_hub,omitempty"`                 // Required unless the connection string has EntityPath
+	TenantID         string `yaml:"tenant_id,omitempty" json:"tenant_id,omitempty"`                 // Azure AD auth
+	ClientID         string `yaml:"client_id,omitempty" json:"client_id,omitempty"`
+	ClientSecret     string `yaml:"client_secret,omitempty" json:"client_secret,omitempty"`
+	PartitionKey     string `yaml:"partition_key,omitempty" json:"partition_key,omitempty"` // Template, default "{call_id}"
+}
+
+// Target returns the namespace host and event hub name
+func (s *EventHubsSink) Target() (namespace, hub string) {
+	namespace, hub = s.Namespace, s.EventHub
+	if s.ConnectionString != "" {
+		parts := parseConnectionString(s.ConnectionString)
+		if endpoint, err := url.Parse(parts["Endpoint"]); err == nil && endpoint.Host != "" {
+			namespace = endpoint.Host
+		}
+		if hub == "" {
+			hub = parts["EntityPath"]
+		}
+	}
+	return namespace, hub
+}
+
+// SharedAccessKey returns the key name and key of the connection string ("" when using Azure AD)
+func (s *EventHubsSink) SharedAccessKey() (keyName, key string) {
+	parts := parseConnectionString(s.ConnectionString)
+	return parts["SharedAccessKeyName"], parts["SharedAccessKey"]
+}
+
+func (s *EventHubsSink) name() string {
+	namespace, hub := s.Target()
+	return fmt.Sprintf("eventhubs:%s/%s", namespace, hub)
+}
+
+func (s *EventHubsSink) address() string {
+	namespace, _ := s.Target()
+	return "https://" + namespace
+}
+
+func (s *EventHubsSink) redacted() sinkSettings {
+	c := *s
+	c.ClientSecret = ""
+	if c.ConnectionString != "" {
+		// Keep the target visible, drop the key
+		namespace, hub := s.Target()
+		c.ConnectionString = ""
+		c.Namespace, c.EventHub = namespace, hub
+	}
+	return &c
+}
+
+// validate checks an Event Hubs sink's settings
+func (s *EventHubsSink) validate() error {
+	if s.ConnectionString != "" {
+		if s.TenantID != "" || s.ClientID != "" || s.ClientSecret != "" {
+			return fmt.Errorf("eventhubs endpoint: use either connection_string or tenant_id/client_id/client_secret")
+		}
+		keyName, key := s.SharedAccessKey()
+		if keyName == "" || key == "" {
+			return fmt.Errorf("eventhubs connection_string requires SharedAccessKeyName and SharedAccessKey")
+		}
+	} else if s.TenantID == "" || s.ClientID == "" || s.ClientSecret == "" {
+		return fmt.Errorf("eventhubs endpoint requires connection_string or tenant_id, client_id and client_secret")
+	}
+
+	namespace, hub := s.Target()
+	if namespace == "" {
+		return fmt.Errorf("eventhubs endpoint requires namespace (or Endpoint in the connection string)")
+	}
+	if hub == "" {
+		return fmt.Errorf("eventhubs endpoint requires event_hub (or EntityPath in the connection string)")
+	}
+	if _, err := transform.Parse(s.PartitionKey); err != nil {
+		return fmt.Errorf("eventhubs partition_key: %w", err)
+	}
+	return nil
+}
+
+// parseConnectionString splits "Key=Value;Key=Value" (values may contain '=')
+func parseConnectionString(connectionString string) map[string]string {
+	parts := make(map[string]string)
+	for _, part := range strings.Split(connectionString, ";") {
+		if key, value, ok := strings.Cut(part, "="); ok {
+			parts[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return parts
+}
+
+// RedisSink appends events to a Redis stream (XADD) so lightweight consumers
+// can read them with consumer groups
+type RedisSink struct {
+	Address  string     `yaml:"address" json:"address"`                   // host:port
+	Stream   string     `yaml:"stream" json:"stream"`                     // Template, e.g. "calls:{domain}"
+	MaxLen   int64      `yaml:"maxlen,omitempty" json:"maxlen,omitempty"` // Approximate stream length cap (0 = unbounded)
+	DB       int        `yaml:"db,omitempty" json:"db,omitempty"`
+	Username string     `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string     `yaml:"password,omitempty" json:"password,omitempty"`
+	TLS      *TLSConfig `yaml:"tls,omitempty" json:"tls,omitempty"`
+}
+
+func (s *RedisSink) name() string {
+	return fmt.Sprintf("redis:%s/%s", s.Address, s.Stream)
+}
+
+func (s *RedisSink) address() string {
+	return "redis://" + s.Address
+}
+
+func (s *RedisSink) redacted() sinkSettings {
+	c := *s
+	c.Password = ""
+	return &c
+}
+
+// validate checks a Redis sink's settings
+func (s *RedisSink) validate() error {
+	if _, _, err := net.SplitHostPort(s.Address); err != nil {
+		return fmt.Errorf("redis address %q must be host:port", s.Address)
+	}
+	if s.Stream == "" {
+		return fmt.Errorf("redis endpoint requires stream")
+	}
+	if _, err := transform.Parse(s.Stream); err != nil {
+		return fmt.Errorf("redis stream: %w", err)
+	}
+	if s.MaxLen < 0 || s.DB < 0 {
+		return fmt.Errorf("redis maxlen and db must not be negative")
+	}
+	return nil
+}
+
+// FileSink appends events to rotating NDJSON or CSV files in a local directory
+// and, if sftp is set, periodically uploads completed files (file-drop integrations)
+type FileSink struct {
+	Directory             string      `yaml:"directory" json:"directory"`
+	Format                string      `yaml:"format,omitempty" json:"format,omitempty"`                                   // ndjson (default) or csv
+	FileName              string      `yaml:"file_name,omitempty" json:"file_name,omitempty"`                             // Template, default "events-{domain}"
+	Rotate                string      `yaml:"rotate,omitempty" json:"rotate,omitempty"`                                   // daily (default) or hourly
+	MaxFileBytes          int64       `yaml:"max_file_bytes,omitempty" json:"max_file_bytes,omitempty"`                   // Also rotate at this size (0 = no limit)
+	CSVColumns            []string    `yaml:"csv_columns,omitempty" json:"csv_columns,omitempty"`                         // Event fields written as CSV columns
+	UploadIntervalSeconds int         `yaml:"upload_interval_seconds,omitempty" json:"upload_interval_seconds,omitempty"` // How often completed files are uploaded (default 300)
+	KeepUploaded          bool        `yaml:"keep_uploaded,omitempty" json:"keep_uploaded,omitempty"`                     // Move uploaded files to uploaded/ instead of deleting them
+	SFTP                  *SFTPTarget `yaml:"sftp,omitempty" json:"sftp,omitempty"`
+}
+
+// SFTPTarget is the destination completed files are uploaded to
+type SFTPTarget struct {
+	Address               string `yaml:"address" json:"address"` // host:port
+	Username              string `yaml:"username" json:"username"`
+	Password              string `yaml:"password,omitempty" json:"password,omitempty"`
+	PrivateKeyFile        string `yaml:"private_key_file,omitempty" json:"private_key_file,omitempty"`
+	HostKey               string `yaml:"host_key,omitempty" json:"host_key,omitempty"` // Server public key, e.g. "ssh-ed25519 AAAA..."
+	InsecureIgnoreHostKey bool   `yaml:"insecure_ignore_host_key,omitempty" json:"insecure_ignore_host_key,omitempty"`
+	RemoteDirectory       string `yaml:"remote_directory" json:"remote_directory"`
+}
+
+// DefaultCSVColumns are written when a csv file sink sets no csv_columns
+var DefaultCSVColumns = []string{"call_id", "domain", "direction", "state", "status", "from_number", "to_number", "time_started", "time_ended", "duration"}
+
+func (s *FileSink) name() string {
+	name := "file:" + s.Directory
+	if s.SFTP != nil {
+		name += " -> sftp://" + s.SFTP.Address + s.SFTP.RemoteDirectory
+	}
+	return name
+}
+
+func (s *FileSink) address() string {
+	if s.SFTP == nil {
+		return ""
+	}
+	return "sftp://" + s.SFTP.Address
+}
+
+func (s *FileSink) redacted() sinkSettings {
+	c := *s
+	if s.SFTP != nil {
+		target := *s.SFTP
+		target.Password = ""
+		c.SFTP = &target
+	}
+	return &c
+}
+
+// sameUpload reports whether two file sinks upload their directory the same way
+func (s *FileSink) sameUpload(other *FileSink) bool {
+	if s.UploadIntervalSeconds != other.UploadIntervalSeconds || s.KeepUploaded != other.KeepUploaded {
+		return false
+	}
+	if s.SFTP == nil || other.SFTP == nil {
+		return s.SFTP == other.SFTP
+	}
+	return *s.SFTP == *other.SFTP
+}
+
+// validate checks a file sink's settings
+func (s *FileSink) validate() error {
+	if s.Directory == "" {
+		return fmt.Errorf("file endpoint requires directory")
+	}
+	switch s.Format {
+	case "", "ndjson", "csv":
+	default:
+		return fmt.Errorf("file endpoint format must be ndjson or csv, got %q", s.Format)
+	}
+	switch s.Rotate {
+	case "", "daily", "hourly":
+	default:
+		return fmt.Errorf("file endpoint rotate must be daily or hourly, got %q", s.Rotate)
+	}
+	if _, err := transform.Parse(s.FileName); err != nil {
+		return fmt.Errorf("file endpoint file_name: %w", err)
+	}
+	if s.MaxFileBytes < 0 || s.UploadIntervalSeconds < 0 {
+		return fmt.Errorf("file endpoint max_file_bytes and upload_interval_seconds must not be negative")
+	}
+	if s.SFTP != nil {
+		if _, _, err := net.SplitHostPort(s.SFTP.Address); err != nil {
+			return fmt.Errorf("sftp address %q must be host:port", s.SFTP.Address)
+		}
+		if s.SFTP.Username == "" {
+			return fmt.Errorf("sftp username is required")
+		}
+		if s.SFTP.Password == "" && s.SFTP.PrivateKeyFile == "" {
+			return fmt.Errorf("sftp requires password or private_key_file")
+		}
+		if s.SFTP.HostKey == "" && !s.SFTP.InsecureIgnoreHostKey {
+			return fmt.Errorf("sftp requires host_key (or insecure_ignore_host_key: true)")
+		}
+	}
+	return nil
+}
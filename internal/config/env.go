@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReference matches ${NAME} and ${NAME:-default} in configuration values, and the
+// escaped $${
+var envReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces the environment variable references in the values of a parsed
+// configuration file, so one file serves every environment and secrets can stay out of it.
+// ${NAME:-default} uses default if NAME is unset or empty; ${NAME} must be set.
+func expandEnv(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		// Keys are not expanded
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := expandEnv(node.Content[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := expandEnv(child); err != nil {
+			return err
+		}
+	}
+	if node.Kind != yaml.ScalarNode || !envReference.MatchString(node.Value) {
+		return nil
+	}
+
+	var err error
+	node.Value = envReference.ReplaceAllStringFunc(node.Value, func(reference string) string {
+		if reference == "$${" {
+			return "${"
+		}
+		match := envReference.FindStringSubmatch(reference)
+		value, set := os.LookupEnv(match[1])
+		switch {
+		case value != "":
+			return value
+		case match[2] != "":
+			return match[3]
+		case !set && err == nil:
+			err = fmt.Errorf("line %d: environment variable %s is not set", node.Line, match[1])
+		}
+		return value
+	})
+	// Unquoted values are typed by what they expand to, e.g. port: ${PORT}
+	if node.Style == 0 {
+		node.Tag = ""
+	}
+	return err
+}
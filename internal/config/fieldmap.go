@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"calleventhub/event"
+)
+
+// FieldMap normalizes the field names PBX vendors use, e.g. CallID -> call_id or
+// caller -> from_number. Sources may be dotted paths into nested objects; targets are
+// top-level fields. The source field is kept.
+type FieldMap map[string]string
+
+// defaultFieldMap is server.field_map when the config sets none
+var defaultFieldMap = FieldMap{"Domain": "domain", "CallID": "call_id"}
+
+// Apply copies each mapped source field that is present to its target, unless the event
+// already sets the target. Sources are applied in name order, so when several sources map
+// to one target the first present wins.
+func (m FieldMap) Apply(ev *event.Event) {
+	if len(m) == 0 {
+		return
+	}
+	sources := make([]string, 0, len(m))
+	for source := range m {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		target := m[source]
+		if current := ev.Get(target); current != nil && current != "" {
+			continue
+		}
+		if value := ev.Get(source); value != nil && value != "" {
+			ev.Set(target, value)
+		}
+	}
+}
+
+// validate checks the field names of the map
+func (m FieldMap) validate() error {
+	for source, target := range m {
+		if source == "" || target == "" {
+			return fmt.Errorf("field_map source and target must not be empty")
+		}
+		if strings.Contains(target, ".") {
+			return fmt.Errorf("field_map target %q must be a top-level field", target)
+		}
+		if source == target {
+			return fmt.Errorf("field_map maps %q to itself", source)
+		}
+	}
+	return nil
+}
+
+// RenameFields renames fields when the outbound payload is built, e.g. from_number ->
+// caller, since backends want different names for the same data. Sources and targets may
+// be dotted paths into nested objects.
+type RenameFields map[string]string
+
+// Apply moves each source field that is present to its target, replacing the target. All
+// sources are read before any is removed, so renames may swap fields. A rename that fails
+// (its target is inside a field that is not an object) leaves the field under its source.
+func (m RenameFields) Apply(ev *event.Event) error {
+	if len(m) == 0 {
+		return nil
+	}
+	// Targets are set in name order, so a failure does not depend on map order
+	sources := make([]string, 0, len(m))
+	values := make(map[string]interface{}, len(m))
+	for source := range m {
+		if value := ev.Get(source); value != nil {
+			sources = append(sources, source)
+			values[source] = value
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool { return m[sources[i]] < m[sources[j]] })
+	for _, source := range sources {
+		ev.Delete(source)
+	}
+
+	var failed []string
+	for _, source := range sources {
+		if err := ev.SetPath(m[source], values[source]); err != nil {
+			ev.SetPath(source, values[source])
+			failed = append(failed, fmt.Sprintf("%s -> %s: %v", source, m[source], err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("rename_fields %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// validate checks the field names of the renames
+func (m RenameFields) validate() error {
+	sources := make(map[string]string, len(m))
+	for source, target := range m {
+		if !validFieldPath(source) || !validFieldPath(target) {
+			return fmt.Errorf("invalid rename_fields entry %q: %q", source, target)
+		}
+		if source == target {
+			return fmt.Errorf("rename_fields renames %q to itself", source)
+		}
+		if other, ok := sources[target]; ok {
+			if other > source {
+				other, source = source, other
+			}
+			return fmt.Errorf("rename_fields renames both %q and %q to %q", other, source, target)
+		}
+		sources[target] = source
+	}
+	return nil
+}
+
+// validFieldPath reports whether name is a field name or a dotted path of field names
+func validFieldPath(name string) bool {
+	for _, key := range strings.Split(name, ".") {
+		if key == "" {
+			return false
+		}
+	}
+	return true
+}
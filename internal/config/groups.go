@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+)
+
+// expandEndpointGroups adds the endpoints of the endpoint_groups a route (or the default
+// route) references to its endpoints, so routes sharing a backend list it once:
+//
+//	endpoint_groups:
+//	  crm_prod: ["https://crm1.example.com/events", "https://crm2.example.com/events"]
+//	routes:
+//	  - domain: "tenant1.example.com"
+//	    endpoint_groups: [crm_prod]
+//
+// Endpoints the route already has (by name) are not added again.
+func (c *Config) expandEndpointGroups() error {
+	for name, endpoints := range c.EndpointGroups {
+		if name == "" {
+			return fmt.Errorf("endpoint_groups: group names must not be empty")
+		}
+		if len(endpoints) == 0 {
+			return fmt.Errorf("endpoint_groups: group %s has no endpoints", name)
+		}
+	}
+
+	routes := make([]*Route, 0, len(c.Routes)+1)
+	for i := range c.Routes {
+		routes = append(routes, &c.Routes[i])
+	}
+	if c.DefaultRoute != nil {
+		routes = append(routes, c.DefaultRoute)
+	}
+	for _, route := range routes {
+		for _, name := range route.EndpointGroups {
+			endpoints, ok := c.EndpointGroups[name]
+			if !ok {
+				where := route.Domain
+				if route == c.DefaultRoute {
+					where = DefaultRouteName
+				}
+				return fmt.Errorf("route %s: endpoint group %s is not defined in endpoint_groups", where, name)
+			}
+			route.Endpoints = appendNewEndpoints(route.Endpoints, endpoints)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration files may be written in JSON, e.g. by provisioning systems: JSON is read by
+// the YAML parser as is, so everything that loads YAML loads it. Only files written back,
+// such as by the route edits, need to stay JSON.
+
+// isJSON reports whether a configuration document is JSON: an object, where a YAML
+// document starts with a key or a comment
+func isJSON(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// checkJSON reports a JSON syntax error of a configuration document that is JSON by its
+// line, since the YAML parser accepts some documents JSON does not (e.g. trailing commas)
+func checkJSON(data []byte) error {
+	if !isJSON(data) {
+		return nil
+	}
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		line := 1 + bytes.Count(data[:syntaxErr.Offset], []byte("\n"))
+		return fmt.Errorf("line %d: %w", line, err)
+	}
+	return err
+}
+
+// encodeJSON writes a parsed configuration document as indented JSON, with its keys in
+// their order in the document
+func encodeJSON(doc *yaml.Node) ([]byte, error) {
+	var compact bytes.Buffer
+	if err := writeJSON(&compact, doc); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// writeJSON writes a node as compact JSON
+func writeJSON(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		return writeJSON(buf, node.Content[0])
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, node.Content[i].Value)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, child := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, child); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			buf.WriteString("null")
+			return nil
+		case "!!bool", "!!int", "!!float":
+			var value interface{}
+			if err := node.Decode(&value); err == nil {
+				if data, err := json.Marshal(value); err == nil {
+					buf.Write(data)
+					return nil
+				}
+			}
+		}
+		writeJSONString(buf, node.Value)
+	default:
+		return fmt.Errorf("line %d: cannot be written as JSON", node.Line)
+	}
+	return nil
+}
+
+// writeJSONString writes a JSON string, without escaping <, > and & as json.Marshal does
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode ends the value with a newline
+	buf.Truncate(buf.Len() - 1)
+}
@@ -0,0 +1,325 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Warning is a non-fatal configuration issue found by Lint: the configuration loads,
+// but probably does not do what was intended
+type Warning struct {
+	Path    string `json:"path"` // Config location, e.g. routes[2] or nats.retry_policy
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string {
+	return w.Path + ": " + w.Message
+}
+
+// LintFile loads the configuration file at path, with the route files of the config
+// directory dir if not empty, and lints it. A configuration that does not load, or a
+// rejected config directory file, is returned as an error.
+func LintFile(configPath, dir string) ([]Warning, error) {
+	cfg, err := LoadDir(configPath, dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.RejectedError(); err != nil {
+		return nil, err
+	}
+	return cfg.Lint(), nil
+}
+
+// Lint reports settings that are valid but likely mistakes, such as routes that can never
+// match or never forward. Call it on a configuration that passed Validate.
+func (c *Config) Lint() []Warning {
+	var warnings []Warning
+	warn := func(path, format string, args ...interface{}) {
+		warnings = append(warnings, Warning{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Routes are matched by exact domain (duplicates are rejected or merged by Parse)
+	seen := make(map[string]int)
+	for i, route := range c.Routes {
+		where := fmt.Sprintf("routes[%d] (%s)", i, route.Domain)
+		if route.File != "" {
+			where = fmt.Sprintf("%s (%s)", route.File, route.Domain)
+		}
+
+		switch {
+		case route.Domain == "":
+			warn(where, "domain is empty, so the route never matches")
+		case route.Domain != strings.TrimSpace(route.Domain):
+			warn(where, "domain has surrounding whitespace, so the route never matches")
+		case route.Domain != strings.ToLower(route.Domain):
+			warn(where, "domain is matched exactly, so events must use the same capitalization")
+		}
+
+		seen[route.Domain] = i
+
+		if strings.ContainsAny(route.Domain, "*?[") {
+			warn(where, "domains are matched exactly, so the wildcard never matches")
+			overlapped := make(map[string]bool)
+			for _, other := range c.Routes {
+				if overlapped[other.Domain] || strings.ContainsAny(other.Domain, "*?[") {
+					continue
+				}
+				if ok, _ := path.Match(route.Domain, other.Domain); ok {
+					overlapped[other.Domain] = true
+					warn(where, "wildcard overlaps route %s, which is the one used for that domain", other.Domain)
+				}
+			}
+		}
+
+		if route.Disabled() {
+			warn(where, "disabled, so its events are acknowledged without being forwarded")
+		} else if len(route.Endpoints) == 0 {
+			if len(route.Match) > 0 {
+				warn(where, "no endpoints, so events matching no match rule fail")
+			} else if len(route.StaleEndpoints) == 0 {
+				warn(where, "no endpoints, so every event of the domain fails")
+			} else {
+				warn(where, "no endpoints, so only stale events are forwarded and the others fail")
+			}
+		}
+		if !route.Disabled() && len(route.Endpoints) > 0 && allDisabled(route.Endpoints) {
+			warn(where, "all endpoints are disabled, so every event of the domain fails")
+		}
+
+		c.lintEndpoints(where, route.Endpoints, warn)
+		c.lintEndpoints(where+" stale_endpoints", route.StaleEndpoints, warn)
+		c.lintEndpoints(where+" fallback_endpoints", route.FallbackEndpoints, warn)
+		for j, rule := range route.Match {
+			ruleWhere := fmt.Sprintf("%s match[%d]", where, j)
+			c.lintEndpoints(ruleWhere, rule.Endpoints, warn)
+			// An earlier rule whose conditions are a subset of this one's takes all its events
+			for k, earlier := range route.Match[:j] {
+				if conditionsSubset(earlier.When, rule.When) {
+					warn(ruleWhere, "every event it matches is matched by match[%d] first, so it never applies", k)
+					break
+				}
+			}
+		}
+
+		if route.AtMostOnce() {
+			if route.RetryPolicy != nil {
+				warn(where, "retry_policy has no effect with delivery at_most_once, failed events are not retried")
+			}
+			if route.MaxDeliveries > 0 || route.RedeliveryDelaySeconds > 0 {
+				warn(where, "max_deliveries and redelivery_delay_seconds have no effect with delivery at_most_once, failed events are not retried")
+			}
+		} else if route.RetryPolicy != nil {
+			c.lintRetryPolicy(where+" retry_policy", route.Domain, route.RetryPolicy, warn)
+		}
+		renamed := make(map[string]bool, len(route.RenameFields))
+		sources := make([]string, 0, len(route.RenameFields))
+		for source, target := range route.RenameFields {
+			renamed[target] = true
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		for _, source := range sources {
+			if target := route.RenameFields[source]; route.Transform[target] != "" {
+				warn(where, "transform %s is replaced by rename_fields with %s whenever the event has it", target, source)
+			}
+		}
+		for _, field := range route.DropFields {
+			if _, ok := route.Transform[field]; ok {
+				warn(where, "transform %s is removed by drop_fields, so it is never sent", field)
+			}
+			if renamed[field] {
+				warn(where, "renamed field %s is removed by drop_fields, so it is never sent", field)
+			}
+		}
+		if route.Hedging.Active() && !hasHTTPEndpoint(route.Endpoints) {
+			warn(where, "hedging only applies to HTTP endpoints and the route has none")
+		}
+		if route.MaxEventAgeSeconds > 0 && !route.AtMostOnce() {
+			if retries := c.retryHorizon(route.Domain, route.effectiveRetryPolicy(c)); retries > time.Duration(route.MaxEventAgeSeconds)*time.Second {
+				warn(where, "retries of a failing event take up to %s, longer than max_event_age_seconds (%d), so late attempts are treated as stale", retries, route.MaxEventAgeSeconds)
+			}
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, route := range c.AllRoutes() {
+		for _, name := range route.EndpointGroups {
+			used[name] = true
+		}
+	}
+	var unused []string
+	for name := range c.EndpointGroups {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		warn("endpoint_groups ("+name+")", "no route references the group, so its endpoints are not used")
+	}
+
+	if route := c.DefaultRoute; route != nil {
+		c.lintEndpoints(DefaultRouteName, route.Endpoints, warn)
+		c.lintEndpoints(DefaultRouteName+" fallback_endpoints", route.FallbackEndpoints, warn)
+		if allDisabled(route.Endpoints) {
+			warn(DefaultRouteName, "all endpoints are disabled, so every event of a domain without a route fails")
+		}
+	}
+
+	if c.NATS.RetryPolicy != nil {
+		c.lintRetryPolicy("nats.retry_policy", "", c.NATS.RetryPolicy, warn)
+	}
+
+	// The server stops delivering at max_ack_pending, so more workers than that stay idle
+	maxAckPending := c.NATS.MaxAckPending
+	if maxAckPending == 0 {
+		maxAckPending = defaultMaxAckPending
+	}
+	if maxAckPending > 0 && c.NATS.Lag.MaxWorkers > maxAckPending {
+		warn("nats.max_ack_pending", "%d messages in flight at most, so only that many of the %d workers (nats.lag.max_workers) are ever busy", maxAckPending, c.NATS.Lag.MaxWorkers)
+	}
+	// Held messages of an open domain circuit count against max_ack_pending
+	if circuit := c.NATS.DomainCircuit; circuit.Enabled && maxAckPending > 0 && circuit.MaxParked >= maxAckPending {
+		warn("nats.domain_circuit", "one open domain can hold max_parked (%d) messages, the whole max_ack_pending (%d), stopping delivery for every other domain", circuit.MaxParked, maxAckPending)
+	}
+
+	if c.Isolation.Enabled {
+		for _, tenant := range c.Isolation.Tenants {
+			for _, domain := range tenant.Domains {
+				if _, ok := seen[domain]; !ok && c.DefaultRoute == nil {
+					warn("isolation.tenants ("+tenant.Name+")", "domain %s has no route, so its events fail", domain)
+				}
+			}
+		}
+	}
+
+	if c.Server.Auth.Enabled {
+		for _, token := range c.Server.Auth.Tokens {
+			for _, domain := range token.Domains {
+				if _, ok := seen[domain]; !ok && c.DefaultRoute == nil {
+					warn("server.auth.tokens ("+token.Name+")", "domain %s has no route", domain)
+				}
+			}
+		}
+	}
+
+	if c.Reports.FailedEvents.Enabled {
+		contacts := false
+		for _, route := range c.Routes {
+			contacts = contacts || len(route.Contacts) > 0
+		}
+		if !contacts {
+			warn("reports.failed_events", "no route has contacts, so no report is sent")
+		}
+	}
+
+	// Running with a config directory file rejected, e.g. after a reload
+	for _, rejected := range c.Rejected {
+		if rejected.Kept {
+			warn(rejected.File, "rejected, the routes of the version loaded before are kept: %s", rejected.Error)
+		} else {
+			warn(rejected.File, "rejected, its routes are not loaded: %s", rejected.Error)
+		}
+	}
+
+	return warnings
+}
+
+// lintEndpoints warns about endpoints listed twice or only reachable on this host
+func (c *Config) lintEndpoints(where string, endpoints []Endpoint, warn func(path, format string, args ...interface{})) {
+	names := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		name := endpoint.Name()
+		if names[name] {
+			warn(where, "endpoint %s is listed twice, so events are sent to it twice", name)
+			continue
+		}
+		names[name] = true
+
+		address := endpoint.URL
+		if sink := endpoint.sink(); sink != nil {
+			address = sink.address()
+		}
+		u, err := url.Parse(address)
+		if err != nil {
+			continue
+		}
+		host := u.Hostname()
+		if ip := net.ParseIP(host); strings.EqualFold(host, "localhost") || (ip != nil && ip.IsLoopback()) {
+			warn(where, "endpoint %s points at this host, so it is unreachable when the hub runs elsewhere (e.g. in a container)", name)
+		}
+	}
+}
+
+// lintRetryPolicy warns about retry policies of a domain's route (or the global one, with no
+// domain) that do not delay retries, or whose delays add up to more than ack_wait, which
+// operators tend to read as the retry window
+func (c *Config) lintRetryPolicy(where, domain string, policy *RetryPolicy, warn func(path, format string, args ...interface{})) {
+	if len(policy.BackoffSeconds) == 0 && policy.InitialDelaySeconds <= 0 {
+		warn(where, "no backoff_seconds or initial_delay_seconds, so failed events are retried after ack_wait_seconds")
+		return
+	}
+	if maxDeliveries := c.MaxDeliveries(domain); len(policy.BackoffSeconds) >= maxDeliveries {
+		warn(where, "backoff_seconds has %d delays but max_deliveries (%d) only uses the first %d", len(policy.BackoffSeconds), maxDeliveries, maxDeliveries-1)
+	}
+	if retries := c.retryHorizon(domain, policy); retries > time.Duration(c.NATS.AckWait)*time.Second {
+		warn(where, "nats ack_wait_seconds (%d) is shorter than the sum of the retry delays (%s): a failing event stays pending that long before it is given up", c.NATS.AckWait, retries)
+	}
+}
+
+// allDisabled reports whether every endpoint is out of rotation
+func allDisabled(endpoints []Endpoint) bool {
+	for _, endpoint := range endpoints {
+		if !endpoint.Disabled {
+			return false
+		}
+	}
+	return true
+}
+
+// retryHorizon returns the total redelivery delay of an event of the domain that fails
+// every attempt
+func (c *Config) retryHorizon(domain string, policy *RetryPolicy) time.Duration {
+	var total time.Duration
+	for attempt := 1; attempt < c.MaxDeliveries(domain); attempt++ {
+		delay := policy.Delay(attempt)
+		if delay == 0 {
+			delay = c.RedeliveryDelay(domain)
+		}
+		total += delay
+	}
+	return total
+}
+
+// effectiveRetryPolicy returns the route's retry policy, or the global one
+func (r *Route) effectiveRetryPolicy(c *Config) *RetryPolicy {
+	if r.RetryPolicy != nil {
+		return r.RetryPolicy
+	}
+	return c.NATS.RetryPolicy
+}
+
+// hasHTTPEndpoint reports whether any of the endpoints is an HTTP endpoint
+func hasHTTPEndpoint(endpoints []Endpoint) bool {
+	for _, endpoint := range endpoints {
+		if endpoint.Type == "" || endpoint.Type == EndpointHTTP {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionsSubset reports whether every condition of a is also in b
+func conditionsSubset(a, b map[string]string) bool {
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// defaultSourceBucket is the NATS KV bucket of nats config sources without a bucket
+const defaultSourceBucket = "event-hub-config"
+
+// natsSource reads the key from a NATS KV bucket; changes are pushed by a key watcher
+type natsSource struct {
+	url     string
+	bucket  string
+	key     string
+	timeout time.Duration
+
+	mu      sync.Mutex
+	conn    *nats.Conn // Kept open for the watcher
+	watcher nats.KeyWatcher
+}
+
+func (s *natsSource) String() string {
+	return fmt.Sprintf("nats kv %s key %s", s.bucket, s.key)
+}
+
+// connect opens a connection to the server; reconnect makes it keep reconnecting
+func (s *natsSource) connect(reconnect bool) (*nats.Conn, error) {
+	opts := []nats.Option{nats.Name("event-hub-config"), nats.Timeout(s.timeout)}
+	if reconnect {
+		opts = append(opts, nats.ReconnectWait(2*time.Second), nats.MaxReconnects(-1))
+	}
+	conn, err := nats.Connect(s.url, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to connect to NATS: %w", s, err)
+	}
+	return conn, nil
+}
+
+// keyValue opens the bucket, creating it if create is set
+func (s *natsSource) keyValue(conn *nats.Conn, create bool) (nats.KeyValue, error) {
+	js, err := conn.JetStream(nats.MaxWait(s.timeout))
+	if err != nil {
+		return nil, err
+	}
+	kv, err := js.KeyValue(s.bucket)
+	if create && errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      s.bucket,
+			Description: "event-hub routes",
+			History:     10,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to open bucket: %w", s, err)
+	}
+	return kv, nil
+}
+
+func (s *natsSource) Get(ctx context.Context) ([]byte, uint64, error) {
+	conn, err := s.connect(false)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	kv, err := s.keyValue(conn, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	entry, err := kv.Get(s.key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, 0, fmt.Errorf("%s: %w", s, ErrSourceKeyNotFound)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", s, err)
+	}
+	return entry.Value(), entry.Revision(), nil
+}
+
+func (s *natsSource) Put(ctx context.Context, value []byte) error {
+	conn, err := s.connect(false)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	kv, err := s.keyValue(conn, true)
+	if err != nil {
+		return err
+	}
+	_, err = kv.Put(s.key, value)
+	return err
+}
+
+func (s *natsSource) Wait(ctx context.Context, version uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watcher == nil {
+		if s.conn == nil {
+			conn, err := s.connect(true)
+			if err != nil {
+				return version, err
+			}
+			s.conn = conn
+		}
+		kv, err := s.keyValue(s.conn, false)
+		if err != nil {
+			return version, err
+		}
+		// Deletes are seen too, so reloading reports the missing key
+		if s.watcher, err = kv.Watch(s.key); err != nil {
+			return version, fmt.Errorf("%s: failed to watch: %w", s, err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return version, nil
+		case entry, ok := <-s.watcher.Updates():
+			if !ok {
+				s.watcher = nil
+				return version, fmt.Errorf("%s: watch stopped", s)
+			}
+			// nil marks the end of the current values
+			if entry != nil && entry.Revision() != version {
+				return entry.Revision(), nil
+			}
+		}
+	}
+}
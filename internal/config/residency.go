@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"calleventhub/internal/transform"
+)
+
+// ResidencyConfig declares the regions data may be stored in. A route with a region may only
+// send its events to destinations of that region - endpoints, stale endpoints, file sink
+// spools and their SFTP uploads, the staging mirror and its tenant's ops_url. Violations fail config validation,
+// so a reload that would move a domain's data out of its region is rejected.
+type ResidencyConfig struct {
+	Regions map[string]Region `yaml:"regions"`
+}
+
+// Region lists the destinations located in one region
+type Region struct {
+	Hosts       []string `yaml:"hosts"`       // Remote hosts: names ("*.eu.example.com" matches subdomains) or CIDRs
+	Directories []string `yaml:"directories"` // Local directories file sinks may spool to (and below)
+}
+
+// allowsHost reports whether a destination host is in the region
+func (r Region) allowsHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+	for _, allowed := range r.Hosts {
+		allowed = strings.ToLower(allowed)
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsDirectory reports whether a local directory is one of the region's, or below one
+func (r Region) allowsDirectory(dir string) bool {
+	dir = filepath.Clean(dir)
+	for _, allowed := range r.Directories {
+		allowed = filepath.Clean(allowed)
+		if dir == allowed || strings.HasPrefix(dir, allowed+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEndpoint returns an error if the endpoint sends data outside the region
+func (r Region) checkEndpoint(endpoint Endpoint) error {
+	if endpoint.Type == EndpointFile && endpoint.File != nil {
+		if !r.allowsDirectory(endpoint.File.Directory) {
+			return fmt.Errorf("directory %s is not in the region", endpoint.File.Directory)
+		}
+		if endpoint.File.SFTP == nil {
+			return nil
+		}
+	}
+
+	address := endpoint.URL
+	if sink := endpoint.sink(); sink != nil {
+		address = sink.address()
+	} else if transform.HasExpressions(address) {
+		// The host must not depend on the event, or it could point anywhere
+		t, err := transform.Parse(address)
+		if err != nil {
+			return err
+		}
+		a, errA := url.Parse(t.Placeholder("a"))
+		b, errB := url.Parse(t.Placeholder("b"))
+		if errA != nil || errB != nil || a.Host != b.Host {
+			return fmt.Errorf("templates are not allowed in the host of a region-bound endpoint")
+		}
+		address = a.String()
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+	if !r.allowsHost(u.Hostname()) {
+		return fmt.Errorf("host %s is not in the region", u.Hostname())
+	}
+	return nil
+}
+
+// validateResidency checks that every region-bound route only sends data to its region
+func (c *Config) validateResidency() error {
+	for name, region := range c.Residency.Regions {
+		if len(region.Hosts) == 0 && len(region.Directories) == 0 {
+			return fmt.Errorf("residency region %s lists no hosts or directories", name)
+		}
+	}
+
+	mirrored := make(map[string]bool, len(c.Mirror.Domains))
+	for _, domain := range c.Mirror.Domains {
+		mirrored[domain] = true
+	}
+
+	for _, route := range c.Routes {
+		if route.Region == "" {
+			continue
+		}
+		region, ok := c.Residency.Regions[route.Region]
+		if !ok {
+			return fmt.Errorf("route %s: region %s is not defined in residency.regions", route.Domain, route.Region)
+		}
+		for _, endpoint := range route.AllEndpoints() {
+			if err := region.checkEndpoint(endpoint); err != nil {
+				return fmt.Errorf("route %s: endpoint %s violates region %s: %w", route.Domain, endpoint.Name(), route.Region, err)
+			}
+		}
+		if c.Isolation.Enabled {
+			if tenant := c.TenantForDomain(route.Domain); tenant != nil && tenant.OpsURL != "" {
+				if u, err := url.Parse(tenant.OpsURL); err != nil || !region.allowsHost(u.Hostname()) {
+					return fmt.Errorf("route %s: ops_url of tenant %s is not in region %s", route.Domain, tenant.Name, route.Region)
+				}
+			}
+		}
+		if c.Mirror.Enabled && c.Mirror.Region != route.Region && (len(c.Mirror.Domains) == 0 || mirrored[route.Domain]) {
+			return fmt.Errorf("route %s: the staging mirror would copy events of region %s; leave the domain out of mirror.domains, or set mirror.region", route.Domain, route.Region)
+		}
+	}
+
+	if c.Mirror.Enabled && c.Mirror.Region != "" {
+		region, ok := c.Residency.Regions[c.Mirror.Region]
+		if !ok {
+			return fmt.Errorf("mirror region %s is not defined in residency.regions", c.Mirror.Region)
+		}
+		if c.Mirror.URL != "" {
+			u, err := url.Parse(c.Mirror.URL)
+			if err != nil || !region.allowsHost(u.Hostname()) {
+				return fmt.Errorf("mirror url %s is not in region %s", c.Mirror.URL, c.Mirror.Region)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Role is what an instance runs, from role or the -role flag, so ingest, forwarding and the
+// dashboard can be scaled, deployed and restarted separately
+type Role struct {
+	Ingest    bool // POST /events: accept events and publish them to the stream
+	Consumer  bool // Forward the events of the stream
+	Dashboard bool // Dashboard, log and config viewers and the /api endpoints
+}
+
+// RoleAll runs everything (the default)
+var RoleAll = Role{Ingest: true, Consumer: true, Dashboard: true}
+
+// ParseRole parses a comma-separated list of ingest, consumer and dashboard; "" and "all"
+// are all of them
+func ParseRole(value string) (Role, error) {
+	if value == "" || value == "all" {
+		return RoleAll, nil
+	}
+	var role Role
+	for _, part := range strings.Split(value, ",") {
+		switch strings.TrimSpace(part) {
+		case "ingest":
+			role.Ingest = true
+		case "consumer":
+			role.Consumer = true
+		case "dashboard":
+			role.Dashboard = true
+		default:
+			return Role{}, fmt.Errorf("unknown role %q, must be all or a list of ingest, consumer and dashboard", strings.TrimSpace(part))
+		}
+	}
+	return role, nil
+}
+
+// String returns the role as ParseRole reads it
+func (r Role) String() string {
+	if r == RoleAll {
+		return "all"
+	}
+	var parts []string
+	if r.Ingest {
+		parts = append(parts, "ingest")
+	}
+	if r.Consumer {
+		parts = append(parts, "consumer")
+	}
+	if r.Dashboard {
+		parts = append(parts, "dashboard")
+	}
+	return strings.Join(parts, ",")
+}
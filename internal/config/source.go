@@ -0,0 +1,417 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config source types
+const (
+	SourceConsul = "consul"
+	SourceEtcd   = "etcd"
+	SourceNATS   = "nats"
+)
+
+// ConfigSourceConfig loads the routes from a key of Consul's or etcd's key/value store, or
+// of a NATS KV bucket, instead of the configuration file, so replicas share them, and
+// reloads them when the key changes. The key holds a YAML document with routes, written
+// like in the file.
+type ConfigSourceConfig struct {
+	Type           string `yaml:"type"`              // consul, etcd or nats (empty = routes are in the file)
+	Address        string `yaml:"address"`           // e.g. http://consul:8500 or http://etcd:2379 (nats: default nats.url)
+	Bucket         string `yaml:"bucket"`            // nats: KV bucket (default event-hub-config)
+	Key            string `yaml:"key"`               // Key holding the routes document
+	Token          string `yaml:"token" json:"-"`    // Consul ACL token
+	Username       string `yaml:"username"`          // etcd user (empty = no authentication)
+	Password       string `yaml:"password" json:"-"` // etcd password
+	TimeoutSeconds int    `yaml:"timeout_seconds"`   // Per request (default 10)
+	PollSeconds    int    `yaml:"poll_seconds"`      // etcd: how often the key is checked for changes (default 5)
+}
+
+// Enabled reports whether the routes are loaded from a config source
+func (s ConfigSourceConfig) Enabled() bool {
+	return s.Type != ""
+}
+
+func (s ConfigSourceConfig) validate() error {
+	switch s.Type {
+	case "", SourceConsul, SourceEtcd, SourceNATS:
+	default:
+		return fmt.Errorf("unknown type %q (expected %s, %s or %s)", s.Type, SourceConsul, SourceEtcd, SourceNATS)
+	}
+	if s.Type == "" {
+		return nil
+	}
+	if s.Type != SourceNATS {
+		if u, err := url.Parse(s.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("address must be an http(s) URL")
+		}
+	}
+	if s.Key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if s.TimeoutSeconds < 0 || s.PollSeconds < 0 {
+		return fmt.Errorf("timeout_seconds and poll_seconds must not be negative")
+	}
+	return nil
+}
+
+// ErrSourceKeyNotFound is returned when the key of a config source does not exist
+var ErrSourceKeyNotFound = errors.New("key not found")
+
+// Source is a key/value store the routes are loaded from (see ConfigSourceConfig)
+type Source interface {
+	// Get returns the key's value and version
+	Get(ctx context.Context) ([]byte, uint64, error)
+	// Wait returns the key's version once it differs from version, or its current version
+	// when ctx is done or the store's wait time ran out
+	Wait(ctx context.Context, version uint64) (uint64, error)
+	// Put replaces the key's value
+	Put(ctx context.Context, value []byte) error
+	// String describes the key in logs and errors
+	String() string
+}
+
+// NewSource returns the config source of the settings (nil if the routes are in the file).
+// natsURL is the server of nats sources without an address.
+func NewSource(settings ConfigSourceConfig, natsURL string) (Source, error) {
+	if err := settings.validate(); err != nil {
+		return nil, err
+	}
+	timeout := 10 * time.Second
+	if settings.TimeoutSeconds > 0 {
+		timeout = time.Duration(settings.TimeoutSeconds) * time.Second
+	}
+	address := strings.TrimSuffix(settings.Address, "/")
+	switch settings.Type {
+	case SourceConsul:
+		return &consulSource{address: address, settings: settings, timeout: timeout}, nil
+	case SourceEtcd:
+		poll := 5 * time.Second
+		if settings.PollSeconds > 0 {
+			poll = time.Duration(settings.PollSeconds) * time.Second
+		}
+		return &etcdSource{address: address, settings: settings, client: &http.Client{Timeout: timeout}, poll: poll}, nil
+	case SourceNATS:
+		if address == "" {
+			address = natsURL
+		}
+		bucket := settings.Bucket
+		if bucket == "" {
+			bucket = defaultSourceBucket
+		}
+		return &natsSource{url: address, bucket: bucket, key: settings.Key, timeout: timeout}, nil
+	}
+	return nil, nil
+}
+
+// consulWait is how long a Consul blocking query waits for a change
+const consulWait = 5 * time.Minute
+
+// consulSource reads the key from Consul's KV store; changes are waited for with
+// blocking queries
+type consulSource struct {
+	address  string
+	settings ConfigSourceConfig
+	timeout  time.Duration
+}
+
+func (s *consulSource) String() string {
+	return fmt.Sprintf("consul key %s", s.settings.Key)
+}
+
+// request sends a KV request for the key and returns the response and its index
+func (s *consulSource) request(ctx context.Context, method string, query url.Values, body []byte, timeout time.Duration) ([]byte, uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	endpoint := s.address + "/v1/kv/" + strings.TrimPrefix(s.settings.Key, "/")
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	if s.settings.Token != "" {
+		req.Header.Set("X-Consul-Token", s.settings.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, index, fmt.Errorf("%s: %w", s, ErrSourceKeyNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return nil, 0, fmt.Errorf("%s: consul returned HTTP %d: %s", s, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, index, nil
+}
+
+func (s *consulSource) Get(ctx context.Context) ([]byte, uint64, error) {
+	return s.request(ctx, http.MethodGet, url.Values{"raw": {""}}, nil, s.timeout)
+}
+
+func (s *consulSource) Put(ctx context.Context, value []byte) error {
+	_, _, err := s.request(ctx, http.MethodPut, nil, value, s.timeout)
+	return err
+}
+
+func (s *consulSource) Wait(ctx context.Context, version uint64) (uint64, error) {
+	query := url.Values{
+		"index": {strconv.FormatUint(version, 10)},
+		"wait":  {consulWait.String()},
+	}
+	// Consul answers by the end of the wait, plus some jitter
+	_, index, err := s.request(ctx, http.MethodGet, query, nil, consulWait+consulWait/16+s.timeout)
+	if errors.Is(err, ErrSourceKeyNotFound) {
+		return index, nil
+	}
+	return index, err
+}
+
+// etcdSource reads the key through etcd's v3 JSON gateway; changes are polled for
+type etcdSource struct {
+	address  string
+	settings ConfigSourceConfig
+	client   *http.Client
+	poll     time.Duration
+}
+
+func (s *etcdSource) String() string {
+	return fmt.Sprintf("etcd key %s", s.settings.Key)
+}
+
+// call posts a JSON request to the gateway and decodes the response into out
+func (s *etcdSource) call(ctx context.Context, path, token string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.address+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: etcd returned HTTP %d: %s", s, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
+
+// authenticate returns a token for the etcd user (empty without a username). Tokens of
+// etcd's simple auth expire within minutes, so every request gets a new one.
+func (s *etcdSource) authenticate(ctx context.Context) (string, error) {
+	if s.settings.Username == "" {
+		return "", nil
+	}
+	var auth struct {
+		Token string `json:"token"`
+	}
+	credentials := map[string]string{"name": s.settings.Username, "password": s.settings.Password}
+	if err := s.call(ctx, "/v3/auth/authenticate", "", credentials, &auth); err != nil {
+		return "", fmt.Errorf("%s: authentication failed: %w", s, err)
+	}
+	return auth.Token, nil
+}
+
+func (s *etcdSource) Get(ctx context.Context) ([]byte, uint64, error) {
+	token, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var result struct {
+		Kvs []struct {
+			Value       string `json:"value"`        // base64
+			ModRevision string `json:"mod_revision"` // int64 as a string
+		} `json:"kvs"`
+	}
+	key := map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(s.settings.Key))}
+	if err := s.call(ctx, "/v3/kv/range", token, key, &result); err != nil {
+		return nil, 0, err
+	}
+	if len(result.Kvs) == 0 {
+		return nil, 0, fmt.Errorf("%s: %w", s, ErrSourceKeyNotFound)
+	}
+	value, err := base64.StdEncoding.DecodeString(result.Kvs[0].Value)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: invalid value: %w", s, err)
+	}
+	revision, _ := strconv.ParseUint(result.Kvs[0].ModRevision, 10, 64)
+	return value, revision, nil
+}
+
+func (s *etcdSource) Put(ctx context.Context, value []byte) error {
+	token, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	put := map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(s.settings.Key)),
+		"value": base64.StdEncoding.EncodeToString(value),
+	}
+	var result struct{}
+	return s.call(ctx, "/v3/kv/put", token, put, &result)
+}
+
+func (s *etcdSource) Wait(ctx context.Context, version uint64) (uint64, error) {
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return version, nil
+		case <-ticker.C:
+		}
+		_, revision, err := s.Get(ctx)
+		if errors.Is(err, ErrSourceKeyNotFound) {
+			revision, err = 0, nil
+		}
+		if err != nil || revision != version {
+			return revision, err
+		}
+	}
+}
+
+// loadSourceRoutes replaces the routes of a parsed configuration file with those of its
+// config_source, if it has one: data, or the value of its key if data is nil
+func loadSourceRoutes(doc *yaml.Node, data []byte) error {
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+	var settings ConfigSourceConfig
+	var natsSettings struct {
+		URL string `yaml:"url"`
+	}
+	routes := -1
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch root.Content[i].Value {
+		case "config_source":
+			if err := root.Content[i+1].Decode(&settings); err != nil {
+				return fmt.Errorf("config_source: %w", err)
+			}
+		case "nats":
+			root.Content[i+1].Decode(&natsSettings)
+		case "routes":
+			routes = i + 1
+		}
+	}
+	source, err := NewSource(settings, natsSettings.URL)
+	if err != nil {
+		return fmt.Errorf("config_source: %w", err)
+	}
+	if source == nil {
+		if data != nil {
+			return fmt.Errorf("config_source is not set")
+		}
+		return nil
+	}
+	if routes >= 0 && len(root.Content[routes].Content) > 0 {
+		return fmt.Errorf("routes must not be set in the file when they are loaded from config_source")
+	}
+
+	if data == nil {
+		// Requests time out by timeout_seconds
+		if data, _, err = source.Get(context.Background()); err != nil {
+			return fmt.Errorf("config_source: %w", err)
+		}
+	}
+	node, err := parseRoutesDocument(data, "config_source")
+	if err != nil {
+		return fmt.Errorf("config_source: %s: %w", source, err)
+	}
+	if routes < 0 {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "routes"}, node)
+	} else {
+		root.Content[routes] = node
+	}
+	return nil
+}
+
+// parseRoutesDocument parses a document holding only routes, as loaded from a config
+// source or a config directory file (from), into the routes node
+func parseRoutesDocument(data []byte, from string) (*yaml.Node, error) {
+	empty := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	if err := checkJSON(data); err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		return empty, nil
+	}
+	if err := expandEnv(&doc); err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("not a YAML mapping with routes")
+	}
+	routes := empty
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if key := root.Content[i].Value; key != "routes" {
+			return nil, fmt.Errorf("only routes can be loaded from %s, found %s", from, key)
+		}
+		routes = root.Content[i+1]
+	}
+	return routes, nil
+}
+
+// PutSourceRoutes validates a routes document against the configuration file at path and
+// writes it to the file's config_source, whose instances then reload it. It returns the
+// description of the key.
+func PutSourceRoutes(path string, routes []byte) (string, error) {
+	data, err := ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := parse(data, routes)
+	if err != nil {
+		return "", err
+	}
+	source, err := NewSource(cfg.ConfigSource, cfg.NATS.URL)
+	if err != nil {
+		return "", err
+	}
+	if source == nil {
+		return "", fmt.Errorf("config_source is not set")
+	}
+	if err := source.Put(context.Background(), routes); err != nil {
+		return "", fmt.Errorf("failed to write routes: %w", err)
+	}
+	return source.String(), nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"calleventhub/internal/transform"
+)
+
+// SuccessConfig decides which responses of a route's HTTP endpoints mean the event was
+// delivered. By default any 2xx does; some backends answer 200 with {"ok":false} when they
+// reject an event, or 409 for an event they already have.
+type SuccessConfig struct {
+	AcceptStatus []int  `yaml:"accept_status" json:"accept_status,omitempty"` // Non-2xx status codes that also mean delivered (e.g. 409 for duplicates); their body is not checked
+	BodyContains string `yaml:"body_contains" json:"body_contains,omitempty"` // A 2xx response body must contain this
+	JSONField    string `yaml:"json_field" json:"json_field,omitempty"`       // A 2xx response must be a JSON object with this field (dotted path into nested objects)
+	JSONValue    string `yaml:"json_value" json:"json_value,omitempty"`       // Value json_field must have (default "true")
+}
+
+// AcceptsStatus reports whether a non-2xx status code counts as delivered
+func (s *SuccessConfig) AcceptsStatus(code int) bool {
+	if s == nil {
+		return false
+	}
+	for _, accepted := range s.AcceptStatus {
+		if code == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckBody returns why a 2xx response body does not mean delivered (nil if it does)
+func (s *SuccessConfig) CheckBody(body []byte) error {
+	if s == nil {
+		return nil
+	}
+	if s.BodyContains != "" && !strings.Contains(string(body), s.BodyContains) {
+		return fmt.Errorf("response body does not contain %q", s.BodyContains)
+	}
+	if s.JSONField == "" {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return fmt.Errorf("response body is not a JSON object")
+	}
+	value := transform.FieldLookup(fields)(s.JSONField)
+	if value == nil {
+		return fmt.Errorf("response field %s is missing", s.JSONField)
+	}
+	expected := s.JSONValue
+	if expected == "" {
+		expected = "true"
+	}
+	if actual := fmt.Sprint(value); actual != expected {
+		return fmt.Errorf("response field %s is %s, expected %s", s.JSONField, actual, expected)
+	}
+	return nil
+}
+
+// validate checks the success criteria of a route
+func (s *SuccessConfig) validate() error {
+	if s == nil {
+		return nil
+	}
+	for _, code := range s.AcceptStatus {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("accept_status %d is not an HTTP status code", code)
+		}
+		if code == 429 || code == 503 {
+			return fmt.Errorf("accept_status cannot include %d, which asks the hub to back off", code)
+		}
+	}
+	if s.JSONValue != "" && s.JSONField == "" {
+		return fmt.Errorf("json_value requires json_field")
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package consumer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// circuitCheckInterval is how often open circuits are probed and held messages kept in progress
+const circuitCheckInterval = time.Second
+
+// Domain circuit states
+const (
+	CircuitClosed   = "closed"    // Events are forwarded
+	CircuitOpen     = "open"      // Events are held; one is forwarded every probe_seconds
+	CircuitHalfOpen = "half_open" // A probe event is being forwarded
+)
+
+// CircuitState is the circuit of one domain on a consumer
+type CircuitState struct {
+	Domain         string    `json:"domain"`
+	State          string    `json:"state"`
+	FailurePercent float64   `json:"failure_percent"` // Of the last min_events forwards
+	OpenedAt       time.Time `json:"opened_at"`
+	NextProbeAt    time.Time `json:"next_probe_at"`
+	Parked         int       `json:"parked"` // Messages held until the circuit closes
+}
+
+// circuitDecision is what to do with a message of a domain
+type circuitDecision int
+
+const (
+	circuitForward circuitDecision = iota // Closed: forward as usual
+	circuitProbe                          // Open and a probe is due: forward it and report the outcome
+	circuitParked                         // Open: held until the circuit closes
+	circuitDelay                          // Open and the domain holds max_parked messages: redeliver after probe_seconds
+)
+
+// domainCircuit follows the recent forwarding outcomes of a domain
+type domainCircuit struct {
+	outcomes  []bool // Ring of the last forwards, true = failed
+	next      int
+	failed    int
+	state     string
+	openedAt  time.Time
+	nextProbe time.Time
+	parked    []*natsgo.Msg
+}
+
+// failurePercent returns the share of failed forwards among the last ones
+func (c *domainCircuit) failurePercent() float64 {
+	if len(c.outcomes) == 0 {
+		return 0
+	}
+	return float64(c.failed) * 100 / float64(len(c.outcomes))
+}
+
+// circuitBreaker pauses forwarding for the domains whose deliveries keep failing, so a
+// backend outage does not spend every event's max_deliveries
+type circuitBreaker struct {
+	mu           sync.Mutex
+	domains      map[string]*domainCircuit
+	lastProgress time.Time // Held messages were last kept in progress
+}
+
+// newCircuitBreaker creates a breaker with every circuit closed
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{domains: make(map[string]*domainCircuit), lastProgress: time.Now()}
+}
+
+// domain returns the circuit of domain, creating it closed if needed; the caller holds b.mu
+func (b *circuitBreaker) domain(domain string) *domainCircuit {
+	c, ok := b.domains[domain]
+	if !ok {
+		c = &domainCircuit{state: CircuitClosed}
+		b.domains[domain] = c
+	}
+	return c
+}
+
+// admit decides what to do with a message of domain; parked messages are kept by the breaker
+func (b *circuitBreaker) admit(msg *natsgo.Msg, domain string, cfg config.DomainCircuitConfig) circuitDecision {
+	if !cfg.Enabled {
+		return circuitForward
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.domain(domain)
+	switch {
+	case c.state == CircuitClosed:
+		return circuitForward
+	case c.state == CircuitOpen && !time.Now().Before(c.nextProbe):
+		c.state = CircuitHalfOpen
+		return circuitProbe
+	case len(c.parked) < cfg.MaxParked:
+		c.parked = append(c.parked, msg)
+		return circuitParked
+	default:
+		return circuitDelay
+	}
+}
+
+// record adds the outcome of a forward of domain and opens or closes its circuit. It
+// returns the held messages to forward again when a probe closed the circuit.
+func (b *circuitBreaker) record(stream, domain string, probe, failed bool, cfg config.DomainCircuitConfig) []*natsgo.Msg {
+	if !cfg.Enabled {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.domain(domain)
+	now := time.Now()
+	if probe {
+		if failed {
+			c.state = CircuitOpen
+			c.nextProbe = now.Add(time.Duration(cfg.ProbeSeconds) * time.Second)
+			logger.LogWithDomain(zapcore.WarnLevel, "Domain circuit probe failed, forwarding stays paused",
+				zap.String("stream", stream),
+				zap.String("domain", domain),
+				zap.Int("parked", len(c.parked)),
+				zap.Time("next_probe_at", c.nextProbe),
+			)
+			return nil
+		}
+		return b.close(stream, domain, c, now)
+	}
+	if c.state != CircuitClosed {
+		// Forwarded before the circuit opened
+		return nil
+	}
+
+	if len(c.outcomes) != cfg.MinEvents {
+		c.outcomes, c.next, c.failed = make([]bool, 0, cfg.MinEvents), 0, 0
+	}
+	if len(c.outcomes) < cap(c.outcomes) {
+		c.outcomes = append(c.outcomes, failed)
+	} else {
+		if c.outcomes[c.next] {
+			c.failed--
+		}
+		c.outcomes[c.next] = failed
+		c.next = (c.next + 1) % len(c.outcomes)
+	}
+	if failed {
+		c.failed++
+	}
+
+	if len(c.outcomes) == cfg.MinEvents && c.failurePercent() >= float64(cfg.FailurePercent) {
+		c.state = CircuitOpen
+		c.openedAt = now
+		c.nextProbe = now.Add(time.Duration(cfg.ProbeSeconds) * time.Second)
+		logger.LogWithDomain(zapcore.ErrorLevel, "Domain circuit opened, forwarding paused",
+			zap.String("stream", stream),
+			zap.String("domain", domain),
+			zap.Float64("failure_percent", c.failurePercent()),
+			zap.Int("forwards", len(c.outcomes)),
+			zap.Int("probe_seconds", cfg.ProbeSeconds),
+		)
+	}
+	return nil
+}
+
+// abandon ends a probe whose outcome says nothing about the backend (e.g. a quarantined event)
+func (b *circuitBreaker) abandon(domain string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.domains[domain]; ok && c.state == CircuitHalfOpen {
+		c.state = CircuitOpen
+	}
+}
+
+// close closes the circuit of domain and returns its held messages; the caller holds b.mu
+func (b *circuitBreaker) close(stream, domain string, c *domainCircuit, now time.Time) []*natsgo.Msg {
+	parked := c.parked
+	logger.LogWithDomain(zapcore.InfoLevel, "Domain circuit closed, forwarding resumed",
+		zap.String("stream", stream),
+		zap.String("domain", domain),
+		zap.Duration("open_for", now.Sub(c.openedAt)),
+		zap.Int("parked", len(parked)),
+	)
+	*c = domainCircuit{state: CircuitClosed}
+	return parked
+}
+
+// tick keeps held messages in progress (with inProgress) every keepAlive and returns the messages to forward:
+// a held message of each open domain whose probe is due, and all held messages of every
+// domain when circuits are disabled
+func (b *circuitBreaker) tick(stream string, cfg config.DomainCircuitConfig, keepAlive time.Duration, inProgress func(*natsgo.Msg) error) []*natsgo.Msg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var resume []*natsgo.Msg
+	for domain, c := range b.domains {
+		switch {
+		case !cfg.Enabled && c.state != CircuitClosed:
+			resume = append(resume, b.close(stream, domain, c, now)...)
+		case c.state == CircuitOpen && !now.Before(c.nextProbe) && len(c.parked) > 0:
+			// admit makes it the probe when it comes back
+			resume = append(resume, c.parked[0])
+			c.parked = c.parked[1:]
+		}
+	}
+
+	if now.Sub(b.lastProgress) >= keepAlive {
+		b.lastProgress = now
+		for _, c := range b.domains {
+			for _, msg := range c.parked {
+				if err := inProgress(msg); err != nil {
+					logger.Logger.Debug("Failed to extend ack deadline of held message", zap.Error(err))
+				}
+			}
+		}
+	}
+	return resume
+}
+
+// drain returns every held message, closing all circuits
+func (b *circuitBreaker) drain() []*natsgo.Msg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var parked []*natsgo.Msg
+	for _, c := range b.domains {
+		parked = append(parked, c.parked...)
+		c.parked = nil
+	}
+	return parked
+}
+
+// states returns the circuits that are not closed, ordered by domain
+func (b *circuitBreaker) states() []CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	states := make([]CircuitState, 0)
+	for domain, c := range b.domains {
+		if c.state == CircuitClosed {
+			continue
+		}
+		states = append(states, CircuitState{
+			Domain:         domain,
+			State:          c.state,
+			FailurePercent: c.failurePercent(),
+			OpenedAt:       c.openedAt,
+			NextProbeAt:    c.nextProbe,
+			Parked:         len(c.parked),
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Domain < states[j].Domain })
+	return states
+}
+
+// monitorCircuits probes open circuits and keeps held messages in progress until Stop.
+// Settings follow config reloads.
+func (cs *ConsumerService) monitorCircuits() {
+	ticker := time.NewTicker(circuitCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cs.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cfg := cs.forwarder.GetConfig().NATS
+		keepAlive := time.Duration(cfg.AckWait) * time.Second / 2
+		cs.resume(cs.circuit.tick(cs.consumer.StreamName(), cfg.DomainCircuit, keepAlive, cs.consumer.InProgress))
+	}
+}
+
+// resume hands held messages back to the receive loop
+func (cs *ConsumerService) resume(msgs []*natsgo.Msg) {
+	if len(msgs) == 0 {
+		return
+	}
+	go func() {
+		for i, msg := range msgs {
+			select {
+			case cs.resumed <- msg:
+			case <-cs.loopDone:
+				for _, msg := range msgs[i:] {
+					cs.release(msg)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// Circuits returns the domains whose circuit is open or probing
+func (cs *ConsumerService) Circuits() []CircuitState {
+	return cs.circuit.states()
+}
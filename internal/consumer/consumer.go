@@ -3,12 +3,17 @@ package consumer
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	hubevent "calleventhub/event"
 	"calleventhub/internal/config"
 	"calleventhub/internal/forwarder"
 	"calleventhub/internal/logger"
 	"calleventhub/internal/nats"
+	"calleventhub/internal/store"
 
 	natsgo "github.com/nats-io/nats.go"
 	"go.uber.org/zap"
@@ -22,6 +27,14 @@ type ConsumerService struct {
 	config   *config.Config
 	ctx      context.Context
 	cancel   context.CancelFunc
+	inflight sync.WaitGroup // Messages currently being processed
+	loopDone chan struct{}  // Closed when Start returns
+	pool     *workerPool    // Bounds concurrently processed messages
+	lag      *lagTracker    // Pending messages per domain
+	circuit  *circuitBreaker // Domains whose forwarding is paused after repeated failures
+	resumed  chan *natsgo.Msg // Held messages to process again
+	stopping atomic.Bool    // Set by Stop: fetched messages are released instead of processed
+	limitWarned sync.Map    // Domains warned that their max_deliveries exceeds the consumer's (domain -> max_deliveries)
 }
 
 // NewConsumerService creates a new consumer service
@@ -33,14 +46,22 @@ func NewConsumerService(cfg *config.Config, natsConsumer *nats.Consumer, fwd *fo
 		config:    cfg,
 		ctx:       ctx,
 		cancel:    cancel,
+		loopDone:  make(chan struct{}),
+		pool:      newWorkerPool(cfg.NATS.Lag.MaxWorkers),
+		lag:       newLagTracker(),
+		circuit:   newCircuitBreaker(),
+		resumed:   make(chan *natsgo.Msg),
 	}
 }
 
 // Start starts consuming messages and forwarding them
 func (cs *ConsumerService) Start() error {
 	logger.Logger.Info("Starting event consumer")
+	defer close(cs.loopDone)
 
 	msgChan := cs.consumer.Messages()
+	go cs.monitorLag()
+	go cs.monitorCircuits()
 
 	for {
 		select {
@@ -52,22 +73,55 @@ func (cs *ConsumerService) Start() error {
 				logger.Logger.Info("Message channel closed")
 				return nil
 			}
-
-			// Process message in a goroutine to allow concurrent processing
-			go cs.processMessage(msg)
+			if !cs.dispatch(msg, false) {
+				return nil
+			}
+		case msg := <-cs.resumed:
+			if !cs.dispatch(msg, true) {
+				return nil
+			}
 		}
 	}
 }
 
-// processMessage processes a single message
-func (cs *ConsumerService) processMessage(msg *natsgo.Msg) {
+// dispatch processes a message on a worker; resumed is set for messages held by an open
+// domain circuit. It returns false once the consumer context is cancelled.
+func (cs *ConsumerService) dispatch(msg *natsgo.Msg, resumed bool) bool {
+	// Stopping - hand messages fetched but not started back to JetStream
+	if cs.stopping.Load() {
+		cs.release(msg)
+		return true
+	}
+
+	// Process message in a goroutine to allow concurrent processing
+	if err := cs.pool.acquire(cs.ctx); err != nil {
+		cs.release(msg)
+		logger.Logger.Info("Consumer context cancelled, stopping")
+		return false
+	}
+	cs.inflight.Add(1)
+	go func() {
+		defer cs.inflight.Done()
+		defer cs.pool.release()
+		cs.processMessage(msg, resumed)
+	}()
+	return true
+}
+
+// processMessage processes a single message; resumed is set for messages held by an open
+// domain circuit, which were already counted as received
+func (cs *ConsumerService) processMessage(msg *natsgo.Msg, resumed bool) {
 	// Extract metadata for logging
 	metadata, err := msg.Metadata()
 	deliveryAttempt := 1
 	sequence := uint64(0)
+	var receivedAt time.Time // When the event was stored in the stream (zero if unknown)
+	var numPending uint64
 	if err == nil && metadata != nil {
 		deliveryAttempt = int(metadata.NumDelivered)
 		sequence = metadata.Sequence.Stream
+		receivedAt = metadata.Timestamp
+		numPending = metadata.NumPending
 	}
 
 	// Log message received with sequence and delivery attempt for debugging
@@ -84,14 +138,51 @@ func (cs *ConsumerService) processMessage(msg *natsgo.Msg) {
 		)
 	}
 
-	// Parse event to extract domain and call_id for logging
-	var event struct {
-		CallID string `json:"call_id"`
-		Domain string `json:"domain"` // Required: used for routing
-		State  string `json:"state"`
-		Status string `json:"status"`
+	// Poison message an operator terminated via the admin API
+	if cs.consumer.ShouldTerminate(msg) {
+		if err := cs.consumer.Term(msg); err != nil {
+			logger.Logger.Error("Failed to terminate message", zap.Uint64("sequence", sequence), zap.Error(err))
+			return
+		}
+		logger.Logger.Warn("Message terminated by operator request",
+			zap.Uint64("sequence", sequence),
+			zap.Int("delivery_attempt", deliveryAttempt),
+		)
+		cs.lag.forget(sequence)
+		return
 	}
-	if err := json.Unmarshal(msg.Data, &event); err != nil {
+
+	// Already forwarded before disaster recovery (consumer recreated, stream restored)
+	if cs.consumer.AlreadyProcessed(msg) {
+		logger.Logger.Info("Skipping message already acknowledged according to dedup ledger",
+			zap.Uint64("sequence", sequence),
+			zap.Int("delivery_attempt", deliveryAttempt),
+		)
+		if err := cs.consumer.Ack(msg); err != nil {
+			logger.Logger.Error("Failed to acknowledge message", zap.Uint64("sequence", sequence), zap.Error(err))
+		}
+		cs.lag.forget(sequence)
+		return
+	}
+
+	// Decompress payload if the publisher compressed it
+	data, err := nats.DecodePayload(msg)
+	if err != nil {
+		logger.Logger.Error("Failed to decode message payload",
+			zap.Error(err),
+			zap.Uint64("sequence", sequence),
+			zap.Int("delivery_attempt", deliveryAttempt),
+		)
+		// NAK the message to trigger redelivery
+		if err := cs.consumer.Nak(msg); err != nil {
+			logger.Logger.Error("Failed to NAK message", zap.Error(err))
+		}
+		return
+	}
+
+	// Parse event to extract domain and call_id for logging
+	var event hubevent.Event
+	if err := json.Unmarshal(data, &event); err != nil {
 		logger.Logger.Error("Failed to parse event",
 			zap.Error(err),
 			zap.Uint64("sequence", sequence),
@@ -108,6 +199,7 @@ func (cs *ConsumerService) processMessage(msg *natsgo.Msg) {
 	if event.Domain == "" {
 		logger.Logger.Error("Event missing domain field",
 			zap.String("call_id", event.CallID),
+			zap.String("hub_event_id", event.HubEventID),
 			zap.Uint64("sequence", sequence),
 			zap.Int("delivery_attempt", deliveryAttempt),
 		)
@@ -121,20 +213,115 @@ func (cs *ConsumerService) processMessage(msg *natsgo.Msg) {
 	// Log processing start with sequence for tracking
 	logger.Logger.Info("Processing message",
 		zap.String("call_id", event.CallID),
+		zap.String("hub_event_id", event.HubEventID),
 		zap.String("domain", event.Domain),
 		zap.Uint64("sequence", sequence),
 		zap.Int("delivery_attempt", deliveryAttempt),
 	)
 
-	// Create context with timeout for forwarding
-	ctx, cancel := context.WithTimeout(cs.ctx, 3*time.Second)
-	defer cancel()
+	// Track the message as pending for its domain until it is acknowledged, terminated
+	// or out of deliveries
+	var forwarding time.Duration
+	maxDeliveries := cs.maxDeliveries(event.Domain)
+	finished := deliveryAttempt >= maxDeliveries
+	cs.lag.received(sequence, event.Domain, receivedAt, deliveryAttempt == 1 && !resumed)
+	defer func() { cs.lag.done(sequence, event.Domain, forwarding, finished) }()
+
+	// Domain circuit open after repeated failures - hold the message instead of spending a delivery
+	cfg := cs.forwarder.GetConfig().NATS
+	decision := cs.circuit.admit(msg, event.Domain, cfg.DomainCircuit)
+	switch decision {
+	case circuitParked:
+		logger.Logger.Debug("Message held while domain circuit is open",
+			zap.String("call_id", event.CallID),
+			zap.String("hub_event_id", event.HubEventID),
+			zap.String("domain", event.Domain),
+			zap.Uint64("sequence", sequence),
+		)
+		return
+	case circuitDelay:
+		delay := time.Duration(cfg.DomainCircuit.ProbeSeconds) * time.Second
+		if err := cs.consumer.NakWithDelay(msg, delay); err != nil {
+			logger.Logger.Error("Failed to NAK message with delay", zap.Error(err))
+		} else {
+			logger.Logger.Warn("Domain circuit open and max_parked reached, message will be redelivered",
+				zap.String("call_id", event.CallID),
+				zap.String("hub_event_id", event.HubEventID),
+				zap.String("domain", event.Domain),
+				zap.Uint64("sequence", sequence),
+				zap.Int("current_attempt", deliveryAttempt),
+				zap.Duration("retry_delay", delay),
+			)
+		}
+		return
+	}
+	probe := decision == circuitProbe
+	if probe {
+		logger.LogWithDomain(zapcore.InfoLevel, "Forwarding probe event for open domain circuit",
+			zap.String("call_id", event.CallID),
+			zap.String("hub_event_id", event.HubEventID),
+			zap.String("domain", event.Domain),
+			zap.Uint64("sequence", sequence),
+		)
+		// Not forwarded after all (shutdown, ack failure) - let another event probe
+		defer func() {
+			if probe {
+				cs.circuit.abandon(event.Domain)
+			}
+		}()
+	}
+
+	// Wait for a per-domain concurrency slot (routes with max_concurrent)
+	release, err := cs.acquireSlot(msg, event.Domain)
+	if err != nil {
+		// Shutting down - release it so another instance gets it right away
+		logger.Logger.Warn("Stopped waiting for domain concurrency slot",
+			zap.String("call_id", event.CallID),
+			zap.String("hub_event_id", event.HubEventID),
+			zap.String("domain", event.Domain),
+			zap.Uint64("sequence", sequence),
+			zap.Error(err),
+		)
+		cs.release(msg)
+		return
+	}
+	defer release()
+
+	// At-most-once routes: acknowledge first, so the event is never forwarded twice
+	atMostOnce := cs.forwarder.AtMostOnce(event.Domain)
+	if atMostOnce {
+		if err := cs.consumer.AckSync(msg); err != nil {
+			// Not forwarded yet - JetStream redelivers it after ack_wait
+			logger.Logger.Error("Failed to acknowledge at-most-once message before forwarding",
+				zap.String("call_id", event.CallID),
+				zap.String("hub_event_id", event.HubEventID),
+				zap.Uint64("sequence", sequence),
+				zap.Error(err),
+			)
+			return
+		}
+		finished = true
+		cs.consumer.MarkProcessed(msg)
+	}
 
 	// Forward event to all endpoints
-	err = cs.forwarder.ForwardEvent(ctx, msg.Data, event.Domain, deliveryAttempt)
+	forwardStart := time.Now()
+	err = cs.forward(data, event.Domain, store.Delivery{
+		Attempt:     deliveryAttempt,
+		NumPending:  numPending,
+		PublishedAt: receivedAt,
+		Replay:      msg.Header.Get(nats.ReplayHeader),
+		AtMostOnce:  atMostOnce,
+
+		MaxDeliveries: maxDeliveries,
+	})
+	forwarding = time.Since(forwardStart)
+	cs.recordOutcome(event.Domain, probe, err, cfg.DomainCircuit)
+	probe = false
 	if err != nil {
 		logger.LogWithDomain(zapcore.ErrorLevel, "Failed to forward event",
 			zap.String("call_id", event.CallID),
+			zap.String("hub_event_id", event.HubEventID),
 			zap.String("domain", event.Domain),
 			zap.String("state", event.State),
 			zap.String("status", event.Status),
@@ -142,11 +329,91 @@ func (cs *ConsumerService) processMessage(msg *natsgo.Msg) {
 			zap.Int("delivery_attempt", deliveryAttempt),
 			zap.Error(err),
 		)
+		// Already acknowledged - the event is dropped
+		if atMostOnce {
+			logger.LogWithDomain(zapcore.WarnLevel, "At-most-once event dropped after failed forward",
+				zap.String("call_id", event.CallID),
+				zap.String("hub_event_id", event.HubEventID),
+				zap.String("domain", event.Domain),
+				zap.Uint64("sequence", sequence),
+			)
+			return
+		}
+
+		// Event can never be delivered as is - it was quarantined, stop redelivering it
+		var quarantined *forwarder.QuarantineError
+		if errors.As(err, &quarantined) {
+			if termErr := cs.consumer.Term(msg); termErr != nil {
+				logger.Logger.Error("Failed to terminate quarantined message", zap.Error(termErr))
+			} else {
+				finished = true
+			}
+			return
+		}
+
+		// Cancelled by Stop - release it so another instance gets it right away
+		if cs.ctx.Err() != nil {
+			cs.release(msg)
+			return
+		}
+
+		// Last delivery of the route - give it up, also when the consumer's limit (the highest
+		// max_deliveries at startup) allows more
+		if deliveryAttempt >= maxDeliveries {
+			if termErr := cs.consumer.Term(msg); termErr != nil {
+				logger.Logger.Error("Failed to terminate message", zap.Uint64("sequence", sequence), zap.Error(termErr))
+			} else {
+				finished = true
+				logger.LogWithDomain(zapcore.WarnLevel, "Message given up after route max_deliveries",
+					zap.String("call_id", event.CallID),
+					zap.String("hub_event_id", event.HubEventID),
+					zap.String("domain", event.Domain),
+					zap.Uint64("sequence", sequence),
+					zap.Int("max_deliveries", maxDeliveries),
+				)
+			}
+			return
+		}
+
+		// Backend asked us to back off - delay redelivery by its Retry-After hint
+		var retryAfter *forwarder.RetryAfterError
+		if errors.As(err, &retryAfter) {
+			if nakErr := cs.consumer.NakWithDelay(msg, retryAfter.Delay); nakErr != nil {
+				logger.Logger.Error("Failed to NAK message with delay", zap.Error(nakErr))
+			} else {
+				logger.Logger.Warn("Message redelivery delayed by backend Retry-After",
+					zap.String("call_id", event.CallID),
+					zap.String("hub_event_id", event.HubEventID),
+					zap.Uint64("sequence", sequence),
+					zap.Int("current_attempt", deliveryAttempt),
+					zap.Duration("retry_after", retryAfter.Delay),
+				)
+			}
+			return
+		}
+
+		// Retry policy: NAK with a per-attempt delay instead of waiting for ack_wait
+		if delay := cs.forwarder.RetryDelay(event.Domain, deliveryAttempt); delay > 0 {
+			if nakErr := cs.consumer.NakWithDelay(msg, delay); nakErr != nil {
+				logger.Logger.Error("Failed to NAK message with delay", zap.Error(nakErr))
+			} else {
+				logger.Logger.Warn("Message will be redelivered after retry policy delay",
+					zap.String("call_id", event.CallID),
+					zap.String("hub_event_id", event.HubEventID),
+					zap.Uint64("sequence", sequence),
+					zap.Int("current_attempt", deliveryAttempt),
+					zap.Duration("retry_delay", delay),
+				)
+			}
+			return
+		}
+
 		// DO NOT acknowledge - let JetStream redeliver after ack_wait expires
 		// The message will be redelivered automatically by JetStream
 		// This will cause delivery_attempt to increase on next delivery
 		logger.Logger.Warn("Message will be redelivered by JetStream",
 			zap.String("call_id", event.CallID),
+			zap.String("hub_event_id", event.HubEventID),
 			zap.Uint64("sequence", sequence),
 			zap.Int("current_attempt", deliveryAttempt),
 		)
@@ -154,17 +421,30 @@ func (cs *ConsumerService) processMessage(msg *natsgo.Msg) {
 	}
 
 	// All endpoints succeeded - acknowledge the message
+	if atMostOnce {
+		logger.Logger.Info("At-most-once event forwarded",
+			zap.String("call_id", event.CallID),
+			zap.String("hub_event_id", event.HubEventID),
+			zap.String("domain", event.Domain),
+			zap.Uint64("sequence", sequence),
+		)
+		return
+	}
 	if err := cs.consumer.Ack(msg); err != nil {
 		logger.Logger.Error("Failed to acknowledge message",
 			zap.String("call_id", event.CallID),
+			zap.String("hub_event_id", event.HubEventID),
 			zap.Uint64("sequence", sequence),
 			zap.Error(err),
 		)
 		return
 	}
+	finished = true
+	cs.consumer.MarkProcessed(msg)
 
 	logger.Logger.Info("Event processed and acknowledged",
 		zap.String("call_id", event.CallID),
+		zap.String("hub_event_id", event.HubEventID),
 		zap.String("domain", event.Domain),
 		zap.String("state", event.State),
 		zap.String("status", event.Status),
@@ -173,9 +453,145 @@ func (cs *ConsumerService) processMessage(msg *natsgo.Msg) {
 	)
 }
 
-// Stop stops the consumer service
-func (cs *ConsumerService) Stop() {
+// recordOutcome feeds a forward's outcome to the domain circuit. Quarantined events and
+// forwards cancelled by Stop say nothing about the backend and are not counted.
+func (cs *ConsumerService) recordOutcome(domain string, probe bool, err error, cfg config.DomainCircuitConfig) {
+	var quarantined *forwarder.QuarantineError
+	if errors.As(err, &quarantined) || (err != nil && cs.ctx.Err() != nil) {
+		if probe {
+			cs.circuit.abandon(domain)
+		}
+		return
+	}
+	cs.resume(cs.circuit.record(cs.consumer.StreamName(), domain, probe, err != nil, cfg))
+}
+
+// maxDeliveries returns how many times an event of the domain is delivered: the route's
+// max_deliveries of the current config, capped by the consumer's limit. JetStream redelivers
+// no more than the limit it was given at startup, so a reload raising max_deliveries above it
+// only takes effect after a restart.
+func (cs *ConsumerService) maxDeliveries(domain string) int {
+	maxDeliveries := cs.forwarder.MaxDeliveries(domain)
+	limit := cs.consumer.MaxDeliver()
+	if limit <= 0 || maxDeliveries <= limit {
+		return maxDeliveries
+	}
+	if warned, _ := cs.limitWarned.Swap(domain, maxDeliveries); warned != maxDeliveries {
+		logger.Logger.Warn("Route max_deliveries is above the NATS consumer's limit, restart to raise it",
+			zap.String("domain", domain),
+			zap.Int("max_deliveries", maxDeliveries),
+			zap.Int("consumer_max_deliveries", limit),
+		)
+	}
+	return limit
+}
+
+// forward forwards an event within the lease of its message (nats.ack_wait_seconds).
+// Requests time out by their endpoint's timeout_ms, which config validation keeps below
+// ack_wait together with the fallback endpoints tried after them; a forward still running
+// when the lease ends would race the redelivery.
+func (cs *ConsumerService) forward(data []byte, domain string, delivery store.Delivery) error {
+	ackWait := time.Duration(cs.forwarder.GetConfig().NATS.AckWait) * time.Second
+	ctx, cancel := context.WithTimeout(cs.ctx, ackWait)
+	defer cancel()
+	return cs.forwarder.ForwardEvent(ctx, data, domain, delivery)
+}
+
+// acquireSlot waits for a concurrency slot for the domain, signalling
+// progress to JetStream while waiting so the message is not redelivered
+func (cs *ConsumerService) acquireSlot(msg *natsgo.Msg, domain string) (func(), error) {
+	waitCtx, stopWaiting := context.WithCancel(cs.ctx)
+	defer stopWaiting()
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cs.config.NATS.AckWait) * time.Second / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-waitCtx.Done():
+				return
+			case <-ticker.C:
+				if err := cs.consumer.InProgress(msg); err != nil {
+					logger.Logger.Debug("Failed to extend ack deadline", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	return cs.forwarder.AcquireSlot(waitCtx, domain)
+}
+
+// Drain stops fetching new messages and waits for in-flight forwards to
+// finish. It returns ctx.Err() if the deadline expires first; messages still
+// in flight at that point are redelivered by JetStream after ack_wait.
+func (cs *ConsumerService) Drain(ctx context.Context) error {
+	logger.Logger.Info("Draining consumer service")
+	cs.consumer.StopFetching()
+
+	// Wait for the receive loop to exit so no new work is started
+	select {
+	case <-cs.loopDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	cs.releaseHeld()
+
+	return cs.waitInflight(ctx)
+}
+
+// waitInflight waits for in-flight forwards to finish, or returns ctx.Err() if ctx is done first
+func (cs *ConsumerService) waitInflight(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		cs.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Logger.Info("All in-flight messages processed")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop stops the consumer service. Fetching stops first; messages already fetched but
+// not started are NAKed so another instance receives them immediately instead of after
+// ack_wait. In-flight forwards get until ctx is done to finish, then they are cancelled
+// and their messages NAKed too. Call it before closing the NATS consumer.
+func (cs *ConsumerService) Stop(ctx context.Context) {
 	logger.Logger.Info("Stopping consumer service")
+	cs.stopping.Store(true)
+	cs.consumer.StopFetching()
+
+	// The receive loop releases the buffered messages and exits once the fetch goroutine has
+	select {
+	case <-cs.loopDone:
+	case <-ctx.Done():
+	}
+	cs.releaseHeld()
+	if err := cs.waitInflight(ctx); err != nil {
+		logger.Logger.Warn("Stop deadline exceeded, cancelling in-flight forwards", zap.Error(err))
+	}
 	cs.cancel()
 }
 
+// release NAKs a message without delay so it is redelivered right away
+func (cs *ConsumerService) release(msg *natsgo.Msg) {
+	if err := cs.consumer.Nak(msg); err != nil {
+		logger.Logger.Error("Failed to NAK message", zap.Error(err))
+	}
+}
+
+// releaseHeld NAKs the messages held by open domain circuits, so another instance can
+// take them right away
+func (cs *ConsumerService) releaseHeld() {
+	held := cs.circuit.drain()
+	for _, msg := range held {
+		cs.release(msg)
+	}
+	if len(held) > 0 {
+		logger.Logger.Info("Released messages held by open domain circuits", zap.Int("messages", len(held)))
+	}
+}
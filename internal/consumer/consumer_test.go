@@ -0,0 +1,158 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/forwarder"
+	"calleventhub/internal/logger"
+	"calleventhub/internal/nats"
+	"calleventhub/internal/store"
+
+	"go.uber.org/zap"
+)
+
+// A route's timeout_ms above the former fixed 3s forward deadline must be honored, e.g. for
+// a slow CRM webhook
+func TestForwardHonorsEndpointTimeoutAbove3s(t *testing.T) {
+	logger.Logger = zap.NewNop()
+
+	delay := 3500 * time.Millisecond
+	received := make(chan struct{}, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusOK)
+		received <- struct{}{}
+	}))
+	defer backend.Close()
+
+	cfg, err := config.Parse([]byte(fmt.Sprintf(`
+nats: {url: "nats://localhost:4222", stream_name: CALL_EVENTS, subject_pattern: "events.>", ack_wait_seconds: 30, max_deliveries: 5}
+server: {port: 8080}
+routes:
+  - domain: crm.example.com
+    endpoints:
+      - url: %q
+        timeout_ms: 10000
+`, backend.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd := forwarder.NewForwarder(cfg, nil)
+	defer fwd.Close()
+	cs := &ConsumerService{forwarder: fwd, config: cfg, ctx: context.Background()}
+
+	start := time.Now()
+	err = cs.forward([]byte(`{"domain":"crm.example.com","call_id":"c1"}`), "crm.example.com", store.Delivery{Attempt: 1})
+	if err != nil {
+		t.Fatalf("forward failed after %s: %v", time.Since(start), err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Fatalf("forward returned after %s, before the backend answered", elapsed)
+	}
+	select {
+	case <-received:
+	default:
+		t.Fatal("backend did not answer")
+	}
+}
+
+// A reload raising a route's max_deliveries above the consumer's limit is capped by it, and
+// lowering it below applies right away
+func TestMaxDeliveriesCappedByConsumer(t *testing.T) {
+	logger.Logger = zap.NewNop()
+
+	routes := func(maxDeliveries int) []byte {
+		return []byte(fmt.Sprintf(`
+nats: {url: "nats://localhost:4222", stream_name: CALL_EVENTS, subject_pattern: "events.>", ack_wait_seconds: 30, max_deliveries: 5}
+server: {port: 8080}
+routes:
+  - domain: crm.example.com
+    max_deliveries: %d
+    endpoints:
+      - url: http://127.0.0.1:9/events
+`, maxDeliveries))
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, routes(3), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd := forwarder.NewForwarder(cfg, nil)
+	defer fwd.Close()
+	natsConsumer := nats.NewDevConsumer(nats.NewDevQueue("CALL_EVENTS"), "test", cfg.NATS.AckWait, cfg.MaxDeliveryLimit(), 0)
+	defer natsConsumer.Close()
+	cs := NewConsumerService(cfg, natsConsumer, fwd)
+
+	if got := cs.maxDeliveries("crm.example.com"); got != 3 {
+		t.Fatalf("maxDeliveries = %d, want the route's 3", got)
+	}
+
+	if err := os.WriteFile(path, routes(8), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fwd.ReloadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := cs.maxDeliveries("crm.example.com"); got != 5 {
+		t.Fatalf("maxDeliveries after reload = %d, want the consumer's limit 5", got)
+	}
+}
+
+// An event is given up after its route's max_deliveries even when the consumer allows more,
+// e.g. an existing consumer created with a higher limit
+func TestTermAfterRouteMaxDeliveries(t *testing.T) {
+	logger.Logger = zap.NewNop()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	cfg, err := config.Parse([]byte(fmt.Sprintf(`
+nats: {url: "nats://localhost:4222", stream_name: CALL_EVENTS, subject_pattern: "events.>", ack_wait_seconds: 30, max_deliveries: 1}
+server: {port: 8080}
+routes:
+  - domain: crm.example.com
+    endpoints:
+      - url: %q
+`, backend.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd := forwarder.NewForwarder(cfg, nil)
+	defer fwd.Close()
+	queue := nats.NewDevQueue("CALL_EVENTS")
+	publisher := nats.NewDevPublisher(queue, "events.>")
+	natsConsumer := nats.NewDevConsumer(queue, "test", cfg.NATS.AckWait, 10, 0)
+	defer natsConsumer.Close()
+	cs := NewConsumerService(cfg, natsConsumer, fwd)
+
+	if err := publisher.Publish([]byte(`{"domain":"crm.example.com","call_id":"c1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-natsConsumer.Messages():
+		cs.processMessage(msg, false)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not delivered")
+	}
+
+	lag, err := natsConsumer.Lag()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag.AckPending != 0 || lag.Pending != 0 {
+		t.Fatalf("message still pending after its last delivery: %+v", lag)
+	}
+}
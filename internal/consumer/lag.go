@@ -0,0 +1,389 @@
+package consumer
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+	"calleventhub/internal/nats"
+)
+
+// lagCheckInterval is how often per-domain lag is evaluated and the worker pool resized
+const lagCheckInterval = 10 * time.Second
+
+// retryForget is how long a message waiting for redelivery is counted as pending; after
+// that it is assumed to have been delivered to another instance (or exhausted)
+const retryForget = time.Hour
+
+// DomainLag is the backlog of one domain on a consumer
+type DomainLag struct {
+	Domain           string  `json:"domain"`
+	Pending          int     `json:"pending"`            // Received and not yet acknowledged, or waiting for redelivery
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"` // Since the oldest pending message was stored in the stream
+	RatePerSecond    float64 `json:"rate_per_second"`    // New messages received per second in the last interval
+	AvgProcessingMs  float64 `json:"avg_processing_ms"`  // Average forwarding time
+	SuggestedWorkers int     `json:"suggested_workers"`  // Workers needed to keep up and drain the backlog in time
+	Alarm            bool    `json:"alarm"`
+}
+
+// LagReport is the lag of one consumer, by domain. The stream is shared by all domains,
+// so messages not yet delivered to the consumer are only known as a total.
+type LagReport struct {
+	Stream               string         `json:"stream"`
+	StreamPending        uint64         `json:"stream_pending"`         // Messages not yet delivered to the consumer
+	AckPending           int            `json:"ack_pending"`            // Delivered to the consumer and not yet acknowledged
+	MaxAckPending        int            `json:"max_ack_pending"`        // The server stops delivering at this many (-1 = unlimited)
+	Throttled            bool           `json:"throttled"`              // ack_pending reached max_ack_pending
+	OldestUnackedSeconds float64        `json:"oldest_unacked_seconds"` // Age of the oldest message not yet acknowledged, delivered or not (0 = caught up)
+	Workers              int            `json:"workers"`                // Worker pool size from now on (0 = unlimited)
+	SuggestedWorkers     int            `json:"suggested_workers"`      // Sum of the domains' suggestions, within the configured bounds
+	Domains              []DomainLag    `json:"domains"`
+	Circuits             []CircuitState `json:"circuits"` // Domains whose forwarding is paused (see nats.domain_circuit)
+	CheckedAt            time.Time      `json:"checked_at"`
+}
+
+// pendingMessage is a message of a domain that has not been acknowledged yet
+type pendingMessage struct {
+	domain       string
+	storedAt     time.Time // When it was stored in the stream
+	waitingSince time.Time // When it was left for redelivery (zero while being processed)
+}
+
+// domainStats are a domain's counters since the last check
+type domainStats struct {
+	received   int           // First deliveries
+	forwarded  int           // Forward attempts
+	forwarding time.Duration // Time spent in them
+}
+
+// lagTracker follows the pending messages of each domain on one consumer
+type lagTracker struct {
+	mu         sync.Mutex
+	pending    map[uint64]*pendingMessage // By stream sequence
+	stats      map[string]*domainStats
+	avgMs      map[string]float64 // Last known average forwarding time per domain
+	alarms     map[string]bool
+	throttled  bool // The consumer was at max_ack_pending at the last check
+	lastReport LagReport
+	lastCheck  time.Time
+}
+
+// newLagTracker creates an empty tracker
+func newLagTracker() *lagTracker {
+	return &lagTracker{
+		pending:   make(map[uint64]*pendingMessage),
+		stats:     make(map[string]*domainStats),
+		avgMs:     make(map[string]float64),
+		alarms:    make(map[string]bool),
+		lastCheck: time.Now(),
+	}
+}
+
+// received records the delivery of a message of domain
+func (t *lagTracker) received(seq uint64, domain string, storedAt time.Time, firstDelivery bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[seq] = &pendingMessage{domain: domain, storedAt: storedAt}
+	if firstDelivery {
+		t.domainStats(domain).received++
+	}
+}
+
+// done records the outcome of a delivery: the time spent forwarding (0 if it was not
+// forwarded) and whether the message is finished or will be delivered again
+func (t *lagTracker) done(seq uint64, domain string, forwarding time.Duration, finished bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if forwarding > 0 {
+		stats := t.domainStats(domain)
+		stats.forwarded++
+		stats.forwarding += forwarding
+	}
+	if finished {
+		delete(t.pending, seq)
+	} else if p, ok := t.pending[seq]; ok {
+		p.waitingSince = time.Now()
+	}
+}
+
+// forget drops a message that was settled without being forwarded
+func (t *lagTracker) forget(seq uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, seq)
+}
+
+// domainStats returns the counters of domain, creating them if needed
+func (t *lagTracker) domainStats(domain string) *domainStats {
+	stats, ok := t.stats[domain]
+	if !ok {
+		stats = &domainStats{}
+		t.stats[domain] = stats
+	}
+	return stats
+}
+
+// check computes the lag of every domain with pending messages or recent traffic, resets
+// the interval counters and raises or clears alarms. oldestUnacked is when the oldest
+// message not yet acknowledged was stored (zero if there is none or it is unknown).
+func (t *lagTracker) check(stream string, consumerLag nats.ConsumerLag, oldestUnacked time.Time, cfg config.LagConfig) LagReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	interval := now.Sub(t.lastCheck).Seconds()
+	t.lastCheck = now
+
+	domains := make(map[string]*DomainLag)
+	lagOf := func(domain string) *DomainLag {
+		d, ok := domains[domain]
+		if !ok {
+			d = &DomainLag{Domain: domain}
+			domains[domain] = d
+		}
+		return d
+	}
+
+	for seq, p := range t.pending {
+		if !p.waitingSince.IsZero() && now.Sub(p.waitingSince) > retryForget {
+			delete(t.pending, seq)
+			continue
+		}
+		d := lagOf(p.domain)
+		d.Pending++
+		if !p.storedAt.IsZero() {
+			d.OldestAgeSeconds = math.Max(d.OldestAgeSeconds, now.Sub(p.storedAt).Seconds())
+		}
+	}
+	for domain, stats := range t.stats {
+		d := lagOf(domain)
+		if interval > 0 {
+			d.RatePerSecond = float64(stats.received) / interval
+		}
+		if stats.forwarded > 0 {
+			t.avgMs[domain] = float64(stats.forwarding) / float64(time.Millisecond) / float64(stats.forwarded)
+		}
+	}
+	t.stats = make(map[string]*domainStats)
+
+	drain := float64(cfg.DrainTargetSeconds)
+	if drain <= 0 {
+		drain = 60
+	}
+
+	report := LagReport{
+		Stream:        stream,
+		StreamPending: consumerLag.Pending,
+		AckPending:    consumerLag.AckPending,
+		MaxAckPending: consumerLag.MaxAckPending,
+		Throttled:     consumerLag.MaxAckPending > 0 && consumerLag.AckPending >= consumerLag.MaxAckPending,
+		Domains:       make([]DomainLag, 0, len(domains)),
+		CheckedAt:     now,
+	}
+	if !oldestUnacked.IsZero() {
+		report.OldestUnackedSeconds = math.Max(0, now.Sub(oldestUnacked).Seconds())
+	}
+	t.updateThrottled(report)
+	for _, d := range domains {
+		d.AvgProcessingMs = t.avgMs[d.Domain]
+
+		// Little's law: workers busy = throughput needed x time per message
+		needed := d.RatePerSecond + float64(d.Pending)/drain
+		d.SuggestedWorkers = int(math.Ceil(needed * d.AvgProcessingMs / 1000))
+		if d.Pending > 0 && d.SuggestedWorkers == 0 {
+			d.SuggestedWorkers = 1
+		}
+		report.SuggestedWorkers += d.SuggestedWorkers
+
+		d.Alarm = (cfg.AlarmPending > 0 && d.Pending > cfg.AlarmPending) ||
+			(cfg.AlarmAgeSeconds > 0 && d.OldestAgeSeconds > float64(cfg.AlarmAgeSeconds))
+		t.updateAlarm(stream, d)
+
+		report.Domains = append(report.Domains, *d)
+	}
+	for domain := range t.alarms {
+		if _, ok := domains[domain]; !ok {
+			t.updateAlarm(stream, &DomainLag{Domain: domain})
+		}
+	}
+	sort.Slice(report.Domains, func(i, j int) bool { return report.Domains[i].Domain < report.Domains[j].Domain })
+
+	if report.SuggestedWorkers < cfg.MinWorkers {
+		report.SuggestedWorkers = cfg.MinWorkers
+	}
+	if cfg.MaxWorkers > 0 && report.SuggestedWorkers > cfg.MaxWorkers {
+		report.SuggestedWorkers = cfg.MaxWorkers
+	}
+	report.Workers = cfg.MaxWorkers
+	if cfg.AutoScale {
+		report.Workers = report.SuggestedWorkers
+	}
+
+	t.lastReport = report
+	return report
+}
+
+// updateThrottled logs when the consumer reaches max_ack_pending, where the server stops
+// delivering messages until some are acknowledged, and when it drops below again
+func (t *lagTracker) updateThrottled(report LagReport) {
+	if report.Throttled == t.throttled {
+		return
+	}
+	t.throttled = report.Throttled
+	if report.Throttled {
+		logger.Logger.Warn("Consumer at max_ack_pending, delivery throttled",
+			zap.String("stream", report.Stream),
+			zap.Int("ack_pending", report.AckPending),
+			zap.Int("max_ack_pending", report.MaxAckPending),
+			zap.Uint64("stream_pending", report.StreamPending),
+		)
+		return
+	}
+	logger.Logger.Info("Consumer below max_ack_pending again",
+		zap.String("stream", report.Stream),
+		zap.Int("ack_pending", report.AckPending),
+	)
+}
+
+// updateAlarm logs when a domain's alarm is raised or cleared
+func (t *lagTracker) updateAlarm(stream string, d *DomainLag) {
+	if d.Alarm == t.alarms[d.Domain] {
+		return
+	}
+	if d.Alarm {
+		t.alarms[d.Domain] = true
+		logger.Logger.Warn("Domain consumer lag alarm",
+			zap.String("stream", stream),
+			zap.String("domain", d.Domain),
+			zap.Int("pending", d.Pending),
+			zap.Float64("oldest_age_seconds", d.OldestAgeSeconds),
+			zap.Int("suggested_workers", d.SuggestedWorkers),
+		)
+		return
+	}
+	delete(t.alarms, d.Domain)
+	logger.Logger.Info("Domain consumer lag alarm cleared",
+		zap.String("stream", stream),
+		zap.String("domain", d.Domain),
+		zap.Int("pending", d.Pending),
+	)
+}
+
+// report returns the result of the last check
+func (t *lagTracker) report() LagReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report := t.lastReport
+	report.Domains = append([]DomainLag(nil), report.Domains...)
+	return report
+}
+
+// workerPool bounds how many messages are processed at once; its size can change at any time
+type workerPool struct {
+	mu     sync.Mutex
+	size   int // 0 = unlimited
+	active int
+	wake   chan struct{} // Closed when a worker is released or the pool is resized
+}
+
+// newWorkerPool creates a pool of size workers (0 = unlimited)
+func newWorkerPool(size int) *workerPool {
+	return &workerPool{size: size, wake: make(chan struct{})}
+}
+
+// acquire waits for a free worker
+func (p *workerPool) acquire(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		if p.size <= 0 || p.active < p.size {
+			p.active++
+			p.mu.Unlock()
+			return nil
+		}
+		wake := p.wake
+		p.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees a worker
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active--
+	p.signal()
+}
+
+// resize changes the pool size; running workers above the new size finish normally
+func (p *workerPool) resize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = size
+	p.signal()
+}
+
+// getSize returns the pool size
+func (p *workerPool) getSize() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// signal wakes all waiters; the caller holds p.mu
+func (p *workerPool) signal() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// monitorLag checks the lag every lagCheckInterval and resizes the worker pool (to the
+// suggested count with auto_scale). Thresholds and bounds follow config reloads.
+func (cs *ConsumerService) monitorLag() {
+	ticker := time.NewTicker(lagCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cs.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cfg := cs.forwarder.GetConfig().NATS.Lag
+		consumerLag, err := cs.consumer.Lag()
+		if err != nil {
+			logger.Logger.Debug("Failed to read consumer lag", zap.String("stream", cs.consumer.StreamName()), zap.Error(err))
+		}
+		oldestUnacked, err := cs.consumer.OldestUnacked()
+		if err != nil {
+			logger.Logger.Debug("Failed to read oldest unacknowledged message", zap.String("stream", cs.consumer.StreamName()), zap.Error(err))
+		}
+		report := cs.lag.check(cs.consumer.StreamName(), consumerLag, oldestUnacked, cfg)
+
+		if previous := cs.pool.getSize(); report.Workers != previous {
+			cs.pool.resize(report.Workers)
+			logger.Logger.Info("Resized consumer worker pool",
+				zap.String("stream", report.Stream),
+				zap.Int("workers", report.Workers),
+				zap.Int("previous", previous),
+				zap.Uint64("stream_pending", report.StreamPending),
+			)
+		}
+	}
+}
+
+// Lag returns the per-domain lag measured at the last check, with the current domain circuits
+func (cs *ConsumerService) Lag() LagReport {
+	report := cs.lag.report()
+	report.Circuits = cs.Circuits()
+	return report
+}
@@ -0,0 +1,193 @@
+// Package correlation groups the call legs of one logical call.
+//
+// PBXs give each leg of a transferred or bridged call its own call_id, but the
+// legs share other identifiers (sip_call_id, a bridge ID) or refer to each
+// other's call_id (the call a leg was transferred from). Such calls are merged
+// into one group, identified by the call_id of the first leg seen.
+package correlation
+
+import "sync"
+
+// DefaultMaxCalls bounds how many call_ids are tracked when no limit is configured
+const DefaultMaxCalls = 10000
+
+// Correlator assigns correlation IDs to call legs. It is safe for concurrent use.
+type Correlator struct {
+	mu       sync.Mutex
+	maxCalls int
+	calls    map[string]*group // call_id -> group
+	keys     map[string]*group // scope, key name and value -> group
+	order    []*group          // Groups by creation, oldest first, for eviction
+	size     int               // Number of call_ids tracked
+}
+
+// group is one logical call
+type group struct {
+	id      string   // call_id of the first leg
+	calls   []string // All call_ids of the legs
+	keys    []string // Index entries pointing at the group
+	evicted bool     // Merged into another group or dropped
+}
+
+// New creates a correlator tracking at most maxCalls call_ids (0 = DefaultMaxCalls);
+// the oldest logical calls are forgotten first
+func New(maxCalls int) *Correlator {
+	if maxCalls <= 0 {
+		maxCalls = DefaultMaxCalls
+	}
+	return &Correlator{
+		maxCalls: maxCalls,
+		calls:    make(map[string]*group),
+		keys:     make(map[string]*group),
+	}
+}
+
+// Resolve records a leg's correlation key values (key name -> value) and the call_ids of
+// other legs it refers to (e.g. the call it was transferred from), and returns the
+// correlation ID of its logical call. Key values only link legs of the same scope
+// (the domain), so tenants reusing IDs are never merged. Empty values are ignored.
+func (c *Correlator) Resolve(scope, callID string, values map[string]string, refs []string) string {
+	if callID == "" {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g := c.track(callID)
+
+	merged := false
+	for _, ref := range refs {
+		if ref == "" || ref == callID {
+			continue
+		}
+		if other := c.track(ref); other != g {
+			g = c.merge(other, g)
+			merged = true
+		}
+	}
+	for name, value := range values {
+		if value == "" {
+			continue
+		}
+		key := scope + "\x00" + name + "\x00" + value
+		other, ok := c.keys[key]
+		if !ok {
+			c.keys[key] = g
+			g.keys = append(g.keys, key)
+			continue
+		}
+		if other != g {
+			g = c.merge(other, g)
+			merged = true
+		}
+	}
+
+	if merged || c.size > c.maxCalls {
+		c.evict(g)
+	}
+	return g.id
+}
+
+// track returns the group of callID, starting a new logical call if it is not known
+func (c *Correlator) track(callID string) *group {
+	g, ok := c.calls[callID]
+	if !ok {
+		g = &group{id: callID, calls: []string{callID}}
+		c.calls[callID] = g
+		c.order = append(c.order, g)
+		c.size++
+	}
+	return g
+}
+
+// Calls returns the correlation ID and all known call_ids of the logical call that
+// callID belongs to (just callID if it is not tracked)
+func (c *Correlator) Calls(callID string) (string, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.calls[callID]
+	if !ok {
+		return callID, []string{callID}
+	}
+	return g.id, append([]string(nil), g.calls...)
+}
+
+// Forget drops the logical call that callID belongs to, with all its legs and key
+// values, so no record of the call is kept (erasure requests). Reports whether it was tracked.
+func (c *Correlator) Forget(callID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.calls[callID]
+	if !ok {
+		return false
+	}
+	for _, leg := range g.calls {
+		delete(c.calls, leg)
+	}
+	for _, key := range g.keys {
+		delete(c.keys, key)
+	}
+	c.size -= len(g.calls)
+	g.evicted = true
+	c.evict(nil)
+	return true
+}
+
+// merge moves the newer group into the older one, so the correlation ID of a call
+// only changes if one of its legs turns out to belong to an earlier call
+func (c *Correlator) merge(a, b *group) *group {
+	keep, drop := a, b
+	if c.index(b) < c.index(a) {
+		keep, drop = b, a
+	}
+	for _, callID := range drop.calls {
+		c.calls[callID] = keep
+	}
+	for _, key := range drop.keys {
+		c.keys[key] = keep
+	}
+	keep.calls = append(keep.calls, drop.calls...)
+	keep.keys = append(keep.keys, drop.keys...)
+	drop.evicted = true
+	return keep
+}
+
+// index returns the group's position in creation order
+func (c *Correlator) index(g *group) int {
+	for i, other := range c.order {
+		if other == g {
+			return i
+		}
+	}
+	return len(c.order)
+}
+
+// evict forgets the oldest logical calls (other than current) until the limit is met,
+// and drops merged groups from the creation order
+func (c *Correlator) evict(current *group) {
+	kept := c.order[:0]
+	for _, g := range c.order {
+		if g.evicted {
+			continue
+		}
+		if c.size > c.maxCalls && g != current {
+			for _, callID := range g.calls {
+				delete(c.calls, callID)
+			}
+			for _, key := range g.keys {
+				delete(c.keys, key)
+			}
+			c.size -= len(g.calls)
+			g.evicted = true
+			continue
+		}
+		kept = append(kept, g)
+	}
+	for i := len(kept); i < len(c.order); i++ {
+		c.order[i] = nil
+	}
+	c.order = kept
+}
@@ -0,0 +1,220 @@
+package fleet
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/clock"
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+	"calleventhub/internal/store"
+)
+
+// Report is the config fingerprint an instance publishes to the fleet subject
+type Report struct {
+	InstanceID string    `json:"instance_id"`
+	ConfigHash string    `json:"config_hash"`
+	RouteCount int       `json:"route_count"`
+	StartedAt  time.Time `json:"started_at"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+// InstanceStatus is a fleet member as seen by this instance
+type InstanceStatus struct {
+	Report
+	LastSeen time.Time `json:"last_seen"`
+	Stale    bool      `json:"stale"` // No report received within 3 intervals
+	Self     bool      `json:"self"`
+}
+
+// Reporter periodically publishes this instance's config hash and collects
+// reports from other instances to detect configuration drift
+type Reporter struct {
+	conn       *nats.Conn
+	sub        *nats.Subscription
+	subject    string
+	instanceID string
+	startedAt  time.Time
+	interval   time.Duration
+	getConfig  func() *config.Config
+	clock      clock.Clock
+
+	// Stats requests answered by this instance (see EnableStats)
+	statsSubject string
+	statsSub     *nats.Subscription
+	counts       func() store.Counts
+
+	peers     map[string]InstanceStatus
+	driftSeen map[string]string // instance_id -> last hash reported as drifted
+	mu        sync.RWMutex
+	stopChan  chan struct{}
+}
+
+// NewReporter connects to NATS and subscribes to fleet reports
+func NewReporter(url, subject, instanceID string, interval time.Duration, getConfig func() *config.Config) (*Reporter, error) {
+	opts := []nats.Option{
+		nats.Name("event-hub-fleet"),
+		nats.ReconnectWait(2 * time.Second),
+		nats.MaxReconnects(-1),
+	}
+
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reporter{
+		conn:       conn,
+		subject:    subject,
+		instanceID: instanceID,
+		startedAt:  time.Now(),
+		interval:   interval,
+		getConfig:  getConfig,
+		clock:      clock.Real,
+		peers:      make(map[string]InstanceStatus),
+		driftSeen:  make(map[string]string),
+		stopChan:   make(chan struct{}),
+	}
+
+	sub, err := conn.Subscribe(subject, r.handleReport)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r.sub = sub
+
+	return r, nil
+}
+
+// SetClock sets the time source of reports and staleness (the system clock by default);
+// call it before Start
+func (r *Reporter) SetClock(c clock.Clock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clock = c
+	r.startedAt = c.Now()
+}
+
+// Start publishes reports every interval until Stop is called
+func (r *Reporter) Start() {
+	ticker := r.clock.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.publish()
+	for {
+		select {
+		case <-ticker.C():
+			r.publish()
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+// Stop stops reporting and closes the connection
+func (r *Reporter) Stop() {
+	close(r.stopChan)
+	if r.sub != nil {
+		_ = r.sub.Unsubscribe()
+	}
+	if r.statsSub != nil {
+		_ = r.statsSub.Unsubscribe()
+	}
+	r.conn.Close()
+}
+
+// publish sends this instance's current report
+func (r *Reporter) publish() {
+	cfg := r.getConfig()
+	if cfg == nil {
+		return
+	}
+
+	report := Report{
+		InstanceID: r.instanceID,
+		ConfigHash: cfg.Hash(),
+		RouteCount: len(cfg.Routes),
+		StartedAt:  r.startedAt,
+		ReportedAt: r.clock.Now(),
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		logger.Logger.Warn("Failed to marshal fleet report", zap.Error(err))
+		return
+	}
+
+	if err := r.conn.Publish(r.subject, data); err != nil {
+		logger.Logger.Warn("Failed to publish fleet report", zap.Error(err))
+	}
+}
+
+// handleReport records a report received from any instance (including this one)
+func (r *Reporter) handleReport(msg *nats.Msg) {
+	var report Report
+	if err := json.Unmarshal(msg.Data, &report); err != nil || report.InstanceID == "" {
+		logger.Logger.Debug("Ignoring invalid fleet report", zap.Error(err))
+		return
+	}
+
+	self := report.InstanceID == r.instanceID
+	localHash := ""
+	if cfg := r.getConfig(); cfg != nil {
+		localHash = cfg.Hash()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.peers[report.InstanceID] = InstanceStatus{
+		Report:   report,
+		LastSeen: r.clock.Now(),
+		Self:     self,
+	}
+
+	// Warn once per instance and hash when a peer runs a different config
+	if !self && report.ConfigHash != localHash && r.driftSeen[report.InstanceID] != report.ConfigHash {
+		r.driftSeen[report.InstanceID] = report.ConfigHash
+		logger.Logger.Warn("Config drift detected",
+			zap.String("remote_instance_id", report.InstanceID),
+			zap.String("remote_config_hash", report.ConfigHash),
+			zap.String("local_config_hash", localHash),
+		)
+	} else if report.ConfigHash == localHash {
+		delete(r.driftSeen, report.InstanceID)
+	}
+}
+
+// Snapshot returns the known instances (sorted by instance ID), grouped
+// config versions of live instances, and whether live instances disagree
+func (r *Reporter) Snapshot() ([]InstanceStatus, map[string]int, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	staleAfter := 3 * r.interval
+	instances := make([]InstanceStatus, 0, len(r.peers))
+	versions := make(map[string]int)
+	for _, status := range r.peers {
+		status.Stale = clock.Since(r.clock, status.LastSeen) > staleAfter
+		if !status.Stale {
+			versions[status.ConfigHash]++
+		}
+		instances = append(instances, status)
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].InstanceID < instances[j].InstanceID
+	})
+
+	return instances, versions, len(versions) > 1
+}
+
+// InstanceID returns this instance's identifier
+func (r *Reporter) InstanceID() string {
+	return r.instanceID
+}
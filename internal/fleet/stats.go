@@ -0,0 +1,133 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+	"calleventhub/internal/store"
+)
+
+// StatsTimeout is how long CollectStats waits for the other instances to answer
+const StatsTimeout = 2 * time.Second
+
+// InstanceStats are the counts one instance answers to a fleet stats request
+type InstanceStats struct {
+	InstanceID  string       `json:"instance_id"`
+	Counts      store.Counts `json:"counts"`
+	CollectedAt time.Time    `json:"collected_at"`
+}
+
+// Stats are the counts of every instance that answered, and their sum
+type Stats struct {
+	Instances []InstanceStats `json:"instances"` // Sorted by instance ID
+	Total     store.Counts    `json:"total"`
+	Missing   []string        `json:"missing,omitempty"` // Live instances (per their config reports) that did not answer in time
+}
+
+// EnableStats answers the stats requests of other instances on subject with counts
+func (r *Reporter) EnableStats(subject string, counts func() store.Counts) error {
+	sub, err := r.conn.Subscribe(subject, func(msg *nats.Msg) {
+		if msg.Reply == "" {
+			return
+		}
+		data, err := json.Marshal(r.localStats())
+		if err != nil {
+			logger.Logger.Warn("Failed to marshal fleet stats", zap.Error(err))
+			return
+		}
+		if err := msg.Respond(data); err != nil {
+			logger.Logger.Warn("Failed to answer fleet stats request", zap.Error(err))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.statsSubject = subject
+	r.statsSub = sub
+	r.counts = counts
+	r.mu.Unlock()
+	return nil
+}
+
+// localStats returns this instance's stats
+func (r *Reporter) localStats() InstanceStats {
+	r.mu.RLock()
+	counts, now := r.counts, r.clock.Now()
+	r.mu.RUnlock()
+	return InstanceStats{InstanceID: r.instanceID, Counts: counts(), CollectedAt: now}
+}
+
+// CollectStats asks every instance for its stats and adds them up. It returns when all live
+// instances answered, or after timeout with those that did; this instance is always included,
+// even when NATS is unavailable.
+func (r *Reporter) CollectStats(ctx context.Context, timeout time.Duration) (*Stats, error) {
+	r.mu.RLock()
+	subject := r.statsSubject
+	r.mu.RUnlock()
+	if subject == "" {
+		return nil, errors.New("fleet stats are not enabled")
+	}
+
+	expected := make(map[string]bool)
+	instances, _, _ := r.Snapshot()
+	for _, instance := range instances {
+		if !instance.Stale {
+			expected[instance.InstanceID] = true
+		}
+	}
+
+	answers := map[string]InstanceStats{r.instanceID: r.localStats()}
+	delete(expected, r.instanceID)
+
+	inbox := nats.NewInbox()
+	sub, err := r.conn.SubscribeSync(inbox)
+	if err == nil {
+		defer sub.Unsubscribe()
+		err = r.conn.PublishRequest(subject, inbox, nil)
+	}
+	if err != nil {
+		logger.Logger.Warn("Failed to request fleet stats", zap.Error(err))
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		// Live instances are known from their config reports; until one was received, wait the full timeout
+		for len(expected) > 0 || len(instances) == 0 {
+			msg, err := sub.NextMsgWithContext(ctx)
+			if err != nil {
+				break
+			}
+			var answer InstanceStats
+			if err := json.Unmarshal(msg.Data, &answer); err != nil || answer.InstanceID == "" {
+				logger.Logger.Debug("Ignoring invalid fleet stats", zap.Error(err))
+				continue
+			}
+			if _, seen := answers[answer.InstanceID]; !seen {
+				answers[answer.InstanceID] = answer
+			}
+			delete(expected, answer.InstanceID)
+		}
+	}
+
+	stats := &Stats{Instances: make([]InstanceStats, 0, len(answers))}
+	for _, answer := range answers {
+		stats.Instances = append(stats.Instances, answer)
+		stats.Total.Add(answer.Counts)
+	}
+	sort.Slice(stats.Instances, func(i, j int) bool {
+		return stats.Instances[i].InstanceID < stats.Instances[j].InstanceID
+	})
+	for instanceID := range expected {
+		stats.Missing = append(stats.Missing, instanceID)
+	}
+	sort.Strings(stats.Missing)
+	return stats, nil
+}
@@ -0,0 +1,48 @@
+package forwarder
+
+import (
+	"sync"
+
+	"calleventhub/internal/config"
+)
+
+// balancer picks the endpoint of each event of load_balance routes by smooth weighted
+// round-robin: over any run of events, every endpoint gets its weight's share of them,
+// spread out rather than in bursts
+type balancer struct {
+	mu      sync.Mutex
+	current map[string]map[string]int // Current weight by domain and endpoint name
+}
+
+func newBalancer() *balancer {
+	return &balancer{current: make(map[string]map[string]int)}
+}
+
+// pick returns the endpoint of a domain's next event among those in rotation (nil if none is)
+func (b *balancer) pick(domain string, endpoints []config.Endpoint) []config.Endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current, ok := b.current[domain]
+	if !ok {
+		current = make(map[string]int)
+		b.current[domain] = current
+	}
+	best, total := -1, 0
+	for i, endpoint := range endpoints {
+		if endpoint.Disabled {
+			continue
+		}
+		weight := endpoint.BalanceWeight()
+		current[endpoint.Name()] += weight
+		total += weight
+		if best < 0 || current[endpoint.Name()] > current[endpoints[best].Name()] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	current[endpoints[best].Name()] -= total
+	return []config.Endpoint{endpoints[best]}
+}
@@ -0,0 +1,356 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// defaultDNSCacheTTL is how long resolved endpoint addresses are reused when dns.cache_ttl_seconds is unset
+const defaultDNSCacheTTL = 30 * time.Second
+
+// resolvedHost is a cached lookup result
+type resolvedHost struct {
+	addrs      []string
+	resolvedAt time.Time
+}
+
+// dnsResolver resolves endpoint hostnames for outbound requests. Results are
+// cached for a bounded TTL so DNS failovers are picked up without a restart,
+// and static overrides can pin a host to fixed addresses. Record TTLs are not
+// known to the Go resolver, so the cache TTL is fixed (cache_ttl_seconds).
+type dnsResolver struct {
+	resolver *net.Resolver
+	dialer   *net.Dialer
+
+	mu        sync.RWMutex
+	ttl       time.Duration
+	overrides map[string][]string
+	cache     map[string]resolvedHost
+
+	connMu sync.Mutex
+	conns  map[*trackedConn]struct{} // Open connections dialed by name
+	stale  map[string]int            // Open connections per host to addresses it no longer has
+
+	// Called when a host's addresses change so pooled connections are dropped
+	onChange func(host string)
+
+	// Rejects addresses that must not be connected to (SSRF protection); nil allows all
+	checkIP func(ip net.IP) error
+}
+
+// newDNSResolver creates a resolver with the given DNS settings
+func newDNSResolver(cfg config.DNSConfig) *dnsResolver {
+	r := &dnsResolver{
+		resolver: net.DefaultResolver,
+		dialer: &net.Dialer{
+			Timeout:   3 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		cache: make(map[string]resolvedHost),
+		conns: make(map[*trackedConn]struct{}),
+		stale: make(map[string]int),
+	}
+	r.update(cfg)
+	return r
+}
+
+// update applies new DNS settings (on config reload)
+func (r *dnsResolver) update(cfg config.DNSConfig) {
+	ttl := defaultDNSCacheTTL
+	if cfg.CacheTTLSeconds > 0 {
+		ttl = time.Duration(cfg.CacheTTLSeconds) * time.Second
+	}
+
+	overrides := make(map[string][]string, len(cfg.Overrides))
+	for host, addrs := range cfg.Overrides {
+		overrides[strings.ToLower(host)] = addrs
+	}
+
+	r.mu.Lock()
+	changed := r.overrides != nil && !equalOverrides(r.overrides, overrides)
+	r.ttl = ttl
+	r.overrides = overrides
+	r.mu.Unlock()
+
+	if changed {
+		r.markStale("")
+	}
+	if changed && r.onChange != nil {
+		logger.Logger.Info("DNS overrides changed, dropping pooled connections")
+		r.onChange("")
+	}
+}
+
+// dialFunc returns a dial function for addr ("host:port") that uses cached or overridden
+// addresses, trying each resolved address in turn, from the given source binding
+func (r *dnsResolver) dialFunc(source config.OutboundConfig) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := r.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range addrs {
+			if r.checkIP != nil {
+				if err := r.checkIP(net.ParseIP(ip)); err != nil {
+					lastErr = fmt.Errorf("refusing to connect to %s: %w", host, err)
+					continue
+				}
+			}
+
+			dialer := *r.dialer
+			local, err := localAddrFor(source, net.ParseIP(ip))
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if local != nil {
+				dialer.LocalAddr = local
+			}
+
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return r.track(conn, host, ip), nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, lastErr
+	}
+}
+
+// lookup returns the addresses for host: overrides first, then a fresh cache entry, then DNS
+func (r *dnsResolver) lookup(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	key := strings.ToLower(host)
+
+	r.mu.RLock()
+	if addrs, ok := r.overrides[key]; ok {
+		r.mu.RUnlock()
+		return addrs, nil
+	}
+	entry, ok := r.cache[key]
+	ttl := r.ttl
+	r.mu.RUnlock()
+
+	if ok && time.Since(entry.resolvedAt) < ttl {
+		return entry.addrs, nil
+	}
+
+	addrs, err := r.resolve(ctx, key)
+	if err != nil {
+		if ok {
+			// Keep using the last known addresses rather than failing every request
+			logger.Logger.Warn("DNS re-resolution failed, using cached addresses",
+				zap.String("host", host),
+				zap.Strings("addresses", entry.addrs),
+				zap.Error(err),
+			)
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// resolve queries DNS for host and records the result, reporting address changes
+func (r *dnsResolver) resolve(ctx context.Context, host string) ([]string, error) {
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	sort.Strings(addrs)
+
+	r.mu.Lock()
+	previous, known := r.cache[host]
+	r.cache[host] = resolvedHost{addrs: addrs, resolvedAt: time.Now()}
+	r.mu.Unlock()
+
+	if known && !equalAddrs(previous.addrs, addrs) {
+		logger.Logger.Info("Endpoint DNS changed",
+			zap.String("host", host),
+			zap.Strings("old_addresses", previous.addrs),
+			zap.Strings("new_addresses", addrs),
+		)
+		r.markStale(host)
+		if r.onChange != nil {
+			r.onChange(host)
+		}
+	}
+
+	return addrs, nil
+}
+
+// refresh re-resolves every cached host so changes are noticed even between requests
+func (r *dnsResolver) refresh() {
+	r.mu.RLock()
+	hosts := make([]string, 0, len(r.cache))
+	for host := range r.cache {
+		if _, overridden := r.overrides[host]; !overridden {
+			hosts = append(hosts, host)
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, host := range hosts {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		if _, err := r.resolve(ctx, host); err != nil {
+			logger.Logger.Debug("Background DNS refresh failed", zap.String("host", host), zap.Error(err))
+		}
+		cancel()
+	}
+}
+
+// trackedConn is a connection dialed to one of host's addresses, tracked until closed so
+// connections to addresses the host no longer has are not reused
+type trackedConn struct {
+	net.Conn
+	resolver *dnsResolver
+	host     string
+	ip       string
+	stale    bool // Guarded by resolver.connMu
+}
+
+// track records a connection dialed to ip for host (hostnames only; IP literals do not change)
+func (r *dnsResolver) track(conn net.Conn, host, ip string) net.Conn {
+	if net.ParseIP(host) != nil {
+		return conn
+	}
+	c := &trackedConn{Conn: conn, resolver: r, host: strings.ToLower(host), ip: ip}
+	r.connMu.Lock()
+	r.conns[c] = struct{}{}
+	r.connMu.Unlock()
+	return c
+}
+
+// Close closes the connection and stops tracking it
+func (c *trackedConn) Close() error {
+	r := c.resolver
+	r.connMu.Lock()
+	if _, ok := r.conns[c]; ok {
+		delete(r.conns, c)
+		if c.stale {
+			if r.stale[c.host]--; r.stale[c.host] <= 0 {
+				delete(r.stale, c.host)
+			}
+		}
+	}
+	r.connMu.Unlock()
+	return c.Conn.Close()
+}
+
+// markStale marks the open connections of host (of every host if empty) to addresses it
+// no longer resolves to
+func (r *dnsResolver) markStale(host string) {
+	r.mu.RLock()
+	current := func(h string) []string {
+		if addrs, ok := r.overrides[h]; ok {
+			return addrs
+		}
+		return r.cache[h].addrs
+	}
+	r.connMu.Lock()
+	for c := range r.conns {
+		if c.stale || (host != "" && c.host != host) {
+			continue
+		}
+		if !containsAddr(current(c.host), c.ip) {
+			c.stale = true
+			r.stale[c.host]++
+		}
+	}
+	r.connMu.Unlock()
+	r.mu.RUnlock()
+}
+
+// hasStale reports whether connections to addresses host no longer has are still open
+func (r *dnsResolver) hasStale(host string) bool {
+	r.connMu.Lock()
+	defer r.connMu.Unlock()
+	return r.stale[strings.ToLower(host)] > 0
+}
+
+// outboundTransport is an outbound HTTP transport that stops reusing connections to
+// addresses an endpoint no longer resolves to. Idle ones are closed when the addresses
+// change; those busy with a request at the time finish it, and while any are open, idle
+// connections are closed before each request to the host and the connection it uses is
+// closed after it.
+type outboundTransport struct {
+	*http.Transport
+	resolver *dnsResolver
+}
+
+// newTransport creates an outbound HTTP transport dialing through the resolver from source
+func newTransport(resolver *dnsResolver, source config.OutboundConfig) *outboundTransport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = resolver.dialFunc(source)
+	return &outboundTransport{Transport: transport, resolver: resolver}
+}
+
+// RoundTrip sends a request, on a connection not reused afterwards while connections to
+// stale addresses of the host are open
+func (t *outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.resolver.hasStale(req.URL.Hostname()) {
+		t.Transport.CloseIdleConnections()
+		req = req.Clone(req.Context())
+		req.Close = true
+	}
+	return t.Transport.RoundTrip(req)
+}
+
+func containsAddr(addrs []string, addr string) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func equalAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalOverrides(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for host, addrs := range a {
+		if other, ok := b[host]; !ok || !equalAddrs(addrs, other) {
+			return false
+		}
+	}
+	return true
+}
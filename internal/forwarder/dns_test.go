@@ -0,0 +1,93 @@
+package forwarder
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// A connection busy with a request when the host's address changes finishes the request
+// but is not reused: the next request connects to the new address
+func TestBusyConnectionNotReusedAfterAddressChange(t *testing.T) {
+	logger.Logger = zap.NewNop()
+
+	release := make(chan struct{})
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, "old")
+	}))
+	defer old.Close()
+	_, port, _ := net.SplitHostPort(old.Listener.Addr().String())
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.2", port))
+	if err != nil {
+		t.Skipf("127.0.0.2 not usable: %v", err)
+	}
+	current := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "new")
+	}))
+	current.Listener = listener
+	current.Start()
+	defer current.Close()
+
+	resolver := newDNSResolver(config.DNSConfig{Overrides: map[string][]string{"backend.test": {"127.0.0.1"}}})
+	transport := newTransport(resolver, config.OutboundConfig{})
+	resolver.onChange = func(string) { transport.CloseIdleConnections() }
+	client := &http.Client{Transport: transport}
+	url := "http://backend.test:" + port + "/events"
+
+	get := func() string {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	busy := make(chan string)
+	go func() { busy <- get() }()
+	for {
+		resolver.connMu.Lock()
+		n := len(resolver.conns)
+		resolver.connMu.Unlock()
+		if n == 1 {
+			break
+		}
+	}
+
+	resolver.update(config.DNSConfig{Overrides: map[string][]string{"backend.test": {"127.0.0.2"}}})
+	if !resolver.hasStale("backend.test") {
+		t.Fatal("connection to the old address not marked stale")
+	}
+	// Requests while the old connection is busy connect to the new address, and stop the
+	// transport closing connections as they become idle
+	if body := get(); body != "new" {
+		t.Fatalf("request during the busy one answered by %q, want new", body)
+	}
+	close(release)
+	if body := <-busy; body != "old" {
+		t.Fatalf("busy request answered by %q, want old", body)
+	}
+
+	for i := 0; i < 3; i++ {
+		if body := get(); body != "new" {
+			t.Fatalf("request %d after the change answered by %q, want new", i, body)
+		}
+	}
+	if resolver.hasStale("backend.test") {
+		t.Fatal("connection to the old address still open")
+	}
+}
@@ -0,0 +1,140 @@
+package forwarder
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"calleventhub/event"
+	"calleventhub/internal/config"
+	"calleventhub/internal/transform"
+)
+
+// encodeBody renders the JSON payload in the route's encoding for HTTP endpoints and
+// returns the body and its Content-Type
+func encodeBody(encoding *config.EncodingConfig, payload []byte, meta eventMeta) ([]byte, string, error) {
+	if encoding == nil || encoding.Format == "" || encoding.Format == config.EncodingJSON {
+		return payload, contentTypeOr(encoding, "application/json"), nil
+	}
+
+	// Encode what is actually sent (after transforms), not the original event
+	if encoding.Format == config.EncodingXML {
+		sent, err := event.Parse(payload)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse payload for %s encoding: %w", encoding.Format, err)
+		}
+		xmlMeta := meta
+		xmlMeta.Event = sent
+		body, err := xmlMeta.expand(encoding.XMLTemplate, xmlEscape)
+		if err != nil {
+			return nil, "", err
+		}
+		return []byte(body), contentTypeOr(encoding, "application/xml"), nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, "", fmt.Errorf("failed to parse payload for %s encoding: %w", encoding.Format, err)
+	}
+
+	switch encoding.Format {
+	case config.EncodingForm:
+		values := url.Values{}
+		for _, kv := range flatten(fields, encoding.FormKeys) {
+			values.Add(kv.key, kv.value)
+		}
+		return []byte(values.Encode()), contentTypeOr(encoding, "application/x-www-form-urlencoded"), nil
+
+	case config.EncodingMultipart:
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		for _, kv := range flatten(fields, encoding.FormKeys) {
+			if err := w.WriteField(kv.key, kv.value); err != nil {
+				return nil, "", err
+			}
+		}
+		if encoding.FileField != "" {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename="event.json"`, encoding.FileField))
+			header.Set("Content-Type", "application/json")
+			part, err := w.CreatePart(header)
+			if err != nil {
+				return nil, "", err
+			}
+			if _, err := part.Write(payload); err != nil {
+				return nil, "", err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		// The boundary is part of the Content-Type, so it cannot be overridden
+		return buf.Bytes(), w.FormDataContentType(), nil
+	}
+
+	return nil, "", fmt.Errorf("unsupported encoding %q", encoding.Format)
+}
+
+func contentTypeOr(encoding *config.EncodingConfig, fallback string) string {
+	if encoding != nil && encoding.ContentType != "" {
+		return encoding.ContentType
+	}
+	return fallback
+}
+
+// formField is one flattened key/value pair
+type formField struct {
+	key   string
+	value string
+}
+
+// flatten turns nested objects and arrays into key/value pairs ("caller.number" or
+// "caller[number]"), sorted by key so bodies are stable
+func flatten(fields map[string]interface{}, style string) []formField {
+	var result []formField
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(joinKey(prefix, key, style), v[key])
+			}
+		case []interface{}:
+			for i, item := range v {
+				walk(joinKey(prefix, strconv.Itoa(i), style), item)
+			}
+		default:
+			result = append(result, formField{key: prefix, value: transform.ToString(v)})
+		}
+	}
+	walk("", fields)
+	return result
+}
+
+func joinKey(prefix, key, style string) string {
+	switch {
+	case prefix == "":
+		return key
+	case style == "brackets":
+		return prefix + "[" + key + "]"
+	default:
+		return prefix + "." + key
+	}
+}
+
+// xmlEscape escapes a value for use in XML text or attribute values
+func xmlEscape(value string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
@@ -0,0 +1,180 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"calleventhub/internal/config"
+)
+
+const (
+	// sasTokenLifetime is how long generated Event Hubs SAS tokens are valid
+	sasTokenLifetime = time.Hour
+	// tokenRefreshMargin renews cached tokens this long before they expire
+	tokenRefreshMargin = 5 * time.Minute
+	// eventHubsScope is the Azure AD scope for Event Hubs data access
+	eventHubsScope = "https://eventhubs.azure.net/.default"
+)
+
+// eventHubsToken is a cached Authorization header value
+type eventHubsToken struct {
+	header    string
+	expiresAt time.Time
+}
+
+// eventHubsAuth caches SAS and Azure AD tokens per sink
+type eventHubsAuth struct {
+	tokens map[string]eventHubsToken
+	mu     sync.Mutex
+}
+
+func newEventHubsAuth() *eventHubsAuth {
+	return &eventHubsAuth{
+		tokens: make(map[string]eventHubsToken),
+	}
+}
+
+// forwardEventHubs sends the event to an Event Hub through its REST API.
+// Responses are handled like HTTP endpoints, so throttling (429/503 with
+// Retry-After) and failures follow the same retry semantics.
+func (f *Forwarder) forwardEventHubs(ctx context.Context, sink *config.EventHubsSink, d *delivery, meta eventMeta) error {
+	name := config.Endpoint{Type: config.EndpointEventHubs, EventHubs: sink}.Name()
+	if remaining := f.endpointPause(name); remaining > 0 {
+		return &RetryAfterError{Delay: remaining, Err: fmt.Errorf("endpoint paused by Retry-After")}
+	}
+
+	partitionKey := sink.PartitionKey
+	if partitionKey == "" {
+		partitionKey = "{call_id}"
+	}
+	partitionKey, err := meta.expand(partitionKey, nil)
+	if err != nil {
+		return err
+	}
+
+	namespace, hub := sink.Target()
+	resource := fmt.Sprintf("https://%s/%s", namespace, hub)
+
+	authorization, err := f.eventHubs.authorization(ctx, f.clientFor(meta.Domain), sink, resource)
+	if err != nil {
+		return fmt.Errorf("eventhubs authentication failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, resource+"/messages?timeout=60&api-version=2014-01", bytes.NewReader(d.payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	brokerProperties, _ := json.Marshal(map[string]string{
+		"PartitionKey": partitionKey,
+	})
+
+	// Route headers become custom message properties
+	for name, values := range d.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("BrokerProperties", string(brokerProperties))
+	// Custom properties are sent as plain headers
+	req.Header.Set("call_id", meta.CallID)
+	req.Header.Set("domain", meta.Domain)
+
+	return f.doRequest(req, name, d.maxResponseBytes, nil, meta)
+}
+
+// authorization returns a valid Authorization header for the sink, renewing it when close to expiry
+func (a *eventHubsAuth) authorization(ctx context.Context, client *http.Client, sink *config.EventHubsSink, resource string) (string, error) {
+	key := resource + "\x00" + sink.ClientID + "\x00" + sink.ConnectionString
+
+	a.mu.Lock()
+	token, ok := a.tokens[key]
+	a.mu.Unlock()
+	if ok && time.Until(token.expiresAt) > tokenRefreshMargin {
+		return token.header, nil
+	}
+
+	var err error
+	if sink.ConnectionString != "" {
+		keyName, sharedKey := sink.SharedAccessKey()
+		token = sasToken(resource, keyName, sharedKey, time.Now().Add(sasTokenLifetime))
+	} else {
+		token, err = aadToken(ctx, client, sink)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	a.mu.Lock()
+	a.tokens[key] = token
+	a.mu.Unlock()
+
+	return token.header, nil
+}
+
+// sasToken creates a Shared Access Signature for resource
+func sasToken(resource, keyName, key string, expiresAt time.Time) eventHubsToken {
+	encodedResource := url.QueryEscape(strings.ToLower(resource))
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(encodedResource + "\n" + expiry))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return eventHubsToken{
+		header: fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s",
+			encodedResource, url.QueryEscape(signature), expiry, url.QueryEscape(keyName)),
+		expiresAt: expiresAt,
+	}
+}
+
+// aadToken obtains an Azure AD access token with the client credentials flow
+func aadToken(ctx context.Context, client *http.Client, sink *config.EventHubsSink) (eventHubsToken, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {sink.ClientID},
+		"client_secret": {sink.ClientSecret},
+		"scope":         {eventHubsScope},
+	}
+	tokenURL := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", url.PathEscape(sink.TenantID))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return eventHubsToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return eventHubsToken{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return eventHubsToken{}, fmt.Errorf("invalid token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return eventHubsToken{}, fmt.Errorf("token request failed (status %d): %s", resp.StatusCode, result.ErrorDescription)
+	}
+
+	return eventHubsToken{
+		header:    "Bearer " + result.AccessToken,
+		expiresAt: time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+	}, nil
+}
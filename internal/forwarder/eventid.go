@@ -0,0 +1,20 @@
+package forwarder
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// EventIDField is the payload field carrying the ID the hub gives every event at ingest.
+// It travels with the event through the stream, forwarded payloads, store records,
+// receipts and log lines, so they can be joined whatever IDs the PBX sent.
+const EventIDField = "hub_event_id"
+
+// NewEventID returns a random (version 4) UUID
+func NewEventID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,354 @@
+package forwarder
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/event"
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// defaultUploadInterval is how often completed spool files are uploaded when upload_interval_seconds is unset
+const defaultUploadInterval = 5 * time.Minute
+
+// activeSuffix marks spool files still being appended to; they are renamed
+// to their final name when rotated, and only final files are uploaded
+const activeSuffix = ".active"
+
+// spoolFile is a file currently being appended to
+type spoolFile struct {
+	file   *os.File
+	path   string // Active path (final name + activeSuffix)
+	period string // Rotation period the file belongs to
+	size   int64
+}
+
+// fileSinks appends events to rotating files and runs one uploader per spool directory
+type fileSinks struct {
+	open      map[string]*spoolFile // directory + file name -> current file
+	uploaders map[string]chan struct{}
+	mu        sync.Mutex
+
+	// Rejects SFTP server addresses that must not be connected to (SSRF protection); nil allows all
+	checkIP func(ip net.IP) error
+}
+
+func newFileSinks() *fileSinks {
+	return &fileSinks{
+		open:      make(map[string]*spoolFile),
+		uploaders: make(map[string]chan struct{}),
+	}
+}
+
+// write appends one event to the sink's current file, rotating it if needed
+func (m *fileSinks) write(sink *config.FileSink, payload []byte, meta eventMeta) error {
+	line, err := formatLine(sink, payload)
+	if err != nil {
+		return err
+	}
+
+	name := sink.FileName
+	if name == "" {
+		name = "events-{domain}"
+	}
+	if name, err = meta.expand(name, fileNamePart); err != nil {
+		return err
+	}
+	key := filepath.Join(sink.Directory, name)
+	period := rotationPeriod(sink.Rotate, time.Now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := m.open[key]
+	if current != nil && (current.period != period || (sink.MaxFileBytes > 0 && current.size+int64(len(line)) > sink.MaxFileBytes && current.size > 0)) {
+		finalizeSpoolFile(current)
+		delete(m.open, key)
+		current = nil
+	}
+	if current == nil {
+		if current, err = openSpoolFile(sink, key, period); err != nil {
+			return err
+		}
+		m.open[key] = current
+	}
+
+	n, err := current.file.Write(line)
+	current.size += int64(n)
+	if err != nil {
+		logger.Logger.Warn("Failed to write event to file sink",
+			zap.String("call_id", meta.CallID),
+			zap.String("hub_event_id", meta.EventID),
+			zap.String("domain", meta.Domain),
+			zap.String("file", current.path),
+			zap.Error(err),
+		)
+		return fmt.Errorf("failed to write %s: %w", current.path, err)
+	}
+	return nil
+}
+
+// openSpoolFile opens (appending) the active file for a period and writes the CSV header to new CSV files
+func openSpoolFile(sink *config.FileSink, key, period string) (*spoolFile, error) {
+	if err := os.MkdirAll(sink.Directory, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	ext := ".ndjson"
+	if sink.Format == "csv" {
+		ext = ".csv"
+	}
+	path := fmt.Sprintf("%s-%s%s%s", key, period, ext, activeSuffix)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	spool := &spoolFile{file: file, path: path, period: period, size: info.Size()}
+	if sink.Format == "csv" && spool.size == 0 {
+		header, _ := csvLine(csvColumns(sink))
+		n, err := file.Write(header)
+		spool.size += int64(n)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return spool, nil
+}
+
+// finalizeSpoolFile closes an active file and renames it to its final name
+func finalizeSpoolFile(spool *spoolFile) {
+	spool.file.Close()
+	finalizePath(spool.path)
+}
+
+// finalizePath renames an active file to the first unused final name
+// ("name.ndjson", then "name-1.ndjson", ...) so it becomes eligible for upload
+func finalizePath(activePath string) {
+	final := uniquePath(strings.TrimSuffix(activePath, activeSuffix), func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	if err := os.Rename(activePath, final); err != nil {
+		logger.Logger.Warn("Failed to finalize spool file", zap.String("file", activePath), zap.Error(err))
+	}
+}
+
+// uniquePath returns path, or path with "-1", "-2", ... before the extension, whichever does not exist
+func uniquePath(path string, exists func(string) bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	candidate := path
+	for i := 1; exists(candidate); i++ {
+		candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	return candidate
+}
+
+// formatLine renders an event as one NDJSON or CSV line
+func formatLine(sink *config.FileSink, payload []byte) ([]byte, error) {
+	if sink.Format != "csv" {
+		// Payloads are compact JSON; make sure it ends the line
+		line := append(bytes.TrimSpace(payload[:len(payload):len(payload)]), '\n')
+		return line, nil
+	}
+
+	ev, err := event.Parse(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse event for csv: %w", err)
+	}
+	columns := csvColumns(sink)
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = ev.Text(column)
+	}
+	return csvLine(record)
+}
+
+func csvColumns(sink *config.FileSink) []string {
+	if len(sink.CSVColumns) > 0 {
+		return sink.CSVColumns
+	}
+	return config.DefaultCSVColumns
+}
+
+func csvLine(record []string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(record); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// rotationPeriod returns the file name suffix of the period t falls in (UTC)
+func rotationPeriod(rotate string, t time.Time) string {
+	if rotate == "hourly" {
+		return t.UTC().Format("2006-01-02T15")
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+// fileNamePart makes a value safe to use in a file name
+func fileNamePart(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r < 32 {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// sync starts an uploader for each spool directory in cfg and stops those no longer configured
+func (m *fileSinks) sync(cfg *config.Config) {
+	sinks := make(map[string]*config.FileSink)
+	for _, route := range cfg.AllRoutes() {
+		for _, endpoint := range route.AllEndpoints() {
+			if endpoint.Type == config.EndpointFile && endpoint.File != nil {
+				sinks[endpoint.File.Directory] = endpoint.File
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for dir, stop := range m.uploaders {
+		if _, ok := sinks[dir]; !ok {
+			close(stop)
+			delete(m.uploaders, dir)
+		}
+	}
+	for dir, sink := range sinks {
+		if stop, ok := m.uploaders[dir]; ok {
+			// Restart so changed upload settings take effect
+			close(stop)
+		}
+		stop := make(chan struct{})
+		m.uploaders[dir] = stop
+		go m.runUploader(*sink, stop)
+	}
+}
+
+// runUploader periodically closes files of past periods and uploads completed files
+func (m *fileSinks) runUploader(sink config.FileSink, stop chan struct{}) {
+	interval := defaultUploadInterval
+	if sink.UploadIntervalSeconds > 0 {
+		interval = time.Duration(sink.UploadIntervalSeconds) * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.closeExpired(sink)
+			if sink.SFTP != nil {
+				if err := m.uploadCompleted(sink); err != nil {
+					logger.Logger.Warn("SFTP upload failed, will retry",
+						zap.String("directory", sink.Directory),
+						zap.String("sftp", sink.SFTP.Address),
+						zap.Error(err),
+					)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// closeExpired finalizes open files of the sink's directory whose rotation period has ended,
+// and active files not open in this process (left over from before a restart)
+func (m *fileSinks) closeExpired(sink config.FileSink) {
+	period := rotationPeriod(sink.Rotate, time.Now())
+	dir := filepath.Clean(sink.Directory)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	openPaths := make(map[string]bool, len(m.open))
+	for key, spool := range m.open {
+		if filepath.Dir(spool.path) == dir && spool.period != period {
+			finalizeSpoolFile(spool)
+			delete(m.open, key)
+			continue
+		}
+		openPaths[spool.path] = true
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*"+activeSuffix))
+	for _, path := range leftovers {
+		if !openPaths[path] {
+			finalizePath(path)
+		}
+	}
+}
+
+// completedFiles lists finalized spool files in dir
+func completedFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && (strings.HasSuffix(name, ".ndjson") || strings.HasSuffix(name, ".csv")) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files, nil
+}
+
+// finishUpload removes an uploaded file, or moves it to uploaded/ when keep_uploaded is set
+func finishUpload(sink config.FileSink, path string) error {
+	if !sink.KeepUploaded {
+		return os.Remove(path)
+	}
+	uploadedDir := filepath.Join(sink.Directory, "uploaded")
+	if err := os.MkdirAll(uploadedDir, 0755); err != nil {
+		return err
+	}
+	return os.Rename(path, filepath.Join(uploadedDir, filepath.Base(path)))
+}
+
+// close stops the uploaders and closes open files; they stay active and are
+// appended to again (or finalized by the uploader) after a restart
+func (m *fileSinks) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, spool := range m.open {
+		spool.file.Close()
+		delete(m.open, key)
+	}
+	for dir, stop := range m.uploaders {
+		close(stop)
+		delete(m.uploaders, dir)
+	}
+}
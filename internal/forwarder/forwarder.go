@@ -3,15 +3,28 @@ package forwarder
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"calleventhub/event"
+	"calleventhub/internal/clock"
 	"calleventhub/internal/config"
+	"calleventhub/internal/correlation"
 	"calleventhub/internal/logger"
+	"calleventhub/internal/opsnotify"
+	"calleventhub/internal/receipts"
+	"calleventhub/internal/schema"
+	"calleventhub/internal/sla"
 	"calleventhub/internal/store"
+	"calleventhub/internal/transform"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -19,126 +32,667 @@ import (
 
 // Forwarder forwards events to backend endpoints
 type Forwarder struct {
-	config   *config.Config
+	config   *config.Config // baseConfig with the endpoint overrides applied
 	client   *http.Client
 	attempts map[string]int // Track delivery attempts for logging
 	mu       sync.RWMutex
 	store    *store.Store // Store for tracking forwarded events
+
+	// Configuration as loaded, and the endpoint rotation changes made via the API
+	baseConfig *config.Config
+	overrides  *endpointOverrides
+	configDir  string // Directory of route files loaded with the config file (see config.LoadDir)
+
+	secrets *signingSecrets // Signing secrets rotated via the API
+
+	// Per-domain concurrency slots for routes with max_concurrent
+	semaphores map[string]chan struct{}
+	semMu      sync.Mutex
+
+	// Recent latencies of hedged endpoints, and hedging counters
+	latencies *latencyWindows
+
+	// Round-robin state of load_balance routes
+	balancer *balancer
+
+	// Failed deliveries in a row per endpoint, and what to do when one recovers (optional)
+	outages    *outages
+	onRecovery func(Recovery)
+
+	// Endpoints paused after a Retry-After hint (url -> resume time)
+	pausedUntil map[string]time.Time
+	pauseMu     sync.Mutex
+
+	// Time source of event ages, pauses and receipts (latencies always use the system clock)
+	clock clock.Clock
+
+	// Endpoint name resolution (cached with TTL, static overrides, background refresh)
+	resolver  *dnsResolver
+	stopChan  chan struct{}
+	closeOnce sync.Once
+
+	// Connected clients for MQTT sinks
+	mqtt *mqttPool
+
+	// Cached credentials for Event Hubs sinks
+	eventHubs *eventHubsAuth
+
+	// Pooled clients for Redis Streams sinks
+	redis *redisPool
+
+	// Spool files and SFTP uploaders of file sinks
+	files *fileSinks
+
+	// Links call legs of transferred and bridged calls
+	correlator *correlation.Correlator
+
+	// Delivery receipts for downstream systems (optional)
+	receipts *receipts.Publisher
+
+	// Dead-letter and circuit notifications to the tenants' ops URLs (optional)
+	ops *opsnotify.Notifier
+
+	// Persistent outcome counts for the delivery report (optional)
+	counters *sla.Counters
+
+	// Identification of this hub instance sent with forwarded requests (see SetIdentity)
+	instanceID string
+	version    string
+
+	// Clients bound to a specific outbound source address or interface
+	clients    map[config.OutboundConfig]*http.Client
+	transports []*outboundTransport // All transports in use, including the default client's
+	clientMu   sync.Mutex
+}
+
+// maxRetryAfter caps how long a backend's Retry-After hint can delay redelivery
+const maxRetryAfter = 10 * time.Minute
+
+// defaultMaxResponseBytes is how much of a backend response is read when the route sets no limit
+const defaultMaxResponseBytes = 64 * 1024
+
+// maxLoggedResponseBytes limits the response body included in non-2xx logs
+const maxLoggedResponseBytes = 512
+
+// RetryAfterError is returned when a backend asked us to back off (429/503 with Retry-After)
+// The consumer uses Delay to postpone redelivery instead of retrying at the next ack_wait
+type RetryAfterError struct {
+	Delay time.Duration
+	Err   error
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.Delay)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// QuarantineError is returned when an event was quarantined instead of forwarded
+// because redelivering it can never succeed. The consumer terminates the message.
+type QuarantineError struct {
+	Err error
+}
+
+func (e *QuarantineError) Error() string {
+	return fmt.Sprintf("event quarantined: %v", e.Err)
+}
+
+func (e *QuarantineError) Unwrap() error {
+	return e.Err
 }
 
 // NewForwarder creates a new forwarder
 func NewForwarder(cfg *config.Config, eventStore *store.Store) *Forwarder {
-	return &Forwarder{
-		config: cfg,
+	resolver := newDNSResolver(cfg.DNS)
+	transport := newTransport(resolver, config.OutboundConfig{})
+
+	f := &Forwarder{
+		config:     cfg,
+		baseConfig: cfg,
+		overrides:  newEndpointOverrides(),
+		secrets:    newSigningSecrets(),
 		client: &http.Client{
-			Timeout: 3 * time.Second, // Backend timeout: 3 seconds
+			Transport: transport, // Requests time out by the endpoint's timeout_ms (see forwardToEndpoint)
 		},
-		attempts: make(map[string]int),
-		store:    eventStore,
+		attempts:    make(map[string]int),
+		store:       eventStore,
+		semaphores:  make(map[string]chan struct{}),
+		pausedUntil: make(map[string]time.Time),
+		clock:       clock.Real,
+		latencies:   newLatencyWindows(),
+		balancer:    newBalancer(),
+		outages:     newOutages(),
+		resolver:    resolver,
+		stopChan:    make(chan struct{}),
+		clients:     make(map[config.OutboundConfig]*http.Client),
+		transports:  []*outboundTransport{transport},
+		mqtt:        newMQTTPool(),
+		eventHubs:   newEventHubsAuth(),
+		redis:       newRedisPool(),
+		files:       newFileSinks(),
+		correlator:  correlation.New(cfg.Correlation.MaxCalls),
+	}
+
+	// Drop pooled connections to stale addresses when DNS changes
+	resolver.onChange = func(string) { f.closeIdleConnections() }
+	// Re-validate every resolved address against endpoint_security at connect time
+	resolver.checkIP = func(ip net.IP) error {
+		f.mu.RLock()
+		defer f.mu.RUnlock()
+		return f.config.EndpointSecurity.CheckIP(ip)
+	}
+	f.mqtt.checkIP = resolver.checkIP
+	f.redis.checkIP = resolver.checkIP
+	f.files.checkIP = resolver.checkIP
+	f.files.sync(cfg)
+	f.applyQuotas(cfg)
+
+	go f.refreshDNS()
+
+	return f
+}
+
+// Close stops background DNS refresh and closes pooled connections and sink clients
+func (f *Forwarder) Close() {
+	f.closeOnce.Do(func() {
+		close(f.stopChan)
+		f.closeIdleConnections()
+		f.mqtt.close()
+		f.redis.close()
+		f.files.close()
+	})
+}
+
+// InstanceHeader identifies the hub instance that sent a forwarded HTTP request
+const InstanceHeader = "X-Hub-Instance"
+
+// SetIdentity sets the instance ID and version sent with forwarded requests and logged
+// with forwarded events. Must be called before events are forwarded.
+func (f *Forwarder) SetIdentity(instanceID, version string) {
+	f.instanceID = instanceID
+	f.version = version
+}
+
+// SetConfigDir sets the config directory whose route files ReloadConfig loads with the config
+// file. Must be called before the configuration is reloaded.
+func (f *Forwarder) SetConfigDir(dir string) {
+	f.configDir = dir
+}
+
+// ConfigDir returns the config directory set by SetConfigDir (empty if none)
+func (f *Forwarder) ConfigDir() string {
+	return f.configDir
+}
+
+// SetClock sets the time source of event ages, endpoint pauses and receipts (the system
+// clock by default). Must be called before events are forwarded.
+func (f *Forwarder) SetClock(c clock.Clock) {
+	f.clock = c
+}
+
+// identify sets the User-Agent and instance headers on a forward request, unless the
+// route's headers already set them
+func (f *Forwarder) identify(req *http.Request) {
+	f.mu.RLock()
+	userAgent := f.config.UserAgent
+	f.mu.RUnlock()
+
+	if req.Header.Get("User-Agent") == "" && userAgent != "" {
+		req.Header.Set("User-Agent", strings.ReplaceAll(userAgent, "{version}", f.version))
+	}
+	if req.Header.Get(InstanceHeader) == "" && f.instanceID != "" {
+		req.Header.Set(InstanceHeader, f.instanceID)
+	}
+}
+
+// SetReceipts sets the publisher that receives a receipt for every forward attempt.
+// Must be called before events are forwarded.
+func (f *Forwarder) SetReceipts(r *receipts.Publisher) {
+	f.receipts = r
+}
+
+// SetOpsNotifier sets the notifier that tells tenants with an ops_url about their events
+// that dead-letter and endpoints whose circuit opens. Must be called before events are forwarded.
+func (f *Forwarder) SetOpsNotifier(n *opsnotify.Notifier) {
+	f.ops = n
+}
+
+// SetDeliveryCounters sets the counters the final outcome of every event is counted in for
+// the delivery report. Must be called before events are forwarded.
+func (f *Forwarder) SetDeliveryCounters(c *sla.Counters) {
+	f.counters = c
+}
+
+// opsTarget returns where the domain's ops notifications go (ok=false if its tenant has no
+// ops_url); caller must hold the read lock
+func (f *Forwarder) opsTarget(domain string) (opsnotify.Target, bool) {
+	if f.ops == nil || !f.config.Isolation.Enabled {
+		return opsnotify.Target{}, false
+	}
+	tenant := f.config.TenantForDomain(domain)
+	if tenant == nil || tenant.OpsURL == "" {
+		return opsnotify.Target{}, false
+	}
+	settings := f.config.Isolation.OpsNotifications
+	return opsnotify.Target{
+		Tenant:          tenant.Name,
+		URL:             tenant.OpsURL,
+		CircuitFailures: settings.CircuitFailures,
+		MinInterval:     time.Duration(settings.MinIntervalSeconds) * time.Second,
+	}, true
+}
+
+// refreshDNS periodically re-resolves endpoint hosts when dns.refresh_seconds is set
+// The interval is re-read each round so reloads take effect
+func (f *Forwarder) refreshDNS() {
+	for {
+		f.mu.RLock()
+		interval := time.Duration(f.config.DNS.RefreshSeconds) * time.Second
+		f.mu.RUnlock()
+
+		wait := interval
+		if wait <= 0 {
+			// Disabled - check again later in case a reload enables it
+			wait = 10 * time.Second
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-f.stopChan:
+			return
+		}
+
+		if interval > 0 {
+			f.resolver.refresh()
+		}
+	}
+}
+
+// AcquireSlot blocks until the domain is below its max_concurrent limit and
+// returns a function that releases the slot. Excess events wait rather than fail;
+// an error is returned only if ctx is done first. Unlimited routes return immediately.
+func (f *Forwarder) AcquireSlot(ctx context.Context, domain string) (func(), error) {
+	sem := f.domainSemaphore(domain)
+	if sem == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// domainSemaphore returns the semaphore for a domain, recreating it if the
+// limit changed on reload (holders of the old one release into it unaffected)
+func (f *Forwarder) domainSemaphore(domain string) chan struct{} {
+	f.mu.RLock()
+	limit := 0
+	if route := f.config.RouteFor(domain); route != nil {
+		limit = route.MaxConcurrent
+	}
+	f.mu.RUnlock()
+
+	f.semMu.Lock()
+	defer f.semMu.Unlock()
+
+	if limit <= 0 {
+		delete(f.semaphores, domain)
+		return nil
 	}
+
+	sem, ok := f.semaphores[domain]
+	if !ok || cap(sem) != limit {
+		sem = make(chan struct{}, limit)
+		f.semaphores[domain] = sem
+	}
+	return sem
 }
 
 // ForwardEvent forwards an event to all configured endpoints for the domain
 //
 // Behavior:
-// - Forwards to ALL endpoints concurrently (parallel HTTP requests)
+// - Forwards to ALL endpoints concurrently (parallel HTTP requests), or to one on load_balance routes
 // - If ANY endpoint fails (non-2xx response or timeout), returns error
 // - The caller should NOT acknowledge the JetStream message if this returns an error
 // - JetStream will redeliver the entire message after ack_wait expires
 // - Backend endpoints MUST be idempotent based on call_id
-func (f *Forwarder) ForwardEvent(ctx context.Context, eventData []byte, domain string, deliveryAttempt int) error {
+// - Stale events (received before the route's max_event_age_seconds) go to its stale_endpoints
+// - Events of a disabled route (enabled: false) are acknowledged without being forwarded
+//
+// jsDelivery carries the JetStream metadata of the message; it is kept with the stored outcome
+func (f *Forwarder) ForwardEvent(ctx context.Context, eventData []byte, domain string, jsDelivery store.Delivery) (err error) {
+	deliveryAttempt := jsDelivery.Attempt
+	receivedAt := jsDelivery.PublishedAt // When the event was stored in the stream (zero if unknown)
 	f.mu.RLock()
-	endpoints := f.config.GetEndpoints(domain)
-	maxDeliveries := f.config.NATS.MaxDeliveries
+	var endpoints []config.Endpoint
+	maxDeliveries := f.config.MaxDeliveries(domain)
+	if jsDelivery.MaxDeliveries > 0 && jsDelivery.MaxDeliveries < maxDeliveries {
+		maxDeliveries = jsDelivery.MaxDeliveries
+	}
+	var maxRequestBytes int64
+	maxResponseBytes := int64(defaultMaxResponseBytes)
+	var headerTemplates, transforms map[string]string
+	var renameFields config.RenameFields
+	var dropFields []string
+	var targetSchema *schema.Schema
+	var schemaFile string
+	var encoding *config.EncodingConfig
+	var maxEventAge time.Duration
+	var staleEndpoints, fallbackEndpoints []config.Endpoint
+	var loadBalance, paused bool
+	var hedging *config.HedgingConfig
+	var success *config.SuccessConfig
+	var signing *config.SigningConfig
+	var timeoutMs int
+	var matchRules config.MatchRules
+	correlationCfg := f.config.Correlation
+	opsTarget, notifyOps := f.opsTarget(domain)
+	recoveryReplay := f.config.RecoveryReplay
+	// The domain's route, or the default route
+	if route := f.config.RouteFor(domain); route != nil {
+		endpoints = route.Endpoints
+		maxRequestBytes = route.MaxRequestBytes
+		if route.MaxResponseBytes > 0 {
+			maxResponseBytes = route.MaxResponseBytes
+		}
+		headerTemplates, transforms = route.Headers, route.Transform
+		renameFields, dropFields = route.RenameFields, route.DropFields
+		targetSchema, schemaFile = route.Schema(), route.SchemaFile
+		encoding = route.Encoding
+		maxEventAge = time.Duration(route.MaxEventAgeSeconds) * time.Second
+		staleEndpoints = route.StaleEndpoints
+		fallbackEndpoints = route.FallbackEndpoints
+		loadBalance = route.LoadBalanced()
+		paused = route.Disabled()
+		if route.Hedging.Active() {
+			hedging = route.Hedging
+		}
+		success = route.Success
+		signing = route.Signing
+		timeoutMs = route.TimeoutMs
+		matchRules = route.Match
+		if jsDelivery.Endpoint != "" {
+			endpoints = nil
+			for _, endpoint := range route.AllEndpoints() {
+				if endpoint.Name() == jsDelivery.Endpoint {
+					endpoints = []config.Endpoint{endpoint}
+					break
+				}
+			}
+		}
+	}
 	f.mu.RUnlock()
-	if len(endpoints) == 0 {
+
+	// Count the final outcome for the delivery report; replays were counted the first time
+	skipped := false
+	if f.counters != nil && jsDelivery.Replay == "" && jsDelivery.Endpoint == "" {
+		defer func() { f.countOutcome(domain, jsDelivery, maxDeliveries, skipped, err) }()
+	}
+
+	if jsDelivery.Endpoint != "" {
+		// Endpoint replay: the event already reached the route's other endpoints
+		if len(endpoints) == 0 {
+			return fmt.Errorf("endpoint %s is not configured for domain: %s", jsDelivery.Endpoint, domain)
+		}
+		if endpoints[0].Disabled {
+			return fmt.Errorf("endpoint %s of domain %s is disabled", jsDelivery.Endpoint, domain)
+		}
+		if paused {
+			return fmt.Errorf("route of domain %s is disabled", domain)
+		}
+	}
+	if len(endpoints) == 0 && !paused {
 		return fmt.Errorf("no endpoints configured for domain: %s", domain)
 	}
 
-	// Parse event to extract all fields for logging
-	// This preserves ALL fields from different PBX systems
-	var eventMap map[string]interface{}
-	if err := json.Unmarshal(eventData, &eventMap); err != nil {
-		logger.Logger.Warn("Failed to parse event for logging", zap.Error(err))
-		// Fallback: try to extract at least call_id
-		var fallbackEvent struct {
-			CallID string `json:"call_id"`
+	// Parse the event once for logging, routing and templates; fields unknown to the event
+	// model are kept as sent, to preserve ALL fields from different PBX systems
+	ev, parseErr := event.Parse(eventData)
+	if parseErr != nil {
+		logger.Logger.Warn("Failed to parse event for logging", zap.Error(parseErr))
+		ev = &event.Event{}
+	}
+
+	// Extract call_id for convenience - support different naming conventions (numbers too)
+	callID := ev.Text("call_id")
+	if callID == "" {
+		if callID = ev.Text("CallID"); callID != "" {
+			ev.CallID = callID // Normalize to lowercase
 		}
-		_ = json.Unmarshal(eventData, &fallbackEvent)
-		eventMap = map[string]interface{}{
-			"call_id": fallbackEvent.CallID,
+	}
+
+	// Given at ingest; empty for events published before hub event IDs existed
+	eventID := ev.HubEventID
+
+	// A paused integration: acknowledge its events instead of failing them
+	if paused {
+		logger.LogWithDomain(zapcore.InfoLevel, "Event of disabled route not forwarded",
+			zap.String("domain", domain),
+			zap.String("call_id", callID),
+			zap.String("hub_event_id", eventID),
+			zap.Int("delivery_attempt", deliveryAttempt),
+		)
+		if f.store != nil {
+			f.store.AddSkippedEvent(eventData, domain, callID, jsDelivery)
 		}
+		skipped = true
+		return nil
 	}
 
-	// Extract call_id for convenience - support different naming conventions
-	callID := ""
-	if id, ok := eventMap["call_id"].(string); ok {
-		callID = id
-	} else if id, ok := eventMap["CallID"].(string); ok {
-		callID = id
-		eventMap["call_id"] = callID // Normalize to lowercase
-	} else if id, ok := eventMap["call_id"].(float64); ok {
-		callID = fmt.Sprintf("%.0f", id)
-	} else if id, ok := eventMap["CallID"].(float64); ok {
-		callID = fmt.Sprintf("%.0f", id)
-		eventMap["call_id"] = callID // Normalize to lowercase
+	// Add delivery_attempt to the event for logging
+	ev.Set("delivery_attempt", deliveryAttempt)
+
+	// Link transferred and bridged legs into one logical call (before any early return,
+	// so every leg seen is remembered)
+	correlationID := f.correlate(domain, callID, ev, correlationCfg)
+	if correlationID != "" {
+		ev.Set("correlation_id", correlationID)
 	}
 
-	// Add delivery_attempt to event map for logging
-	eventMap["delivery_attempt"] = deliveryAttempt
+	// Events whose fields match a rule of the route go to the rule's endpoints instead
+	if len(matchRules) > 0 && jsDelivery.Endpoint == "" {
+		if matched, ok := matchRules.Endpoints(ev); ok {
+			endpoints = matched
+		}
+	}
+
+	// Events replayed long after ingest (e.g. after an outage) must not trigger real-time workflows
+	stale := false
+	if maxEventAge > 0 && !receivedAt.IsZero() && jsDelivery.Endpoint == "" {
+		if age := clock.Since(f.clock, receivedAt); age > maxEventAge {
+			stale = true
+			if len(staleEndpoints) == 0 {
+				logger.LogWithDomain(zapcore.WarnLevel, "Stale event not forwarded",
+					zap.String("domain", domain),
+					zap.String("call_id", callID),
+					zap.String("hub_event_id", eventID),
+					zap.Int("delivery_attempt", deliveryAttempt),
+					zap.Duration("event_age", age),
+					zap.Duration("max_event_age", maxEventAge),
+					zap.Any("event", ev), // Log full event data
+				)
+				if f.store != nil {
+					f.store.AddStaleEvent(eventData, domain, callID, jsDelivery, nil, nil)
+				}
+				skipped = true
+				return nil
+			}
+			logger.LogWithDomain(zapcore.WarnLevel, "Stale event diverted to stale endpoints",
+				zap.String("domain", domain),
+				zap.String("call_id", callID),
+				zap.String("hub_event_id", eventID),
+				zap.Duration("event_age", age),
+				zap.Duration("max_event_age", maxEventAge),
+			)
+			endpoints = staleEndpoints
+		}
+	}
+
+	// Endpoints taken out of rotation or weighted to a share of the calls, or the one
+	// endpoint of a load-balanced event
+	if !stale && jsDelivery.Endpoint == "" {
+		configured := endpoints
+		if loadBalance {
+			endpoints = f.balancer.pick(domain, configured)
+		} else {
+			endpoints = selectEndpoints(configured, callID, eventData)
+		}
+		if len(endpoints) == 0 && allDisabled(configured) {
+			return fmt.Errorf("all %d endpoints of domain %s are disabled", len(configured), domain)
+		}
+	}
+
+	endpointNames := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		endpointNames[i] = endpoint.Name()
+	}
 
 	// Use domain-aware logging with full event data
 	// Log call_id and delivery_attempt to help debug duplicate forwarding issues
 	logger.LogWithDomain(zapcore.InfoLevel, "Forwarding event",
 		zap.String("domain", domain),
 		zap.String("call_id", callID),
+		zap.String("hub_event_id", eventID),
 		zap.Int("delivery_attempt", deliveryAttempt),
 		zap.Int("endpoint_count", len(endpoints)),
-		zap.Any("event", eventMap), // Log full event data
+		zap.String("replay", jsDelivery.Replay),
+		zap.Any("event", ev), // Log full event data
 	)
 
-	// Add delivery_attempt and using_forwarder to event payload
-	eventPayload, err := f.enrichPayload(eventData, deliveryAttempt)
+	// Extract state and status for error logging (and sink and header templates)
+	meta := eventMeta{CallID: callID, EventID: eventID, Domain: domain, State: ev.State, Status: ev.Status, Direction: ev.Direction,
+		CorrelationID: correlationID, Replay: jsDelivery.Replay, Event: ev}
+
+	// Add delivery_attempt and using_forwarder (and the route's transforms) to event payload
+	eventPayload, err := f.enrichPayload(ev, deliveryAttempt, transforms, renameFields, dropFields, meta)
+	if err == nil && parseErr != nil {
+		err = parseErr // Enriching the empty stand-in would drop the event's data
+	}
 	if err != nil {
 		logger.Logger.Warn("Failed to enrich payload, using original payload",
 			zap.String("call_id", callID),
+			zap.String("hub_event_id", eventID),
 			zap.Error(err),
 		)
 		eventPayload = eventData // Fallback to original payload
 	}
 
-	// Extract state and status for error logging
-	state := ""
-	status := ""
-	if s, ok := eventMap["state"].(string); ok {
-		state = s
+	// The encoded payload is shared (read-only) by all endpoint requests, never copied per endpoint
+	if maxRequestBytes > 0 && int64(len(eventPayload)) > maxRequestBytes {
+		err := fmt.Errorf("payload of %d bytes exceeds max_request_bytes (%d)", len(eventPayload), maxRequestBytes)
+		logger.Logger.Warn("Event too large to forward",
+			zap.String("call_id", callID),
+			zap.String("hub_event_id", eventID),
+			zap.String("domain", domain),
+			zap.Int("payload_bytes", len(eventPayload)),
+			zap.Int64("max_request_bytes", maxRequestBytes),
+		)
+		if f.store != nil {
+			f.store.AddFailedEvent(eventData, domain, callID, jsDelivery, maxDeliveries, endpointNames, []string{err.Error()}, nil)
+		}
+		if notifyOps && isLastAttempt(jsDelivery, maxDeliveries) {
+			f.ops.DeadLetter(opsTarget, domain, callID, err.Error())
+		}
+		return err
 	}
-	if s, ok := eventMap["status"].(string); ok {
-		status = s
+
+	// Catch broken transforms here instead of as 400s from the backend
+	if targetSchema != nil {
+		if err := targetSchema.ValidateJSON(eventPayload); err != nil {
+			var violations []string
+			var validationErr *schema.ValidationError
+			if errors.As(err, &validationErr) {
+				violations = validationErr.Violations
+			}
+			logger.LogWithDomain(zapcore.ErrorLevel, "Event quarantined: payload does not match schema",
+				zap.String("domain", domain),
+				zap.String("call_id", callID),
+				zap.String("hub_event_id", eventID),
+				zap.String("schema_file", schemaFile),
+				zap.Strings("violations", violations),
+				zap.Error(err),
+				zap.Any("event", ev), // Log full event data
+			)
+			reason := fmt.Sprintf("payload does not match schema %s", schemaFile)
+			if f.store != nil {
+				f.store.AddQuarantinedEvent(eventData, eventPayload, domain, callID, deliveryAttempt, reason, violations)
+			}
+			if notifyOps {
+				f.ops.DeadLetter(opsTarget, domain, callID, reason)
+			}
+			return &QuarantineError{Err: fmt.Errorf("%s: %w", reason, err)}
+		}
 	}
 
-	// Forward to all endpoints concurrently
-	var wg sync.WaitGroup
-	errChan := make(chan error, len(endpoints))
+	d := &delivery{payload: eventPayload, maxResponseBytes: maxResponseBytes, hedging: hedging, success: success, timeoutMs: timeoutMs}
+	d.headers, err = meta.expandHeaders(headerTemplates)
+	if err == nil {
+		d.body, d.contentType, err = encodeBody(encoding, eventPayload, meta)
+	}
+	if err == nil && maxRequestBytes > 0 && int64(len(d.body)) > maxRequestBytes {
+		err = fmt.Errorf("encoded body of %d bytes exceeds max_request_bytes (%d)", len(d.body), maxRequestBytes)
+	}
+	if err == nil && signing != nil {
+		f.sign(d, domain, signing)
+	}
+	if err != nil {
+		if f.store != nil {
+			f.store.AddFailedEvent(eventData, domain, callID, jsDelivery, maxDeliveries, endpointNames, []string{err.Error()}, nil)
+		}
+		if notifyOps && isLastAttempt(jsDelivery, maxDeliveries) {
+			f.ops.DeadLetter(opsTarget, domain, callID, err.Error())
+		}
+		return err
+	}
 
-	for _, endpoint := range endpoints {
-		wg.Add(1)
-		go func(url string) {
-			defer wg.Done()
-			if err := f.forwardToEndpoint(ctx, url, eventPayload, callID, domain, state, status); err != nil {
-				errChan <- fmt.Errorf("endpoint %s failed: %w", url, err)
+	results, errors, retryAfter := f.forwardConcurrently(ctx, endpoints, d, meta)
+
+	// Backup receivers only get the event when every endpoint failed, so it is never
+	// delivered to both during normal operation
+	fallbackUsed := ""
+	if len(endpoints) > 0 && len(errors) == len(endpoints) && len(fallbackEndpoints) > 0 && !stale && jsDelivery.Endpoint == "" {
+		for _, endpoint := range selectEndpoints(fallbackEndpoints, callID, eventData) {
+			logger.LogWithDomain(zapcore.WarnLevel, "All endpoints failed, trying fallback endpoint",
+				zap.String("domain", domain),
+				zap.String("call_id", callID),
+				zap.String("hub_event_id", eventID),
+				zap.String("fallback_endpoint", endpoint.Name()),
+				zap.Int("failed_endpoints", len(endpoints)),
+			)
+			endpointNames = append(endpointNames, endpoint.Name())
+			start := time.Now()
+			fallbackCtx, cancel := fallbackContext(ctx, endpoint.Timeout(timeoutMs))
+			err := f.forwardToEndpoint(fallbackCtx, endpoint, d, meta)
+			cancel()
+			results = append(results, deliveryResult(endpoint, err, time.Since(start)))
+			if err == nil {
+				fallbackUsed = endpoint.Name()
+				errors, retryAfter = nil, 0
+				break
+			}
+			if ra, ok := err.(*RetryAfterError); ok && ra.Delay > retryAfter {
+				retryAfter = ra.Delay
 			}
-		}(endpoint)
+			errors = append(errors, fmt.Errorf("fallback endpoint %s failed: %w", endpoint.Name(), err))
+		}
 	}
 
-	// Wait for all goroutines to complete
-	wg.Wait()
-	close(errChan)
-
-	// Check if any endpoint failed
-	var errors []error
-	for err := range errChan {
-		errors = append(errors, err)
+	if f.receipts != nil {
+		// Once a fallback delivered the event, the failed endpoints see no redelivery either
+		f.publishReceipts(results, meta, jsDelivery, maxDeliveries, fallbackUsed != "")
+	}
+	if notifyOps {
+		f.ops.Results(opsTarget, domain, results)
+	}
+	if f.onRecovery != nil && recoveryReplay.Enabled {
+		for _, recovery := range f.outages.record(domain, results, recoveryReplay.UnhealthyAfter, f.clock.Now()) {
+			f.onRecovery(recovery)
+		}
 	}
 
 	if len(errors) > 0 {
@@ -151,41 +705,220 @@ func (f *Forwarder) ForwardEvent(ctx context.Context, eventData []byte, domain s
 		// Log full event data with error information
 		logger.LogWithDomain(zapcore.ErrorLevel, "Failed to forward event",
 			zap.String("domain", domain),
+			zap.String("hub_event_id", eventID),
 			zap.Int("failed_endpoints", len(errors)),
 			zap.Strings("errors", errorMessages),
-			zap.Any("event", eventMap), // Log full event data
+			zap.Any("event", ev), // Log full event data
 		)
 
 		// Store the failed event for dashboard
 		if f.store != nil {
-			f.store.AddFailedEvent(eventData, domain, callID, deliveryAttempt, maxDeliveries, endpoints, errorMessages)
+			f.store.AddFailedEvent(eventData, domain, callID, jsDelivery, maxDeliveries, endpointNames, errorMessages, results)
+		}
+		if notifyOps && isLastAttempt(jsDelivery, maxDeliveries) {
+			f.ops.DeadLetter(opsTarget, domain, callID, strings.Join(errorMessages, "; "))
 		}
 
-		return fmt.Errorf("failed to forward to %d endpoint(s): %v", len(errors), errors)
+		err := fmt.Errorf("failed to forward to %d endpoint(s): %v", len(errors), errors)
+		if retryAfter > 0 {
+			return &RetryAfterError{Delay: retryAfter, Err: err}
+		}
+		return err
 	}
 
 	// Log full event data on success
 	logger.LogWithDomain(zapcore.InfoLevel, "Event forwarded successfully",
 		zap.String("domain", domain),
+		zap.String("hub_event_id", eventID),
 		zap.Int("endpoint_count", len(endpoints)),
-		zap.Any("event", eventMap), // Log full event data
+		zap.String("fallback_endpoint", fallbackUsed),
+		zap.Any("event", ev), // Log full event data
 	)
 
 	// Store the forwarded event for dashboard
 	if f.store != nil {
-		f.store.AddEvent(eventData, domain, callID, deliveryAttempt, endpoints)
+		if stale {
+			f.store.AddStaleEvent(eventData, domain, callID, jsDelivery, endpointNames, results)
+		} else {
+			f.store.AddEvent(eventData, domain, callID, jsDelivery, endpointNames, results)
+		}
 	}
 
 	return nil
 }
 
+// fallbackContext returns the context of an attempt at a fallback endpoint. The endpoints
+// tried before may have used up ctx's deadline (every one timed out), so the attempt gets
+// its own deadline of the fallback's timeout; it still ends when ctx is canceled, e.g. on
+// shutdown.
+func fallbackContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	attemptCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			cancel()
+		}
+	})
+	return attemptCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// forwardConcurrently forwards a delivery to all endpoints at once. It returns the result of
+// each endpoint, the errors of those that failed, and the longest Retry-After hint among them.
+func (f *Forwarder) forwardConcurrently(ctx context.Context, endpoints []config.Endpoint, d *delivery, meta eventMeta) ([]store.DeliveryResult, []error, time.Duration) {
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(endpoints))
+	results := make([]store.DeliveryResult, len(endpoints))
+
+	// Longest Retry-After hint among failed endpoints
+	var retryAfter time.Duration
+	var retryMu sync.Mutex
+
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint config.Endpoint) {
+			defer wg.Done()
+			start := time.Now()
+			err := f.forwardToEndpoint(ctx, endpoint, d, meta)
+			results[i] = deliveryResult(endpoint, err, time.Since(start))
+			if err != nil {
+				if ra, ok := err.(*RetryAfterError); ok {
+					retryMu.Lock()
+					if ra.Delay > retryAfter {
+						retryAfter = ra.Delay
+					}
+					retryMu.Unlock()
+				}
+				errChan <- fmt.Errorf("endpoint %s failed: %w", endpoint.Name(), err)
+			}
+		}(i, endpoint)
+	}
+
+	// Wait for all goroutines to complete
+	wg.Wait()
+	close(errChan)
+
+	var errors []error
+	for err := range errChan {
+		errors = append(errors, err)
+	}
+	return results, errors, retryAfter
+}
+
+// countOutcome counts an event for the delivery report: delivered (or skipped) if forwarded,
+// dead-lettered if it failed for the last time or was quarantined. Failures that are
+// redelivered are not counted.
+func (f *Forwarder) countOutcome(domain string, jsDelivery store.Delivery, maxDeliveries int, skipped bool, err error) {
+	outcome := sla.Delivered
+	var quarantined *QuarantineError
+	switch {
+	case err == nil && skipped:
+		outcome = sla.Skipped
+	case err == nil:
+	case errors.As(err, &quarantined) || isLastAttempt(jsDelivery, maxDeliveries):
+		outcome = sla.DeadLettered
+	default:
+		return
+	}
+	f.counters.Record(domain, outcome, f.clock.Now())
+}
+
+// isLastAttempt reports whether no redelivery follows a failure of this delivery
+func isLastAttempt(jsDelivery store.Delivery, maxDeliveries int) bool {
+	return jsDelivery.AtMostOnce || (maxDeliveries > 0 && jsDelivery.Attempt >= maxDeliveries)
+}
+
+// publishReceipts publishes the outcome of this attempt for every endpoint; final marks every
+// receipt final regardless of the attempt
+func (f *Forwarder) publishReceipts(results []store.DeliveryResult, meta eventMeta, jsDelivery store.Delivery, maxDeliveries int, final bool) {
+	lastAttempt := final || isLastAttempt(jsDelivery, maxDeliveries)
+	now := f.clock.Now()
+	for _, result := range results {
+		f.receipts.Publish(receipts.Receipt{
+			CallID:          meta.CallID,
+			HubEventID:      meta.EventID,
+			Domain:          meta.Domain,
+			DeliveryAttempt: jsDelivery.Attempt,
+			Final:           result.Status == store.ResultSuccess || lastAttempt,
+			Replay:          jsDelivery.Replay,
+			Instance:        f.instanceID,
+			Timestamp:       now,
+			DeliveryResult:  result,
+		})
+	}
+}
+
+// correlate returns the correlation ID of the event's logical call ("" if correlation is not configured)
+func (f *Forwarder) correlate(domain, callID string, ev *event.Event, cfg config.CorrelationConfig) string {
+	if !cfg.Enabled() {
+		return ""
+	}
+	values := make(map[string]string, len(cfg.Keys))
+	for _, key := range cfg.Keys {
+		values[key] = ev.Text(key)
+	}
+	refs := make([]string, 0, len(cfg.CallIDRefs))
+	for _, field := range cfg.CallIDRefs {
+		refs = append(refs, ev.Text(field))
+	}
+	return f.correlator.Resolve(domain, callID, values, refs)
+}
+
+// CorrelatedCalls returns the correlation ID and known call_ids of the logical call
+// that callID belongs to
+func (f *Forwarder) CorrelatedCalls(callID string) (string, []string) {
+	return f.correlator.Calls(callID)
+}
+
+// ForgetCall drops the correlation links of the logical call that callID belongs to
+func (f *Forwarder) ForgetCall(callID string) bool {
+	return f.correlator.Forget(callID)
+}
+
+// RetryDelay returns the redelivery delay for a failed delivery attempt of a domain's event,
+// using the route's retry policy if set, otherwise the global one, otherwise the route's
+// redelivery_delay_seconds (0 = rely on the consumer's ack_wait)
+func (f *Forwarder) RetryDelay(domain string, deliveryAttempt int) time.Duration {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	policy := f.config.NATS.RetryPolicy
+	route := f.config.RouteFor(domain)
+	if route != nil && route.RetryPolicy != nil {
+		policy = route.RetryPolicy
+	}
+	if delay := policy.Delay(deliveryAttempt); delay > 0 || route == nil || route.RedeliveryDelaySeconds == 0 {
+		return delay
+	}
+	return time.Duration(route.RedeliveryDelaySeconds) * time.Second
+}
+
+// MaxDeliveries returns how many times an event of the domain is delivered before it is
+// given up (the route's max_deliveries, or nats.max_deliveries)
+func (f *Forwarder) MaxDeliveries(domain string) int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.config.MaxDeliveries(domain)
+}
+
+// AtMostOnce reports whether the domain's route acknowledges events before forwarding them
+func (f *Forwarder) AtMostOnce(domain string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	route := f.config.RouteFor(domain)
+	return route != nil && route.AtMostOnce()
+}
+
 // ReloadConfig reloads the configuration from the specified file path
 func (f *Forwarder) ReloadConfig(configPath string) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	// Load new config
-	newCfg, err := config.Load(configPath)
+	// Load new config, keeping the loaded version of config directory files now rejected
+	newCfg, err := config.LoadDir(configPath, f.configDir, f.baseConfig)
 	if err != nil {
 		return fmt.Errorf("failed to reload config: %w", err)
 	}
@@ -195,12 +928,25 @@ func (f *Forwarder) ReloadConfig(configPath string) error {
 		return fmt.Errorf("invalid reloaded config: %w", err)
 	}
 
+	// Pooled connections may point at addresses the new policy blocks
+	securityChanged := !reflect.DeepEqual(f.config.EndpointSecurity, newCfg.EndpointSecurity)
+
 	// Update config atomically
-	f.config = newCfg
+	f.baseConfig = newCfg
+	f.config = f.withOverrides(newCfg)
+	f.resolver.update(newCfg.DNS)
+	f.files.sync(newCfg)
+	f.applyQuotas(newCfg)
+	if securityChanged {
+		f.closeIdleConnections()
+	}
 
 	logger.Logger.Info("Configuration reloaded successfully",
 		zap.Int("route_count", len(newCfg.Routes)),
 	)
+	for _, warning := range newCfg.Lint() {
+		logger.Logger.Warn("Configuration warning", zap.String("path", warning.Path), zap.String("warning", warning.Message))
+	}
 
 	return nil
 }
@@ -212,44 +958,245 @@ func (f *Forwarder) GetConfig() *config.Config {
 	return f.config
 }
 
-// enrichPayload adds delivery_attempt and using_forwarder fields to the event payload
-func (f *Forwarder) enrichPayload(eventData []byte, deliveryAttempt int) ([]byte, error) {
-	// Parse the event as a map to preserve all fields
-	var eventMap map[string]interface{}
-	if err := json.Unmarshal(eventData, &eventMap); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
-	}
+// enrichPayload adds delivery_attempt and using_forwarder fields to the event payload,
+// sets the route's transform fields (dotted names set nested fields), then applies its
+// rename_fields and removes its drop_fields. Transforms read the original event, so their
+// order does not matter; a failing transform or rename is logged and leaves its field
+// unchanged.
+func (f *Forwarder) enrichPayload(ev *event.Event, deliveryAttempt int, transforms map[string]string, renameFields config.RenameFields, dropFields []string, meta eventMeta) ([]byte, error) {
+	// Work on a copy; transforms read the event as received
+	payload := ev.Clone()
 
 	// Add or update delivery_attempt field
-	eventMap["delivery_attempt"] = deliveryAttempt
+	payload.Set("delivery_attempt", deliveryAttempt)
 
 	// Add using_forwarder field to indicate this event is forwarded by the forwarder service
-	eventMap["using_forwarder"] = 1
+	payload.Set("using_forwarder", 1)
+
+	if meta.CorrelationID != "" {
+		payload.Set("correlation_id", meta.CorrelationID)
+	}
+
+	// Tell backends the event was sent again by an operator replay
+	if meta.Replay != "" {
+		payload.Set("replay", true)
+		payload.Set("replay_id", meta.Replay)
+	}
+
+	for field, source := range transforms {
+		t, err := transform.Cached(source)
+		if err == nil {
+			var value interface{}
+			if value, err = t.Value(meta.lookup); err == nil {
+				if err = payload.SetPath(field, value); err == nil {
+					continue
+				}
+			}
+		}
+		logger.Logger.Warn("Payload transform failed, field left unchanged",
+			zap.String("call_id", meta.CallID),
+			zap.String("hub_event_id", meta.EventID),
+			zap.String("domain", meta.Domain),
+			zap.String("field", field),
+			zap.String("template", source),
+			zap.Error(err),
+		)
+	}
+
+	if err := renameFields.Apply(payload); err != nil {
+		logger.Logger.Warn("Payload field rename failed, field left unchanged",
+			zap.String("call_id", meta.CallID),
+			zap.String("hub_event_id", meta.EventID),
+			zap.String("domain", meta.Domain),
+			zap.Error(err),
+		)
+	}
 
-	// Marshal back to JSON
-	payload, err := json.Marshal(eventMap)
+	for _, field := range dropFields {
+		payload.Delete(field)
+	}
+
+	// Marshal back to JSON, keeping the fields the hub does not change as received
+	data, err := payload.MarshalJSON()
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal event: %w", err)
 	}
 
-	return payload, nil
+	return data, nil
 }
 
-// forwardToEndpoint forwards the event to a single endpoint
-func (f *Forwarder) forwardToEndpoint(ctx context.Context, url string, eventData []byte, callID, domain, state, status string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(eventData))
+// eventMeta carries the event fields used for logging, sink routing and templates
+type eventMeta struct {
+	CallID        string
+	EventID       string // hub_event_id given at ingest (empty for older events)
+	Domain        string
+	State         string
+	Status        string
+	Direction     string
+	CorrelationID string       // Logical call of the leg (empty if correlation is not configured)
+	Replay        string       // Replay ID if the event is sent again by a stream replay
+	Event         *event.Event // Parsed event, read-only
+}
+
+// lookup resolves template fields; the normalized values above take precedence over the raw event
+func (m eventMeta) lookup(name string) interface{} {
+	switch name {
+	case "domain":
+		return m.Domain
+	case "call_id":
+		return m.CallID
+	case "state":
+		return m.State
+	case "status":
+		return m.Status
+	case "direction":
+		return m.Direction
+	case "correlation_id":
+		if m.CorrelationID != "" {
+			return m.CorrelationID
+		}
+	}
+	if m.Event == nil {
+		return nil
+	}
+	return m.Event.Get(name)
+}
+
+// expand renders a URL, header or sink template for the event, passing each value
+// through escape if set. Failures are logged and returned as a templateError.
+func (m eventMeta) expand(template string, escape func(string) string) (string, error) {
+	value, err := transform.Expand(template, m.lookup, escape)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		logger.Logger.Warn("Template evaluation failed",
+			zap.String("call_id", m.CallID),
+			zap.String("hub_event_id", m.EventID),
+			zap.String("domain", m.Domain),
+			zap.String("template", template),
+			zap.Error(err),
+		)
+		return "", &templateError{err: err}
+	}
+	return value, nil
+}
+
+// expandHeaders renders the route's header templates
+func (m eventMeta) expandHeaders(templates map[string]string) (http.Header, error) {
+	headers := make(http.Header, len(templates))
+	for name, template := range templates {
+		value, err := m.expand(template, nil)
+		if err != nil {
+			return nil, err
+		}
+		headers.Set(name, value)
+	}
+	return headers, nil
+}
+
+// urlEscape percent-encodes everything but unreserved characters, so a value is
+// safe in any part of a URL template (path segment or query)
+func urlEscape(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// delivery is what is sent for one event, shared read-only by all endpoint requests
+type delivery struct {
+	payload          []byte      // JSON payload, sent as is by non-HTTP sinks
+	body             []byte      // HTTP request body in the route's encoding
+	contentType      string      // Content-Type of body
+	headers          http.Header // Route's extra request headers, used by HTTP-based sinks
+	maxResponseBytes int64
+	hedging          *config.HedgingConfig // Set when HTTP requests are hedged
+	success          *config.SuccessConfig // Route's success criteria for HTTP endpoints (nil = any 2xx)
+	timeoutMs        int                   // Route's timeout_ms, for endpoints that set none
+}
+
+// forwardToEndpoint forwards the event to a single endpoint, dispatching on its type
+func (f *Forwarder) forwardToEndpoint(ctx context.Context, endpoint config.Endpoint, d *delivery, meta eventMeta) error {
+	switch endpoint.Type {
+	case config.EndpointMQTT:
+		return f.mqtt.publish(ctx, endpoint.MQTT, d.payload, meta)
+	case config.EndpointFile:
+		return f.files.write(endpoint.File, d.payload, meta)
+	case config.EndpointRedis:
+		return f.redis.xadd(ctx, endpoint.Redis, d.payload, meta)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Call-ID", callID)
-	req.Header.Set("X-Domain", domain)
+	// HTTP-based endpoints: slow CRM webhooks may get longer than fast internal services
+	ctx, cancel := context.WithTimeout(ctx, endpoint.Timeout(d.timeoutMs))
+	defer cancel()
+	if endpoint.Type == config.EndpointEventHubs {
+		return f.forwardEventHubs(ctx, endpoint.EventHubs, d, meta)
+	}
+	return f.forwardHTTP(ctx, endpoint.URL, d, meta)
+}
+
+// forwardHTTP posts the event to an HTTP endpoint; url may be a template
+func (f *Forwarder) forwardHTTP(ctx context.Context, url string, d *delivery, meta eventMeta) error {
+	// Don't hit an endpoint that asked us to back off
+	if remaining := f.endpointPause(url); remaining > 0 {
+		return &RetryAfterError{Delay: remaining, Err: fmt.Errorf("endpoint paused by Retry-After")}
+	}
+
+	target := url
+	if transform.HasExpressions(url) {
+		var err error
+		if target, err = meta.expand(url, urlEscape); err != nil {
+			return err
+		}
+	}
+
+	newRequest := func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(d.body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		for name, values := range d.headers {
+			req.Header[name] = values
+		}
+		req.Header.Set("Content-Type", d.contentType)
+		req.Header.Set("X-Call-ID", meta.CallID)
+		if meta.EventID != "" {
+			req.Header.Set("X-Hub-Event-ID", meta.EventID)
+		}
+		req.Header.Set("X-Domain", meta.Domain)
+		return req, nil
+	}
+
+	if d.hedging != nil {
+		return f.doHedged(ctx, url, d, meta, newRequest)
+	}
+	req, err := newRequest(ctx)
+	if err != nil {
+		return err
+	}
+	return f.doRequest(req, url, d.maxResponseBytes, d.success, meta)
+}
+
+// doRequest sends a forward request and classifies the response: 2xx succeeds, 429/503 with
+// Retry-After pauses the endpoint (named by url) and returns a RetryAfterError, anything else fails.
+// success, if set, also accepts some non-2xx codes and can reject a 2xx by its body.
+func (f *Forwarder) doRequest(req *http.Request, url string, maxResponseBytes int64, success *config.SuccessConfig, meta eventMeta) error {
+	callID, domain, state, status := meta.CallID, meta.Domain, meta.State, meta.Status
 
-	resp, err := f.client.Do(req)
+	f.identify(req)
+	resp, err := f.clientFor(domain).Do(req)
 	if err != nil {
+		if errors.Is(context.Cause(req.Context()), errHedgeLost) {
+			return err
+		}
 		logger.Logger.Warn("HTTP request failed",
 			zap.String("call_id", callID),
+			zap.String("hub_event_id", meta.EventID),
 			zap.String("domain", domain),
 			zap.String("state", state),
 			zap.String("status", status),
@@ -260,18 +1207,124 @@ func (f *Forwarder) forwardToEndpoint(ctx context.Context, url string, eventData
 	}
 	defer resp.Body.Close()
 
+	// Read at most maxResponseBytes; a fully read body lets the connection be reused
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			f.pauseEndpoint(url, delay)
+			logger.Logger.Warn("Backend asked to back off",
+				zap.String("call_id", callID),
+				zap.String("hub_event_id", meta.EventID),
+				zap.String("domain", domain),
+				zap.String("endpoint", url),
+				zap.Int("status_code", resp.StatusCode),
+				zap.Duration("retry_after", delay),
+			)
+			return &RetryAfterError{Delay: delay, Err: &statusError{code: resp.StatusCode}}
+		}
+	}
+
+	if success.AcceptsStatus(resp.StatusCode) {
+		logger.Logger.Debug("HTTP response status accepted as success",
+			zap.String("call_id", callID),
+			zap.String("hub_event_id", meta.EventID),
+			zap.String("domain", domain),
+			zap.String("endpoint", url),
+			zap.Int("status_code", resp.StatusCode),
+		)
+		return nil
+	}
+
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		err := fmt.Errorf("non-2xx response: %d", resp.StatusCode)
+		err := &statusError{code: resp.StatusCode}
 		logger.Logger.Warn("HTTP request returned non-2xx",
 			zap.String("call_id", callID),
+			zap.String("hub_event_id", meta.EventID),
 			zap.String("domain", domain),
 			zap.String("state", state),
 			zap.String("status", status),
 			zap.String("endpoint", url),
 			zap.Int("status_code", resp.StatusCode),
+			zap.String("response_body", truncateBody(body, maxLoggedResponseBytes)),
 		)
 		return err
 	}
 
+	if err := success.CheckBody(body); err != nil {
+		logger.Logger.Warn("HTTP response rejected by the route's success criteria",
+			zap.String("call_id", callID),
+			zap.String("hub_event_id", meta.EventID),
+			zap.String("domain", domain),
+			zap.String("state", state),
+			zap.String("status", status),
+			zap.String("endpoint", url),
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("reason", err.Error()),
+			zap.String("response_body", truncateBody(body, maxLoggedResponseBytes)),
+		)
+		return &rejectedError{code: resp.StatusCode, reason: err.Error()}
+	}
+
 	return nil
 }
+
+// pauseEndpoint stops forwarding to an endpoint for the given duration
+func (f *Forwarder) pauseEndpoint(url string, delay time.Duration) {
+	f.pauseMu.Lock()
+	defer f.pauseMu.Unlock()
+
+	until := f.clock.Now().Add(delay)
+	if until.After(f.pausedUntil[url]) {
+		f.pausedUntil[url] = until
+	}
+}
+
+// endpointPause returns how long the endpoint remains paused (0 if not paused)
+func (f *Forwarder) endpointPause(url string) time.Duration {
+	f.pauseMu.Lock()
+	defer f.pauseMu.Unlock()
+
+	until, ok := f.pausedUntil[url]
+	if !ok {
+		return 0
+	}
+	remaining := until.Sub(f.clock.Now())
+	if remaining <= 0 {
+		delete(f.pausedUntil, url)
+		return 0
+	}
+	return remaining
+}
+
+// parseRetryAfter parses a Retry-After header (delay-seconds or HTTP-date), capped at maxRetryAfter
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		delay = time.Until(t)
+	} else {
+		return 0, false
+	}
+
+	if delay <= 0 {
+		return 0, false
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay, true
+}
+
+// truncateBody returns at most max bytes of a response body for logging
+func truncateBody(body []byte, max int) string {
+	if len(body) > max {
+		return string(body[:max]) + "..."
+	}
+	return string(body)
+}
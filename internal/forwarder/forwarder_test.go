@@ -0,0 +1,79 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+	"calleventhub/internal/store"
+
+	"go.uber.org/zap"
+)
+
+// When the primary endpoint hangs until its timeout, the deadline of the forward is spent
+// too; the fallback endpoint must still get its own time and the event
+func TestFallbackAfterPrimaryTimeout(t *testing.T) {
+	logger.Logger = zap.NewNop()
+
+	release := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer primary.Close()
+	defer close(release)
+	received := make(chan struct{}, 1)
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fallback.Close()
+
+	cfg, err := config.Parse([]byte(fmt.Sprintf(`
+nats: {url: "nats://localhost:4222", stream_name: CALL_EVENTS, subject_pattern: "events.>", ack_wait_seconds: 30, max_deliveries: 5}
+server: {port: 8080}
+routes:
+  - domain: tenant1.example.com
+    timeout_ms: 500
+    endpoints: [%q]
+    fallback_endpoints: [%q]
+`, primary.URL, fallback.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewForwarder(cfg, nil)
+	defer f.Close()
+
+	// The forward's deadline ends with the primary's timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	err = f.ForwardEvent(ctx, []byte(`{"domain":"tenant1.example.com","call_id":"c1"}`), "tenant1.example.com", store.Delivery{Attempt: 1})
+	if err != nil {
+		t.Fatalf("forward failed: %v", err)
+	}
+	select {
+	case <-received:
+	default:
+		t.Fatal("fallback endpoint did not get the event")
+	}
+}
+
+// A fallback attempt still ends when the forward is canceled, e.g. on shutdown
+func TestFallbackContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attemptCtx, stop := fallbackContext(ctx, time.Minute)
+	defer stop()
+	cancel()
+	select {
+	case <-attemptCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("fallback attempt not canceled with the forward")
+	}
+}
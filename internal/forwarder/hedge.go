@@ -0,0 +1,201 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// Latency samples kept per endpoint, and the fewest needed to trust their P95
+const (
+	latencySamples    = 200
+	minLatencySamples = 20
+)
+
+// errHedgeLost cancels the request of a hedged pair that did not answer first
+var errHedgeLost = errors.New("hedged request lost")
+
+// HedgeStats counts the hedged requests of a domain
+type HedgeStats struct {
+	Domain string `json:"domain"`
+	Hedged int64  `json:"hedged"` // Second requests sent because the first was slow
+	Won    int64  `json:"won"`    // Second requests that answered first
+}
+
+// latencyWindows keeps the recent successful latencies of each hedged endpoint
+type latencyWindows struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration // Ring per endpoint URL
+	next    map[string]int             // Next slot to overwrite once the ring is full
+
+	stats map[string]*HedgeStats // By domain
+}
+
+func newLatencyWindows() *latencyWindows {
+	return &latencyWindows{
+		samples: make(map[string][]time.Duration),
+		next:    make(map[string]int),
+		stats:   make(map[string]*HedgeStats),
+	}
+}
+
+// record adds a successful request's latency
+func (l *latencyWindows) record(url string, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	samples := l.samples[url]
+	if len(samples) < latencySamples {
+		l.samples[url] = append(samples, latency)
+		return
+	}
+	samples[l.next[url]] = latency
+	l.next[url] = (l.next[url] + 1) % latencySamples
+}
+
+// p95 returns the endpoint's 95th percentile latency, false until enough requests succeeded
+func (l *latencyWindows) p95(url string) (time.Duration, bool) {
+	l.mu.Lock()
+	samples := append([]time.Duration(nil), l.samples[url]...)
+	l.mu.Unlock()
+
+	if len(samples) < minLatencySamples {
+		return 0, false
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples[len(samples)*95/100], true
+}
+
+// count records a hedged request of a domain and whether it won
+func (l *latencyWindows) count(domain string, won bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.stats[domain]
+	if !ok {
+		s = &HedgeStats{Domain: domain}
+		l.stats[domain] = s
+	}
+	s.Hedged++
+	if won {
+		s.Won++
+	}
+}
+
+// HedgeStats returns the hedging counters of the domains accepted by include, ordered by domain
+func (f *Forwarder) HedgeStats(include func(domain string) bool) []HedgeStats {
+	f.latencies.mu.Lock()
+	defer f.latencies.mu.Unlock()
+
+	stats := make([]HedgeStats, 0, len(f.latencies.stats))
+	for domain, s := range f.latencies.stats {
+		if include(domain) {
+			stats = append(stats, *s)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Domain < stats[j].Domain })
+	return stats
+}
+
+// hedgeDelay returns how long to wait for the first request before sending the second
+func (f *Forwarder) hedgeDelay(url string, hedging *config.HedgingConfig) time.Duration {
+	delay, ok := f.latencies.p95(url)
+	if !ok {
+		delay = hedging.InitialDelay()
+	}
+	if min := hedging.MinDelay(); delay < min {
+		delay = min
+	}
+	return delay
+}
+
+// hedgedAttempt is the outcome of one request of a hedged pair
+type hedgedAttempt struct {
+	second  bool
+	err     error
+	latency time.Duration
+}
+
+// doHedged sends the request built by newRequest and, if it has not answered within the
+// endpoint's recent P95 latency, an identical second one. The first success wins and the
+// other request is cancelled; a request that fails before the delay is not hedged.
+func (f *Forwarder) doHedged(ctx context.Context, url string, d *delivery, meta eventMeta, newRequest func(context.Context) (*http.Request, error)) error {
+	attempts := make(chan hedgedAttempt, 2)
+	var cancels []context.CancelCauseFunc
+	defer func() {
+		for _, cancel := range cancels {
+			cancel(errHedgeLost)
+		}
+	}()
+
+	send := func(second bool) error {
+		attemptCtx, cancel := context.WithCancelCause(ctx)
+		cancels = append(cancels, cancel)
+		req, err := newRequest(attemptCtx)
+		if err != nil {
+			return err
+		}
+		go func() {
+			start := time.Now()
+			err := f.doRequest(req, url, d.maxResponseBytes, d.success, meta)
+			attempts <- hedgedAttempt{second: second, err: err, latency: time.Since(start)}
+		}()
+		return nil
+	}
+
+	if err := send(false); err != nil {
+		return err
+	}
+	timer := time.NewTimer(f.hedgeDelay(url, d.hedging))
+	defer timer.Stop()
+
+	pending, hedged := 1, false
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if f.endpointPause(url) > 0 {
+				continue
+			}
+			if err := send(true); err != nil {
+				continue
+			}
+			hedged = true
+			pending++
+			logger.Logger.Debug("Hedging slow request",
+				zap.String("call_id", meta.CallID),
+				zap.String("hub_event_id", meta.EventID),
+				zap.String("domain", meta.Domain),
+				zap.String("endpoint", url),
+			)
+
+		case a := <-attempts:
+			pending--
+			if a.err == nil {
+				f.latencies.record(url, a.latency)
+				if hedged {
+					f.latencies.count(meta.Domain, a.second)
+				}
+				return nil
+			}
+			if firstErr == nil {
+				firstErr = a.err
+			}
+			// Wait for the other request; a failure before the hedge delay is final, like any other
+			if pending == 0 {
+				if hedged {
+					f.latencies.count(meta.Domain, false)
+				}
+				return firstErr
+			}
+		}
+	}
+}
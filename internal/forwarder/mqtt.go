@@ -0,0 +1,224 @@
+package forwarder
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// mqttTimeout bounds connecting and publishing, like the HTTP backend timeout
+const mqttTimeout = 3 * time.Second
+
+// mqttPool keeps one connected client per broker and credential set
+type mqttPool struct {
+	clients map[string]mqtt.Client
+	mu      sync.Mutex
+
+	// Rejects broker addresses that must not be connected to (SSRF protection); nil allows all
+	checkIP func(ip net.IP) error
+}
+
+func newMQTTPool() *mqttPool {
+	return &mqttPool{
+		clients: make(map[string]mqtt.Client),
+	}
+}
+
+// publish sends the event to the sink's topic and waits for the broker to accept it (QoS > 0)
+func (p *mqttPool) publish(ctx context.Context, sink *config.MQTTSink, payload []byte, meta eventMeta) error {
+	client, err := p.client(sink)
+	if err != nil {
+		logger.Logger.Warn("MQTT connect failed",
+			zap.String("call_id", meta.CallID),
+			zap.String("hub_event_id", meta.EventID),
+			zap.String("domain", meta.Domain),
+			zap.String("broker", sink.Broker),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	topic, err := mqttTopic(sink.Topic, meta)
+	if err != nil {
+		return err
+	}
+	token := client.Publish(topic, sink.QoS, sink.Retained, payload)
+
+	select {
+	case <-token.Done():
+	case <-time.After(mqttTimeout):
+		return fmt.Errorf("mqtt publish to %s %w", topic, errTimedOut)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := token.Error(); err != nil {
+		logger.Logger.Warn("MQTT publish failed",
+			zap.String("call_id", meta.CallID),
+			zap.String("hub_event_id", meta.EventID),
+			zap.String("domain", meta.Domain),
+			zap.String("broker", sink.Broker),
+			zap.String("topic", topic),
+			zap.Error(err),
+		)
+		return fmt.Errorf("mqtt publish to %s failed: %w", topic, err)
+	}
+	return nil
+}
+
+// client returns a connected client for the sink, connecting on first use
+func (p *mqttPool) client(sink *config.MQTTSink) (mqtt.Client, error) {
+	key := mqttClientKey(sink)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if client, ok := p.clients[key]; ok {
+		// Auto-reconnect handles dropped connections; only a never-connected client is retried here
+		if client.IsConnectionOpen() || client.IsConnected() {
+			return client, nil
+		}
+		client.Disconnect(0)
+		delete(p.clients, key)
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(sink.Broker).
+		SetClientID(mqttClientID(sink, key)).
+		SetUsername(sink.Username).
+		SetPassword(sink.Password).
+		SetConnectTimeout(mqttTimeout).
+		SetWriteTimeout(mqttTimeout).
+		SetAutoReconnect(true).
+		SetCleanSession(true).
+		SetDialer(&net.Dialer{
+			Timeout: mqttTimeout,
+			Control: controlDial(p.checkIP, "mqtt broker"),
+		})
+
+	if sink.TLS != nil {
+		tlsConfig, err := buildTLSConfig(sink.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(mqttTimeout) {
+		client.Disconnect(0)
+		return nil, fmt.Errorf("mqtt connect to %s %w", sink.Broker, errTimedOut)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("mqtt connect to %s failed: %w", sink.Broker, err)
+	}
+
+	p.clients[key] = client
+	return client, nil
+}
+
+// controlDial returns a net.Dialer Control function that rejects blocked
+// addresses after DNS resolution (used by non-HTTP sinks)
+func controlDial(checkIP func(ip net.IP) error, what string) func(network, address string, _ syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		if checkIP == nil {
+			return nil
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if err := checkIP(net.ParseIP(host)); err != nil {
+			return fmt.Errorf("refusing to connect to %s: %w", what, err)
+		}
+		return nil
+	}
+}
+
+// close disconnects all clients
+func (p *mqttPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, client := range p.clients {
+		client.Disconnect(250)
+		delete(p.clients, key)
+	}
+}
+
+// mqttClientKey identifies the connection settings of a sink (topic and QoS do not need a separate client)
+func mqttClientKey(sink *config.MQTTSink) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s", sink.Broker, sink.ClientID, sink.Username, sink.Password)
+	if sink.TLS != nil {
+		fmt.Fprintf(h, "\x00%+v", *sink.TLS)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// mqttClientID returns the configured client ID, or one unique to this process and connection
+func mqttClientID(sink *config.MQTTSink, key string) string {
+	if sink.ClientID != "" {
+		return sink.ClientID
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("event-hub-%s-%d-%s", hostname, os.Getpid(), key[:6])
+}
+
+// mqttTopic expands the event fields in a topic template
+func mqttTopic(template string, meta eventMeta) (string, error) {
+	return meta.expand(template, topicLevel)
+}
+
+// topicLevel makes a value safe to use as a single MQTT topic level
+func topicLevel(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(value)
+}
+
+// buildTLSConfig loads the CA and client certificate files of a sink
+func buildTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in ca_file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,84 @@
+package forwarder
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"calleventhub/internal/config"
+)
+
+// clientFor returns the HTTP client bound to the domain's outbound source
+// (route override, else global setting). Clients are created on first use.
+func (f *Forwarder) clientFor(domain string) *http.Client {
+	f.mu.RLock()
+	source := f.config.Outbound
+	if route := f.config.RouteFor(domain); route != nil && route.Outbound != nil {
+		source = *route.Outbound
+	}
+	f.mu.RUnlock()
+
+	if source == (config.OutboundConfig{}) {
+		return f.client
+	}
+
+	f.clientMu.Lock()
+	defer f.clientMu.Unlock()
+
+	client, ok := f.clients[source]
+	if !ok {
+		transport := newTransport(f.resolver, source)
+		client = &http.Client{
+			Transport: transport, // Requests time out by the endpoint's timeout_ms (see forwardToEndpoint)
+		}
+		f.clients[source] = client
+		f.transports = append(f.transports, transport)
+	}
+	return client
+}
+
+// closeIdleConnections drops pooled connections of every outbound client
+func (f *Forwarder) closeIdleConnections() {
+	f.clientMu.Lock()
+	defer f.clientMu.Unlock()
+	for _, transport := range f.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+// localAddrFor returns the local address to bind when connecting to remote,
+// or nil to let the OS choose. The source address must match remote's IP family.
+func localAddrFor(source config.OutboundConfig, remote net.IP) (*net.TCPAddr, error) {
+	wantIPv4 := remote.To4() != nil
+
+	if source.SourceAddress != "" {
+		ip := net.ParseIP(source.SourceAddress)
+		if (ip.To4() != nil) != wantIPv4 {
+			return nil, fmt.Errorf("source address %s cannot reach %s", source.SourceAddress, remote)
+		}
+		return &net.TCPAddr{IP: ip}, nil
+	}
+
+	if source.SourceInterface != "" {
+		iface, err := net.InterfaceByName(source.SourceInterface)
+		if err != nil {
+			return nil, fmt.Errorf("source interface %s: %w", source.SourceInterface, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("source interface %s: %w", source.SourceInterface, err)
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			if (ipNet.IP.To4() != nil) == wantIPv4 {
+				return &net.TCPAddr{IP: ipNet.IP}, nil
+			}
+		}
+		return nil, fmt.Errorf("source interface %s has no address that can reach %s", source.SourceInterface, remote)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,234 @@
+package forwarder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// Errors returned by SetEndpointOverride
+var (
+	ErrRouteNotFound    = errors.New("route not found")
+	ErrEndpointNotFound = errors.New("endpoint not found")
+)
+
+// EndpointOverride changes the rotation settings of one configured endpoint at runtime.
+// Unset fields keep the value from the configuration file.
+type EndpointOverride struct {
+	Disabled *bool `json:"disabled,omitempty"`
+	Weight   *int  `json:"weight,omitempty"`
+}
+
+// endpointOverrides are the overrides set via the API, by domain and endpoint name.
+// They are saved to a file so they survive config reloads and restarts.
+type endpointOverrides struct {
+	mu       sync.Mutex
+	path     string // Empty = not persisted
+	byDomain map[string]map[string]EndpointOverride
+}
+
+// newEndpointOverrides creates an empty set of overrides
+func newEndpointOverrides() *endpointOverrides {
+	return &endpointOverrides{byDomain: make(map[string]map[string]EndpointOverride)}
+}
+
+// apply sets the overridden settings on the endpoints of cfg, which must not be shared yet
+func (o *endpointOverrides) apply(cfg *config.Config) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := range cfg.Routes {
+		route := &cfg.Routes[i]
+		overrides := o.byDomain[route.Domain]
+		if len(overrides) == 0 {
+			continue
+		}
+		route.Endpoints = applyOverrides(route.Endpoints, overrides)
+		if len(route.Match) > 0 {
+			route.Match = append(config.MatchRules(nil), route.Match...)
+			for j := range route.Match {
+				route.Match[j].Endpoints = applyOverrides(route.Match[j].Endpoints, overrides)
+			}
+		}
+		route.FallbackEndpoints = applyOverrides(route.FallbackEndpoints, overrides)
+	}
+}
+
+// applyOverrides returns a copy of endpoints with the overridden settings
+func applyOverrides(endpoints []config.Endpoint, overrides map[string]EndpointOverride) []config.Endpoint {
+	endpoints = append([]config.Endpoint(nil), endpoints...)
+	for i := range endpoints {
+		if override, ok := overrides[endpoints[i].Name()]; ok {
+			override.applyTo(&endpoints[i])
+		}
+	}
+	return endpoints
+}
+
+// applyTo sets the overridden fields on endpoint
+func (o EndpointOverride) applyTo(endpoint *config.Endpoint) {
+	if o.Disabled != nil {
+		endpoint.Disabled = *o.Disabled
+	}
+	if o.Weight != nil {
+		endpoint.Weight = *o.Weight
+	}
+}
+
+// set replaces the overrides of a domain; the caller holds o.mu
+func (o *endpointOverrides) set(domain string, overrides map[string]EndpointOverride) {
+	if len(overrides) == 0 {
+		delete(o.byDomain, domain)
+		return
+	}
+	o.byDomain[domain] = overrides
+}
+
+// save writes the overrides to the file atomically; the caller holds o.mu
+func (o *endpointOverrides) save() error {
+	if o.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(o.byDomain, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(o.path), filepath.Base(o.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), o.path)
+}
+
+// LoadEndpointOverrides reads the endpoint overrides saved at path (if the file exists),
+// applies them to the current configuration and saves later changes there
+func (f *Forwarder) LoadEndpointOverrides(path string) error {
+	f.overrides.mu.Lock()
+	f.overrides.path = path
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &f.overrides.byDomain)
+		if f.overrides.byDomain == nil {
+			f.overrides.byDomain = make(map[string]map[string]EndpointOverride)
+		}
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	f.overrides.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to load endpoint overrides from %s: %w", path, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config = f.withOverrides(f.baseConfig)
+	return nil
+}
+
+// withOverrides returns a copy of cfg with the endpoint overrides applied
+func (f *Forwarder) withOverrides(cfg *config.Config) *config.Config {
+	copied := *cfg
+	copied.Routes = append([]config.Route(nil), cfg.Routes...)
+	f.overrides.apply(&copied)
+	return &copied
+}
+
+// SetEndpointOverride takes an endpoint of a domain's route out of rotation, puts it back
+// or changes its weight, and saves the change. reset drops the endpoint's override, so the
+// configuration file applies again. Returns the route as it is now used.
+func (f *Forwarder) SetEndpointOverride(domain, endpoint string, override EndpointOverride, reset bool) (config.Route, error) {
+	if override.Weight != nil && (*override.Weight < 0 || *override.Weight > 100) {
+		return config.Route{}, fmt.Errorf("weight must be between 0 and 100")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	base := f.baseConfig
+	route := base.GetRoute(domain)
+	if route == nil {
+		return config.Route{}, ErrRouteNotFound
+	}
+	found := false
+	for _, e := range route.ForwardEndpoints() {
+		if e.Name() == endpoint {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return config.Route{}, ErrEndpointNotFound
+	}
+
+	f.overrides.mu.Lock()
+	// Change a copy of the domain's overrides, so a failed save can be undone
+	previous := f.overrides.byDomain[domain]
+	updated := make(map[string]EndpointOverride, len(previous)+1)
+	for name, o := range previous {
+		updated[name] = o
+	}
+	if reset {
+		delete(updated, endpoint)
+	} else {
+		merged := updated[endpoint]
+		if override.Disabled != nil {
+			merged.Disabled = override.Disabled
+		}
+		if override.Weight != nil {
+			merged.Weight = override.Weight
+		}
+		updated[endpoint] = merged
+	}
+	f.overrides.set(domain, updated)
+	if err := f.overrides.save(); err != nil {
+		f.overrides.set(domain, previous)
+		f.overrides.mu.Unlock()
+		return config.Route{}, fmt.Errorf("failed to save endpoint overrides: %w", err)
+	}
+	f.overrides.mu.Unlock()
+
+	f.config = f.withOverrides(base)
+	logger.Logger.Info("Endpoint override changed",
+		zap.String("domain", domain),
+		zap.String("endpoint", endpoint),
+		zap.Bool("reset", reset),
+	)
+	return *f.config.GetRoute(domain), nil
+}
+
+// selectEndpoints returns the endpoints that receive an event of the given call
+func selectEndpoints(endpoints []config.Endpoint, callID string, eventData []byte) []config.Endpoint {
+	selected := endpoints[:0:0]
+	for _, endpoint := range endpoints {
+		if endpoint.Receives(callID, eventData) {
+			selected = append(selected, endpoint)
+		}
+	}
+	return selected
+}
+
+// allDisabled reports whether every endpoint is out of rotation
+func allDisabled(endpoints []config.Endpoint) bool {
+	for _, endpoint := range endpoints {
+		if !endpoint.Disabled {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,20 @@
+package forwarder
+
+import (
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// applyQuotas applies the per-domain quotas of cfg (and the global log settings) to the event
+// store and the domain log files
+func (f *Forwarder) applyQuotas(cfg *config.Config) {
+	if f.store != nil {
+		f.store.SetDomainLimits(cfg.DomainLimits())
+	}
+
+	byDomain := make(map[string]logger.RetentionPolicy)
+	for domain, logs := range cfg.LogRetention() {
+		byDomain[domain] = logger.RetentionPolicy{Days: logs.RetentionDays, Archive: logs.Archive}
+	}
+	logger.SetRetention(logger.RetentionPolicy{Days: cfg.Logs.RetentionDays, Archive: cfg.Logs.Archive}, byDomain)
+}
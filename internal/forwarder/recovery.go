@@ -0,0 +1,82 @@
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"calleventhub/internal/store"
+)
+
+// Recovery is an endpoint of a domain delivering again after an outage: recovery_replay
+// unhealthy_after or more failed deliveries in a row
+type Recovery struct {
+	Domain    string
+	Endpoint  string
+	Since     time.Time // First failed delivery of the outage
+	Recovered time.Time // First successful delivery after it
+	Failures  int       // Failed deliveries in a row
+}
+
+// outageKey identifies one endpoint of a domain
+type outageKey struct {
+	domain   string
+	endpoint string
+}
+
+// outage is a run of failed deliveries to an endpoint
+type outage struct {
+	since    time.Time
+	failures int
+}
+
+// outages follows the failed deliveries in a row of every endpoint
+type outages struct {
+	mu        sync.Mutex
+	endpoints map[outageKey]*outage
+}
+
+func newOutages() *outages {
+	return &outages{endpoints: make(map[outageKey]*outage)}
+}
+
+// record adds the delivery results of a forward and returns the endpoints whose outage
+// (at least unhealthyAfter failures in a row) ended with a successful delivery
+func (o *outages) record(domain string, results []store.DeliveryResult, unhealthyAfter int, now time.Time) []Recovery {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var recovered []Recovery
+	for _, result := range results {
+		key := outageKey{domain: domain, endpoint: result.Endpoint}
+		current, ok := o.endpoints[key]
+		if result.Status != store.ResultSuccess {
+			if !ok {
+				current = &outage{since: now}
+				o.endpoints[key] = current
+			}
+			current.failures++
+			continue
+		}
+		if !ok {
+			continue
+		}
+		delete(o.endpoints, key)
+		if current.failures >= unhealthyAfter {
+			recovered = append(recovered, Recovery{
+				Domain:    domain,
+				Endpoint:  result.Endpoint,
+				Since:     current.since,
+				Recovered: now,
+				Failures:  current.failures,
+			})
+		}
+	}
+	return recovered
+}
+
+// SetRecoveryHandler sets what is done when an endpoint delivers again after an outage
+// (with recovery_replay enabled). It is called while forwarding, so it must not block.
+// Must be called before events are forwarded.
+func (f *Forwarder) SetRecoveryHandler(handler func(Recovery)) {
+	f.onRecovery = handler
+}
@@ -0,0 +1,130 @@
+package forwarder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// redisPool keeps one pooled client per Redis server and credential set, shared
+// by every route that writes to that server
+type redisPool struct {
+	clients map[string]*redis.Client
+	mu      sync.Mutex
+
+	// Rejects server addresses that must not be connected to (SSRF protection); nil allows all
+	checkIP func(ip net.IP) error
+}
+
+func newRedisPool() *redisPool {
+	return &redisPool{
+		clients: make(map[string]*redis.Client),
+	}
+}
+
+// xadd appends the event to the sink's stream, trimming it to about maxlen entries
+func (p *redisPool) xadd(ctx context.Context, sink *config.RedisSink, payload []byte, meta eventMeta) error {
+	client, err := p.client(sink)
+	if err != nil {
+		return err
+	}
+
+	stream, err := meta.expand(sink.Stream, nil)
+	if err != nil {
+		return err
+	}
+	args := &redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]interface{}{
+			"event":   payload,
+			"domain":  meta.Domain,
+			"call_id": meta.CallID,
+		},
+	}
+	if sink.MaxLen > 0 {
+		args.MaxLen = sink.MaxLen
+		args.Approx = true
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, mqttTimeout)
+	defer cancel()
+
+	if err := client.XAdd(sendCtx, args).Err(); err != nil {
+		logger.Logger.Warn("Redis XADD failed",
+			zap.String("call_id", meta.CallID),
+			zap.String("hub_event_id", meta.EventID),
+			zap.String("domain", meta.Domain),
+			zap.String("address", sink.Address),
+			zap.String("stream", stream),
+			zap.Error(err),
+		)
+		return fmt.Errorf("redis xadd to %s failed: %w", stream, err)
+	}
+	return nil
+}
+
+// client returns the pooled client for the sink's server
+func (p *redisPool) client(sink *config.RedisSink) (*redis.Client, error) {
+	key := redisClientKey(sink)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if client, ok := p.clients[key]; ok {
+		return client, nil
+	}
+
+	opts := &redis.Options{
+		Addr:         sink.Address,
+		Username:     sink.Username,
+		Password:     sink.Password,
+		DB:           sink.DB,
+		DialTimeout:  mqttTimeout,
+		ReadTimeout:  mqttTimeout,
+		WriteTimeout: mqttTimeout,
+		Dialer: (&net.Dialer{
+			Timeout: mqttTimeout,
+			Control: controlDial(p.checkIP, "redis server"),
+		}).DialContext,
+	}
+	if sink.TLS != nil {
+		tlsConfig, err := buildTLSConfig(sink.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	client := redis.NewClient(opts)
+	p.clients[key] = client
+	return client, nil
+}
+
+// close closes all clients
+func (p *redisPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, client := range p.clients {
+		_ = client.Close()
+		delete(p.clients, key)
+	}
+}
+
+// redisClientKey identifies the connection settings of a sink (streams share a client)
+func redisClientKey(sink *config.RedisSink) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s", sink.Address, sink.DB, sink.Username, sink.Password)
+	if sink.TLS != nil {
+		fmt.Fprintf(h, "\x00%+v", *sink.TLS)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,142 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/store"
+)
+
+// Error classes of failed deliveries, shared by all sink types
+const (
+	errorClassTimeout     = "timeout"      // No answer in time
+	errorClassConnection  = "connection"   // DNS, connect or transport failure
+	errorClassThrottled   = "throttled"    // 429, or 503 with Retry-After
+	errorClassServerError = "server_error" // 5xx
+	errorClassClientError = "client_error" // 4xx other than 408/429; retrying will not help
+	errorClassRejected    = "rejected"     // 2xx whose body fails the route's success criteria
+	errorClassBlocked     = "blocked"      // Address refused by endpoint_security
+	errorClassPayload     = "payload"      // The event could not be encoded for the sink, or a template failed
+	errorClassSink        = "sink_error"   // Any other error reported by the sink
+)
+
+// errTimedOut is wrapped by sink errors for operations that did not complete in time
+var errTimedOut = errors.New("timed out")
+
+// templateError is returned when a URL, header or sink template cannot be rendered for an event
+type templateError struct {
+	err error
+}
+
+func (e *templateError) Error() string {
+	return e.err.Error()
+}
+
+func (e *templateError) Unwrap() error {
+	return e.err
+}
+
+// statusError is returned for non-2xx responses of HTTP-based sinks
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("non-2xx response: %d", e.code)
+}
+
+// rejectedError is returned for 2xx responses that fail the route's success criteria
+type rejectedError struct {
+	code   int
+	reason string
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("response %d rejected: %s", e.code, e.reason)
+}
+
+// deliveryResult builds the result of one endpoint delivery from its error (nil on success)
+func deliveryResult(endpoint config.Endpoint, err error, latency time.Duration) store.DeliveryResult {
+	sinkType := endpoint.Type
+	if sinkType == "" {
+		sinkType = config.EndpointHTTP
+	}
+	result := store.DeliveryResult{
+		Endpoint:  endpoint.Name(),
+		SinkType:  sinkType,
+		Status:    store.ResultSuccess,
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+	}
+	if err == nil {
+		return result
+	}
+
+	result.Status = store.ResultFailed
+	result.Error = err.Error()
+	result.ErrorClass, result.Retryable = classifyError(err)
+
+	var se *statusError
+	var re *rejectedError
+	if errors.As(err, &se) {
+		result.StatusCode = se.code
+	} else if errors.As(err, &re) {
+		result.StatusCode = re.code
+	}
+	return result
+}
+
+// classifyError returns the error class of a failed delivery and whether a redelivery may succeed
+func classifyError(err error) (string, bool) {
+	var se *statusError
+	var ra *RetryAfterError
+	var te *templateError
+	var re *rejectedError
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, config.ErrBlockedNetwork):
+		return errorClassBlocked, false
+	case errors.As(err, &te):
+		return errorClassPayload, false
+	case errors.As(err, &re):
+		// The backend may accept the event once it recovers, like a 5xx
+		return errorClassRejected, true
+	case errors.As(err, &se):
+		switch {
+		case se.code == http.StatusTooManyRequests:
+			return errorClassThrottled, true
+		case se.code == http.StatusRequestTimeout:
+			return errorClassTimeout, true
+		case se.code >= 500:
+			if errors.As(err, &ra) {
+				return errorClassThrottled, true
+			}
+			return errorClassServerError, true
+		case se.code >= 400:
+			return errorClassClientError, false
+		}
+		return errorClassSink, true
+	case errors.As(err, &ra):
+		// Endpoint still paused by an earlier Retry-After
+		return errorClassThrottled, true
+	case errors.Is(err, errTimedOut), errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return errorClassTimeout, true
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return errorClassTimeout, true
+		}
+		return errorClassConnection, true
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return errorClassPayload, false
+	}
+	return errorClassSink, true
+}
@@ -0,0 +1,219 @@
+package forwarder
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// ErrSigningNotConfigured is returned by RotateSigningSecret for a route without signing
+var ErrSigningNotConfigured = errors.New("route has no signing configured")
+
+// signingSecretBytes is the size of the secrets generated by a rotation
+const signingSecretBytes = 32
+
+// SigningKeys are the secrets a domain's deliveries are signed with after a rotation via the
+// API. They take precedence over signing.secret of the configuration file.
+type SigningKeys struct {
+	Current       string    `json:"current"`
+	Previous      string    `json:"previous,omitempty"`       // Rotated-out secret, still signing during the overlap
+	PreviousUntil time.Time `json:"previous_until,omitempty"` // When Previous is retired
+}
+
+// SigningRotation is the outcome of a secret rotation
+type SigningRotation struct {
+	Domain        string    `json:"domain"`
+	Secret        string    `json:"secret"`                   // New secret, only ever returned here
+	Header        string    `json:"header"`                   // Request header of the signatures
+	PreviousUntil time.Time `json:"previous_until,omitempty"` // Deliveries are dual-signed until then (zero = no previous secret)
+}
+
+// signingSecrets are the rotated secrets, by domain. They are saved to a file so they survive
+// config reloads and restarts.
+type signingSecrets struct {
+	mu       sync.Mutex
+	path     string // Empty = not persisted
+	byDomain map[string]SigningKeys
+}
+
+// newSigningSecrets creates an empty set of rotated secrets
+func newSigningSecrets() *signingSecrets {
+	return &signingSecrets{byDomain: make(map[string]SigningKeys)}
+}
+
+// keys returns the secrets deliveries of domain are signed with at now, newest first; a
+// previous secret whose overlap ended is retired (and the change saved)
+func (s *signingSecrets) keys(domain, configured string, now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.byDomain[domain]
+	if !ok {
+		if configured == "" {
+			return nil
+		}
+		return []string{configured}
+	}
+	if k.Previous == "" {
+		return []string{k.Current}
+	}
+	if now.Before(k.PreviousUntil) {
+		return []string{k.Current, k.Previous}
+	}
+
+	retired := k
+	k.Previous, k.PreviousUntil = "", time.Time{}
+	s.byDomain[domain] = k
+	if err := s.save(); err != nil {
+		logger.Logger.Warn("Failed to save signing secrets", zap.Error(err))
+	}
+	logger.LogWithDomain(zapcore.WarnLevel, "Previous signing secret retired",
+		zap.String("domain", domain),
+		zap.Time("overlap_ended", retired.PreviousUntil),
+	)
+	return []string{k.Current}
+}
+
+// save writes the secrets to the file atomically, readable by the owner only; the caller holds s.mu
+func (s *signingSecrets) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.byDomain, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// LoadSigningSecrets reads the signing secrets rotated via the API and saved at path (if the
+// file exists), and saves later rotations there
+func (f *Forwarder) LoadSigningSecrets(path string) error {
+	f.secrets.mu.Lock()
+	defer f.secrets.mu.Unlock()
+	f.secrets.path = path
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &f.secrets.byDomain)
+		if f.secrets.byDomain == nil {
+			f.secrets.byDomain = make(map[string]SigningKeys)
+		}
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load signing secrets from %s: %w", path, err)
+	}
+	return nil
+}
+
+// RotateSigningSecret generates a new signing secret for a domain's route and saves it.
+// Until the overlap ends, deliveries are signed with both the new and the previous secret;
+// nil uses the route's overlap_seconds, 0 retires the previous secret at once. A rotation
+// during the overlap of the previous one retires the oldest secret at once.
+func (f *Forwarder) RotateSigningSecret(domain string, overlap *time.Duration) (SigningRotation, error) {
+	f.mu.RLock()
+	var signing *config.SigningConfig
+	route := f.config.GetRoute(domain)
+	if route != nil {
+		signing = route.Signing
+	}
+	f.mu.RUnlock()
+	if route == nil {
+		return SigningRotation{}, ErrRouteNotFound
+	}
+	if signing == nil {
+		return SigningRotation{}, ErrSigningNotConfigured
+	}
+	window := signing.Overlap()
+	if overlap != nil {
+		window = *overlap
+	}
+
+	raw := make([]byte, signingSecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return SigningRotation{}, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	rotation := SigningRotation{Domain: domain, Secret: hex.EncodeToString(raw), Header: signing.HeaderName()}
+
+	f.secrets.mu.Lock()
+	defer f.secrets.mu.Unlock()
+	previous, rotated := f.secrets.byDomain[domain]
+	updated := SigningKeys{Current: rotation.Secret, Previous: signing.Secret}
+	if rotated {
+		updated.Previous = previous.Current
+	}
+	if updated.Previous != "" && window > 0 {
+		rotation.PreviousUntil = f.clock.Now().Add(window).UTC()
+		updated.PreviousUntil = rotation.PreviousUntil
+	} else {
+		updated.Previous = ""
+	}
+	f.secrets.byDomain[domain] = updated
+	if err := f.secrets.save(); err != nil {
+		if rotated {
+			f.secrets.byDomain[domain] = previous
+		} else {
+			delete(f.secrets.byDomain, domain)
+		}
+		return SigningRotation{}, fmt.Errorf("failed to save signing secrets: %w", err)
+	}
+	return rotation, nil
+}
+
+// signature returns the signature header value of a body sent at now: the timestamp and one
+// HMAC-SHA256 of "<timestamp>.<body>" per secret, e.g. t=1700000000,v1=<hex>,v1=<hex>
+func signature(secrets []string, body []byte, now time.Time) string {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	var sb strings.Builder
+	sb.WriteString("t=" + timestamp)
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		sb.WriteString(",v1=" + hex.EncodeToString(mac.Sum(nil)))
+	}
+	return sb.String()
+}
+
+// sign sets the route's signature header on a delivery whose body is encoded
+func (f *Forwarder) sign(d *delivery, domain string, signing *config.SigningConfig) {
+	now := f.clock.Now()
+	secrets := f.secrets.keys(domain, signing.Secret, now)
+	if len(secrets) == 0 {
+		return
+	}
+	if d.headers == nil {
+		d.headers = make(http.Header)
+	}
+	d.headers.Set(signing.HeaderName(), signature(secrets, d.body, now))
+}
@@ -0,0 +1,141 @@
+package forwarder
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// sftpTimeout bounds connecting to the SFTP server
+const sftpTimeout = 10 * time.Second
+
+// uploadCompleted uploads the sink directory's finalized files over SFTP. Each file is
+// written under a temporary name and renamed when complete, so the receiving import job
+// never sees partial files; an existing remote file is never overwritten.
+func (m *fileSinks) uploadCompleted(sink config.FileSink) error {
+	files, err := completedFiles(sink.Directory)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	conn, err := m.dialSFTP(sink.SFTP)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("failed to start sftp session: %w", err)
+	}
+	defer client.Close()
+
+	for _, local := range files {
+		remote, err := uploadFile(client, local, sink.SFTP.RemoteDirectory)
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", local, err)
+		}
+		if err := finishUpload(sink, local); err != nil {
+			logger.Logger.Warn("Failed to clean up uploaded file", zap.String("file", local), zap.Error(err))
+		}
+		logger.Logger.Info("Uploaded event file",
+			zap.String("file", local),
+			zap.String("sftp", sink.SFTP.Address),
+			zap.String("remote_path", remote),
+		)
+	}
+	return nil
+}
+
+// uploadFile copies one local file into remoteDir and returns its remote path
+func uploadFile(client *sftp.Client, local, remoteDir string) (string, error) {
+	src, err := os.Open(local)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	remote := uniquePath(path.Join(remoteDir, filepath.Base(local)), func(p string) bool {
+		_, err := client.Stat(p)
+		return err == nil
+	})
+	partial := remote + ".part"
+
+	dst, err := client.Create(partial)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		_ = client.Remove(partial)
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		_ = client.Remove(partial)
+		return "", err
+	}
+	if err := client.Rename(partial, remote); err != nil {
+		return "", err
+	}
+	return remote, nil
+}
+
+// dialSFTP opens an SSH connection to the target
+func (m *fileSinks) dialSFTP(target *config.SFTPTarget) (*ssh.Client, error) {
+	var auth []ssh.AuthMethod
+	if target.PrivateKeyFile != "" {
+		keyPEM, err := os.ReadFile(target.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private_key_file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private_key_file: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if target.Password != "" {
+		auth = append(auth, ssh.Password(target.Password))
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if target.HostKey != "" {
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(target.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid sftp host_key: %w", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(hostKey)
+	}
+
+	dialer := &net.Dialer{
+		Timeout: sftpTimeout,
+		Control: controlDial(m.checkIP, "sftp server"),
+	}
+	conn, err := dialer.Dial("tcp", target.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, target.Address, &ssh.ClientConfig{
+		User:            target.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sftpTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s failed: %w", target.Address, err)
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
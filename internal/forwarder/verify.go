@@ -0,0 +1,296 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/event"
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+	"calleventhub/internal/store"
+)
+
+// Outcomes of an endpoint verification case
+const (
+	VerifyPass = "pass"
+	VerifyFail = "fail"
+	VerifySkip = "skip" // Does not apply to the route
+)
+
+// verifyLargePayloadBytes is the size of the large-payload case when the route sets no
+// max_request_bytes
+const verifyLargePayloadBytes = 256 * 1024
+
+// VerifyCase is the outcome of one synthetic delivery of an endpoint verification
+type VerifyCase struct {
+	Name       string  `json:"name"`
+	Expect     string  `json:"expect"` // What a correct backend does
+	Status     string  `json:"status"` // VerifyPass, VerifyFail or VerifySkip
+	Detail     string  `json:"detail,omitempty"`
+	StatusCode int     `json:"status_code,omitempty"`
+	LatencyMs  float64 `json:"latency_ms,omitempty"`
+}
+
+// VerifyReport is the outcome of an endpoint verification
+type VerifyReport struct {
+	Domain   string       `json:"domain"`
+	Endpoint string       `json:"endpoint"`
+	CallID   string       `json:"call_id"` // Of the synthetic events, to find them in the backend's logs
+	Cases    []VerifyCase `json:"cases"`
+	Passed   int          `json:"passed"`
+	Failed   int          `json:"failed"`
+	Skipped  int          `json:"skipped"`
+}
+
+// add appends the outcome of a case
+func (r *VerifyReport) add(c VerifyCase) {
+	r.Cases = append(r.Cases, c)
+	switch c.Status {
+	case VerifyPass:
+		r.Passed++
+	case VerifyFail:
+		r.Failed++
+	default:
+		r.Skipped++
+	}
+}
+
+// String formats the report for a terminal, one case per line
+func (r *VerifyReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Endpoint %s (route %s), call_id %s\n", r.Endpoint, r.Domain, r.CallID)
+	for _, c := range r.Cases {
+		fmt.Fprintf(&sb, "%-4s  %-15s  %s\n", strings.ToUpper(c.Status), c.Name, c.Expect)
+		if c.Detail != "" {
+			fmt.Fprintf(&sb, "      -> %s\n", c.Detail)
+		}
+	}
+	fmt.Fprintf(&sb, "%d cases: %d passed, %d failed, %d skipped\n", len(r.Cases), r.Passed, r.Failed, r.Skipped)
+	return sb.String()
+}
+
+// verifyTarget is the endpoint under verification and the route settings it is sent with
+type verifyTarget struct {
+	endpoint         config.Endpoint
+	domain           string
+	headers          map[string]string
+	transforms       map[string]string
+	renameFields     config.RenameFields
+	dropFields       []string
+	encoding         *config.EncodingConfig
+	success          *config.SuccessConfig
+	signing          *config.SigningConfig
+	timeoutMs        int
+	maxRequestBytes  int64
+	maxResponseBytes int64
+}
+
+// VerifyEndpoint sends synthetic events to an HTTP endpoint and reports which the backend
+// handled correctly: each call lifecycle state, a duplicate delivery, an event without the
+// route's credential headers, and a large payload. Events are sent like real forwards
+// (route transforms, headers, encoding and success criteria) with "verification": true,
+// but are not stored, logged per domain or published as receipts.
+//
+// endpoint is the name of one of the route's endpoints, or the URL of a backend not
+// configured yet, which is then sent the settings of domain's route. domain may be empty
+// if endpoint is configured in a route.
+func (f *Forwarder) VerifyEndpoint(ctx context.Context, domain, endpoint string) (*VerifyReport, error) {
+	target, err := f.verifyTarget(domain, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	callID := "verify-" + NewEventID()[:8]
+	report := &VerifyReport{Domain: target.domain, Endpoint: endpoint, CallID: callID}
+	newEvent := func(callID, state, status string) *event.Event {
+		e := &event.Event{
+			CallID:      callID,
+			Domain:      target.domain,
+			Direction:   "inbound",
+			FromNumber:  "0900000001",
+			ToNumber:    "0900000002",
+			Hotline:     "0900000000",
+			State:       state,
+			Status:      status,
+			TimeStarted: time.Now().Format("2006-01-02 15:04:05"),
+			HubEventID:  NewEventID(),
+		}
+		e.Set("verification", true)
+		return e
+	}
+
+	// Every state of an answered call, then a missed call
+	var last *event.Event
+	for _, step := range []struct{ callID, state, status string }{
+		{callID, "ringing", "ringing"},
+		{callID, "answered", "answered"},
+		{callID, "hangup", "normal-clearing"},
+		{callID + "-missed", "missed", "busy-line"},
+	} {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		e := newEvent(step.callID, step.state, step.status)
+		if step.state == "hangup" {
+			last = e
+		}
+		result, err := f.verifySend(ctx, target, e, 1, true)
+		report.add(expectAccepted("state_"+step.state, fmt.Sprintf("accepts an event with state %q", step.state), result, err))
+	}
+
+	// JetStream delivers at least once: a redelivery must be acknowledged, not refused
+	result, err := f.verifySend(ctx, target, last, 2, true)
+	c := expectAccepted("duplicate", "accepts the hangup event again (same hub_event_id, delivery_attempt 2)", result, err)
+	if c.Status == VerifyFail {
+		c.Detail += "; deliveries are at-least-once, so deduplicate by hub_event_id and answer 2xx"
+	}
+	report.add(c)
+
+	// Credentials the route sends in headers (and its signature) must be required by the backend
+	c = VerifyCase{Name: "signed_payload"}
+	if len(target.headers) == 0 && target.signing == nil {
+		c.Expect = "rejects events without the route's credential headers"
+		c.Status, c.Detail = VerifySkip, "the route sends no headers"
+	} else {
+		names := make([]string, 0, len(target.headers)+1)
+		for name := range target.headers {
+			names = append(names, name)
+		}
+		if target.signing != nil {
+			names = append(names, target.signing.HeaderName())
+		}
+		sort.Strings(names)
+		c.Expect = fmt.Sprintf("rejects an event sent without the route's headers (%s)", strings.Join(names, ", "))
+		result, err := f.verifySend(ctx, target, newEvent(callID, "ringing", "ringing"), 1, false)
+		c.StatusCode, c.LatencyMs = result.StatusCode, result.LatencyMs
+		var se *statusError
+		switch {
+		case err == nil:
+			c.Status, c.Detail = VerifyFail, "the event was accepted without credentials"
+		case errors.As(err, &se) && se.code >= 400 && se.code < 500:
+			c.Status = VerifyPass
+		default:
+			c.Status, c.Detail = VerifyFail, fmt.Sprintf("expected a 4xx response: %v", err)
+		}
+	}
+	report.add(c)
+
+	// Large payload, as sent by PBXs with long custom fields
+	size := verifyLargePayloadBytes
+	if target.maxRequestBytes > 0 && target.maxRequestBytes*9/10 < int64(size) {
+		size = int(target.maxRequestBytes * 9 / 10) // Room for the fields added when forwarding
+	}
+	large := newEvent(callID, "hangup", "normal-clearing")
+	large.Set("verification_padding", strings.Repeat("x", size))
+	result, err = f.verifySend(ctx, target, large, 1, true)
+	report.add(expectAccepted("large_payload", fmt.Sprintf("accepts a %d KiB event", size/1024), result, err))
+
+	logger.Logger.Info("Endpoint verification completed",
+		zap.String("domain", report.Domain),
+		zap.String("endpoint", endpoint),
+		zap.String("call_id", callID),
+		zap.Int("passed", report.Passed),
+		zap.Int("failed", report.Failed),
+		zap.Int("skipped", report.Skipped),
+	)
+	return report, nil
+}
+
+// verifyTarget resolves the endpoint to verify and the settings of its route
+func (f *Forwarder) verifyTarget(domain, endpoint string) (*verifyTarget, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var route *config.Route
+	if domain != "" {
+		if route = f.config.GetRoute(domain); route == nil {
+			return nil, fmt.Errorf("no route for domain %s", domain)
+		}
+	} else {
+		for i := range f.config.Routes {
+			for _, e := range f.config.Routes[i].AllEndpoints() {
+				if e.Name() == endpoint {
+					route = &f.config.Routes[i]
+				}
+			}
+		}
+		if route == nil {
+			return nil, fmt.Errorf("endpoint %s is not configured; give the domain whose route settings apply", endpoint)
+		}
+	}
+
+	target := &verifyTarget{
+		endpoint:         config.Endpoint{Type: config.EndpointHTTP, URL: endpoint},
+		domain:           route.Domain,
+		headers:          route.Headers,
+		transforms:       route.Transform,
+		renameFields:     route.RenameFields,
+		dropFields:       route.DropFields,
+		encoding:         route.Encoding,
+		success:          route.Success,
+		signing:          route.Signing,
+		timeoutMs:        route.TimeoutMs,
+		maxRequestBytes:  route.MaxRequestBytes,
+		maxResponseBytes: defaultMaxResponseBytes,
+	}
+	if route.MaxResponseBytes > 0 {
+		target.maxResponseBytes = route.MaxResponseBytes
+	}
+	for _, e := range route.AllEndpoints() {
+		if e.Name() == endpoint {
+			target.endpoint = e
+		}
+	}
+	if target.endpoint.Type != "" && target.endpoint.Type != config.EndpointHTTP {
+		return nil, fmt.Errorf("endpoint %s is a %s sink; only HTTP endpoints can be verified", endpoint, target.endpoint.Type)
+	}
+	if !strings.HasPrefix(target.endpoint.URL, "http://") && !strings.HasPrefix(target.endpoint.URL, "https://") {
+		return nil, fmt.Errorf("endpoint %s is not an http(s) URL", endpoint)
+	}
+	return target, nil
+}
+
+// verifySend forwards one synthetic event to the target, with or without the route's headers
+func (f *Forwarder) verifySend(ctx context.Context, target *verifyTarget, ev *event.Event, deliveryAttempt int, withHeaders bool) (store.DeliveryResult, error) {
+	meta := eventMeta{CallID: ev.CallID, EventID: ev.HubEventID, Domain: target.domain, State: ev.State, Status: ev.Status, Direction: ev.Direction, Event: ev}
+
+	start := time.Now()
+	err := func() error {
+		payload, err := f.enrichPayload(ev, deliveryAttempt, target.transforms, target.renameFields, target.dropFields, meta)
+		if err != nil {
+			return err
+		}
+		d := &delivery{payload: payload, maxResponseBytes: target.maxResponseBytes, success: target.success, timeoutMs: target.timeoutMs}
+		if withHeaders {
+			if d.headers, err = meta.expandHeaders(target.headers); err != nil {
+				return err
+			}
+		}
+		if d.body, d.contentType, err = encodeBody(target.encoding, payload, meta); err != nil {
+			return err
+		}
+		if target.maxRequestBytes > 0 && int64(len(d.body)) > target.maxRequestBytes {
+			return fmt.Errorf("encoded body of %d bytes exceeds max_request_bytes (%d)", len(d.body), target.maxRequestBytes)
+		}
+		if withHeaders && target.signing != nil {
+			f.sign(d, target.domain, target.signing)
+		}
+		return f.forwardToEndpoint(ctx, target.endpoint, d, meta)
+	}()
+	return deliveryResult(target.endpoint, err, time.Since(start)), err
+}
+
+// expectAccepted is the outcome of a case the backend should accept
+func expectAccepted(name, expect string, result store.DeliveryResult, err error) VerifyCase {
+	c := VerifyCase{Name: name, Expect: expect, Status: VerifyPass, StatusCode: result.StatusCode, LatencyMs: result.LatencyMs}
+	if err != nil {
+		c.Status, c.Detail = VerifyFail, err.Error()
+	}
+	return c
+}
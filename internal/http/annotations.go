@@ -0,0 +1,197 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+	"calleventhub/internal/store"
+)
+
+// annotationRequest is the body of POST /api/annotations and PUT /api/annotations/{id}
+type annotationRequest struct {
+	Start       *time.Time `json:"start,omitempty"` // Default now
+	End         *time.Time `json:"end,omitempty"`   // Omit while ongoing
+	Domains     []string   `json:"domains,omitempty"`
+	Description string     `json:"description"`
+}
+
+// annotation validates the request and returns the annotation it describes
+func (req *annotationRequest) annotation() (store.Annotation, error) {
+	a := store.Annotation{
+		Start:       time.Now(),
+		End:         req.End,
+		Domains:     req.Domains,
+		Description: strings.TrimSpace(req.Description),
+	}
+	if req.Start != nil {
+		a.Start = *req.Start
+	}
+	if a.Description == "" {
+		return a, fmt.Errorf("description is required")
+	}
+	if a.End != nil && a.End.Before(a.Start) {
+		return a, fmt.Errorf("end must not be before start")
+	}
+	for _, domain := range a.Domains {
+		if domain == "" {
+			return a, fmt.Errorf("domains must not be empty")
+		}
+	}
+	return a, nil
+}
+
+// HandleAnnotations handles /api/annotations - GET lists operator notes about incidents
+// (?since=, ?until= and ?domain= narrow the list), POST records one (admin only).
+// In isolation mode or with API auth a scoped token only sees notes about all domains or its own.
+func (h *Handler) HandleAnnotations(w http.ResponseWriter, r *http.Request) {
+	if h.store == nil {
+		http.Error(w, "Event store not available", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		scope, ok := h.authorize(w, r)
+		if !ok {
+			return
+		}
+		domain := r.URL.Query().Get("domain")
+		if domain != "" && !scope.allows(domain) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		since, until, err := parseTimeWindow(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		annotations := h.store.GetAnnotations(since, until, func(d string) bool {
+			return scope.allows(d) && (domain == "" || d == domain)
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"annotations": annotations,
+			"count":       len(annotations),
+		})
+
+	case http.MethodPost:
+		if !h.requireAdmin(w, r) {
+			return
+		}
+		var req annotationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		a, err := req.annotation()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		a = h.store.AddAnnotation(a)
+		logger.Logger.Info("Annotation recorded by operator",
+			zap.Uint64("id", a.ID),
+			zap.Strings("domains", a.Domains),
+			zap.String("description", a.Description),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(a)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleAnnotation handles /api/annotations/{id} - GET returns one note, PUT replaces it
+// (e.g. to set its end once the incident is over) and DELETE removes it (admin only)
+func (h *Handler) HandleAnnotation(w http.ResponseWriter, r *http.Request) {
+	if h.store == nil {
+		http.Error(w, "Event store not available", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/api/annotations/"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		scope, ok := h.authorize(w, r)
+		if !ok {
+			return
+		}
+		a, found := h.store.GetAnnotation(id)
+		if found {
+			a, found = a.Visible(scope.allows)
+		}
+		if !found {
+			http.Error(w, "Annotation not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(a)
+
+	case http.MethodPut:
+		if !h.requireAdmin(w, r) {
+			return
+		}
+		var req annotationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		a, err := req.annotation()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a, found := h.store.UpdateAnnotation(id, a)
+		if !found {
+			http.Error(w, "Annotation not found", http.StatusNotFound)
+			return
+		}
+		logger.Logger.Info("Annotation updated by operator",
+			zap.Uint64("id", a.ID),
+			zap.Strings("domains", a.Domains),
+			zap.String("description", a.Description),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(a)
+
+	case http.MethodDelete:
+		if !h.requireAdmin(w, r) {
+			return
+		}
+		if !h.store.DeleteAnnotation(id) {
+			http.Error(w, "Annotation not found", http.StatusNotFound)
+			return
+		}
+		logger.Logger.Info("Annotation deleted by operator",
+			zap.Uint64("id", id),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+	"calleventhub/internal/sla"
+)
+
+// deliveryReportTimeout bounds reading the counts of all instances from the KV bucket
+const deliveryReportTimeout = 10 * time.Second
+
+// SetDeliveryCounters sets the persistent counters ingested events are counted in and the
+// delivery report is built from
+func (h *Handler) SetDeliveryCounters(c *sla.Counters) {
+	h.counters = c
+}
+
+// HandleGetDeliveryReport handles GET /api/reports/delivery?month=2006-01&domain=...&format=csv -
+// the events accepted, delivered and dead-lettered per domain and day of a month, over all
+// instances. Without month, the current month so far.
+func (h *Handler) HandleGetDeliveryReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.counters == nil {
+		http.Error(w, "Delivery report not enabled (nats.delivery_report)", http.StatusNotFound)
+		return
+	}
+
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	domain := query.Get("domain")
+	if domain != "" && !scope.allows(domain) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	month := query.Get("month")
+	if month == "" {
+		month = now.Format("2006-01")
+	}
+	if _, err := time.ParseInLocation("2006-01", month, now.Location()); err != nil {
+		http.Error(w, "month must be YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	if month > now.Format("2006-01") {
+		http.Error(w, "month must not be in the future", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), deliveryReportTimeout)
+	defer cancel()
+	report, err := sla.Build(ctx, h.counters, month, func(d string) bool {
+		return scope.allows(d) && (domain == "" || d == domain)
+	}, now)
+	if err != nil {
+		logger.Logger.Error("Failed to build delivery report", zap.String("month", month), zap.Error(err))
+		http.Error(w, "Failed to read delivery counters", http.StatusServiceUnavailable)
+		return
+	}
+
+	if format == "csv" {
+		filename := "delivery-" + month + ".csv"
+		if domain != "" {
+			filename = "delivery-" + domain + "-" + month + ".csv"
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+		w.Write(report.CSV())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
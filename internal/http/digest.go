@@ -0,0 +1,62 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"calleventhub/internal/report"
+	"calleventhub/internal/store"
+)
+
+// HandleGetDigest handles GET /api/digest?domain=...&day=2006-01-02 - the per-domain
+// summary published to NATS at the end of each day. Without day, today's digest so far.
+func (h *Handler) HandleGetDigest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.store == nil {
+		http.Error(w, "Event store not available", http.StatusInternalServerError)
+		return
+	}
+
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	domain := r.URL.Query().Get("domain")
+	if domain != "" && !scope.allows(domain) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	day := r.URL.Query().Get("day")
+	if day == "" {
+		day = now.Format("2006-01-02")
+	}
+	if _, err := time.ParseInLocation("2006-01-02", day, now.Location()); err != nil {
+		http.Error(w, "day must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	oldest := now.AddDate(0, 0, 1-store.DigestDays).Format("2006-01-02")
+	if day < oldest || day > now.Format("2006-01-02") {
+		http.Error(w, fmt.Sprintf("day must be within the last %d days (from %s)", store.DigestDays, oldest), http.StatusBadRequest)
+		return
+	}
+
+	digests := report.Digests(h.store, h.currentConfig(), day, func(d string) bool {
+		return scope.allows(d) && (domain == "" || d == domain)
+	}, now)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"day":     day,
+		"digests": digests,
+	})
+}
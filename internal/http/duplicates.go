@@ -0,0 +1,95 @@
+package http
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// PossibleDuplicateField is set on ingested events whose call_id and state were already
+// received within the duplicate window
+const PossibleDuplicateField = "possible_pbx_duplicate"
+
+// duplicateKey identifies an event of a call for duplicate detection
+type duplicateKey struct {
+	domain string
+	callID string
+	state  string
+}
+
+// duplicateSeen is when a call_id and state was first received in the current window
+type duplicateSeen struct {
+	first time.Time
+	count int // Times received, including the first
+}
+
+// duplicateDetector remembers recently ingested call_id+state pairs and counts repeats
+// per domain. The counts are never reset, so they can be exported as counters.
+type duplicateDetector struct {
+	mu        sync.Mutex
+	seen      map[duplicateKey]duplicateSeen
+	counts    map[string]int64 // domain -> possible duplicates since startup
+	lastSweep time.Time
+}
+
+// newDuplicateDetector creates an empty detector
+func newDuplicateDetector() *duplicateDetector {
+	return &duplicateDetector{
+		seen:   make(map[duplicateKey]duplicateSeen),
+		counts: make(map[string]int64),
+	}
+}
+
+// observe records an ingested event. For a repeat within window it returns the time
+// since the first one and how many times the event has now been received.
+func (d *duplicateDetector) observe(domain, callID, state string, window time.Duration) (bool, time.Duration, int) {
+	if callID == "" || state == "" {
+		return false, 0, 0
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Forget expired pairs once per window so the map stays bounded by the ingest rate
+	if now.Sub(d.lastSweep) > window {
+		for key, seen := range d.seen {
+			if now.Sub(seen.first) > window {
+				delete(d.seen, key)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	key := duplicateKey{domain: domain, callID: callID, state: state}
+	seen, ok := d.seen[key]
+	if !ok || now.Sub(seen.first) > window {
+		d.seen[key] = duplicateSeen{first: now, count: 1}
+		return false, 0, 1
+	}
+	seen.count++
+	d.seen[key] = seen
+	d.counts[domain]++
+	return true, now.Sub(seen.first), seen.count
+}
+
+// DuplicateCount is the number of possible PBX duplicates ingested for a domain
+type DuplicateCount struct {
+	Domain string `json:"domain"`
+	Count  int64  `json:"count"`
+}
+
+// snapshot returns the counts of the domains accepted by include, ordered by domain
+func (d *duplicateDetector) snapshot(include func(domain string) bool) []DuplicateCount {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counts := make([]DuplicateCount, 0, len(d.counts))
+	for domain, count := range d.counts {
+		if include(domain) {
+			counts = append(counts, DuplicateCount{Domain: domain, Count: count})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Domain < counts[j].Domain })
+	return counts
+}
@@ -0,0 +1,187 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/forwarder"
+	"calleventhub/internal/logger"
+)
+
+// endpointPatchRequest is the body of PATCH /api/config/routes/{domain}/endpoints
+type endpointPatchRequest struct {
+	Endpoint string `json:"endpoint"`          // Endpoint name as listed by /api/config
+	Enabled  *bool  `json:"enabled,omitempty"` // false = out of rotation
+	Weight   *int   `json:"weight,omitempty"`  // Percentage of the calls it receives (0 or 100 = all)
+	Reset    bool   `json:"reset,omitempty"`   // Drop the override, back to the config file
+	Reason   string `json:"reason,omitempty"`  // Recorded in the audit log
+}
+
+// endpointVerifyRequest is the body of POST /api/endpoints/verify
+type endpointVerifyRequest struct {
+	Endpoint string `json:"endpoint"`         // Endpoint name, or the URL of a backend not configured yet
+	Domain   string `json:"domain,omitempty"` // Route whose settings apply (required for unconfigured URLs)
+}
+
+// endpointStatus is the rotation state of one endpoint of a route
+type endpointStatus struct {
+	Endpoint string `json:"endpoint"`
+	Enabled  bool   `json:"enabled"`
+	Weight   int    `json:"weight"`
+}
+
+// HandleRouteEndpoints handles PATCH /api/config/routes/{domain}/endpoints - takes one
+// endpoint of a route out of rotation, puts it back or changes its weight without
+// editing the config file. Changes are saved and survive reloads and restarts.
+// POST /api/config/routes/{domain}/secrets/rotate is handled by handleRotateSecret, and
+// PUT and DELETE /api/config/routes/{domain} by handleRoute.
+func (h *Handler) HandleRouteEndpoints(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/config/routes/")
+	if domain, ok := strings.CutSuffix(rest, "/secrets/rotate"); ok && domain != "" && !strings.Contains(domain, "/") {
+		h.handleRotateSecret(w, r, domain)
+		return
+	}
+	if rest != "" && !strings.Contains(rest, "/") {
+		h.handleRoute(w, r, rest)
+		return
+	}
+	domain, ok := strings.CutSuffix(rest, "/endpoints")
+	if !ok || domain == "" || strings.Contains(domain, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if h.forwarder == nil {
+		http.Error(w, "Forwarder not available", http.StatusInternalServerError)
+		return
+	}
+
+	var req endpointPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	if req.Endpoint == "" {
+		http.Error(w, "endpoint is required", http.StatusBadRequest)
+		return
+	}
+	if req.Enabled == nil && req.Weight == nil && !req.Reset {
+		http.Error(w, "Set enabled, weight or reset", http.StatusBadRequest)
+		return
+	}
+	if req.Weight != nil && (*req.Weight < 0 || *req.Weight > 100) {
+		http.Error(w, "weight must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+
+	var override forwarder.EndpointOverride
+	if req.Enabled != nil {
+		disabled := !*req.Enabled
+		override.Disabled = &disabled
+	}
+	override.Weight = req.Weight
+
+	route, err := h.forwarder.SetEndpointOverride(domain, req.Endpoint, override, req.Reset)
+	switch {
+	case errors.Is(err, forwarder.ErrRouteNotFound):
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return
+	case errors.Is(err, forwarder.ErrEndpointNotFound):
+		http.Error(w, "Endpoint not found in route", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.config = h.forwarder.GetConfig()
+
+	// Audit record
+	fields := []zap.Field{
+		zap.String("domain", domain),
+		zap.String("endpoint", req.Endpoint),
+		zap.Bool("reset", req.Reset),
+		zap.String("reason", req.Reason),
+		zap.String("remote_addr", r.RemoteAddr),
+	}
+	if req.Enabled != nil {
+		fields = append(fields, zap.Bool("enabled", *req.Enabled))
+	}
+	if req.Weight != nil {
+		fields = append(fields, zap.Int("weight", *req.Weight))
+	}
+	logger.LogWithDomain(zapcore.WarnLevel, "Endpoint rotation changed by operator", fields...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"domain":    domain,
+		"endpoints": endpointStatuses(route.ForwardEndpoints()),
+	})
+}
+
+// HandleVerifyEndpoint handles POST /api/endpoints/verify - sends a backend the synthetic
+// events of the contract test (lifecycle states, duplicate, missing credentials, large
+// payload) and reports which it handled correctly
+func (h *Handler) HandleVerifyEndpoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if h.forwarder == nil {
+		http.Error(w, "Forwarder not available", http.StatusInternalServerError)
+		return
+	}
+
+	var req endpointVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	if req.Endpoint == "" {
+		http.Error(w, "endpoint is required", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.forwarder.VerifyEndpoint(r.Context(), req.Domain, req.Endpoint)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// endpointStatuses lists the rotation state of endpoints
+func endpointStatuses(endpoints []config.Endpoint) []endpointStatus {
+	statuses := make([]endpointStatus, len(endpoints))
+	for i, endpoint := range endpoints {
+		weight := endpoint.Weight
+		if weight == 0 {
+			weight = 100
+		}
+		statuses[i] = endpointStatus{Endpoint: endpoint.Name(), Enabled: !endpoint.Disabled, Weight: weight}
+	}
+	return statuses
+}
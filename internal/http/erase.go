@@ -0,0 +1,123 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"calleventhub/internal/logger"
+	"calleventhub/internal/nats"
+	"calleventhub/internal/store"
+)
+
+// erasureResult is the response of DELETE /api/calls/{call_id}
+type erasureResult struct {
+	store.Erasure
+	StreamMessages int  `json:"stream_messages"` // Deleted from the NATS stream (with ?stream=true)
+	Correlation    bool `json:"correlation"`     // Correlation links of the call were forgotten
+}
+
+// HandleEraseCall handles DELETE /api/calls/{call_id} - erases the stored events of a call
+// (right-to-erasure requests): forwarded, failed and quarantined events, its correlation links
+// and, with ?stream=true, its messages in the NATS stream. ?reason= is recorded in the audit log.
+func (h *Handler) HandleEraseCall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.store == nil {
+		http.Error(w, "Event store not available", http.StatusInternalServerError)
+		return
+	}
+
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	callID := strings.TrimPrefix(r.URL.Path, "/api/calls/")
+	if callID == "" || strings.Contains(callID, "/") {
+		http.Error(w, "call_id is required", http.StatusBadRequest)
+		return
+	}
+
+	// Check the stream can be erased before touching anything
+	var publisher *nats.Publisher
+	eraseStream := r.URL.Query().Get("stream") == "true"
+	if eraseStream {
+		// Tenants erase from their own stream; admins may pick one with ?tenant=
+		publisher = h.publisher
+		if scope != nil && scope.tenant == nil {
+			// The shared stream holds every domain's events
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		} else if scope != nil {
+			publisher = h.tenantPublishers[scope.tenant.Name]
+		} else if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+			publisher = h.tenantPublishers[tenant]
+		}
+		if publisher == nil {
+			http.Error(w, "NATS publisher not available", http.StatusInternalServerError)
+			return
+		}
+		if !requireStream(w, publisher) {
+			return
+		}
+	}
+
+	result := erasureResult{Erasure: h.store.EraseCall(callID, scope.allows)}
+	erased := result.Forwarded + result.Failed + result.Quarantined
+
+	// Tenants only drop the links of calls they had events of; the correlator is not scoped
+	if h.forwarder != nil && (scope == nil || erased > 0) {
+		result.Correlation = h.forwarder.ForgetCall(callID)
+	}
+
+	var streamErr error
+	if eraseStream {
+		id := make([]byte, 6)
+		rand.Read(id)
+		result.StreamMessages, streamErr = nats.EraseFromStream(r.Context(), publisher.GetJetStream(),
+			publisher.GetStreamName(), hex.EncodeToString(id), func(data []byte) bool {
+				var event struct {
+					CallID string `json:"call_id"`
+					Domain string `json:"domain"`
+				}
+				return json.Unmarshal(data, &event) == nil && event.CallID == callID && scope.allows(event.Domain)
+			})
+	}
+
+	// Audit record
+	fields := []zap.Field{
+		zap.String("call_id", callID),
+		zap.Int("forwarded", result.Forwarded),
+		zap.Int("failed", result.Failed),
+		zap.Int("quarantined", result.Quarantined),
+		zap.Int("stream_messages", result.StreamMessages),
+		zap.Bool("correlation", result.Correlation),
+		zap.String("reason", r.URL.Query().Get("reason")),
+		zap.String("remote_addr", r.RemoteAddr),
+	}
+	if scope != nil && scope.tenant != nil {
+		fields = append(fields, zap.String("tenant", scope.tenant.Name))
+	}
+	if streamErr != nil {
+		logger.LogWithDomain(zapcore.ErrorLevel, "Call data erasure incomplete", append(fields, zap.Error(streamErr))...)
+		http.Error(w, "Failed to erase stream messages: "+streamErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.LogWithDomain(zapcore.WarnLevel, "Call data erased", fields...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"call_id": callID,
+		"erased":  result,
+	})
+}
@@ -2,22 +2,36 @@ package http
 
 import (
 	"bufio"
+	"compress/gzip"
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"calleventhub/event"
+	"calleventhub/internal/anomaly"
+	"calleventhub/internal/anonymize"
 	"calleventhub/internal/config"
+	"calleventhub/internal/consumer"
+	"calleventhub/internal/fleet"
 	"calleventhub/internal/forwarder"
 	"calleventhub/internal/logger"
+	"calleventhub/internal/mirror"
 	"calleventhub/internal/nats"
+	"calleventhub/internal/sla"
 	"calleventhub/internal/store"
 
 	natsgo "github.com/nats-io/nats.go"
@@ -29,32 +43,6 @@ import (
 //go:embed web/*
 var webAssets embed.FS
 
-// Event represents a subset of common fields in telephony signaling events
-// Note: The system preserves ALL fields from incoming JSON, not just these.
-// Different PBX systems may have different field structures and naming conventions.
-// The handler decodes JSON to map[string]interface{} to preserve all fields.
-type Event struct {
-	ActualHotline        string `json:"actual_hotline"`
-	Billsec              string `json:"billsec"`
-	CallID               string `json:"call_id"`
-	CRMContactID         string `json:"crm_contact_id"`
-	Direction            string `json:"direction"`
-	Domain               string `json:"domain"` // Required: used for routing
-	Duration             string `json:"duration"`
-	FromNumber           string `json:"from_number"`
-	Hotline              string `json:"hotline"`
-	Network              string `json:"network"`
-	Provider             string `json:"provider"`
-	ReceiveDest          string `json:"receive_dest"`
-	SIPCallID            string `json:"sip_call_id"`
-	SIPHangupDisposition string `json:"sip_hangup_disposition"`
-	State                string `json:"state"`
-	Status               string `json:"status"`
-	TimeEnded            string `json:"time_ended"`
-	TimeStarted          string `json:"time_started"`
-	ToNumber             string `json:"to_number"`
-}
-
 // Handler handles HTTP requests
 type Handler struct {
 	publisher  *nats.Publisher
@@ -62,6 +50,22 @@ type Handler struct {
 	config     *config.Config
 	forwarder  *forwarder.Forwarder
 	configPath string
+	draining   atomic.Bool // Set during shutdown to fail readiness checks
+	instanceID string      // Reported by /metrics (see SetIdentity)
+	version    string
+
+	tenantPublishers map[string]*nats.Publisher  // Per-tenant publishers in isolation mode
+	consumers        []*nats.Consumer            // Consumers of this instance, for terminating messages
+	consumerServices []*consumer.ConsumerService // Consumer services, for lag reports
+	fleet            *fleet.Reporter             // Config drift reporter (optional)
+	mirror           *mirror.Mirror              // Staging mirror (optional)
+	backpressure     *nats.Backpressure          // Ingest backpressure monitor (optional)
+	replays          replayJobs                  // Stream replays started on this instance
+	duplicates       *duplicateDetector          // Events the PBX sent more than once
+	anomalies        *anomaly.Detector           // Ingest rate spikes and silences (optional)
+	listings         listingCache                // Log and config domain listings
+	counters         *sla.Counters               // Persistent delivery counts (optional)
+	routesMu         sync.Mutex                  // Serializes route edits of the config file
 }
 
 // NewHandler creates a new HTTP handler
@@ -72,6 +76,7 @@ func NewHandler(publisher *nats.Publisher, eventStore *store.Store, cfg *config.
 		config:     cfg,
 		forwarder:  fwd,
 		configPath: configPath,
+		duplicates: newDuplicateDetector(),
 	}
 }
 
@@ -82,66 +87,174 @@ func (h *Handler) HandleEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Decode JSON directly to map to preserve ALL fields from different PBX systems
-	var eventMap map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&eventMap); err != nil {
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	// Unknown fields are kept as sent, to preserve ALL fields from different PBX systems
+	var ev event.Event
+	if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
 		logger.Logger.Warn("Failed to decode event", zap.Error(err))
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	// Different PBX systems name the same fields differently
+	cfg := h.currentConfig()
+	cfg.Server.FieldMap.Apply(&ev)
+
+	// One ID for every record and log line about the event, whatever the PBX sent
+	eventID := forwarder.NewEventID()
+	ev.HubEventID = eventID
+
 	// Validate required fields
 	// Domain is required for routing
-	domain, ok := eventMap["domain"].(string)
-	if !ok || domain == "" {
-		// Try alternative field names that might be used by different PBX systems
-		if altDomain, ok := eventMap["Domain"].(string); ok && altDomain != "" {
-			domain = altDomain
-			eventMap["domain"] = domain // Normalize to lowercase
-		} else {
-			http.Error(w, "domain is required", http.StatusBadRequest)
+	domain := ev.Domain
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+
+	// Tenants may only ingest events for their own domains
+	if !scope.allows(domain) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// PBXs submit from static addresses; events claiming a domain from elsewhere are spoofed
+	route := cfg.GetRoute(domain)
+	if route != nil && len(route.AllowedSources) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip == nil || !route.AllowsSource(ip) {
+			logger.LogWithDomain(zapcore.WarnLevel, "Event rejected from source not allowed for domain",
+				zap.String("domain", domain),
+				zap.String("hub_event_id", eventID),
+				zap.String("remote_addr", r.RemoteAddr),
+			)
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 	}
 
+	if route != nil {
+		route.FieldMap.Apply(&ev)
+	}
+
 	// Extract call_id for logging (if available)
-	callID := ""
-	if id, ok := eventMap["call_id"].(string); ok {
-		callID = id
-	} else if id, ok := eventMap["CallID"].(string); ok {
-		callID = id
-		eventMap["call_id"] = callID // Normalize to lowercase
+	callID := ev.CallID
+
+	if h.anomalies != nil {
+		h.anomalies.Observe(domain)
+	}
+
+	// The same call_id and state again within a few seconds: the PBX sent the event twice.
+	// It is still published, flagged so integrators can show their vendor.
+	if duplicates := cfg.Server.Duplicates; !duplicates.Disabled {
+		state := ev.State
+		window := time.Duration(duplicates.WindowSeconds) * time.Second
+		if repeat, since, count := h.duplicates.observe(domain, callID, state, window); repeat {
+			ev.Set(PossibleDuplicateField, true)
+			logger.LogWithDomain(zapcore.WarnLevel, "Possible duplicate event from PBX",
+				zap.String("call_id", callID),
+				zap.String("hub_event_id", eventID),
+				zap.String("domain", domain),
+				zap.String("state", state),
+				zap.Int("times_received", count),
+				zap.Duration("since_first", since),
+			)
+		}
 	}
 
 	// Publish to NATS JetStream - preserve all fields
-	eventJSON, err := json.Marshal(eventMap)
+	eventJSON, err := ev.MarshalJSON()
 	if err != nil {
-		logger.Logger.Error("Failed to marshal event", zap.Error(err), zap.String("call_id", callID), zap.String("domain", domain))
+		logger.Logger.Error("Failed to marshal event", zap.Error(err), zap.String("call_id", callID), zap.String("hub_event_id", eventID), zap.String("domain", domain))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	if err := h.publisher.Publish(eventJSON); err != nil {
-		logger.Logger.Error("Failed to publish event", zap.Error(err), zap.String("call_id", callID), zap.String("domain", domain))
+	publisher := h.publisherForDomain(domain)
+	if publisher == nil {
+		logger.Logger.Error("No tenant stream for domain", zap.String("call_id", callID), zap.String("hub_event_id", eventID), zap.String("domain", domain))
+		http.Error(w, "No stream available for domain", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Refuse events while JetStream or the consumer is falling behind so the PBX backs off
+	if h.backpressure != nil {
+		if state, active := h.backpressure.Reject(publisher.GetStreamName()); active {
+			retryAfter := cfg.Server.Backpressure.RetryAfter()
+			logger.Logger.Warn("Event refused due to backpressure",
+				zap.String("call_id", callID),
+				zap.String("hub_event_id", eventID),
+				zap.String("domain", domain),
+				zap.String("reason", state.Reason),
+				zap.Int("retry_after_seconds", retryAfter),
+			)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(w, "Service busy, retry later", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	// With server.spool, events are kept on disk while NATS is unavailable
+	spooled, err := publisher.Accept(eventJSON)
+	if errors.Is(err, nats.ErrSpoolFull) {
+		retryAfter := cfg.Server.Backpressure.RetryAfter()
+		logger.Logger.Error("Event refused, NATS unavailable and ingest spool full",
+			zap.String("call_id", callID),
+			zap.String("hub_event_id", eventID),
+			zap.String("domain", domain),
+			zap.String("stream", publisher.GetStreamName()),
+		)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "Service unavailable, retry later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		logger.Logger.Error("Failed to publish event", zap.Error(err), zap.String("call_id", callID), zap.String("hub_event_id", eventID), zap.String("domain", domain))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	if h.counters != nil {
+		h.counters.Record(domain, sla.Accepted, time.Now())
+	}
+
+	// Copy a sample of events to staging (best-effort, never blocks ingest)
+	if h.mirror != nil {
+		h.mirror.Offer(domain, callID, eventJSON)
+	}
+
 	// Log full event data with all fields from any PBX system
 	// This log is written BEFORE forwarding, so you can check how many events
 	// were actually received from the PBX system
 	// IMPORTANT: If you see multiple "Event received and published" logs for the same call_id,
 	// it means the PBX is sending the same event multiple times, NOT that the app is duplicating it
-	logger.LogWithDomain(zapcore.InfoLevel, "Event received and published",
+	message := "Event received and published"
+	if spooled {
+		message = "Event received and spooled until NATS is available"
+	}
+	logger.LogWithDomain(zapcore.InfoLevel, message,
 		zap.String("call_id", callID),
+		zap.String("hub_event_id", eventID),
 		zap.String("domain", domain),
-		zap.String("state", getStringFromMap(eventMap, "state")),
-		zap.String("status", getStringFromMap(eventMap, "status")),
-		zap.Any("event", eventMap), // Log full event data with all fields
+		zap.String("state", ev.State),
+		zap.String("status", ev.Status),
+		zap.Any("event", ev), // Log full event data with all fields
 	)
 
+	response := map[string]interface{}{"status": "accepted", "hub_event_id": eventID}
+	if spooled {
+		response["spooled"] = true
+	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(`{"status":"accepted"}`))
+	json.NewEncoder(w).Encode(response)
 }
 
 // HandleHealth handles GET /health
@@ -157,10 +270,26 @@ func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Backpressure is reported but does not make the service unhealthy
+	if h.backpressure != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":       "healthy",
+			"backpressure": h.backpressure.States(),
+		})
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte(`{"status":"healthy"}`))
 }
 
+// SetDraining marks the service as draining so readiness checks fail
+func (h *Handler) SetDraining() {
+	h.draining.Store(true)
+}
+
 // HandleGetEvents handles GET /api/events - returns events grouped by domain
 func (h *Handler) HandleGetEvents(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -173,14 +302,51 @@ func (h *Handler) HandleGetEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
 	// Get domain filter and event type from query parameters
 	domain := r.URL.Query().Get("domain")
 	eventType := r.URL.Query().Get("type") // "success", "failed", or "" for all
+	endpoint := r.URL.Query().Get("endpoint")
+
+	if domain != "" && !scope.allows(domain) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	since, until, err := parseTimeWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Cursor for /api/events/delta, taken before reading so nothing is missed
+	cursor := h.store.LatestCursor()
 
 	var eventsByDomain map[string][]store.ForwardedEvent
 	var failedEventsByDomain map[string][]store.FailedEvent
 
-	if domain != "" {
+	if endpoint != "" {
+		// Impact analysis: what was sent to one endpoint
+		events, failedEvents := h.store.GetEventsByEndpoint(endpoint, func(d string) bool {
+			return domain == "" || d == domain
+		})
+		eventsByDomain = make(map[string][]store.ForwardedEvent)
+		failedEventsByDomain = make(map[string][]store.FailedEvent)
+		if eventType != "failed" {
+			for _, event := range events {
+				eventsByDomain[event.Domain] = append(eventsByDomain[event.Domain], event)
+			}
+		}
+		if eventType != "success" {
+			for _, event := range failedEvents {
+				failedEventsByDomain[event.Domain] = append(failedEventsByDomain[event.Domain], event)
+			}
+		}
+	} else if domain != "" {
 		// Filter by specific domain
 		if eventType != "failed" {
 			events := h.store.GetEventsByDomainFiltered(domain)
@@ -204,6 +370,20 @@ func (h *Handler) HandleGetEvents(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Restrict to the tenant's domains
+	if scope != nil {
+		for d := range eventsByDomain {
+			if !scope.allows(d) {
+				delete(eventsByDomain, d)
+			}
+		}
+		for d := range failedEventsByDomain {
+			if !scope.allows(d) {
+				delete(failedEventsByDomain, d)
+			}
+		}
+	}
+
 	// Sort events by timestamp (newest first) for each domain
 	for domain := range eventsByDomain {
 		sort.Slice(eventsByDomain[domain], func(i, j int) bool {
@@ -230,9 +410,17 @@ func (h *Handler) HandleGetEvents(w http.ResponseWriter, r *http.Request) {
 
 	var allEvents []eventWithTime
 
+	// Only the requested time window (e.g. an incident)
+	within := func(t time.Time) bool {
+		return (since.IsZero() || !t.Before(since)) && (until.IsZero() || !t.After(until))
+	}
+
 	// Collect successful events
 	for domainName, events := range eventsByDomain {
 		for i := range events {
+			if !within(events[i].ForwardedAt) {
+				continue
+			}
 			allEvents = append(allEvents, eventWithTime{
 				forwardedEvent: &events[i],
 				timestamp:      events[i].ForwardedAt,
@@ -245,6 +433,9 @@ func (h *Handler) HandleGetEvents(w http.ResponseWriter, r *http.Request) {
 	// Collect failed events
 	for domainName, events := range failedEventsByDomain {
 		for i := range events {
+			if !within(events[i].FailedAt) {
+				continue
+			}
 			allEvents = append(allEvents, eventWithTime{
 				failedEvent: &events[i],
 				timestamp:   events[i].FailedAt,
@@ -280,6 +471,8 @@ func (h *Handler) HandleGetEvents(w http.ResponseWriter, r *http.Request) {
 	var stats map[string]interface{}
 	if domain != "" {
 		stats = h.store.GetStatsByDomain(domain)
+	} else if scope != nil {
+		stats = h.store.GetStatsForDomains(scope.domains)
 	} else {
 		stats = h.store.GetStats()
 	}
@@ -288,6 +481,93 @@ func (h *Handler) HandleGetEvents(w http.ResponseWriter, r *http.Request) {
 		"events_by_domain":        eventsByDomain,
 		"failed_events_by_domain": failedEventsByDomain,
 		"stats":                   stats,
+		"cursor":                  cursor,
+		"annotations": h.store.GetAnnotations(since, until, func(d string) bool {
+			return scope.allows(d) && (domain == "" || d == domain)
+		}),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetEventsDelta handles GET /api/events/delta?cursor= - returns only events added after the cursor
+// Optional query parameters: domain, type ("success" or "failed"), limit (default 1000, max 5000)
+func (h *Handler) HandleGetEventsDelta(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.store == nil {
+		http.Error(w, "Event store not available", http.StatusInternalServerError)
+		return
+	}
+
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	domain := query.Get("domain")
+	eventType := query.Get("type")
+
+	if domain != "" && !scope.allows(domain) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var cursor uint64
+	if v := query.Get("cursor"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = parsed
+	}
+
+	limit := 1000
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if parsed > 5000 {
+			parsed = 5000
+		}
+		limit = parsed
+	}
+
+	delta := h.store.GetEventsSince(cursor, limit, func(d string) bool {
+		return scope.allows(d) && (domain == "" || d == domain)
+	})
+
+	if eventType == "failed" {
+		delta.Events = []store.ForwardedEvent{}
+	} else if eventType == "success" {
+		delta.FailedEvents = []store.FailedEvent{}
+	}
+
+	var stats map[string]interface{}
+	if domain != "" {
+		stats = h.store.GetStatsByDomain(domain)
+	} else if scope != nil {
+		stats = h.store.GetStatsForDomains(scope.domains)
+	} else {
+		stats = h.store.GetStats()
+	}
+
+	response := map[string]interface{}{
+		"events":        delta.Events,
+		"failed_events": delta.FailedEvents,
+		"cursor":        delta.Cursor,
+		"has_more":      delta.HasMore,
+		"truncated":     delta.Truncated,
+		"stats":         stats,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -307,7 +587,204 @@ func (h *Handler) HandleGetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stats := h.store.GetStats()
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var stats map[string]interface{}
+	if scope != nil {
+		stats = h.store.GetStatsForDomains(scope.domains)
+	} else {
+		stats = h.store.GetStats()
+	}
+	stats["sinks"] = h.store.GetSinkMetrics(scope.allows)
+	stats["possible_pbx_duplicates"] = h.duplicates.snapshot(scope.allows)
+	stats["event_age"] = h.store.GetAgeMetrics(scope.allows)
+	if h.anomalies != nil {
+		stats["ingest_rates"] = h.anomalies.States(scope.allows)
+	}
+	stats["oldest_unacked_seconds"] = oldestUnacked(h.visibleLag(scope))
+	now := time.Now()
+	stats["active_annotations"] = h.store.GetAnnotations(now, now, scope.allows)
+
+	writeJSONWithETag(w, r, stats)
+}
+
+// HandleGetQuarantine handles GET /api/quarantine - returns events quarantined instead of forwarded
+func (h *Handler) HandleGetQuarantine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.store == nil {
+		http.Error(w, "Event store not available", http.StatusInternalServerError)
+		return
+	}
+
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	domain := r.URL.Query().Get("domain")
+	if domain != "" && !scope.allows(domain) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	events := h.store.GetQuarantinedEvents(func(d string) bool {
+		return scope.allows(d) && (domain == "" || d == domain)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// HandleGetCall handles GET /api/calls?call_id=... - all stored events of the logical call
+// the call_id belongs to, including transferred and bridged legs linked by correlation keys
+func (h *Handler) HandleGetCall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.store == nil {
+		http.Error(w, "Event store not available", http.StatusInternalServerError)
+		return
+	}
+
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	callID := r.URL.Query().Get("call_id")
+	if callID == "" {
+		http.Error(w, "call_id is required", http.StatusBadRequest)
+		return
+	}
+
+	correlationID, callIDs := callID, []string{callID}
+	if h.forwarder != nil {
+		correlationID, callIDs = h.forwarder.CorrelatedCalls(callID)
+	}
+	events, failedEvents := h.store.GetEventsByCallIDs(callIDs, scope.allows)
+
+	// Only list the legs the caller can see
+	visible := map[string]bool{callID: true}
+	for _, event := range events {
+		visible[event.CallID] = true
+	}
+	for _, event := range failedEvents {
+		visible[event.CallID] = true
+	}
+	legs := make([]string, 0, len(visible))
+	for _, id := range callIDs {
+		if visible[id] {
+			legs = append(legs, id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"correlation_id": correlationID,
+		"call_ids":       legs,
+		"events":         events,
+		"failed_events":  failedEvents,
+	})
+}
+
+// SetBackpressure sets the monitor that makes ingest refuse events while the pipeline falls behind
+func (h *Handler) SetBackpressure(b *nats.Backpressure) {
+	h.backpressure = b
+}
+
+// SetAnomalies sets the detector that is told about every ingested event
+func (h *Handler) SetAnomalies(d *anomaly.Detector) {
+	h.anomalies = d
+}
+
+// SetMirror sets the staging mirror that receives a sample of ingested events
+func (h *Handler) SetMirror(m *mirror.Mirror) {
+	h.mirror = m
+}
+
+// SetFleet sets the fleet reporter used by /api/fleet and /api/fleet/stats
+func (h *Handler) SetFleet(reporter *fleet.Reporter) {
+	h.fleet = reporter
+}
+
+// SetIdentity sets the instance ID and version reported by /metrics
+func (h *Handler) SetIdentity(instanceID, version string) {
+	h.instanceID = instanceID
+	h.version = version
+}
+
+// HandleGetFleet handles GET /api/fleet - shows which instances run which config version
+func (h *Handler) HandleGetFleet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if h.fleet == nil {
+		http.Error(w, "Fleet reporting not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	localHash := ""
+	if cfg := h.currentConfig(); cfg != nil {
+		localHash = cfg.Hash()
+	}
+
+	instances, versions, drift := h.fleet.Snapshot()
+
+	response := map[string]interface{}{
+		"instance_id":     h.fleet.InstanceID(),
+		"config_hash":     localHash,
+		"instances":       instances,
+		"config_versions": versions,
+		"drift":           drift,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetFleetStats handles GET /api/fleet/stats - event counts of every instance and
+// their sum, collected from the instances over NATS
+func (h *Handler) HandleGetFleetStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if h.fleet == nil {
+		http.Error(w, "Fleet reporting not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	stats, err := h.fleet.CollectStats(r.Context(), fleet.StatsTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -330,10 +807,30 @@ func (h *Handler) HandleGetStreamMessages(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if h.publisher == nil {
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	// Tenants read their own stream; admins may pick one with ?tenant=
+	publisher := h.publisher
+	if scope != nil && scope.tenant == nil {
+		// The shared stream holds every domain's events
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	} else if scope != nil {
+		publisher = h.tenantPublishers[scope.tenant.Name]
+	} else if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+		publisher = h.tenantPublishers[tenant]
+	}
+
+	if publisher == nil {
 		http.Error(w, "NATS publisher not available", http.StatusInternalServerError)
 		return
 	}
+	if !requireStream(w, publisher) {
+		return
+	}
 
 	// Get query parameters
 	limitStr := r.URL.Query().Get("limit")
@@ -350,8 +847,8 @@ func (h *Handler) HandleGetStreamMessages(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	js := h.publisher.GetJetStream()
-	streamName := h.publisher.GetStreamName()
+	js := publisher.GetJetStream()
+	streamName := publisher.GetStreamName()
 
 	// Get stream info
 	streamInfo, err := js.StreamInfo(streamName)
@@ -404,21 +901,27 @@ func (h *Handler) HandleGetStreamMessages(w http.ResponseWriter, r *http.Request
 	for _, msg := range msgs {
 		metadata, _ := msg.Metadata()
 
+		// Decompress payload if it was compressed on publish
+		data, err := nats.DecodePayload(msg)
+		if err != nil {
+			logger.Logger.Warn("Failed to decode stream message", zap.Uint64("sequence", metadata.Sequence.Stream), zap.Error(err))
+			data = msg.Data
+		}
+
 		streamMsg := StreamMessage{
 			Sequence:  metadata.Sequence.Stream,
 			Timestamp: metadata.Timestamp,
 			Subject:   msg.Subject,
-			Data:      msg.Data,
+			Data:      data,
 		}
 
 		// Try to parse event data for summary
-		var eventData map[string]interface{}
-		if err := json.Unmarshal(msg.Data, &eventData); err == nil {
+		if ev, err := event.Parse(data); err == nil {
 			streamMsg.EventSummary = map[string]interface{}{
-				"call_id": eventData["call_id"],
-				"domain":  eventData["domain"],
-				"state":   eventData["state"],
-				"status":  eventData["status"],
+				"call_id": ev.Get("call_id"),
+				"domain":  ev.Get("domain"),
+				"state":   ev.Get("state"),
+				"status":  ev.Get("status"),
 			}
 		}
 
@@ -437,27 +940,237 @@ func (h *Handler) HandleGetStreamMessages(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(response)
 }
 
-// Server wraps the HTTP server
+// HandleExportStream handles GET /api/stream/export - downloads stream messages as JSON Lines
+// Optional query parameters: start_seq, end_seq, since, until (RFC3339), anonymize (profile name)
+func (h *Handler) HandleExportStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if h.publisher == nil {
+		http.Error(w, "NATS publisher not available", http.StatusInternalServerError)
+		return
+	}
+	if !requireStream(w, h.publisher) {
+		return
+	}
+
+	rng, err := parseExportRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Optional anonymization profile for exports leaving production
+	var transform nats.PayloadTransform
+	if profile := r.URL.Query().Get("anonymize"); profile != "" {
+		anonymizer, err := anonymize.FromConfig(h.currentConfig(), profile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		transform = anonymizer.Apply
+	}
+
+	// A full export takes longer than the server's write timeout, which would cut it off
+	// after the 200 went out
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	streamName := h.publisher.GetStreamName()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", streamName+".jsonl"))
+
+	count, err := nats.ExportStream(h.publisher.GetJetStream(), streamName, rng, transform, w)
+	if err != nil {
+		// Headers are already sent, so the error can only be logged; the export lacks its
+		// end record, so importing it fails as truncated
+		logger.Logger.Error("Stream export failed", zap.String("stream", streamName), zap.Int("exported", count), zap.Error(err))
+		return
+	}
+
+	logger.Logger.Info("Stream exported", zap.String("stream", streamName), zap.Int("messages", count))
+}
+
+// HandleImportStream handles POST /api/stream/import - imports a JSON Lines export into the stream
+func (h *Handler) HandleImportStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if h.publisher == nil {
+		http.Error(w, "NATS publisher not available", http.StatusInternalServerError)
+		return
+	}
+	if !requireStream(w, h.publisher) {
+		return
+	}
+
+	// A full import takes longer than the server's read and write timeouts
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	streamName := h.publisher.GetStreamName()
+	count, err := nats.ImportStream(h.publisher.GetJetStream(), streamName, r.Body)
+	if err != nil {
+		logger.Logger.Error("Stream import failed", zap.String("stream", streamName), zap.Int("imported", count), zap.Error(err))
+		http.Error(w, fmt.Sprintf("Import failed after %d messages: %v", count, err), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Logger.Info("Stream imported", zap.String("stream", streamName), zap.Int("messages", count))
+
+	response := map[string]interface{}{
+		"status":   "success",
+		"stream":   streamName,
+		"imported": count,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseTimeWindow reads the optional since and until (RFC3339) query parameters
+func parseTimeWindow(r *http.Request) (since, until time.Time, err error) {
+	query := r.URL.Query()
+	if v := query.Get("since"); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			return since, until, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		if until, err = time.Parse(time.RFC3339, v); err != nil {
+			return since, until, fmt.Errorf("invalid until: %v", err)
+		}
+	}
+	return since, until, nil
+}
+
+// parseExportRange reads start_seq, end_seq, since and until query parameters
+func parseExportRange(r *http.Request) (nats.ExportRange, error) {
+	var rng nats.ExportRange
+	query := r.URL.Query()
+
+	if v := query.Get("start_seq"); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return rng, fmt.Errorf("invalid start_seq: %v", err)
+		}
+		rng.StartSeq = seq
+	}
+	if v := query.Get("end_seq"); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return rng, fmt.Errorf("invalid end_seq: %v", err)
+		}
+		rng.EndSeq = seq
+	}
+	if v := query.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return rng, fmt.Errorf("invalid since: %v", err)
+		}
+		rng.Since = t
+	}
+	if v := query.Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return rng, fmt.Errorf("invalid until: %v", err)
+		}
+		rng.Until = t
+	}
+
+	return rng, nil
+}
+
+// Server wraps the HTTP server, and the ingest server when /events has a listener of its own
 type Server struct {
-	httpServer *http.Server
-	handler    *Handler
+	httpServer     *http.Server
+	ingestServer   *http.Server
+	httpListener   net.Listener // Bound by Listen
+	ingestListener net.Listener
+	handler        *Handler
 }
 
-// NewServer creates a new HTTP server
-func NewServer(port int, handler *Handler) *Server {
+// NewServer creates a new HTTP server serving what the instance's role includes: POST /events
+// (and the separate ingest listener) with ingest, the dashboard and /api endpoints with
+// dashboard. Health checks and metrics are always served.
+func NewServer(cfg config.ServerConfig, handler *Handler, role config.Role) *Server {
 	mux := http.NewServeMux()
 
 	// API endpoints
-	mux.HandleFunc("/events", handler.HandleEvents)
+	if role.Ingest && !cfg.Ingest.Enabled() {
+		mux.HandleFunc("/events", handler.HandleEvents)
+	}
 	mux.HandleFunc("/health", handler.HandleHealth)
+	mux.HandleFunc("/ready", handler.HandleReady)
+	mux.HandleFunc("/readyz", handler.HandleReady)
+	mux.HandleFunc("/metrics", handler.HandleMetrics)
+	if role.Dashboard {
+		registerDashboard(mux, handler)
+	}
+
+	server := &Server{
+		httpServer: newHTTPServer(cfg.Host, cfg.Port, mux),
+		handler:    handler,
+	}
+
+	// PBXs only reach /events (and the health checks of their load balancer)
+	if role.Ingest && cfg.Ingest.Enabled() {
+		ingest := http.NewServeMux()
+		ingest.HandleFunc("/events", handler.HandleEvents)
+		ingest.HandleFunc("/health", handler.HandleHealth)
+		ingest.HandleFunc("/ready", handler.HandleReady)
+		ingest.HandleFunc("/readyz", handler.HandleReady)
+		server.ingestServer = newHTTPServer(cfg.Ingest.Host, cfg.Ingest.Port, ingest)
+	}
+	return server
+}
+
+// registerDashboard registers the dashboard, the log and config viewers and the /api endpoints
+func registerDashboard(mux *http.ServeMux, handler *Handler) {
+	mux.HandleFunc("/status", handler.HandleStatus)
 	mux.HandleFunc("/api/events", handler.HandleGetEvents)
+	mux.HandleFunc("/api/events/delta", handler.HandleGetEventsDelta)
 	mux.HandleFunc("/api/stats", handler.HandleGetStats)
+	mux.HandleFunc("/api/quarantine", handler.HandleGetQuarantine)
+	mux.HandleFunc("/api/calls", handler.HandleGetCall)
+	mux.HandleFunc("/api/calls/", handler.HandleEraseCall)
+	mux.HandleFunc("/api/lag", handler.HandleGetLag)
+	mux.HandleFunc("/api/digest", handler.HandleGetDigest)
+	mux.HandleFunc("/api/reports/delivery", handler.HandleGetDeliveryReport)
+	mux.HandleFunc("/api/share", handler.HandleCreateShare)
+	mux.HandleFunc("/shared/", handler.HandleShared)
+	mux.HandleFunc("/api/annotations", handler.HandleAnnotations)
+	mux.HandleFunc("/api/annotations/", handler.HandleAnnotation)
 	mux.HandleFunc("/api/stream/messages", handler.HandleGetStreamMessages)
+	mux.HandleFunc("/api/stream/messages/", handler.HandleStreamMessage)
+	mux.HandleFunc("/api/stream/export", handler.HandleExportStream)
+	mux.HandleFunc("/api/stream/replay", handler.HandleStreamReplay)
+	mux.HandleFunc("/api/endpoints/replay", handler.HandleEndpointReplay)
+	mux.HandleFunc("/api/endpoints/verify", handler.HandleVerifyEndpoint)
+	mux.HandleFunc("/api/stream/import", handler.HandleImportStream)
+	mux.HandleFunc("/api/fleet", handler.HandleGetFleet)
+	mux.HandleFunc("/api/fleet/stats", handler.HandleGetFleetStats)
 	mux.HandleFunc("/api/logs", handler.HandleGetLogs)
 	mux.HandleFunc("/api/logs/domains", handler.HandleGetLogDomains)
 	mux.HandleFunc("/api/config", handler.HandleGetConfig)
 	mux.HandleFunc("/api/config/domains", handler.HandleGetConfigDomains)
 	mux.HandleFunc("/api/config/reload", handler.HandleReloadConfig)
+	mux.HandleFunc("/api/config/validate", handler.HandleValidateConfig)
+	mux.HandleFunc("/api/config/routes", handler.HandleRoutes)
+	mux.HandleFunc("/api/config/routes/", handler.HandleRouteEndpoints)
 
 	// Serve static assets (JS, CSS, etc.)
 	mux.HandleFunc("/static/", handler.HandleStatic)
@@ -470,15 +1183,15 @@ func NewServer(port int, handler *Handler) *Server {
 
 	// Serve dashboard (must be last to catch all other routes)
 	mux.HandleFunc("/", handler.HandleDashboard)
+}
 
-	return &Server{
-		httpServer: &http.Server{
-			Addr:         fmt.Sprintf(":%d", port),
-			Handler:      mux,
-			ReadTimeout:  10 * time.Second,
-			WriteTimeout: 10 * time.Second,
-		},
-		handler: handler,
+// newHTTPServer creates an http.Server listening on host:port (host empty = all interfaces)
+func newHTTPServer(host string, port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         net.JoinHostPort(host, strconv.Itoa(port)),
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
 	}
 }
 
@@ -620,6 +1333,11 @@ func (h *Handler) HandleGetLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
 	// Get query parameters
 	domain := r.URL.Query().Get("domain")
 	date := r.URL.Query().Get("date")
@@ -630,14 +1348,14 @@ func (h *Handler) HandleGetLogs(w http.ResponseWriter, r *http.Request) {
 	logsDir := "logs"
 	if domain == "" {
 		// List all domains
-		domains, err := h.listLogDomains(logsDir)
+		domains, err := h.cachedLogDomains(logsDir)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to list domains: %v", err), http.StatusInternalServerError)
 			return
 		}
 
 		response := map[string]interface{}{
-			"domains": domains,
+			"domains": filterLogDomains(domains, scope),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -645,6 +1363,11 @@ func (h *Handler) HandleGetLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !scope.allows(domain) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	// Read logs for specific domain and date
 	logs, err := h.readLogsFromFile(logsDir, domain, date)
 	if err != nil {
@@ -668,12 +1391,12 @@ func (h *Handler) HandleGetLogs(w http.ResponseWriter, r *http.Request) {
 	// Track event metadata by call_id to enrich failed events
 	eventMetadata := make(map[string]map[string]interface{}) // call_id -> metadata
 
-	maxDeliveries := 3 // Default value
-	if h.config != nil {
-		maxDeliveries = h.config.NATS.MaxDeliveries
-	}
-
 	for domain, entries := range logsByDomain {
+		maxDeliveries := 3 // Default value
+		if h.config != nil {
+			maxDeliveries = h.config.MaxDeliveries(domain)
+		}
+
 		// First pass: collect full event data from "Event received and published"
 		for _, entry := range entries {
 			if entry.Message == "Event received and published" {
@@ -861,15 +1584,20 @@ func (h *Handler) HandleGetLogDomains(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
 	logsDir := "logs"
-	domains, err := h.listLogDomains(logsDir)
+	domains, err := h.cachedLogDomains(logsDir)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to list domains: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	response := map[string]interface{}{
-		"domains": domains,
+		"domains": filterLogDomains(domains, scope),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -889,6 +1617,11 @@ func (h *Handler) HandleGetConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
 	// Get current config from forwarder (may have been reloaded)
 	var routes []config.Route
 	if h.forwarder != nil {
@@ -902,15 +1635,19 @@ func (h *Handler) HandleGetConfig(w http.ResponseWriter, r *http.Request) {
 		routes = h.config.Routes
 	}
 
+	routes = filterRoutes(routes, scope)
+
 	// Build response with routes
 	response := map[string]interface{}{
 		"routes": routes,
 		"count":  len(routes),
 	}
+	// Where unrouted domains go, for unscoped callers
+	if defaultRoute := h.currentConfig().DefaultRoute; defaultRoute != nil && scope == nil {
+		response["default_route"] = defaultRoute
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	writeJSONWithETag(w, r, response)
 }
 
 // HandleGetConfigDomains handles GET /api/config/domains - returns list of domains from config
@@ -925,40 +1662,29 @@ func (h *Handler) HandleGetConfigDomains(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get current config from forwarder (may have been reloaded)
-	var routes []config.Route
-	if h.forwarder != nil {
-		cfg := h.forwarder.GetConfig()
-		if cfg != nil {
-			routes = cfg.Routes
-		} else {
-			routes = h.config.Routes
-		}
-	} else {
-		routes = h.config.Routes
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
 	}
 
-	// Extract unique domains
-	domainMap := make(map[string]bool)
-	domains := []string{}
-	for _, route := range routes {
-		if route.Domain != "" && !domainMap[route.Domain] {
-			domainMap[route.Domain] = true
-			domains = append(domains, route.Domain)
+	// Unique domains of the current config (may have been reloaded), sorted alphabetically
+	domains := h.cachedConfigDomains(h.currentConfig())
+	if scope != nil {
+		visible := make([]string, 0, len(domains))
+		for _, domain := range domains {
+			if scope.allows(domain) {
+				visible = append(visible, domain)
+			}
 		}
+		domains = visible
 	}
 
-	// Sort domains alphabetically
-	sort.Strings(domains)
-
 	response := map[string]interface{}{
 		"domains": domains,
 		"count":   len(domains),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	writeJSONWithETag(w, r, response)
 }
 
 // HandleReloadConfig handles POST /api/config/reload - reloads configuration from file
@@ -968,6 +1694,10 @@ func (h *Handler) HandleReloadConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
 	if h.forwarder == nil {
 		http.Error(w, "Forwarder not available", http.StatusInternalServerError)
 		return
@@ -1027,11 +1757,12 @@ func (h *Handler) listLogDomains(logsDir string) ([]map[string]interface{}, erro
 			continue
 		}
 
-		// Count log files and get latest date
+		// Count log files (plain or archived) and get latest date
 		var dates []string
 		for _, logFile := range logFiles {
-			if !logFile.IsDir() && strings.HasSuffix(logFile.Name(), ".log") {
-				date := strings.TrimSuffix(logFile.Name(), ".log")
+			name := strings.TrimSuffix(logFile.Name(), ".gz")
+			if !logFile.IsDir() && strings.HasSuffix(name, ".log") {
+				date := strings.TrimSuffix(name, ".log")
 				if len(date) == 10 { // YYYY-MM-DD format
 					dates = append(dates, date)
 				}
@@ -1059,6 +1790,18 @@ func (h *Handler) readLogsFromFile(logsDir, domain, date string) ([]LogEntry, er
 	logFile := filepath.Join(logsDir, safeDomain, fmt.Sprintf("%s.log", date))
 
 	file, err := os.Open(logFile)
+	var reader io.Reader = file
+	if os.IsNotExist(err) {
+		// Past days may be archived (see logs.archive)
+		if file, err = os.Open(logFile + ".gz"); err == nil {
+			zr, zerr := gzip.NewReader(file)
+			if zerr != nil {
+				file.Close()
+				return nil, zerr
+			}
+			reader = zr
+		}
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []LogEntry{}, nil
@@ -1068,7 +1811,7 @@ func (h *Handler) readLogsFromFile(logsDir, domain, date string) ([]LogEntry, er
 	defer file.Close()
 
 	var logs []LogEntry
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
 		line := scanner.Bytes()
 		if len(line) == 0 {
@@ -1183,14 +1926,53 @@ func sanitizeDomain(domain string) string {
 	return safe
 }
 
-// Start starts the HTTP server
+// Listen binds the HTTP server's address (and the ingest server's), so requests are
+// accepted, and queued until Start serves them, as soon as it returns
+func (s *Server) Listen() error {
+	if s.httpListener != nil {
+		return nil
+	}
+	httpListener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
+	if s.ingestServer != nil {
+		ingestListener, err := net.Listen("tcp", s.ingestServer.Addr)
+		if err != nil {
+			httpListener.Close()
+			return fmt.Errorf("failed to listen on %s: %w", s.ingestServer.Addr, err)
+		}
+		s.ingestListener = ingestListener
+	}
+	s.httpListener = httpListener
+	return nil
+}
+
+// Start serves the HTTP server (and the ingest server), binding them first unless Listen
+// did, and returns when one of them stops
 func (s *Server) Start() error {
-	logger.Logger.Info("Starting HTTP server", zap.String("addr", s.httpServer.Addr))
-	return s.httpServer.ListenAndServe()
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	errs := make(chan error, 2)
+	if s.ingestServer != nil {
+		logger.Logger.Info("Starting ingest HTTP server", zap.String("addr", s.ingestListener.Addr().String()))
+		go func() { errs <- s.ingestServer.Serve(s.ingestListener) }()
+	}
+	logger.Logger.Info("Starting HTTP server", zap.String("addr", s.httpListener.Addr().String()))
+	go func() { errs <- s.httpServer.Serve(s.httpListener) }()
+	return <-errs
 }
 
-// Shutdown gracefully shuts down the HTTP server
+// Shutdown gracefully shuts down the HTTP server (and the ingest server)
 func (s *Server) Shutdown(ctx context.Context) error {
 	logger.Logger.Info("Shutting down HTTP server")
-	return s.httpServer.Shutdown(ctx)
+	var ingestErr error
+	if s.ingestServer != nil {
+		ingestErr = s.ingestServer.Shutdown(ctx)
+	}
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return err
+	}
+	return ingestErr
 }
@@ -0,0 +1,164 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"calleventhub/internal/consumer"
+)
+
+// SetConsumerServices sets the consumer services whose per-domain lag is reported
+func (h *Handler) SetConsumerServices(services []*consumer.ConsumerService) {
+	h.consumerServices = services
+}
+
+// HandleGetLag handles GET /api/lag - pending messages per domain on each consumer, with
+// the suggested worker count. In isolation mode a tenant token only sees its own stream.
+func (h *Handler) HandleGetLag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"consumers": h.visibleLag(scope),
+	})
+}
+
+// visibleLag returns the lag reports of the streams the scope may see, limited to its domains
+func (h *Handler) visibleLag(scope *tenantScope) []consumer.LagReport {
+	reports := make([]consumer.LagReport, 0, len(h.consumerServices))
+	stream := ""
+	if scope != nil {
+		stream = scope.streamName(h.currentConfig().NATS.StreamName)
+	}
+	for _, cs := range h.consumerServices {
+		report := cs.Lag()
+		if scope == nil {
+			reports = append(reports, report)
+			continue
+		}
+		if report.Stream != stream {
+			continue
+		}
+		domains := report.Domains[:0]
+		for _, d := range report.Domains {
+			if scope.allows(d.Domain) {
+				domains = append(domains, d)
+			}
+		}
+		report.Domains = domains
+		circuits := report.Circuits[:0]
+		for _, c := range report.Circuits {
+			if scope.allows(c.Domain) {
+				circuits = append(circuits, c)
+			}
+		}
+		report.Circuits = circuits
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// oldestUnacked returns the age of the oldest unacknowledged message across the reports
+func oldestUnacked(reports []consumer.LagReport) float64 {
+	oldest := 0.0
+	for _, r := range reports {
+		if r.OldestUnackedSeconds > oldest {
+			oldest = r.OldestUnackedSeconds
+		}
+	}
+	return oldest
+}
+
+// writeLagMetrics renders the per-domain lag and worker pool sizes of each consumer
+func writeLagMetrics(buf *bytes.Buffer, reports []consumer.LagReport) {
+	buf.WriteString("# HELP eventhub_consumer_stream_pending Stream messages not yet delivered to the consumer.\n")
+	buf.WriteString("# TYPE eventhub_consumer_stream_pending gauge\n")
+	for _, r := range reports {
+		fmt.Fprintf(buf, "eventhub_consumer_stream_pending{stream=%s} %d\n", quoteLabel(r.Stream), r.StreamPending)
+	}
+
+	buf.WriteString("# HELP eventhub_consumer_ack_pending Messages delivered to the consumer and not yet acknowledged.\n")
+	buf.WriteString("# TYPE eventhub_consumer_ack_pending gauge\n")
+	for _, r := range reports {
+		fmt.Fprintf(buf, "eventhub_consumer_ack_pending{stream=%s} %d\n", quoteLabel(r.Stream), r.AckPending)
+	}
+
+	buf.WriteString("# HELP eventhub_consumer_max_ack_pending Ack pending limit of the consumer (-1 = unlimited).\n")
+	buf.WriteString("# TYPE eventhub_consumer_max_ack_pending gauge\n")
+	for _, r := range reports {
+		fmt.Fprintf(buf, "eventhub_consumer_max_ack_pending{stream=%s} %d\n", quoteLabel(r.Stream), r.MaxAckPending)
+	}
+
+	buf.WriteString("# HELP eventhub_consumer_oldest_unacked_seconds Age of the oldest stream message not yet acknowledged (0 = caught up).\n")
+	buf.WriteString("# TYPE eventhub_consumer_oldest_unacked_seconds gauge\n")
+	for _, r := range reports {
+		fmt.Fprintf(buf, "eventhub_consumer_oldest_unacked_seconds{stream=%s} %g\n", quoteLabel(r.Stream), r.OldestUnackedSeconds)
+	}
+
+	buf.WriteString("# HELP eventhub_consumer_workers Worker pool size (0 = unlimited).\n")
+	buf.WriteString("# TYPE eventhub_consumer_workers gauge\n")
+	for _, r := range reports {
+		fmt.Fprintf(buf, "eventhub_consumer_workers{stream=%s} %d\n", quoteLabel(r.Stream), r.Workers)
+	}
+
+	buf.WriteString("# HELP eventhub_consumer_suggested_workers Workers needed to keep up and drain backlogs in time.\n")
+	buf.WriteString("# TYPE eventhub_consumer_suggested_workers gauge\n")
+	for _, r := range reports {
+		fmt.Fprintf(buf, "eventhub_consumer_suggested_workers{stream=%s} %d\n", quoteLabel(r.Stream), r.SuggestedWorkers)
+	}
+
+	buf.WriteString("# HELP eventhub_domain_pending Messages of a domain received and not yet acknowledged.\n")
+	buf.WriteString("# TYPE eventhub_domain_pending gauge\n")
+	for _, r := range reports {
+		for _, d := range r.Domains {
+			fmt.Fprintf(buf, "eventhub_domain_pending{stream=%s,domain=%s} %d\n", quoteLabel(r.Stream), quoteLabel(d.Domain), d.Pending)
+		}
+	}
+
+	buf.WriteString("# HELP eventhub_domain_oldest_pending_seconds Age of the oldest pending message of a domain.\n")
+	buf.WriteString("# TYPE eventhub_domain_oldest_pending_seconds gauge\n")
+	for _, r := range reports {
+		for _, d := range r.Domains {
+			fmt.Fprintf(buf, "eventhub_domain_oldest_pending_seconds{stream=%s,domain=%s} %g\n", quoteLabel(r.Stream), quoteLabel(d.Domain), d.OldestAgeSeconds)
+		}
+	}
+
+	buf.WriteString("# HELP eventhub_domain_lag_alarm Whether a domain is above its lag alarm thresholds.\n")
+	buf.WriteString("# TYPE eventhub_domain_lag_alarm gauge\n")
+	for _, r := range reports {
+		for _, d := range r.Domains {
+			alarm := 0
+			if d.Alarm {
+				alarm = 1
+			}
+			fmt.Fprintf(buf, "eventhub_domain_lag_alarm{stream=%s,domain=%s} %d\n", quoteLabel(r.Stream), quoteLabel(d.Domain), alarm)
+		}
+	}
+
+	buf.WriteString("# HELP eventhub_domain_circuit_open Whether forwarding for a domain is paused by its circuit (1) or not (0).\n")
+	buf.WriteString("# TYPE eventhub_domain_circuit_open gauge\n")
+	for _, r := range reports {
+		for _, c := range r.Circuits {
+			fmt.Fprintf(buf, "eventhub_domain_circuit_open{stream=%s,domain=%s} 1\n", quoteLabel(r.Stream), quoteLabel(c.Domain))
+		}
+	}
+
+	buf.WriteString("# HELP eventhub_domain_circuit_parked Messages of a domain held until its circuit closes.\n")
+	buf.WriteString("# TYPE eventhub_domain_circuit_parked gauge\n")
+	for _, r := range reports {
+		for _, c := range r.Circuits {
+			fmt.Fprintf(buf, "eventhub_domain_circuit_parked{stream=%s,domain=%s} %d\n", quoteLabel(r.Stream), quoteLabel(c.Domain), c.Parked)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// logDomainsTTL is how long a scan of the log directory is reused. Log files opened by this
+// process invalidate it at once; files removed or written by anything else show up after it.
+const logDomainsTTL = 30 * time.Second
+
+// listingCache keeps the domain listings of /api/logs/domains and /api/config/domains, so
+// the log directory is not walked and the routes not sorted on every request
+type listingCache struct {
+	mu sync.Mutex
+
+	logDomains   []map[string]interface{}
+	logsDir      string
+	logVersion   uint64 // logger.LogFilesVersion when the directory was scanned
+	logScannedAt time.Time
+
+	configDomains []string
+	domainsOf     *config.Config // Config the domains were listed from; reloads replace it
+}
+
+// cachedLogDomains returns the listing of logsDir, scanning it again when it may have changed.
+// The result is shared and must not be modified.
+func (h *Handler) cachedLogDomains(logsDir string) ([]map[string]interface{}, error) {
+	c := &h.listings
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	version := logger.LogFilesVersion()
+	if c.logDomains != nil && c.logsDir == logsDir && c.logVersion == version && time.Since(c.logScannedAt) < logDomainsTTL {
+		return c.logDomains, nil
+	}
+
+	domains, err := h.listLogDomains(logsDir)
+	if err != nil {
+		return nil, err
+	}
+	if domains == nil {
+		domains = []map[string]interface{}{}
+	}
+	c.logDomains, c.logsDir, c.logVersion, c.logScannedAt = domains, logsDir, version, time.Now()
+	return domains, nil
+}
+
+// cachedConfigDomains returns the routed domains of cfg, sorted and without duplicates.
+// The result is shared and must not be modified.
+func (h *Handler) cachedConfigDomains(cfg *config.Config) []string {
+	c := &h.listings
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.domainsOf == cfg && c.configDomains != nil {
+		return c.configDomains
+	}
+
+	seen := make(map[string]bool)
+	domains := []string{}
+	for _, route := range cfg.Routes {
+		if route.Domain != "" && !seen[route.Domain] {
+			seen[route.Domain] = true
+			domains = append(domains, route.Domain)
+		}
+	}
+	sort.Strings(domains)
+	c.configDomains, c.domainsOf = domains, cfg
+	return domains
+}
@@ -0,0 +1,323 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"calleventhub/internal/anomaly"
+	"calleventhub/internal/forwarder"
+	"calleventhub/internal/nats"
+	"calleventhub/internal/store"
+)
+
+// HandleMetrics handles GET /metrics - per-sink delivery metrics in the Prometheus text format
+// In isolation mode a tenant token only sees its own domains
+func (h *Handler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.store == nil {
+		http.Error(w, "Event store not available", http.StatusInternalServerError)
+		return
+	}
+
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if h.instanceID != "" {
+		writeInstanceMetrics(&buf, h.instanceID, h.version)
+	}
+	writeSinkMetrics(&buf, h.store.GetSinkMetrics(scope.allows))
+	writeAgeMetrics(&buf, h.store.GetAgeMetrics(scope.allows))
+	if h.backpressure != nil {
+		writeBackpressureMetrics(&buf, h.visibleBackpressure(scope))
+	}
+	writeLagMetrics(&buf, h.visibleLag(scope))
+	writeDuplicateMetrics(&buf, h.duplicates.snapshot(scope.allows))
+	if h.anomalies != nil {
+		writeAnomalyMetrics(&buf, h.anomalies.States(scope.allows))
+	}
+	if h.forwarder != nil {
+		writeHedgeMetrics(&buf, h.forwarder.HedgeStats(scope.allows))
+	}
+	if scope == nil {
+		writeStoreMetrics(&buf, h.store.GetMemoryUsage())
+		writeSpoolMetrics(&buf, h.spoolStats())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// writeSinkMetrics renders delivery counters and latency histograms of each endpoint
+func writeSinkMetrics(buf *bytes.Buffer, metrics []store.SinkMetrics) {
+	buf.WriteString("# HELP eventhub_sink_deliveries_total Event deliveries by endpoint and outcome.\n")
+	buf.WriteString("# TYPE eventhub_sink_deliveries_total counter\n")
+	for _, m := range metrics {
+		labels := sinkLabels(m)
+		fmt.Fprintf(buf, "eventhub_sink_deliveries_total{%s,status=\"success\",error_class=\"\"} %d\n", labels, m.Successes)
+
+		classes := make([]string, 0, len(m.ErrorClasses))
+		for class := range m.ErrorClasses {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			fmt.Fprintf(buf, "eventhub_sink_deliveries_total{%s,status=\"failed\",error_class=%s} %d\n",
+				labels, quoteLabel(class), m.ErrorClasses[class])
+		}
+	}
+
+	buf.WriteString("# HELP eventhub_sink_retryable_failures_total Failed deliveries that may succeed when redelivered.\n")
+	buf.WriteString("# TYPE eventhub_sink_retryable_failures_total counter\n")
+	for _, m := range metrics {
+		fmt.Fprintf(buf, "eventhub_sink_retryable_failures_total{%s} %d\n", sinkLabels(m), m.RetryableFailures)
+	}
+
+	buf.WriteString("# HELP eventhub_sink_delivery_duration_seconds Time taken by event deliveries.\n")
+	buf.WriteString("# TYPE eventhub_sink_delivery_duration_seconds histogram\n")
+	for _, m := range metrics {
+		labels := sinkLabels(m)
+		var cumulative int64
+		for i, bound := range store.LatencyBuckets {
+			cumulative += m.LatencyCounts[i]
+			fmt.Fprintf(buf, "eventhub_sink_delivery_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		cumulative += m.LatencyCounts[len(store.LatencyBuckets)]
+		fmt.Fprintf(buf, "eventhub_sink_delivery_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, cumulative)
+		fmt.Fprintf(buf, "eventhub_sink_delivery_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(m.LatencySumSeconds, 'g', -1, 64))
+		fmt.Fprintf(buf, "eventhub_sink_delivery_duration_seconds_count{%s} %d\n", labels, cumulative)
+	}
+}
+
+// writeAgeMetrics renders the age histogram of each domain's events when they were forwarded
+func writeAgeMetrics(buf *bytes.Buffer, metrics []store.AgeMetrics) {
+	buf.WriteString("# HELP eventhub_event_age_seconds Time from an event being stored in the stream to being forwarded successfully.\n")
+	buf.WriteString("# TYPE eventhub_event_age_seconds histogram\n")
+	for _, m := range metrics {
+		labels := "domain=" + quoteLabel(m.Domain)
+		var cumulative int64
+		for i, bound := range store.AgeBuckets {
+			cumulative += m.Counts[i]
+			fmt.Fprintf(buf, "eventhub_event_age_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		cumulative += m.Counts[len(store.AgeBuckets)]
+		fmt.Fprintf(buf, "eventhub_event_age_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, cumulative)
+		fmt.Fprintf(buf, "eventhub_event_age_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(m.SumSeconds, 'g', -1, 64))
+		fmt.Fprintf(buf, "eventhub_event_age_seconds_count{%s} %d\n", labels, cumulative)
+	}
+}
+
+// writeBackpressureMetrics renders the ingest backpressure state of each stream
+func writeBackpressureMetrics(buf *bytes.Buffer, states []nats.BackpressureState) {
+	buf.WriteString("# HELP eventhub_backpressure_active Whether ingest currently refuses events with 503 (1) or not (0).\n")
+	buf.WriteString("# TYPE eventhub_backpressure_active gauge\n")
+	for _, s := range states {
+		active := 0
+		if s.Active {
+			active = 1
+		}
+		fmt.Fprintf(buf, "eventhub_backpressure_active{stream=%s,reason=%s} %d\n", quoteLabel(s.Stream), quoteLabel(s.Reason), active)
+	}
+
+	buf.WriteString("# HELP eventhub_backpressure_rejected_total Events refused with 503 because of backpressure.\n")
+	buf.WriteString("# TYPE eventhub_backpressure_rejected_total counter\n")
+	for _, s := range states {
+		fmt.Fprintf(buf, "eventhub_backpressure_rejected_total{stream=%s} %d\n", quoteLabel(s.Stream), s.Rejected)
+	}
+
+	buf.WriteString("# HELP eventhub_publish_latency_seconds Average JetStream publish latency over the last check interval.\n")
+	buf.WriteString("# TYPE eventhub_publish_latency_seconds gauge\n")
+	for _, s := range states {
+		fmt.Fprintf(buf, "eventhub_publish_latency_seconds{stream=%s} %s\n", quoteLabel(s.Stream), strconv.FormatFloat(s.PublishLatencyMs/1000, 'g', -1, 64))
+	}
+
+	buf.WriteString("# HELP eventhub_consumer_lag Stream messages not yet delivered to the consumer (0 unless max_consumer_lag is set).\n")
+	buf.WriteString("# TYPE eventhub_consumer_lag gauge\n")
+	for _, s := range states {
+		fmt.Fprintf(buf, "eventhub_consumer_lag{stream=%s} %d\n", quoteLabel(s.Stream), s.ConsumerLag)
+	}
+}
+
+// writeInstanceMetrics renders the identity of the instance, to join its other metrics with
+// the instance ID used in logs and event records
+func writeInstanceMetrics(buf *bytes.Buffer, instanceID, version string) {
+	buf.WriteString("# HELP eventhub_instance_info Identity of the hub instance serving these metrics.\n")
+	buf.WriteString("# TYPE eventhub_instance_info gauge\n")
+	fmt.Fprintf(buf, "eventhub_instance_info{instance_id=%s,version=%s} 1\n", quoteLabel(instanceID), quoteLabel(version))
+}
+
+// writeStoreMetrics renders the memory taken by the event store
+func writeStoreMetrics(buf *bytes.Buffer, usage store.MemoryUsage) {
+	buf.WriteString("# HELP eventhub_store_bytes Size of the event bodies kept in memory, after compression.\n")
+	buf.WriteString("# TYPE eventhub_store_bytes gauge\n")
+	fmt.Fprintf(buf, "eventhub_store_bytes %d\n", usage.Bytes)
+
+	buf.WriteString("# HELP eventhub_store_raw_bytes Uncompressed size of the event bodies kept in memory.\n")
+	buf.WriteString("# TYPE eventhub_store_raw_bytes gauge\n")
+	fmt.Fprintf(buf, "eventhub_store_raw_bytes %d\n", usage.RawBytes)
+
+	buf.WriteString("# HELP eventhub_store_evicted_for_memory_total Events removed early to stay under the store memory limit.\n")
+	buf.WriteString("# TYPE eventhub_store_evicted_for_memory_total counter\n")
+	fmt.Fprintf(buf, "eventhub_store_evicted_for_memory_total %d\n", usage.EvictedForMemory)
+
+	buf.WriteString("# HELP eventhub_store_evicted_for_quota_total Events removed early to stay under their domain's max_stored_events.\n")
+	buf.WriteString("# TYPE eventhub_store_evicted_for_quota_total counter\n")
+	fmt.Fprintf(buf, "eventhub_store_evicted_for_quota_total %d\n", usage.EvictedForQuota)
+}
+
+// spoolStats returns the ingest spool of each stream, by stream name
+func (h *Handler) spoolStats() map[string]nats.SpoolStats {
+	stats := make(map[string]nats.SpoolStats)
+	publishers := []*nats.Publisher{h.publisher}
+	for _, p := range h.tenantPublishers {
+		publishers = append(publishers, p)
+	}
+	for _, p := range publishers {
+		if p != nil && p.Spool() != nil {
+			stats[p.GetStreamName()] = p.Spool().Stats()
+		}
+	}
+	return stats
+}
+
+// writeSpoolMetrics renders the ingested events waiting on disk for NATS
+func writeSpoolMetrics(buf *bytes.Buffer, stats map[string]nats.SpoolStats) {
+	if len(stats) == 0 {
+		return
+	}
+	streams := make([]string, 0, len(stats))
+	for stream := range stats {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+
+	buf.WriteString("# HELP eventhub_spool_events Ingested events kept on disk until NATS accepts them.\n")
+	buf.WriteString("# TYPE eventhub_spool_events gauge\n")
+	for _, stream := range streams {
+		fmt.Fprintf(buf, "eventhub_spool_events{stream=%s} %d\n", quoteLabel(stream), stats[stream].Events)
+	}
+	buf.WriteString("# HELP eventhub_spool_bytes Size of the spooled events.\n")
+	buf.WriteString("# TYPE eventhub_spool_bytes gauge\n")
+	for _, stream := range streams {
+		fmt.Fprintf(buf, "eventhub_spool_bytes{stream=%s} %d\n", quoteLabel(stream), stats[stream].Bytes)
+	}
+	buf.WriteString("# HELP eventhub_spool_dropped_total Oldest spooled events deleted to make room (overflow: drop_oldest).\n")
+	buf.WriteString("# TYPE eventhub_spool_dropped_total counter\n")
+	for _, stream := range streams {
+		fmt.Fprintf(buf, "eventhub_spool_dropped_total{stream=%s} %d\n", quoteLabel(stream), stats[stream].Dropped)
+	}
+	buf.WriteString("# HELP eventhub_spool_rejected_total Events refused with 503 because the spool was full (overflow: reject).\n")
+	buf.WriteString("# TYPE eventhub_spool_rejected_total counter\n")
+	for _, stream := range streams {
+		fmt.Fprintf(buf, "eventhub_spool_rejected_total{stream=%s} %d\n", quoteLabel(stream), stats[stream].Rejected)
+	}
+	buf.WriteString("# HELP eventhub_spool_failed_total Spooled events the stream refused, moved to the spool's failed directory.\n")
+	buf.WriteString("# TYPE eventhub_spool_failed_total counter\n")
+	for _, stream := range streams {
+		fmt.Fprintf(buf, "eventhub_spool_failed_total{stream=%s} %d\n", quoteLabel(stream), stats[stream].Failed)
+	}
+}
+
+// writeDuplicateMetrics renders the possible PBX duplicates ingested per domain
+func writeDuplicateMetrics(buf *bytes.Buffer, counts []DuplicateCount) {
+	buf.WriteString("# HELP eventhub_ingest_possible_duplicates_total Events received again with the same call_id and state within the duplicate window.\n")
+	buf.WriteString("# TYPE eventhub_ingest_possible_duplicates_total counter\n")
+	for _, c := range counts {
+		fmt.Fprintf(buf, "eventhub_ingest_possible_duplicates_total{domain=%s} %d\n", quoteLabel(c.Domain), c.Count)
+	}
+}
+
+// writeAnomalyMetrics renders the ingest rate of each routed domain and its anomalies
+func writeAnomalyMetrics(buf *bytes.Buffer, states []anomaly.State) {
+	buf.WriteString("# HELP eventhub_ingest_rate_per_minute Events ingested per minute over the recent window.\n")
+	buf.WriteString("# TYPE eventhub_ingest_rate_per_minute gauge\n")
+	for _, s := range states {
+		fmt.Fprintf(buf, "eventhub_ingest_rate_per_minute{domain=%s} %g\n", quoteLabel(s.Domain), s.RecentPerMinute)
+	}
+
+	buf.WriteString("# HELP eventhub_ingest_baseline_per_minute Events ingested per minute over the baseline before the recent window.\n")
+	buf.WriteString("# TYPE eventhub_ingest_baseline_per_minute gauge\n")
+	for _, s := range states {
+		fmt.Fprintf(buf, "eventhub_ingest_baseline_per_minute{domain=%s} %g\n", quoteLabel(s.Domain), s.BaselinePerMinute)
+	}
+
+	buf.WriteString("# HELP eventhub_ingest_anomaly Whether a domain's ingest rate is in an anomaly of the kind (1) or not (0).\n")
+	buf.WriteString("# TYPE eventhub_ingest_anomaly gauge\n")
+	for _, s := range states {
+		for _, kind := range anomaly.Kinds {
+			active := 0
+			if s.Anomaly == kind {
+				active = 1
+			}
+			fmt.Fprintf(buf, "eventhub_ingest_anomaly{domain=%s,kind=%s} %d\n", quoteLabel(s.Domain), quoteLabel(kind), active)
+		}
+	}
+}
+
+// writeHedgeMetrics renders the hedged requests of each domain with hedging
+func writeHedgeMetrics(buf *bytes.Buffer, stats []forwarder.HedgeStats) {
+	buf.WriteString("# HELP eventhub_hedged_requests_total Second requests sent to endpoints slower than their recent P95 latency.\n")
+	buf.WriteString("# TYPE eventhub_hedged_requests_total counter\n")
+	for _, s := range stats {
+		fmt.Fprintf(buf, "eventhub_hedged_requests_total{domain=%s} %d\n", quoteLabel(s.Domain), s.Hedged)
+	}
+
+	buf.WriteString("# HELP eventhub_hedged_requests_won_total Hedged second requests that answered before the first.\n")
+	buf.WriteString("# TYPE eventhub_hedged_requests_won_total counter\n")
+	for _, s := range stats {
+		fmt.Fprintf(buf, "eventhub_hedged_requests_won_total{domain=%s} %d\n", quoteLabel(s.Domain), s.Won)
+	}
+}
+
+// visibleBackpressure returns the backpressure states of the streams the scope may see
+func (h *Handler) visibleBackpressure(scope *tenantScope) []nats.BackpressureState {
+	states := h.backpressure.States()
+	if scope == nil {
+		return states
+	}
+	stream := scope.streamName(h.currentConfig().NATS.StreamName)
+	visible := make([]nats.BackpressureState, 0, 1)
+	for _, s := range states {
+		if s.Stream == stream {
+			visible = append(visible, s)
+		}
+	}
+	return visible
+}
+
+// sinkLabels returns the label set identifying an endpoint
+func sinkLabels(m store.SinkMetrics) string {
+	return fmt.Sprintf("domain=%s,sink_type=%s,endpoint=%s",
+		quoteLabel(m.Domain), quoteLabel(m.SinkType), quoteLabel(metricEndpoint(m.Endpoint)))
+}
+
+// metricEndpoint strips credentials and query strings (often carrying secret keys) from endpoint URLs
+func metricEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return endpoint
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// quoteLabel quotes a Prometheus label value
+func quoteLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
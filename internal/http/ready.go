@@ -0,0 +1,179 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/nats"
+	"calleventhub/internal/store"
+)
+
+// publisherReadiness is the connection state of one stream's publisher
+type publisherReadiness struct {
+	Stream              string  `json:"stream"`
+	Connected           bool    `json:"connected"`
+	DisconnectedSeconds float64 `json:"disconnected_seconds,omitempty"`
+	Spooled             int     `json:"spooled,omitempty"` // Ingested events waiting on disk for NATS (server.spool)
+}
+
+// consumerReadiness is the state of one stream's consumer
+type consumerReadiness struct {
+	Stream    string `json:"stream"`
+	Connected bool   `json:"connected"`
+	Fetching  bool   `json:"fetching"` // false once fetching stopped on an error
+	Lag       uint64 `json:"lag"`
+	LagError  string `json:"lag_error,omitempty"`
+}
+
+// endpointReadiness counts the endpoints used within the window whose last delivery failed
+type endpointReadiness struct {
+	Total          int     `json:"total"`
+	Failing        int     `json:"failing"`
+	FailingPercent float64 `json:"failing_percent"`
+	WindowSeconds  int     `json:"window_seconds"`
+}
+
+// readiness is the verbose /ready report
+type readiness struct {
+	Status     string               `json:"status"`            // "ready" or "not_ready"
+	Reasons    []string             `json:"reasons,omitempty"` // Why the instance is not ready
+	Draining   bool                 `json:"draining"`
+	Publishers []publisherReadiness `json:"publishers"`
+	Consumers  []consumerReadiness  `json:"consumers"`
+	Endpoints  endpointReadiness    `json:"endpoints"`
+}
+
+// HandleReady handles GET /ready (and /readyz) - readiness probe for load balancers
+// Fails while the service is draining, when a consumer stopped fetching, and when the
+// server.readiness policy is exceeded (NATS being down only counts once server.spool is full). ?verbose=1 returns the full report as JSON.
+func (h *Handler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	verbose := r.URL.Query().Get("verbose")
+	report := h.checkReadiness(verbose != "" && verbose != "0")
+
+	status := http.StatusOK
+	if len(report.Reasons) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+
+	if verbose == "" || verbose == "0" {
+		if status != http.StatusOK {
+			http.Error(w, strings.Join(report.Reasons, "; "), status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"status":"ready"}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// checkReadiness evaluates the readiness policy. Consumer lag is only read from NATS when
+// the policy checks it or a verbose report is requested.
+func (h *Handler) checkReadiness(verbose bool) readiness {
+	policy := config.ReadinessConfig{}
+	if cfg := h.currentConfig(); cfg != nil {
+		policy = cfg.Server.Readiness
+	}
+
+	report := readiness{
+		Status:     "ready",
+		Draining:   h.draining.Load(),
+		Publishers: []publisherReadiness{},
+		Consumers:  []consumerReadiness{},
+	}
+	if report.Draining {
+		report.Reasons = append(report.Reasons, "Service is draining")
+	}
+
+	publishers := []*nats.Publisher{h.publisher}
+	for _, p := range h.tenantPublishers {
+		publishers = append(publishers, p)
+	}
+	for _, p := range publishers {
+		if p == nil {
+			continue
+		}
+		state := publisherReadiness{Stream: p.GetStreamName(), Connected: p.IsConnected()}
+		spool := p.Spool()
+		if spool != nil {
+			state.Spooled = spool.Len()
+		}
+		if !state.Connected {
+			down := p.DisconnectedFor()
+			state.DisconnectedSeconds = down.Seconds()
+			// Ingest still works while the spool takes events
+			if spool != nil && spool.Accepting() {
+				report.Publishers = append(report.Publishers, state)
+				continue
+			}
+			if down >= time.Duration(policy.MaxNATSDownSeconds)*time.Second {
+				report.Reasons = append(report.Reasons, fmt.Sprintf("NATS not connected (stream %s)", state.Stream))
+			}
+		}
+		report.Publishers = append(report.Publishers, state)
+	}
+	sort.Slice(report.Publishers, func(i, j int) bool { return report.Publishers[i].Stream < report.Publishers[j].Stream })
+
+	for _, c := range h.consumers {
+		state := consumerReadiness{Stream: c.StreamName(), Connected: c.IsConnected(), Fetching: !c.FetchFailed()}
+		if !state.Fetching {
+			report.Reasons = append(report.Reasons, fmt.Sprintf("Consumer stopped fetching (stream %s)", state.Stream))
+		}
+		if verbose || policy.MaxConsumerLag > 0 {
+			lag, err := c.Lag()
+			if err != nil {
+				state.LagError = err.Error()
+			}
+			state.Lag = lag.Pending
+			if policy.MaxConsumerLag > 0 && lag.Pending > uint64(policy.MaxConsumerLag) {
+				report.Reasons = append(report.Reasons, fmt.Sprintf("Consumer lag %d exceeds %d (stream %s)", lag.Pending, policy.MaxConsumerLag, state.Stream))
+			}
+		}
+		report.Consumers = append(report.Consumers, state)
+	}
+
+	report.Endpoints = h.endpointReadiness(policy.EndpointWindowSeconds)
+	if policy.MaxFailingEndpointsPercent > 0 && report.Endpoints.FailingPercent > float64(policy.MaxFailingEndpointsPercent) {
+		report.Reasons = append(report.Reasons, fmt.Sprintf("%.0f%% of endpoints failing", report.Endpoints.FailingPercent))
+	}
+
+	if len(report.Reasons) > 0 {
+		report.Status = "not_ready"
+	}
+	return report
+}
+
+// endpointReadiness counts the endpoints with a delivery within the window and those whose last one failed
+func (h *Handler) endpointReadiness(windowSeconds int) endpointReadiness {
+	result := endpointReadiness{WindowSeconds: windowSeconds}
+	if h.store == nil {
+		return result
+	}
+	since := time.Now().Add(-time.Duration(windowSeconds) * time.Second)
+	for _, m := range h.store.GetSinkMetrics(func(string) bool { return true }) {
+		if m.LastResultAt.Before(since) {
+			continue
+		}
+		result.Total++
+		if m.LastStatus == store.ResultFailed {
+			result.Failing++
+		}
+	}
+	if result.Total > 0 {
+		result.FailingPercent = float64(result.Failing) * 100 / float64(result.Total)
+	}
+	return result
+}
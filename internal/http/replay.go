@@ -0,0 +1,415 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"calleventhub/internal/forwarder"
+	"calleventhub/internal/logger"
+	"calleventhub/internal/nats"
+	"calleventhub/internal/store"
+)
+
+// endpointReplayRequest is the body of POST /api/endpoints/replay
+type endpointReplayRequest struct {
+	Endpoint string    `json:"endpoint"` // Endpoint name as listed by /api/config
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`     // Default: now
+	Domain   string    `json:"domain"` // Only replay this domain's events (empty = all)
+	Reason   string    `json:"reason"` // Recorded in the audit log
+}
+
+// replayRequest is the body of POST /api/stream/replay
+type replayRequest struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`     // Default: now
+	Domain string    `json:"domain"` // Only replay this domain's events (empty = all)
+	Reason string    `json:"reason"` // Recorded in the audit log
+}
+
+// Replay statuses
+const (
+	replayRunning  = "running"
+	replayFinished = "finished"
+	replayFailed   = "failed"
+)
+
+// replayTriggerRecovery marks the endpoint replays started by an endpoint's recovery
+const replayTriggerRecovery = "recovery"
+
+// replayJob is a running or finished stream replay
+type replayJob struct {
+	ID         string     `json:"id"`
+	Stream     string     `json:"stream,omitempty"`
+	Endpoint   string     `json:"endpoint,omitempty"` // Endpoint replays: the endpoint events were sent to again
+	Domain     string     `json:"domain,omitempty"`
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Failed     int        `json:"failed,omitempty"`  // Endpoint replays: events the endpoint failed again
+	Trigger    string     `json:"trigger,omitempty"` // Set when started automatically (replayTriggerRecovery)
+	Skipped    int        `json:"skipped,omitempty"` // Recovery replays: failed events beyond recovery_replay max_events
+	nats.ReplayProgress
+}
+
+// maxReplayJobs is how many replays are remembered for GET /api/stream/replay
+const maxReplayJobs = 50
+
+// replayJobs tracks the replays started on this instance
+type replayJobs struct {
+	mu   sync.Mutex
+	jobs []*replayJob
+}
+
+// add remembers a new job, forgetting the oldest finished ones beyond maxReplayJobs
+func (r *replayJobs) add(job *replayJob) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs = append(r.jobs, job)
+	for i := 0; len(r.jobs) > maxReplayJobs && i < len(r.jobs); {
+		if r.jobs[i].Status == replayRunning {
+			i++
+			continue
+		}
+		r.jobs = append(r.jobs[:i], r.jobs[i+1:]...)
+	}
+}
+
+// update changes a job under the lock
+func (r *replayJobs) update(job *replayJob, fn func(job *replayJob)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(job)
+}
+
+// running reports whether an endpoint replay of the endpoint and domain is running
+func (r *replayJobs) running(endpoint, domain string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.Status == replayRunning && job.Endpoint == endpoint && job.Domain == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns copies of the jobs, newest first
+func (r *replayJobs) list() []replayJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]replayJob, len(r.jobs))
+	for i, job := range r.jobs {
+		jobs[i] = *job
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.After(jobs[j].StartedAt) })
+	return jobs
+}
+
+// HandleStreamReplay handles /api/stream/replay. POST {from, to, domain} republishes the
+// stream's messages stored in that window (optionally of one domain) flagged as replays, so
+// they are forwarded again; it runs in the background. GET lists the replays and their progress.
+func (h *Handler) HandleStreamReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		writeJSONWithETag(w, r, map[string]interface{}{"replays": h.replays.list()})
+		return
+	}
+
+	var req replayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload (from and to are RFC3339 times)", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	if req.To.IsZero() || req.To.After(now) {
+		req.To = now
+	}
+	if req.From.IsZero() || !req.From.Before(req.To) {
+		http.Error(w, "from is required and must be before to", http.StatusBadRequest)
+		return
+	}
+
+	// Admins pick a tenant's stream with ?tenant=
+	publisher := h.publisher
+	if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+		publisher = h.tenantPublishers[tenant]
+	}
+	if publisher == nil {
+		http.Error(w, "NATS publisher not available", http.StatusInternalServerError)
+		return
+	}
+	if !requireStream(w, publisher) {
+		return
+	}
+
+	id := make([]byte, 6)
+	rand.Read(id)
+	job := &replayJob{
+		ID:        hex.EncodeToString(id),
+		Stream:    publisher.GetStreamName(),
+		Domain:    req.Domain,
+		From:      req.From,
+		To:        req.To,
+		Status:    replayRunning,
+		StartedAt: now,
+	}
+	h.replays.add(job)
+
+	// Audit record
+	logger.LogWithDomain(zapcore.WarnLevel, "Stream replay started by operator",
+		zap.String("domain", req.Domain),
+		zap.String("replay", job.ID),
+		zap.String("stream", job.Stream),
+		zap.Time("from", req.From),
+		zap.Time("to", req.To),
+		zap.String("reason", req.Reason),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+
+	var match func(data []byte) bool
+	if req.Domain != "" {
+		match = func(data []byte) bool {
+			var event struct {
+				Domain string `json:"domain"`
+			}
+			return json.Unmarshal(data, &event) == nil && event.Domain == req.Domain
+		}
+	}
+
+	go func() {
+		progress, err := nats.ReplayStream(context.Background(), publisher.GetJetStream(), job.Stream, job.ID,
+			nats.ReplayRange{From: req.From, To: req.To}, match,
+			func(p nats.ReplayProgress) {
+				h.replays.update(job, func(job *replayJob) { job.ReplayProgress = p })
+			})
+
+		h.replays.update(job, func(job *replayJob) {
+			finished := time.Now()
+			job.ReplayProgress = progress
+			job.FinishedAt = &finished
+			job.Status = replayFinished
+			if err != nil {
+				job.Status = replayFailed
+				job.Error = err.Error()
+			}
+		})
+		if err != nil {
+			logger.Logger.Error("Stream replay failed", zap.String("replay", job.ID), zap.Int("replayed", progress.Replayed), zap.Error(err))
+			return
+		}
+		logger.Logger.Info("Stream replay finished",
+			zap.String("replay", job.ID),
+			zap.Int("scanned", progress.Scanned),
+			zap.Int("replayed", progress.Replayed),
+		)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleEndpointReplay handles /api/endpoints/replay. POST {endpoint, from, to, domain} forwards
+// again, to that endpoint only, the events that failed against it between from and to while
+// every other endpoint accepted them - the recovery after a partial outage. It runs in the
+// background; GET lists the endpoint replays and their progress.
+func (h *Handler) HandleEndpointReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		jobs := make([]replayJob, 0)
+		for _, job := range h.replays.list() {
+			if job.Endpoint != "" {
+				jobs = append(jobs, job)
+			}
+		}
+		writeJSONWithETag(w, r, map[string]interface{}{"replays": jobs})
+		return
+	}
+
+	if h.store == nil || h.forwarder == nil {
+		http.Error(w, "Event store not available", http.StatusInternalServerError)
+		return
+	}
+
+	var req endpointReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload (from and to are RFC3339 times)", http.StatusBadRequest)
+		return
+	}
+	if req.Endpoint == "" {
+		http.Error(w, "endpoint is required", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	if req.To.IsZero() || req.To.After(now) {
+		req.To = now
+	}
+	if req.From.IsZero() || !req.From.Before(req.To) {
+		http.Error(w, "from is required and must be before to", http.StatusBadRequest)
+		return
+	}
+
+	events := h.store.GetEndpointFailures(req.Endpoint, req.From, req.To, func(domain string) bool {
+		return req.Domain == "" || domain == req.Domain
+	})
+
+	id := make([]byte, 6)
+	rand.Read(id)
+	job := &replayJob{
+		ID:        hex.EncodeToString(id),
+		Endpoint:  req.Endpoint,
+		Domain:    req.Domain,
+		From:      req.From,
+		To:        req.To,
+		Status:    replayRunning,
+		StartedAt: now,
+	}
+	job.Scanned = len(events)
+	h.replays.add(job)
+
+	// Audit record
+	logger.LogWithDomain(zapcore.WarnLevel, "Endpoint replay started by operator",
+		zap.String("domain", req.Domain),
+		zap.String("replay", job.ID),
+		zap.String("endpoint", req.Endpoint),
+		zap.Time("from", req.From),
+		zap.Time("to", req.To),
+		zap.Int("events", len(events)),
+		zap.String("reason", req.Reason),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+
+	go h.replayToEndpoint(job, events)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// ReplayRecovered starts an endpoint replay of the events that failed against an endpoint of
+// a domain during its outage, when it delivers again (recovery_replay). The outage window
+// and the number of events are bounded by recovery_replay max_window_minutes and max_events.
+func (h *Handler) ReplayRecovered(recovery forwarder.Recovery) {
+	if h.store == nil || h.forwarder == nil {
+		return
+	}
+	settings := h.forwarder.GetConfig().RecoveryReplay
+	if h.replays.running(recovery.Endpoint, recovery.Domain) {
+		logger.LogWithDomain(zapcore.WarnLevel, "Endpoint recovered while a replay to it is running, not replaying again",
+			zap.String("domain", recovery.Domain),
+			zap.String("endpoint", recovery.Endpoint),
+		)
+		return
+	}
+
+	from := recovery.Since
+	if earliest := recovery.Recovered.Add(-time.Duration(settings.MaxWindowMinutes) * time.Minute); from.Before(earliest) {
+		from = earliest
+	}
+	events := h.store.GetEndpointFailures(recovery.Endpoint, from, recovery.Recovered, func(domain string) bool {
+		return domain == recovery.Domain
+	})
+	skipped := 0
+	if len(events) > settings.MaxEvents {
+		skipped = len(events) - settings.MaxEvents
+		events = events[:settings.MaxEvents]
+	}
+
+	id := make([]byte, 6)
+	rand.Read(id)
+	job := &replayJob{
+		ID:        hex.EncodeToString(id),
+		Endpoint:  recovery.Endpoint,
+		Domain:    recovery.Domain,
+		From:      from,
+		To:        recovery.Recovered,
+		Status:    replayRunning,
+		StartedAt: time.Now(),
+		Trigger:   replayTriggerRecovery,
+		Skipped:   skipped,
+	}
+	job.Scanned = len(events)
+	h.replays.add(job)
+
+	logger.LogWithDomain(zapcore.WarnLevel, "Endpoint recovered, replaying events that failed during the outage",
+		zap.String("domain", recovery.Domain),
+		zap.String("replay", job.ID),
+		zap.String("endpoint", recovery.Endpoint),
+		zap.Time("from", from),
+		zap.Time("to", recovery.Recovered),
+		zap.Int("consecutive_failures", recovery.Failures),
+		zap.Int("events", len(events)),
+		zap.Int("skipped", skipped),
+	)
+
+	go h.replayToEndpoint(job, events)
+}
+
+// replayToEndpoint forwards the events to the job's endpoint one at a time, oldest first,
+// within their domains' max_concurrent limits
+func (h *Handler) replayToEndpoint(job *replayJob, events []store.FailedEvent) {
+	ctx := context.Background()
+	for _, event := range events {
+		jsDelivery := store.Delivery{
+			Attempt:     event.DeliveryAttempt + 1,
+			PublishedAt: event.PublishedAt,
+			Replay:      job.ID,
+			Endpoint:    job.Endpoint,
+		}
+		release, err := h.forwarder.AcquireSlot(ctx, event.Domain)
+		if err == nil {
+			err = h.forwarder.ForwardEvent(ctx, event.Event, event.Domain, jsDelivery)
+			release()
+		}
+		h.replays.update(job, func(job *replayJob) {
+			if err != nil {
+				job.Failed++
+			} else {
+				job.Replayed++
+			}
+		})
+	}
+
+	var replayed, failed int
+	h.replays.update(job, func(job *replayJob) {
+		finished := time.Now()
+		job.FinishedAt = &finished
+		job.Status = replayFinished
+		replayed, failed = job.Replayed, job.Failed
+	})
+	logger.Logger.Info("Endpoint replay finished",
+		zap.String("replay", job.ID),
+		zap.String("endpoint", job.Endpoint),
+		zap.Int("replayed", replayed),
+		zap.Int("failed", failed),
+	)
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// maxRouteBytes bounds the body of a route create or replace request
+const maxRouteBytes = 1 << 20
+
+// HandleRoutes handles POST /api/config/routes - adds a route to the config file and
+// applies it. The body is the route as it would be written in config.yaml, in JSON.
+func (h *Handler) HandleRoutes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.editRoute(w, r, "")
+}
+
+// handleRoute handles PUT and DELETE /api/config/routes/{domain} - replaces or removes a
+// route in the config file and applies the change
+func (h *Handler) handleRoute(w http.ResponseWriter, r *http.Request, domain string) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.editRoute(w, r, domain)
+}
+
+// editRoute adds (POST), replaces (PUT) or deletes (DELETE) a route: the edited config file
+// must load, is written back atomically, and is then reloaded. ?reason= is recorded in the
+// audit log.
+func (h *Handler) editRoute(w http.ResponseWriter, r *http.Request, domain string) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if h.forwarder == nil {
+		http.Error(w, "Forwarder not available", http.StatusInternalServerError)
+		return
+	}
+	if h.configPath == "" {
+		http.Error(w, "Config path not configured", http.StatusInternalServerError)
+		return
+	}
+	if source := h.forwarder.GetConfig().ConfigSource; source.Enabled() {
+		http.Error(w, fmt.Sprintf("Routes are loaded from %s key %s; edit them there", source.Type, source.Key), http.StatusConflict)
+		return
+	}
+
+	// The domain the route has after the edit (POST, or PUT renaming it)
+	newDomain := domain
+	var body []byte
+	if r.Method != http.MethodDelete {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxRouteBytes+1))
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxRouteBytes {
+			http.Error(w, "Route too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		var route map[string]interface{}
+		if err := json.Unmarshal(body, &route); err != nil || route == nil {
+			http.Error(w, "Invalid JSON payload: the route must be an object", http.StatusBadRequest)
+			return
+		}
+		if newDomain, _ = route["domain"].(string); newDomain == "" {
+			http.Error(w, "domain is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Routes of config directory files are owned by whoever maintains the file
+	for _, d := range []string{domain, newDomain} {
+		if route := h.forwarder.GetConfig().GetRoute(d); route != nil && route.File != "" {
+			http.Error(w, fmt.Sprintf("Route %s is defined in config directory file %s; edit it there", d, route.File), http.StatusConflict)
+			return
+		}
+	}
+
+	// One edit at a time, so concurrent edits do not overwrite each other
+	h.routesMu.Lock()
+	defer h.routesMu.Unlock()
+
+	current, err := config.ReadFile(h.configPath)
+	if err != nil {
+		logger.Logger.Error("Failed to read config file for route edit", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var edited []byte
+	action := "deleted"
+	switch r.Method {
+	case http.MethodPost:
+		action = "created"
+		edited, err = config.AddRoute(current, body)
+	case http.MethodPut:
+		action = "replaced"
+		edited, err = config.ReplaceRoute(current, domain, body)
+	default:
+		edited, err = config.DeleteRoute(current, domain)
+	}
+	switch {
+	case errors.Is(err, config.ErrRouteNotFound):
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return
+	case errors.Is(err, config.ErrRouteExists), errors.Is(err, config.ErrRouteDuplicated):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Never write a file that would not load
+	if _, err := config.Parse(edited); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := config.WriteFile(h.configPath, edited); err != nil {
+		logger.Logger.Error("Failed to write config file", zap.String("path", h.configPath), zap.Error(err))
+		http.Error(w, fmt.Sprintf("Failed to write config file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := h.forwarder.ReloadConfig(h.configPath); err != nil {
+		logger.Logger.Error("Failed to reload config after route edit", zap.Error(err))
+		http.Error(w, fmt.Sprintf("Config file written, but failed to reload config: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.config = h.forwarder.GetConfig()
+
+	// Audit record
+	fields := []zap.Field{
+		zap.String("domain", newDomain),
+		zap.String("reason", r.URL.Query().Get("reason")),
+		zap.String("remote_addr", r.RemoteAddr),
+	}
+	if domain != "" && newDomain != domain {
+		fields = append(fields, zap.String("previous_domain", domain))
+	}
+	logger.LogWithDomain(zapcore.WarnLevel, "Route "+action+" by operator", fields...)
+
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(h.config.GetRoute(newDomain))
+}
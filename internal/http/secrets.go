@@ -0,0 +1,85 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"calleventhub/internal/forwarder"
+	"calleventhub/internal/logger"
+)
+
+// secretRotateRequest is the (optional) body of POST /api/config/routes/{domain}/secrets/rotate
+type secretRotateRequest struct {
+	OverlapSeconds *int   `json:"overlap_seconds,omitempty"` // Dual-signing window (default: the route's overlap_seconds; 0 = retire the old secret at once)
+	Reason         string `json:"reason,omitempty"`          // Recorded in the audit log
+}
+
+// handleRotateSecret handles POST /api/config/routes/{domain}/secrets/rotate - generates a
+// new signing secret for the route and returns it, once. Deliveries carry the signatures of
+// both secrets until the overlap ends, then the old secret is retired.
+func (h *Handler) handleRotateSecret(w http.ResponseWriter, r *http.Request, domain string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if h.forwarder == nil {
+		http.Error(w, "Forwarder not available", http.StatusInternalServerError)
+		return
+	}
+
+	var req secretRotateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	var overlap *time.Duration
+	if req.OverlapSeconds != nil {
+		if *req.OverlapSeconds < 0 {
+			http.Error(w, "overlap_seconds must not be negative", http.StatusBadRequest)
+			return
+		}
+		d := time.Duration(*req.OverlapSeconds) * time.Second
+		overlap = &d
+	}
+
+	rotation, err := h.forwarder.RotateSigningSecret(domain, overlap)
+	switch {
+	case errors.Is(err, forwarder.ErrRouteNotFound):
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return
+	case errors.Is(err, forwarder.ErrSigningNotConfigured):
+		http.Error(w, "Route has no signing configured", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Audit record (never the secret itself)
+	fields := []zap.Field{
+		zap.String("domain", domain),
+		zap.String("header", rotation.Header),
+		zap.String("reason", req.Reason),
+		zap.String("remote_addr", r.RemoteAddr),
+	}
+	if !rotation.PreviousUntil.IsZero() {
+		fields = append(fields, zap.Time("previous_until", rotation.PreviousUntil))
+	}
+	logger.LogWithDomain(zapcore.WarnLevel, "Signing secret rotated by operator", fields...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rotation)
+}
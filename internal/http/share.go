@@ -0,0 +1,294 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+)
+
+// Kinds of shared content
+const (
+	shareCall = "call" // One call's timeline, as returned by /api/calls
+	shareLogs = "logs" // A slice of one domain's log file
+)
+
+// shareClaims is what a share link grants access to; it is signed, not encrypted
+type shareClaims struct {
+	Kind    string `json:"k"`
+	CallID  string `json:"c,omitempty"`
+	Domain  string `json:"d,omitempty"`
+	Date    string `json:"t,omitempty"` // Log file date (logs)
+	Since   int64  `json:"s,omitempty"` // Unix seconds, 0 = start of the file (logs)
+	Until   int64  `json:"u,omitempty"` // Unix seconds, 0 = end of the file (logs)
+	Expires int64  `json:"e"`
+}
+
+// shareRequest is the body of POST /api/share
+type shareRequest struct {
+	Kind       string     `json:"kind"`
+	CallID     string     `json:"call_id,omitempty"`
+	Domain     string     `json:"domain,omitempty"`
+	Date       string     `json:"date,omitempty"` // YYYY-MM-DD, default today (logs)
+	Since      *time.Time `json:"since,omitempty"`
+	Until      *time.Time `json:"until,omitempty"`
+	TTLSeconds int        `json:"ttl_seconds,omitempty"`
+}
+
+// claims validates the request and returns the claims of the link it asks for
+func (req *shareRequest) claims(defaultTTL, maxTTL int) (shareClaims, error) {
+	c := shareClaims{Kind: req.Kind, CallID: req.CallID, Domain: req.Domain}
+	switch req.Kind {
+	case shareCall:
+		if req.CallID == "" {
+			return c, fmt.Errorf("call_id is required")
+		}
+	case shareLogs:
+		if req.Domain == "" {
+			return c, fmt.Errorf("domain is required")
+		}
+		c.Date = req.Date
+		if c.Date == "" {
+			c.Date = time.Now().Format("2006-01-02")
+		}
+		if _, err := time.Parse("2006-01-02", c.Date); err != nil {
+			return c, fmt.Errorf("date must be YYYY-MM-DD")
+		}
+		if req.Since != nil {
+			c.Since = req.Since.Unix()
+		}
+		if req.Until != nil {
+			c.Until = req.Until.Unix()
+		}
+		if c.Since != 0 && c.Until != 0 && c.Until < c.Since {
+			return c, fmt.Errorf("until must not be before since")
+		}
+	default:
+		return c, fmt.Errorf("kind must be %s or %s", shareCall, shareLogs)
+	}
+
+	ttl := req.TTLSeconds
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	if ttl < 0 || ttl > maxTTL {
+		return c, fmt.Errorf("ttl_seconds must be between 1 and %d", maxTTL)
+	}
+	c.Expires = time.Now().Add(time.Duration(ttl) * time.Second).Unix()
+	return c, nil
+}
+
+// signShare encodes the claims as a token: base64url(claims) "." base64url(HMAC-SHA256)
+func signShare(c shareClaims, secret string) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(shareMAC(encoded, secret)), nil
+}
+
+// verifyShare returns the claims of a token signed with secret that has not expired
+func verifyShare(token, secret string) (shareClaims, error) {
+	var c shareClaims
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, fmt.Errorf("malformed link")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, shareMAC(encoded, secret)) {
+		return c, fmt.Errorf("invalid signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return c, fmt.Errorf("malformed link")
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, fmt.Errorf("malformed link")
+	}
+	if time.Now().Unix() >= c.Expires {
+		return c, fmt.Errorf("link expired")
+	}
+	return c, nil
+}
+
+// shareMAC returns the HMAC-SHA256 of an encoded token payload
+func shareMAC(encoded, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// HandleCreateShare handles POST /api/share - issues a signed, time-limited link to one
+// call's timeline or a slice of a domain's logs (admin only). Anyone holding the link can
+// read it until it expires, without an API token.
+func (h *Handler) HandleCreateShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	settings := h.currentConfig().Server.ShareLinks
+	if settings.Secret == "" {
+		http.Error(w, "Share links are disabled (server.share_links.secret is not set)", http.StatusNotFound)
+		return
+	}
+
+	var req shareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	claims, err := req.claims(settings.DefaultTTLSeconds, settings.MaxTTLSeconds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token, err := signShare(claims, settings.Secret)
+	if err != nil {
+		http.Error(w, "Failed to sign link", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Unix(claims.Expires, 0)
+	logger.Logger.Info("Share link issued by operator",
+		zap.String("kind", claims.Kind),
+		zap.String("call_id", claims.CallID),
+		zap.String("domain", claims.Domain),
+		zap.String("date", claims.Date),
+		zap.Time("expires_at", expiresAt),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+
+	path := "/shared/" + token
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":        requestBaseURL(r) + path,
+		"path":       path,
+		"expires_at": expiresAt,
+	})
+}
+
+// HandleShared handles GET /shared/{token} - the content of a share link, without authentication
+func (h *Handler) HandleShared(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := h.currentConfig().Server.ShareLinks.Secret
+	if secret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	claims, err := verifyShare(strings.TrimPrefix(r.URL.Path, "/shared/"), secret)
+	if err != nil {
+		// Same answer for forged and expired links
+		http.Error(w, "Link is invalid or has expired", http.StatusNotFound)
+		return
+	}
+
+	var content map[string]interface{}
+	switch claims.Kind {
+	case shareCall:
+		content, err = h.sharedCall(claims)
+	case shareLogs:
+		content, err = h.sharedLogs(claims)
+	default:
+		http.Error(w, "Link is invalid or has expired", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content["expires_at"] = time.Unix(claims.Expires, 0)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(content)
+}
+
+// sharedCall returns the timeline of a shared call and its correlated legs, limited to the
+// link's domain if it names one
+func (h *Handler) sharedCall(c shareClaims) (map[string]interface{}, error) {
+	if h.store == nil {
+		return nil, fmt.Errorf("Event store not available")
+	}
+	correlationID, callIDs := c.CallID, []string{c.CallID}
+	if h.forwarder != nil {
+		correlationID, callIDs = h.forwarder.CorrelatedCalls(c.CallID)
+	}
+	events, failedEvents := h.store.GetEventsByCallIDs(callIDs, func(domain string) bool {
+		return c.Domain == "" || domain == c.Domain
+	})
+
+	// Only list the legs the link shows
+	visible := map[string]bool{c.CallID: true}
+	for _, event := range events {
+		visible[event.CallID] = true
+	}
+	for _, event := range failedEvents {
+		visible[event.CallID] = true
+	}
+	legs := make([]string, 0, len(visible))
+	for _, id := range callIDs {
+		if visible[id] {
+			legs = append(legs, id)
+		}
+	}
+	return map[string]interface{}{
+		"correlation_id": correlationID,
+		"call_ids":       legs,
+		"events":         events,
+		"failed_events":  failedEvents,
+	}, nil
+}
+
+// sharedLogs returns the entries of a shared log slice
+func (h *Handler) sharedLogs(c shareClaims) (map[string]interface{}, error) {
+	entries, err := h.readLogsFromFile("logs", c.Domain, c.Date)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read logs: %v", err)
+	}
+
+	slice := make([]LogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if c.Since != 0 || c.Until != 0 {
+			at := getTimestampFromEvent(entry.Fields)
+			if at.IsZero() || (c.Since != 0 && at.Unix() < c.Since) || (c.Until != 0 && at.Unix() > c.Until) {
+				continue
+			}
+		}
+		slice = append(slice, entry)
+	}
+	return map[string]interface{}{
+		"domain": c.Domain,
+		"date":   c.Date,
+		"logs":   slice,
+		"count":  len(slice),
+	}, nil
+}
+
+// requestBaseURL returns the scheme and host the request was sent to, honouring a TLS-terminating proxy
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,178 @@
+package http
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+	"calleventhub/internal/store"
+)
+
+// Pipeline states of the public status page
+const (
+	pipelineUp       = "up"       // Ready
+	pipelineDegraded = "degraded" // Running, but readiness policy exceeded (lag, failing endpoints, draining)
+	pipelineDown     = "down"     // NATS disconnected or a consumer stopped fetching
+)
+
+// Domain forwarding states of the public status page
+const (
+	domainGreen  = "green"  // Last deliveries succeeded
+	domainYellow = "yellow" // Some endpoints failing, or the domain is lagging or its ingest rate is unusual
+	domainRed    = "red"    // Every recently used endpoint is failing, or forwarding is paused by the domain circuit
+)
+
+// domainStatus is the forwarding state of one domain on the status page
+type domainStatus struct {
+	Domain string `json:"domain"`
+	Status string `json:"status"`
+}
+
+// publicStatus is the /status report. It must never carry call data, endpoint URLs or error details.
+type publicStatus struct {
+	Pipeline  string         `json:"pipeline"`
+	Domains   []domainStatus `json:"domains"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// HandleStatus handles GET /status - the public status page, without authentication,
+// when server.status_page is enabled. Browsers get an HTML page; ?format=json (or an
+// Accept header without text/html) returns the report as JSON.
+func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := h.currentConfig()
+	if cfg == nil || !cfg.Server.StatusPage.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "json" && (format == "html" || strings.Contains(r.Header.Get("Accept"), "text/html")) {
+		h.serveStatusPage(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.publicStatus(cfg))
+}
+
+// serveStatusPage writes the embedded status page, which polls /status?format=json
+func (h *Handler) serveStatusPage(w http.ResponseWriter) {
+	htmlFS, err := fs.Sub(webAssets, "web")
+	if err != nil {
+		logger.Logger.Error("Failed to read status page HTML", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	htmlContent, err := fs.ReadFile(htmlFS, "status.html")
+	if err != nil {
+		logger.Logger.Error("Failed to read status page HTML", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(htmlContent)
+}
+
+// publicStatus evaluates the pipeline and the listed domains
+func (h *Handler) publicStatus(cfg *config.Config) publicStatus {
+	report := publicStatus{Pipeline: pipelineUp, Domains: []domainStatus{}, UpdatedAt: time.Now()}
+
+	readiness := h.checkReadiness(false)
+	if len(readiness.Reasons) > 0 {
+		report.Pipeline = pipelineDegraded
+	}
+	for _, p := range readiness.Publishers {
+		if !p.Connected {
+			report.Pipeline = pipelineDown
+		}
+	}
+	for _, c := range readiness.Consumers {
+		if !c.Fetching {
+			report.Pipeline = pipelineDown
+		}
+	}
+
+	domains := cfg.Server.StatusPage.Domains
+	if len(domains) == 0 {
+		for _, route := range cfg.Routes {
+			domains = append(domains, route.Domain)
+		}
+	}
+	listed := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		listed[domain] = true
+	}
+
+	// Endpoints used within the window, and those whose last delivery failed
+	type endpointCounts struct{ total, failing int }
+	endpoints := make(map[string]*endpointCounts)
+	if h.store != nil {
+		since := time.Now().Add(-time.Duration(cfg.Server.StatusPage.WindowSeconds) * time.Second)
+		for _, m := range h.store.GetSinkMetrics(func(d string) bool { return listed[d] }) {
+			if m.LastResultAt.Before(since) {
+				continue
+			}
+			counts, ok := endpoints[m.Domain]
+			if !ok {
+				counts = &endpointCounts{}
+				endpoints[m.Domain] = counts
+			}
+			counts.total++
+			if m.LastStatus == store.ResultFailed {
+				counts.failing++
+			}
+		}
+	}
+
+	// Lag alarms and ingest anomalies turn a domain yellow, an open circuit turns it red
+	warned := make(map[string]bool)
+	paused := make(map[string]bool)
+	for _, lag := range h.visibleLag(nil) {
+		for _, d := range lag.Domains {
+			if d.Alarm {
+				warned[d.Domain] = true
+			}
+		}
+		for _, c := range lag.Circuits {
+			paused[c.Domain] = true
+		}
+	}
+	if h.anomalies != nil {
+		for _, s := range h.anomalies.States(func(d string) bool { return listed[d] }) {
+			if s.Anomaly != "" {
+				warned[s.Domain] = true
+			}
+		}
+	}
+
+	for domain := range listed {
+		status := domainGreen
+		counts := endpoints[domain]
+		switch {
+		case paused[domain], counts != nil && counts.failing > 0 && counts.failing == counts.total:
+			status = domainRed
+		case counts != nil && counts.failing > 0, warned[domain]:
+			status = domainYellow
+		}
+		report.Domains = append(report.Domains, domainStatus{Domain: domain, Status: status})
+	}
+	sort.Slice(report.Domains, func(i, j int) bool { return report.Domains[i].Domain < report.Domains[j].Domain })
+	return report
+}
@@ -0,0 +1,184 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/nats"
+)
+
+// tenantScope restricts a request to the domains of a single tenant or API token
+// A nil scope means unrestricted access (no auth configured or admin token)
+type tenantScope struct {
+	domains []string
+	tenant  *config.Tenant // Set in isolation mode, where the tenant has its own stream
+}
+
+// allows reports whether the scope may access the domain
+func (s *tenantScope) allows(domain string) bool {
+	if s == nil {
+		return true
+	}
+	for _, d := range s.domains {
+		if d == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// streamName returns the stream holding the scope's events
+func (s *tenantScope) streamName(base string) string {
+	if s.tenant == nil {
+		return base
+	}
+	return s.tenant.StreamName(base)
+}
+
+// allowsLogDir reports whether the scope may access a sanitized log directory name
+func (s *tenantScope) allowsLogDir(dir string) bool {
+	if s == nil {
+		return true
+	}
+	for _, domain := range s.domains {
+		if sanitizeDomain(domain) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTenantPublishers sets the per-tenant publishers used in isolation mode (keyed by tenant name)
+func (h *Handler) SetTenantPublishers(publishers map[string]*nats.Publisher) {
+	h.tenantPublishers = publishers
+}
+
+// currentConfig returns the latest configuration (may have been reloaded)
+func (h *Handler) currentConfig() *config.Config {
+	if h.forwarder != nil {
+		if cfg := h.forwarder.GetConfig(); cfg != nil {
+			return cfg
+		}
+	}
+	return h.config
+}
+
+// authorize resolves the scope of a request when isolation or auth is enabled
+// Writes 401 and returns ok=false if the token is missing or unknown
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) (*tenantScope, bool) {
+	cfg := h.currentConfig()
+	if cfg == nil || (!cfg.Isolation.Enabled && !cfg.Server.Auth.Enabled) {
+		return nil, true
+	}
+
+	token := requestToken(r)
+	if token == "" {
+		http.Error(w, "Missing API token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if cfg.Isolation.Enabled {
+		if cfg.Isolation.AdminToken != "" && tokensEqual(token, cfg.Isolation.AdminToken) {
+			return nil, true
+		}
+		for i := range cfg.Isolation.Tenants {
+			tenant := &cfg.Isolation.Tenants[i]
+			if tokensEqual(token, tenant.Token) {
+				return &tenantScope{domains: tenant.Domains, tenant: tenant}, true
+			}
+		}
+	} else {
+		if cfg.Server.Auth.AdminToken != "" && tokensEqual(token, cfg.Server.Auth.AdminToken) {
+			return nil, true
+		}
+		for _, apiToken := range cfg.Server.Auth.Tokens {
+			if tokensEqual(token, apiToken.Token) {
+				return &tenantScope{domains: apiToken.Domains}, true
+			}
+		}
+	}
+
+	http.Error(w, "Invalid API token", http.StatusUnauthorized)
+	return nil, false
+}
+
+// requireAdmin rejects tenant-scoped requests for operations that affect all tenants
+func (h *Handler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	scope, ok := h.authorize(w, r)
+	if !ok {
+		return false
+	}
+	if scope != nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// requireStream rejects requests that read or write the JetStream stream when the
+// publisher has none (the in-process queue of dev mode)
+func requireStream(w http.ResponseWriter, publisher *nats.Publisher) bool {
+	if publisher.GetJetStream() == nil {
+		http.Error(w, "Not available in dev mode (no JetStream stream)", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
+
+// publisherForDomain returns the publisher for a domain's events
+// In isolation mode this is the owning tenant's publisher, or nil if none exists
+func (h *Handler) publisherForDomain(domain string) *nats.Publisher {
+	cfg := h.currentConfig()
+	if cfg == nil || !cfg.Isolation.Enabled {
+		return h.publisher
+	}
+
+	tenant := cfg.TenantForDomain(domain)
+	if tenant == nil {
+		return nil
+	}
+	return h.tenantPublishers[tenant.Name]
+}
+
+// requestToken extracts the API token from the Authorization header or the token query parameter
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return r.URL.Query().Get("token")
+}
+
+// tokensEqual compares tokens in constant time
+func tokensEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// filterRoutes returns the routes visible to the scope
+func filterRoutes(routes []config.Route, scope *tenantScope) []config.Route {
+	if scope == nil {
+		return routes
+	}
+	filtered := make([]config.Route, 0, len(routes))
+	for _, route := range routes {
+		if scope.allows(route.Domain) {
+			filtered = append(filtered, route)
+		}
+	}
+	return filtered
+}
+
+// filterLogDomains returns the log domain listings visible to the scope
+func filterLogDomains(domains []map[string]interface{}, scope *tenantScope) []map[string]interface{} {
+	if scope == nil {
+		return domains
+	}
+	filtered := make([]map[string]interface{}, 0, len(domains))
+	for _, d := range domains {
+		if dir, ok := d["domain"].(string); ok && scope.allowsLogDir(dir) {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
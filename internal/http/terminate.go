@@ -0,0 +1,152 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	natsgo "github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"calleventhub/internal/logger"
+	"calleventhub/internal/nats"
+)
+
+// terminateRequest is the optional body of a terminate request
+type terminateRequest struct {
+	Reason string `json:"reason"`
+	Delete bool   `json:"delete"` // Also delete the message from the stream
+}
+
+// SetConsumers sets the consumers whose messages can be terminated via the admin API
+func (h *Handler) SetConsumers(consumers []*nats.Consumer) {
+	h.consumers = consumers
+}
+
+// HandleStreamMessage handles POST /api/stream/messages/{seq}/terminate - permanently drops a
+// poison message: the consumer terminates it (JetStream Term) on its next delivery instead
+// of waiting for max_deliveries, and a copy is kept in the quarantine
+func (h *Handler) HandleStreamMessage(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/stream/messages/"), "/")
+	if len(parts) != 2 || parts[1] != "terminate" {
+		http.NotFound(w, r)
+		return
+	}
+	seq, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || seq == 0 {
+		http.Error(w, "Invalid sequence", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var req terminateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Admins pick a tenant's stream with ?tenant=
+	publisher := h.publisher
+	if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+		publisher = h.tenantPublishers[tenant]
+	}
+	if publisher == nil {
+		http.Error(w, "NATS publisher not available", http.StatusInternalServerError)
+		return
+	}
+	if !requireStream(w, publisher) {
+		return
+	}
+
+	js := publisher.GetJetStream()
+	streamName := publisher.GetStreamName()
+
+	raw, err := js.GetMsg(streamName, seq)
+	if errors.Is(err, natsgo.ErrMsgNotFound) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read message: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := nats.DecodePayload(&natsgo.Msg{Header: raw.Header, Data: raw.Data})
+	if err != nil {
+		data = raw.Data
+	}
+	var event struct {
+		CallID     string `json:"call_id"`
+		HubEventID string `json:"hub_event_id"`
+		Domain     string `json:"domain"`
+	}
+	_ = json.Unmarshal(data, &event)
+
+	marked := 0
+	for _, c := range h.consumers {
+		if c.StreamName() == streamName {
+			c.TerminateOnDelivery(seq)
+			marked++
+		}
+	}
+	if marked == 0 && !req.Delete {
+		http.Error(w, "No consumer for this stream on this instance; use \"delete\": true", http.StatusConflict)
+		return
+	}
+
+	// Other instances sharing the consumer may receive it next - deleting reaches them too
+	if req.Delete {
+		if err := js.DeleteMsg(streamName, seq); err != nil && !errors.Is(err, natsgo.ErrMsgNotFound) {
+			http.Error(w, fmt.Sprintf("Failed to delete message: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	reason := "terminated by operator"
+	if req.Reason != "" {
+		reason += ": " + req.Reason
+	}
+	if h.store != nil {
+		// Non-JSON payloads are kept as a JSON string
+		stored := json.RawMessage(data)
+		if !json.Valid(data) {
+			stored, _ = json.Marshal(string(data))
+		}
+		h.store.AddQuarantinedEvent(stored, nil, event.Domain, event.CallID, 0, reason, nil)
+	}
+
+	// Audit record
+	logger.LogWithDomain(zapcore.WarnLevel, "Stream message terminated by operator",
+		zap.String("domain", event.Domain),
+		zap.String("call_id", event.CallID),
+		zap.String("hub_event_id", event.HubEventID),
+		zap.String("stream", streamName),
+		zap.Uint64("sequence", seq),
+		zap.String("reason", req.Reason),
+		zap.Bool("deleted", req.Delete),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "terminating",
+		"stream":   streamName,
+		"sequence": seq,
+		"deleted":  req.Delete,
+	})
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"calleventhub/internal/config"
+)
+
+// maxValidateBytes bounds the configuration accepted by POST /api/config/validate
+const maxValidateBytes = 4 << 20
+
+// validateResponse is the result of validating a configuration
+type validateResponse struct {
+	Valid    bool             `json:"valid"`
+	Error    string           `json:"error,omitempty"`
+	Warnings []config.Warning `json:"warnings"`
+}
+
+// HandleValidateConfig handles /api/config/validate - validates and lints a configuration
+// without applying it. GET checks the config file (what a reload would apply); POST checks
+// the YAML in the request body.
+func (h *Handler) HandleValidateConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var warnings []config.Warning
+	var err error
+	if r.Method == http.MethodPost {
+		data, readErr := io.ReadAll(io.LimitReader(r.Body, maxValidateBytes+1))
+		if readErr != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if len(data) > maxValidateBytes {
+			http.Error(w, "Configuration too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		var cfg *config.Config
+		if cfg, err = config.Parse(data); err == nil {
+			warnings = cfg.Lint()
+		}
+	} else {
+		if h.configPath == "" {
+			http.Error(w, "Config path not configured", http.StatusInternalServerError)
+			return
+		}
+		configDir := ""
+		if h.forwarder != nil {
+			configDir = h.forwarder.ConfigDir()
+		}
+		warnings, err = config.LintFile(h.configPath, configDir)
+	}
+
+	response := validateResponse{Valid: err == nil, Warnings: warnings}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	if response.Warnings == nil {
+		response.Warnings = []config.Warning{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
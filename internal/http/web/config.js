@@ -1,4 +1,17 @@
 // Config Viewer JavaScript Logic (jQuery)
+
+// API token for multi-tenant isolation mode (?token=... is remembered for later visits)
+(function() {
+    const params = new URLSearchParams(window.location.search);
+    if (params.get('token')) {
+        localStorage.setItem('apiToken', params.get('token'));
+    }
+    const token = localStorage.getItem('apiToken');
+    if (token) {
+        $.ajaxSetup({ headers: { 'Authorization': 'Bearer ' + token } });
+    }
+})();
+
 function loadConfig() {
     const $loading = $('#loading');
     const $container = $('#configContainer');
@@ -44,7 +57,7 @@ function loadConfig() {
                         <div class="endpoints-list">
                             ${endpoints.length > 0 
                                 ? endpoints.map(function(endpoint) {
-                                    return `<div class="endpoint-item"><i class="fas fa-link"></i> ${escapeHtml(endpoint)}</div>`;
+                                    return `<div class="endpoint-item"><i class="fas fa-link"></i> ${escapeHtml(endpointLabel(endpoint))}</div>`;
                                 }).join('')
                                 : '<div class="endpoint-item" style="color: #999; font-style: italic;"><i class="fas fa-exclamation-circle"></i> No endpoints configured</div>'
                             }
@@ -104,6 +117,27 @@ function reloadConfig() {
     });
 }
 
+// HTTP endpoints are plain URLs (objects if disabled or weighted); other sinks are objects with a type
+function endpointLabel(endpoint) {
+    if (typeof endpoint === 'string') {
+        return endpoint;
+    }
+    let state = '';
+    if (endpoint.disabled) state += ' [disabled]';
+    if (endpoint.weight) state += ` [weight ${endpoint.weight}%]`;
+    if (endpoint.type === 'http') {
+        return endpoint.url + state;
+    }
+    if (endpoint.type === 'mqtt') {
+        return `mqtt: ${endpoint.broker} → ${endpoint.topic} (QoS ${endpoint.qos || 0})${state}`;
+    }
+    const settings = Object.assign({}, endpoint);
+    delete settings.type;
+    delete settings.disabled;
+    delete settings.weight;
+    return `${endpoint.type}: ${JSON.stringify(settings)}${state}`;
+}
+
 function escapeHtml(text) {
     const map = {
         '&': '&amp;',
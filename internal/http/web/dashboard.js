@@ -1,7 +1,24 @@
 // Dashboard JavaScript Logic (jQuery)
+
+// API token for multi-tenant isolation mode (?token=... is remembered for later visits)
+(function() {
+    const params = new URLSearchParams(window.location.search);
+    if (params.get('token')) {
+        localStorage.setItem('apiToken', params.get('token'));
+    }
+    const token = localStorage.getItem('apiToken');
+    if (token) {
+        $.ajaxSetup({ headers: { 'Authorization': 'Bearer ' + token } });
+    }
+})();
+
 let autoRefreshInterval = null;
 let currentTab = 'success';
 
+// Client-side copy of the last full load, kept in sync via /api/events/delta
+let eventCache = null;
+const MAX_CACHED_EVENTS_PER_DOMAIN = 10000;
+
 function formatTime(timestamp) {
     const date = new Date(timestamp);
     return date.toLocaleString('vi-VN', {
@@ -25,6 +42,24 @@ function formatRelativeTime(timestamp) {
     return `${Math.floor(diff / 86400)} ngày trước`;
 }
 
+// Time from publishing to the outcome, across all delivery attempts (e.g. " trong 21 giây")
+function formatElapsed(event) {
+    if (!event.elapsed_seconds) return '';
+    const secs = event.elapsed_seconds;
+    if (secs < 1) return ` trong ${Math.round(secs * 1000)} ms`;
+    if (secs < 60) return ` trong ${Math.round(secs)} giây`;
+    if (secs < 3600) return ` trong ${Math.floor(secs / 60)} phút ${Math.round(secs % 60)} giây`;
+    return ` trong ${(secs / 3600).toFixed(1)} giờ`;
+}
+
+// Tooltip with the JetStream delivery metadata of a stored event
+function deliveryTitle(event) {
+    const parts = [];
+    if (event.published_at && !event.published_at.startsWith('0001-')) parts.push(`Published: ${formatTime(event.published_at)}`);
+    if (event.num_pending !== undefined) parts.push(`Pending at delivery: ${event.num_pending}`);
+    return parts.join('\n');
+}
+
 function getStateBadge(state) {
     const badges = {
         'answered': '<span class="badge badge-success"><i class="fas fa-check-circle"></i> Answered</span>',
@@ -132,7 +167,7 @@ function renderEvents(eventsByDomain, failedEventsByDomain) {
                                     </div>
                                     <div class="event-detail">
                                         <div class="event-detail-label">Attempt</div>
-                                        <div class="event-detail-value">#${event.delivery_attempt}</div>
+                                        <div class="event-detail-value" title="${deliveryTitle(event)}">#${event.delivery_attempt}${formatElapsed(event)}</div>
                                     </div>
                                 </div>
                                 ${event.endpoints && event.endpoints.length > 0 ? `
@@ -185,6 +220,7 @@ function renderEvents(eventsByDomain, failedEventsByDomain) {
                                     <div class="event-call-id">
                                         <i class="fas fa-phone"></i> ${event.call_id || 'N/A'}
                                         ${willRetry ? '<span class="badge badge-warning" style="margin-left: 8px;"><i class="fas fa-redo"></i> Will Retry</span>' : ''}
+                                        ${event.at_most_once ? '<span class="badge badge-info" style="margin-left: 8px;" title="delivery: at_most_once - not retried"><i class="fas fa-ban"></i> Dropped</span>' : ''}
                                     </div>
                                     <div class="event-time" title="${formatTime(event.failed_at)}">
                                         <i class="fas fa-clock"></i> ${formatRelativeTime(event.failed_at)}
@@ -205,7 +241,7 @@ function renderEvents(eventsByDomain, failedEventsByDomain) {
                                     </div>
                                     <div class="event-detail">
                                         <div class="event-detail-label">Attempt</div>
-                                        <div class="event-detail-value">${attemptDisplay}</div>
+                                        <div class="event-detail-value" title="${deliveryTitle(event)}">${attemptDisplay}${formatElapsed(event)}</div>
                                     </div>
                                 </div>
                                 ${event.error || (event.error_messages && event.error_messages.length > 0) ? `
@@ -215,6 +251,12 @@ function renderEvents(eventsByDomain, failedEventsByDomain) {
                                         ${event.error_messages ? event.error_messages.map(err => `<div class="error-message">${err}</div>`).join('') : ''}
                                     </div>
                                 ` : ''}
+                                ${event.attempts && event.attempts.length > 1 ? `
+                                    <div class="error-messages">
+                                        <strong style="font-size: 12px; color: #721c24;"><i class="fas fa-history"></i> Attempts:</strong>
+                                        ${event.attempts.map(a => `<div class="error-message" title="${formatTime(a.failed_at)}">#${a.attempt} ${formatRelativeTime(a.failed_at)} - ${(a.endpoints || []).join(', ') || 'no endpoint'}: ${(a.error_messages || []).join('; ')}</div>`).join('')}
+                                    </div>
+                                ` : ''}
                                 ${event.endpoints && event.endpoints.length > 0 ? `
                                     <div class="endpoints-list">
                                         <strong style="font-size: 12px; color: #6c757d;"><i class="fas fa-server"></i> Endpoints:</strong>
@@ -237,14 +279,8 @@ function renderEvents(eventsByDomain, failedEventsByDomain) {
     `);
 }
 
-function loadEvents() {
-    const $loading = $('#loading');
+function eventQueryParams() {
     const domainFilter = $('#domainFilter').val();
-
-    $loading.show();
-
-    // Read from in-memory store
-    let url = '/api/events';
     const params = new URLSearchParams();
     if (domainFilter) {
         params.append('domain', domainFilter);
@@ -252,9 +288,83 @@ function loadEvents() {
     if (currentTab !== 'all') {
         params.append('type', currentTab);
     }
-    
-    if (params.toString()) {
-        url += '?' + params.toString();
+    return params;
+}
+
+function updateStats(stats) {
+    if (stats) {
+        $('#totalSuccessful').text(stats.total_successful || 0);
+        $('#totalFailed').text(stats.total_failed || 0);
+        $('#retryCount').text(stats.retry_count || 0);
+        $('#droppedCount').text(stats.dropped_count ? `${stats.dropped_count} dropped (at-most-once)` : '');
+        $('#totalDomains').text(stats.domains || 0);
+    }
+}
+
+function appendByDomain(target, events) {
+    (events || []).forEach(event => {
+        let list = target[event.domain] || (target[event.domain] = []);
+        if (event.supersedes) {
+            // A new attempt of a failed event replaces the record of its earlier attempts
+            list = target[event.domain] = list.filter(e => e.id !== event.supersedes);
+        }
+        list.push(event);
+        if (list.length > MAX_CACHED_EVENTS_PER_DOMAIN) {
+            list.splice(0, list.length - MAX_CACHED_EVENTS_PER_DOMAIN);
+        }
+    });
+}
+
+// Fetch only events added since the last load and merge them into the cache
+function pollDelta() {
+    const params = eventQueryParams();
+    if (!eventCache || eventCache.query !== params.toString()) {
+        loadEvents();
+        return;
+    }
+    params.append('cursor', eventCache.cursor);
+
+    $.ajax({
+        url: '/api/events/delta?' + params.toString(),
+        method: 'GET',
+        dataType: 'json',
+        success: function(data) {
+            if (data.truncated) {
+                // Cursor is no longer valid - fall back to a full reload
+                loadEvents();
+                return;
+            }
+
+            appendByDomain(eventCache.events, data.events);
+            appendByDomain(eventCache.failed, data.failed_events);
+            eventCache.cursor = data.cursor;
+
+            updateStats(data.stats);
+            if ((data.events || []).length > 0 || (data.failed_events || []).length > 0) {
+                renderEvents(eventCache.events, eventCache.failed);
+            }
+            if (data.has_more) {
+                pollDelta();
+            }
+        },
+        error: function(xhr, status, error) {
+            console.error('Error polling event delta:', error);
+        }
+    });
+}
+
+function loadEvents() {
+    const $loading = $('#loading');
+
+    $loading.show();
+
+    // Read from in-memory store
+    let url = '/api/events';
+    const params = eventQueryParams();
+    const query = params.toString();
+
+    if (query) {
+        url += '?' + query;
     }
     
     $.ajax({
@@ -273,15 +383,18 @@ function loadEvents() {
             }
 
             // Update stats
-            if (data.stats) {
-                $('#totalSuccessful').text(data.stats.total_successful || 0);
-                $('#totalFailed').text(data.stats.total_failed || 0);
-                $('#retryCount').text(data.stats.retry_count || 0);
-                $('#totalDomains').text(data.stats.domains || 0);
-            }
+            updateStats(data.stats);
+
+            // Remember the snapshot so auto-refresh only fetches new events
+            eventCache = {
+                query: query,
+                cursor: data.cursor || 0,
+                events: data.events_by_domain || {},
+                failed: data.failed_events_by_domain || {}
+            };
 
             // Render events
-            renderEvents(data.events_by_domain || {}, data.failed_events_by_domain || {});
+            renderEvents(eventCache.events, eventCache.failed);
         },
         error: function(xhr, status, error) {
             console.error('Error loading events:', error);
@@ -313,7 +426,7 @@ function toggleAutoRefresh() {
     const $checkbox = $('#autoRefresh');
     
     if ($checkbox.is(':checked')) {
-        autoRefreshInterval = setInterval(loadEvents, 5000); // Refresh every 5 seconds
+        autoRefreshInterval = setInterval(pollDelta, 5000); // Poll for new events every 5 seconds
     } else {
         if (autoRefreshInterval) {
             clearInterval(autoRefreshInterval);
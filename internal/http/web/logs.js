@@ -1,4 +1,17 @@
 // Log Viewer JavaScript Logic (jQuery)
+
+// API token for multi-tenant isolation mode (?token=... is remembered for later visits)
+(function() {
+    const params = new URLSearchParams(window.location.search);
+    if (params.get('token')) {
+        localStorage.setItem('apiToken', params.get('token'));
+    }
+    const token = localStorage.getItem('apiToken');
+    if (token) {
+        $.ajaxSetup({ headers: { 'Authorization': 'Bearer ' + token } });
+    }
+})();
+
 let autoRefreshInterval = null;
 
 function escapeHtml(text) {
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -21,15 +22,40 @@ type DomainLoggerManager struct {
 	baseDir       string
 	level         zapcore.Level
 	encoder       zapcore.Encoder
-	loggers       map[string]*zap.Logger // key: domain-date (e.g., "domain.com-2026-01-04")
+	loggers       map[string]*zap.Logger        // key: domain-date (e.g., "domain.com-2026-01-04")
+	files         map[string]*lumberjack.Logger // Log file of each logger, by the same key
 	mu            sync.RWMutex
 	cleanupTicker *time.Ticker
 	stopCleanup   chan bool
+
+	// How long log files are kept (see SetRetention)
+	retention      RetentionPolicy
+	retentionByDir map[string]RetentionPolicy // By sanitized domain
 }
 
 var domainLoggerManager *DomainLoggerManager
 var domainLoggerOnce sync.Once
 
+// instanceFields are added to every log entry (see SetInstance)
+var instanceFields []zap.Field
+
+// logFilesVersion changes whenever a domain log file is opened, so listings of the log
+// directory know they may be out of date
+var logFilesVersion atomic.Uint64
+
+// LogFilesVersion returns a number that changes whenever a domain log file may have been created
+func LogFilesVersion() uint64 {
+	return logFilesVersion.Load()
+}
+
+// LogsDir returns the directory domain log files are written to ("" if domain logging is disabled)
+func LogsDir() string {
+	if domainLoggerManager == nil {
+		return ""
+	}
+	return domainLoggerManager.baseDir
+}
+
 // localTimeEncoder encodes time in local timezone with ISO8601 format
 func localTimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 	// Convert to local timezone
@@ -111,6 +137,7 @@ func Init(level string, logFile string, enableDomainLogging bool) error {
 				level:       zapLevel,
 				encoder:     encoder,
 				loggers:     make(map[string]*zap.Logger),
+				files:       make(map[string]*lumberjack.Logger),
 				stopCleanup: make(chan bool),
 			}
 
@@ -123,10 +150,27 @@ func Init(level string, logFile string, enableDomainLogging bool) error {
 	core := zapcore.NewTee(cores...)
 
 	logger := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
-	Logger = logger
+	Logger = logger.With(instanceFields...)
 	return nil
 }
 
+// SetInstance adds the instance ID to every later log entry, including domain log files,
+// so the logs of several instances can be merged. Call it once, right after Init.
+func SetInstance(instanceID string) {
+	if instanceID == "" || len(instanceFields) > 0 {
+		return
+	}
+	instanceFields = []zap.Field{zap.String("instance_id", instanceID)}
+	Logger = Logger.With(instanceFields...)
+	if dlm := domainLoggerManager; dlm != nil {
+		dlm.mu.Lock()
+		for key, logger := range dlm.loggers {
+			dlm.loggers[key] = logger.With(instanceFields...)
+		}
+		dlm.mu.Unlock()
+	}
+}
+
 // getDomainLogger returns a logger for a specific domain and date
 func (dlm *DomainLoggerManager) getDomainLogger(domain, date string) *zap.Logger {
 	key := fmt.Sprintf("%s-%s", domain, date)
@@ -185,8 +229,10 @@ func (dlm *DomainLoggerManager) getDomainLogger(domain, date string) *zap.Logger
 		fileCore,
 	)
 
-	logger := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+	logger := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)).With(instanceFields...)
 	dlm.loggers[key] = logger
+	dlm.files[key] = fileWriter
+	logFilesVersion.Add(1)
 
 	return logger
 }
@@ -220,12 +266,16 @@ func (dlm *DomainLoggerManager) cleanupRoutine() {
 			today := time.Now().Format("2006-01-02")
 			yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
 
-			for key := range dlm.loggers {
+			for key, logger := range dlm.loggers {
 				if !strings.HasSuffix(key, "-"+today) && !strings.HasSuffix(key, "-"+yesterday) {
+					_ = logger.Sync()
+					_ = dlm.files[key].Close()
 					delete(dlm.loggers, key)
+					delete(dlm.files, key)
 				}
 			}
 			dlm.mu.Unlock()
+			dlm.enforceRetention(time.Now())
 		case <-dlm.stopCleanup:
 			return
 		}
@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetentionPolicy is how long a domain's log files are kept and whether the files of past
+// days are archived (gzipped to YYYY-MM-DD.log.gz)
+type RetentionPolicy struct {
+	Days    int // Files of days more than Days ago are deleted (0 = kept forever)
+	Archive bool
+}
+
+// SetRetention sets the retention of domain log files: byDomain for the domains it lists,
+// defaultPolicy for the others. It is applied at once and then every hour (no-op when
+// domain logging is disabled).
+func SetRetention(defaultPolicy RetentionPolicy, byDomain map[string]RetentionPolicy) {
+	dlm := domainLoggerManager
+	if dlm == nil {
+		return
+	}
+	byDir := make(map[string]RetentionPolicy, len(byDomain))
+	for domain, policy := range byDomain {
+		byDir[sanitizeDomain(domain)] = policy
+	}
+
+	dlm.mu.Lock()
+	dlm.retention = defaultPolicy
+	dlm.retentionByDir = byDir
+	dlm.mu.Unlock()
+
+	go dlm.enforceRetention(time.Now())
+}
+
+// enforceRetention deletes expired log files and archives the files of past days, in every
+// domain directory. Today's and yesterday's files, which may still be written, are never touched.
+func (dlm *DomainLoggerManager) enforceRetention(now time.Time) {
+	dlm.mu.RLock()
+	defaultPolicy, byDir := dlm.retention, dlm.retentionByDir
+	dlm.mu.RUnlock()
+
+	entries, err := os.ReadDir(dlm.baseDir)
+	if err != nil {
+		return
+	}
+	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+	changed := false
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		policy, ok := byDir[entry.Name()]
+		if !ok {
+			policy = defaultPolicy
+		}
+		cutoff := ""
+		if policy.Days > 0 {
+			cutoff = now.AddDate(0, 0, -policy.Days).Format("2006-01-02")
+		}
+
+		dir := filepath.Join(dlm.baseDir, entry.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			name := file.Name()
+			date := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".log")
+			if file.IsDir() || len(date) != 10 || date >= yesterday || (name != date+".log" && name != date+".log.gz") {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			switch {
+			case date < cutoff:
+				if err := os.Remove(path); err != nil {
+					Logger.Warn("Failed to delete expired log file", zap.String("file", path), zap.Error(err))
+					continue
+				}
+				changed = true
+			case policy.Archive && name == date+".log":
+				if err := archiveFile(path); err != nil {
+					Logger.Warn("Failed to archive log file", zap.String("file", path), zap.Error(err))
+					continue
+				}
+				changed = true
+			}
+		}
+	}
+	if changed {
+		logFilesVersion.Add(1)
+	}
+}
+
+// archiveFile gzips path to path.gz and removes path
+func archiveFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,188 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/anonymize"
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+)
+
+// Mirror copies a sample of production events to a staging hub or subject
+// Mirroring is best-effort: events are queued and dropped if the queue is full
+type Mirror struct {
+	cfg        config.MirrorConfig
+	anonymizer *anonymize.Anonymizer // nil = send raw events
+	client     *http.Client
+	conn       *nats.Conn
+	domains    map[string]bool
+	queue      chan []byte
+	done       chan struct{} // Closed by Close; the sender flushes the queue and stops
+	wg         sync.WaitGroup
+
+	mu     sync.Mutex // Held while queueing, so nothing is queued once closed is set
+	closed bool
+}
+
+// NewMirror creates a mirror and starts its background sender
+// anonymizer may be nil to mirror events unchanged
+func NewMirror(cfg config.MirrorConfig, natsURL string, anonymizer *anonymize.Anonymizer) (*Mirror, error) {
+	m := &Mirror{
+		cfg:        cfg,
+		anonymizer: anonymizer,
+		client: &http.Client{
+			Timeout: 3 * time.Second,
+		},
+		domains: make(map[string]bool),
+		queue:   make(chan []byte, 1000),
+		done:    make(chan struct{}),
+	}
+
+	for _, domain := range cfg.Domains {
+		m.domains[domain] = true
+	}
+
+	if cfg.Subject != "" {
+		conn, err := nats.Connect(natsURL,
+			nats.Name("event-hub-mirror"),
+			nats.ReconnectWait(2*time.Second),
+			nats.MaxReconnects(-1),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect mirror to NATS: %w", err)
+		}
+		m.conn = conn
+	}
+
+	m.wg.Add(1)
+	go m.run()
+
+	return m, nil
+}
+
+// Offer queues an event for mirroring if it falls within the sample
+func (m *Mirror) Offer(domain, callID string, eventJSON []byte) {
+	if len(m.domains) > 0 && !m.domains[domain] {
+		return
+	}
+	if !sampled(callID, eventJSON, m.cfg.Percentage) {
+		return
+	}
+
+	payload := eventJSON
+	if m.anonymizer != nil {
+		anonymized, err := m.anonymizer.Apply(eventJSON)
+		if err != nil {
+			logger.Logger.Debug("Failed to anonymize mirrored event", zap.String("domain", domain), zap.Error(err))
+			return
+		}
+		payload = anonymized
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.queue <- payload:
+	default:
+		logger.Logger.Debug("Mirror queue full, dropping event", zap.String("domain", domain), zap.String("call_id", callID))
+	}
+}
+
+// Close stops the sender after flushing queued events. Events offered afterwards are
+// dropped.
+func (m *Mirror) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	close(m.done)
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	if m.conn != nil {
+		m.conn.Close()
+	}
+}
+
+// run sends queued events to the configured targets
+func (m *Mirror) run() {
+	defer m.wg.Done()
+	for {
+		select {
+		case payload := <-m.queue:
+			m.send(payload)
+		case <-m.done:
+			// Nothing is queued once done is closed
+			for {
+				select {
+				case payload := <-m.queue:
+					m.send(payload)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// send mirrors one event to the configured targets
+func (m *Mirror) send(payload []byte) {
+	if m.conn != nil {
+		if err := m.conn.Publish(m.cfg.Subject, payload); err != nil {
+			logger.Logger.Debug("Failed to mirror event to subject", zap.String("subject", m.cfg.Subject), zap.Error(err))
+		}
+	}
+	if m.cfg.URL != "" {
+		m.post(payload)
+	}
+}
+
+// post sends one event to the staging hub
+func (m *Mirror) post(payload []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.URL, bytes.NewReader(payload))
+	if err != nil {
+		logger.Logger.Debug("Failed to create mirror request", zap.Error(err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Mirrored-From", "production")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		logger.Logger.Debug("Failed to mirror event to staging hub", zap.String("url", m.cfg.URL), zap.Error(err))
+		return
+	}
+	resp.Body.Close()
+}
+
+// sampled decides deterministically per call_id so all events of a call are mirrored together
+func sampled(callID string, eventJSON []byte, percentage float64) bool {
+	if percentage >= 100 {
+		return true
+	}
+	key := []byte(callID)
+	if callID == "" {
+		key = eventJSON
+	}
+	sum := sha256.Sum256(key)
+	bucket := binary.BigEndian.Uint64(sum[:8]) % 10000
+	return float64(bucket) < percentage*100
+}
@@ -0,0 +1,57 @@
+package mirror
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// Events offered while and after the mirror closes are dropped, not sent on a closed
+// channel; those queued before Close are still sent
+func TestOfferDuringClose(t *testing.T) {
+	logger.Logger = zap.NewNop()
+
+	var received atomic.Int64
+	staging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer staging.Close()
+
+	m, err := NewMirror(config.MirrorConfig{Enabled: true, Percentage: 100, URL: staging.URL}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		m.Offer("tenant1.example.com", "c1", []byte(`{"call_id":"c1"}`))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.Offer("tenant1.example.com", "c2", []byte(`{"call_id":"c2"}`))
+			}
+		}()
+	}
+	m.Close()
+	wg.Wait()
+	m.Close()
+
+	if n := received.Load(); n < 10 {
+		t.Fatalf("staging hub received %d events, want the 10 queued before Close", n)
+	}
+	sent := received.Load()
+	m.Offer("tenant1.example.com", "c3", []byte(`{"call_id":"c3"}`))
+	if received.Load() != sent || len(m.queue) != 0 {
+		t.Fatal("event queued after Close")
+	}
+}
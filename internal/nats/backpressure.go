@@ -0,0 +1,189 @@
+package nats
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+)
+
+// Backpressure reasons
+const (
+	ReasonPublishLatency = "publish_latency"
+	ReasonConsumerLag    = "consumer_lag"
+)
+
+// BackpressureLimits are the thresholds above which ingest into a stream is refused (0 = not checked)
+type BackpressureLimits struct {
+	MaxPublishLatency time.Duration // Average JetStream publish latency since the last check
+	MaxConsumerLag    uint64        // Messages in the stream not yet delivered to the consumer
+}
+
+// BackpressureState is the ingest backpressure state of one stream
+type BackpressureState struct {
+	Stream           string    `json:"stream"`
+	Active           bool      `json:"active"`
+	Reason           string    `json:"reason,omitempty"`
+	Since            time.Time `json:"since,omitempty"` // When backpressure became active
+	PublishLatencyMs float64   `json:"publish_latency_ms"`
+	ConsumerLag      uint64    `json:"consumer_lag"`
+	Rejected         uint64    `json:"rejected"` // Events refused while active, since startup
+}
+
+// Backpressure watches publish latency and consumer lag of streams so ingest can
+// refuse events (and PBXs back off) while the pipeline is falling behind
+type Backpressure struct {
+	limits func() BackpressureLimits
+
+	mu      sync.RWMutex
+	streams []*watchedStream
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// watchedStream is a stream's publisher, the lag of its consumer and current state
+type watchedStream struct {
+	publisher *Publisher
+	lag       func() (ConsumerLag, error) // nil = consumer lag not checked
+	state     BackpressureState
+}
+
+// NewBackpressure creates a monitor; limits is called on every check so reloaded thresholds apply
+func NewBackpressure(limits func() BackpressureLimits) *Backpressure {
+	return &Backpressure{
+		limits:   limits,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Watch adds a stream, identified by its publisher's stream name, with the consumer reading it
+func (b *Backpressure) Watch(publisher *Publisher, consumer *Consumer) {
+	var lag func() (ConsumerLag, error)
+	if consumer != nil {
+		lag = consumer.Lag
+	}
+	b.watch(publisher, lag)
+}
+
+// WatchConsumer adds a stream whose durable consumer runs on other instances; its lag is
+// read from the server
+func (b *Backpressure) WatchConsumer(publisher *Publisher, consumerName string) {
+	b.watch(publisher, func() (ConsumerLag, error) {
+		return publisher.ConsumerLag(consumerName)
+	})
+}
+
+// watch adds a stream with the function reading its consumer's lag
+func (b *Backpressure) watch(publisher *Publisher, lag func() (ConsumerLag, error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.streams = append(b.streams, &watchedStream{
+		publisher: publisher,
+		lag:       lag,
+		state:     BackpressureState{Stream: publisher.GetStreamName()},
+	})
+}
+
+// Start checks all streams every interval until Stop is called
+func (b *Backpressure) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stopChan:
+			return
+		case <-ticker.C:
+			b.check()
+		}
+	}
+}
+
+// Stop stops the periodic checks
+func (b *Backpressure) Stop() {
+	b.stopOnce.Do(func() { close(b.stopChan) })
+}
+
+// check measures each stream and updates its state
+func (b *Backpressure) check() {
+	limits := b.limits()
+
+	b.mu.RLock()
+	streams := append([]*watchedStream(nil), b.streams...)
+	b.mu.RUnlock()
+
+	for _, s := range streams {
+		latency := s.publisher.takeLatency()
+		var lag uint64
+		if limits.MaxConsumerLag > 0 && s.lag != nil {
+			consumerLag, err := s.lag()
+			if err != nil {
+				logger.Logger.Debug("Failed to read consumer lag", zap.String("stream", s.state.Stream), zap.Error(err))
+			}
+			lag = consumerLag.Pending
+		}
+
+		reason := ""
+		switch {
+		case limits.MaxPublishLatency > 0 && latency > limits.MaxPublishLatency:
+			reason = ReasonPublishLatency
+		case limits.MaxConsumerLag > 0 && lag > limits.MaxConsumerLag:
+			reason = ReasonConsumerLag
+		}
+
+		b.mu.Lock()
+		wasActive := s.state.Active
+		s.state.PublishLatencyMs = float64(latency) / float64(time.Millisecond)
+		s.state.ConsumerLag = lag
+		s.state.Active = reason != ""
+		s.state.Reason = reason
+		if s.state.Active && !wasActive {
+			s.state.Since = time.Now()
+		} else if !s.state.Active {
+			s.state.Since = time.Time{}
+		}
+		state := s.state
+		b.mu.Unlock()
+
+		if state.Active && !wasActive {
+			logger.Logger.Warn("Ingest backpressure activated, refusing events with 503",
+				zap.String("stream", state.Stream),
+				zap.String("reason", state.Reason),
+				zap.Float64("publish_latency_ms", state.PublishLatencyMs),
+				zap.Uint64("consumer_lag", state.ConsumerLag),
+			)
+		} else if !state.Active && wasActive {
+			logger.Logger.Info("Ingest backpressure released",
+				zap.String("stream", state.Stream),
+				zap.Float64("publish_latency_ms", state.PublishLatencyMs),
+				zap.Uint64("consumer_lag", state.ConsumerLag),
+			)
+		}
+	}
+}
+
+// Reject reports whether events for the stream must currently be refused, counting the refusal
+func (b *Backpressure) Reject(stream string) (BackpressureState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.streams {
+		if s.state.Stream == stream && s.state.Active {
+			s.state.Rejected++
+			return s.state, true
+		}
+	}
+	return BackpressureState{}, false
+}
+
+// States returns the state of every watched stream
+func (b *Backpressure) States() []BackpressureState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	states := make([]BackpressureState, len(b.streams))
+	for i, s := range b.streams {
+		states[i] = s.state
+	}
+	return states
+}
@@ -0,0 +1,73 @@
+package nats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/nats-io/nats.go"
+)
+
+// EncodingHeader is the NATS header that flags a compressed payload
+const EncodingHeader = "Content-Encoding"
+
+// Supported compression algorithms
+const (
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+)
+
+// compressPayload compresses data with the given algorithm
+func compressPayload(data []byte, algorithm string) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip payload: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip payload: %w", err)
+		}
+		return buf.Bytes(), nil
+	case CompressionSnappy:
+		return s2.EncodeSnappy(nil, data), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
+	}
+}
+
+// DecodePayload returns the original event body of a message,
+// decompressing it if the publisher flagged it via the encoding header.
+// Messages without the header are returned unchanged.
+func DecodePayload(msg *nats.Msg) ([]byte, error) {
+	if msg.Header == nil {
+		return msg.Data, nil
+	}
+
+	switch encoding := msg.Header.Get(EncodingHeader); encoding {
+	case "":
+		return msg.Data, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(msg.Data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip payload: %w", err)
+		}
+		defer zr.Close()
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to gunzip payload: %w", err)
+		}
+		return data, nil
+	case CompressionSnappy:
+		data, err := s2.Decode(nil, msg.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode snappy payload: %w", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported payload encoding: %s", encoding)
+	}
+}
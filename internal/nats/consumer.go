@@ -1,7 +1,11 @@
 package nats
 
 import (
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -21,9 +25,26 @@ type Consumer struct {
 	js       nats.JetStreamContext
 	sub      *nats.Subscription
 	stream   string
+	name     string
 	subject  string
 	msgChan  chan *nats.Msg
 	stopChan chan struct{}
+	stopOnce sync.Once
+
+	origin string  // Identifies the stream incarnation (see streamOrigin)
+	ledger *Ledger // Acknowledged sequences (nil unless EnableLedger was called)
+
+	// Stream sequences an operator asked to terminate on their next delivery
+	terminate   map[uint64]bool
+	terminateMu sync.Mutex
+
+	fetchFailed *atomic.Bool  // Set when fetching stopped on an error (the consumer receives nothing more)
+	fetchDone   chan struct{} // Closed when the fetch goroutine has exited
+
+	maxDeliver int // Deliveries of a message before JetStream gives it up (0 or less = unlimited)
+
+	// In-process queue replacing JetStream in dev mode (nil = JetStream, see NewDevConsumer)
+	dev *DevQueue
 }
 
 // NewConsumer creates a new NATS consumer with PUSH-based delivery
@@ -39,7 +60,10 @@ type Consumer struct {
 //     at-least-once delivery semantics
 //   - If ANY endpoint fails during forwarding, the message is NOT acknowledged,
 //     causing JetStream to redeliver the entire message after ack_wait expires
-func NewConsumer(url, streamName, subjectPattern, consumerName string, ackWait, maxDeliveries int) (*Consumer, error) {
+//
+// maxAckPending bounds the messages delivered and not yet acknowledged (0 = JetStream default);
+// it is applied to an existing consumer too.
+func NewConsumer(url, streamName, subjectPattern, consumerName string, ackWait, maxDeliveries, maxAckPending int) (*Consumer, error) {
 	opts := []nats.Option{
 		nats.Name("event-hub-consumer"),
 		nats.ReconnectWait(2 * time.Second),
@@ -66,17 +90,42 @@ func NewConsumer(url, streamName, subjectPattern, consumerName string, ackWait,
 	}
 
 	// Ensure stream exists
-	_, err = js.StreamInfo(streamName)
+	streamInfo, err := js.StreamInfo(streamName)
 	if err != nil {
 		conn.Close()
 		return nil, err
 	}
 
 	// Check if consumer already exists
-	_, err = js.ConsumerInfo(streamName, consumerName)
+	maxDeliver := maxDeliveries
+	existing, err := js.ConsumerInfo(streamName, consumerName)
 	if err == nil {
 		// Consumer exists, use it (don't delete and recreate to avoid losing message position)
 		logger.Logger.Info("Using existing NATS consumer", zap.String("consumer", consumerName))
+
+		// MaxAckPending can be changed in place, and MaxDeliver raised when a route needs
+		// more deliveries (see config.MaxDeliveryLimit); both go in one update
+		updated := existing.Config
+		if maxAckPending != 0 && existing.Config.MaxAckPending != maxAckPending {
+			updated.MaxAckPending = maxAckPending
+		}
+		if existing.Config.MaxDeliver > 0 && existing.Config.MaxDeliver < maxDeliveries {
+			updated.MaxDeliver = maxDeliveries
+		}
+		if updated.MaxAckPending != existing.Config.MaxAckPending || updated.MaxDeliver != existing.Config.MaxDeliver {
+			if _, err := js.UpdateConsumer(streamName, &updated); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			logger.Logger.Info("Updated NATS consumer",
+				zap.String("consumer", consumerName),
+				zap.Int("max_ack_pending", updated.MaxAckPending),
+				zap.Int("previous_max_ack_pending", existing.Config.MaxAckPending),
+				zap.Int("max_deliveries", updated.MaxDeliver),
+				zap.Int("previous_max_deliveries", existing.Config.MaxDeliver),
+			)
+		}
+		maxDeliver = updated.MaxDeliver
 	} else {
 		// Consumer doesn't exist, will be created below
 		logger.Logger.Info("Consumer does not exist, will create new one", zap.String("consumer", consumerName))
@@ -95,6 +144,7 @@ func NewConsumer(url, streamName, subjectPattern, consumerName string, ackWait,
 		AckPolicy:     nats.AckExplicitPolicy,
 		AckWait:       time.Duration(ackWait) * time.Second,
 		MaxDeliver:    maxDeliveries,
+		MaxAckPending: maxAckPending,
 		// PUSH-based: messages are pushed to the subscription channel
 		// No polling required - messages arrive asynchronously
 	}
@@ -134,11 +184,15 @@ func NewConsumer(url, streamName, subjectPattern, consumerName string, ackWait,
 
 	// Create stop channel for graceful shutdown
 	stopChan := make(chan struct{})
+	fetchFailed := &atomic.Bool{}
+	fetchDone := make(chan struct{})
 
 	// Start a goroutine to continuously fetch messages and push to channel
 	// This simulates PUSH-based delivery by polling with very short intervals
 	go func() {
+		defer close(fetchDone)
 		defer close(msgChan)
+		pending := uint64(0) // Messages left in the consumer after the last fetch
 		for {
 			select {
 			case <-stopChan:
@@ -150,11 +204,24 @@ func NewConsumer(url, streamName, subjectPattern, consumerName string, ackWait,
 					return
 				}
 
-				// Fetch with small batch size and short timeout to simulate PUSH
-				msgs, err := sub.Fetch(1, nats.MaxWait(50*time.Millisecond))
+				// Wait while the buffer is full: every worker is busy
+				batch := fetchBatch(pending, cap(msgChan)-len(msgChan))
+				if batch == 0 {
+					select {
+					case <-stopChan:
+						return
+					case <-time.After(10 * time.Millisecond):
+					}
+					continue
+				}
+
+				// Fetch one message at a time with a short timeout to simulate PUSH,
+				// and in batches while a backlog drains
+				msgs, err := sub.Fetch(batch, nats.MaxWait(50*time.Millisecond))
 				if err != nil {
 					if err == nats.ErrTimeout {
 						// Timeout is expected when no messages available, continue polling
+						pending = 0
 						continue
 					}
 					// Check if subscription is invalid (e.g., during shutdown)
@@ -164,13 +231,23 @@ func NewConsumer(url, streamName, subjectPattern, consumerName string, ackWait,
 					}
 					// Other errors - log and exit
 					logger.Logger.Error("Error fetching messages from NATS", zap.Error(err))
+					fetchFailed.Store(true)
 					return
 				}
+				if len(msgs) > 0 {
+					if metadata, err := msgs[len(msgs)-1].Metadata(); err == nil {
+						pending = metadata.NumPending
+					}
+				}
 				for _, msg := range msgs {
 					select {
 					case msgChan <- msg:
 					case <-stopChan:
-						// Stop signal received while sending, exit gracefully
+						// Stop signal received while sending - release the message for
+						// immediate redelivery instead of letting it wait for ack_wait
+						if err := msg.Nak(); err != nil {
+							logger.Logger.Debug("Failed to NAK message fetched during stop", zap.Error(err))
+						}
 						return
 					default:
 						logger.Logger.Warn("Message channel full, dropping message")
@@ -181,18 +258,45 @@ func NewConsumer(url, streamName, subjectPattern, consumerName string, ackWait,
 	}()
 
 	cons := &Consumer{
-		conn:     conn,
-		js:       js,
-		sub:      sub,
-		stream:   streamName,
-		subject:  subjectPattern,
-		msgChan:  msgChan,
-		stopChan: stopChan,
+		conn:      conn,
+		js:        js,
+		sub:       sub,
+		stream:    streamName,
+		name:      consumerName,
+		subject:   subjectPattern,
+		msgChan:   msgChan,
+		stopChan:  stopChan,
+		origin:    streamOrigin(streamInfo),
+		terminate: make(map[uint64]bool),
+
+		fetchFailed: fetchFailed,
+		fetchDone:   fetchDone,
+		maxDeliver:  maxDeliver,
 	}
 
 	return cons, nil
 }
 
+// maxFetchBatch bounds how many messages are fetched at once while a backlog drains
+const maxFetchBatch = 64
+
+// fetchBatch returns how many messages to fetch next: one while the consumer keeps up
+// (lowest latency), up to maxFetchBatch while messages are pending, and never more than
+// free, the room left in the message buffer, so a batch does not wait for busy workers
+func fetchBatch(pending uint64, free int) int {
+	batch := 1
+	if pending > 1 {
+		batch = maxFetchBatch
+		if pending < maxFetchBatch {
+			batch = int(pending)
+		}
+	}
+	if batch > free {
+		batch = free
+	}
+	return batch
+}
+
 // Messages returns the channel that receives messages (PUSH-based delivery)
 func (c *Consumer) Messages() <-chan *nats.Msg {
 	return c.msgChan
@@ -200,28 +304,221 @@ func (c *Consumer) Messages() <-chan *nats.Msg {
 
 // Ack acknowledges a message
 func (c *Consumer) Ack(msg *nats.Msg) error {
+	if c.dev != nil {
+		return c.dev.ack(msg)
+	}
 	return msg.Ack()
 }
 
+// AckSync acknowledges a message and waits for the server to confirm it
+func (c *Consumer) AckSync(msg *nats.Msg) error {
+	if c.dev != nil {
+		return c.dev.ack(msg)
+	}
+	return msg.AckSync()
+}
+
 // Nak negatively acknowledges a message (triggers redelivery)
 func (c *Consumer) Nak(msg *nats.Msg) error {
+	if c.dev != nil {
+		return c.dev.nak(msg, 0)
+	}
 	return msg.Nak()
 }
 
+// Term terminates a message: JetStream will not redeliver it (used for events that can never succeed)
+func (c *Consumer) Term(msg *nats.Msg) error {
+	if c.dev != nil {
+		return c.dev.term(msg)
+	}
+	return msg.Term()
+}
+
+// InProgress tells JetStream the message is still being worked on, resetting its ack_wait
+func (c *Consumer) InProgress(msg *nats.Msg) error {
+	if c.dev != nil {
+		return c.dev.inProgress(msg)
+	}
+	return msg.InProgress()
+}
+
+// StopFetching stops pulling new messages from JetStream without closing the
+// connection, so in-flight messages can still be acknowledged.
+// The Messages channel is closed (and FetchStopped signalled) once the fetch goroutine exits.
+func (c *Consumer) StopFetching() {
+	c.stopOnce.Do(func() {
+		if c.stopChan != nil {
+			close(c.stopChan)
+		}
+	})
+}
+
+// NakWithDelay negatively acknowledges a message, asking JetStream to redeliver it after delay
+func (c *Consumer) NakWithDelay(msg *nats.Msg, delay time.Duration) error {
+	if c.dev != nil {
+		return c.dev.nak(msg, delay)
+	}
+	return msg.NakWithDelay(delay)
+}
+
+// FetchStopped returns a channel closed once the fetch goroutine has exited
+func (c *Consumer) FetchStopped() <-chan struct{} {
+	return c.fetchDone
+}
+
+// IsConnected returns whether the consumer's NATS connection is alive
+func (c *Consumer) IsConnected() bool {
+	if c.dev != nil {
+		return true
+	}
+	return c.conn.IsConnected()
+}
+
+// FetchFailed reports whether fetching stopped on an error, so no more messages are received
+func (c *Consumer) FetchFailed() bool {
+	return c.fetchFailed.Load()
+}
+
+// MaxDeliver returns how many times the consumer delivers a message before JetStream gives
+// it up (0 or less = unlimited). An existing consumer keeps a higher limit it was created with.
+func (c *Consumer) MaxDeliver() int {
+	return c.maxDeliver
+}
+
+// StreamName returns the name of the stream the consumer reads
+func (c *Consumer) StreamName() string {
+	return c.stream
+}
+
+// TerminateOnDelivery makes the consumer terminate the message at seq the next time it is delivered
+func (c *Consumer) TerminateOnDelivery(seq uint64) {
+	c.terminateMu.Lock()
+	defer c.terminateMu.Unlock()
+	c.terminate[seq] = true
+}
+
+// ShouldTerminate reports (once) whether an operator asked to terminate the message
+func (c *Consumer) ShouldTerminate(msg *nats.Msg) bool {
+	metadata, err := msg.Metadata()
+	if err != nil {
+		return false
+	}
+	c.terminateMu.Lock()
+	defer c.terminateMu.Unlock()
+	if !c.terminate[metadata.Sequence.Stream] {
+		return false
+	}
+	delete(c.terminate, metadata.Sequence.Stream)
+	return true
+}
+
+// EnableLedger records acknowledged messages in the KV bucket so they can be skipped
+// if they are delivered again after disaster recovery (see Ledger)
+func (c *Consumer) EnableLedger(bucket string, maxRanges int) error {
+	if c.dev != nil {
+		return errors.New("the dedup ledger needs JetStream, not available in dev mode")
+	}
+	ledger, err := openLedger(c.js, bucket, c.name, maxRanges)
+	if err != nil {
+		return err
+	}
+	c.ledger = ledger
+	return nil
+}
+
+// AlreadyProcessed reports whether the ledger shows the message as acknowledged before
+func (c *Consumer) AlreadyProcessed(msg *nats.Msg) bool {
+	if c.ledger == nil {
+		return false
+	}
+	origin, seq, ok := messageOrigin(msg, c.origin)
+	return ok && c.ledger.Contains(origin, seq)
+}
+
+// MarkProcessed records an acknowledged message in the ledger (no-op without a ledger)
+func (c *Consumer) MarkProcessed(msg *nats.Msg) {
+	if c.ledger == nil {
+		return
+	}
+	if origin, seq, ok := messageOrigin(msg, c.origin); ok {
+		c.ledger.Record(origin, seq)
+	}
+}
+
+// Lag returns the consumer's backlog and how close it is to max_ack_pending
+func (c *Consumer) Lag() (ConsumerLag, error) {
+	if c.dev != nil {
+		return c.dev.lag(), nil
+	}
+	info, err := c.js.ConsumerInfo(c.stream, c.name)
+	if err != nil {
+		return ConsumerLag{}, err
+	}
+	return ConsumerLag{
+		Pending:       info.NumPending,
+		AckPending:    info.NumAckPending,
+		MaxAckPending: info.Config.MaxAckPending,
+	}, nil
+}
+
+// maxOldestLookups bounds how many deleted messages past the ack floor OldestUnacked skips
+const maxOldestLookups = 100
+
+// OldestUnacked returns when the oldest message not yet acknowledged (delivered or not)
+// was stored in the stream: the first message after the consumer's ack floor. It returns
+// the zero time when the consumer has nothing left to acknowledge.
+func (c *Consumer) OldestUnacked() (time.Time, error) {
+	if c.dev != nil {
+		return c.dev.oldest(), nil
+	}
+	info, err := c.js.ConsumerInfo(c.stream, c.name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if info.NumPending == 0 && info.NumAckPending == 0 {
+		return time.Time{}, nil
+	}
+
+	last := info.Delivered.Stream + info.NumPending
+	for seq, lookups := info.AckFloor.Stream+1, 0; seq <= last && lookups < maxOldestLookups; seq, lookups = seq+1, lookups+1 {
+		raw, err := c.js.GetMsg(c.stream, seq)
+		if err != nil {
+			if errors.Is(err, nats.ErrMsgNotFound) {
+				// Deleted or erased message - the next one is the oldest
+				continue
+			}
+			return time.Time{}, fmt.Errorf("failed to read sequence %d: %w", seq, err)
+		}
+		return raw.Time, nil
+	}
+	return time.Time{}, nil
+}
+
+// ConsumerLag is the consumer's backlog as seen by the server
+type ConsumerLag struct {
+	Pending       uint64 // Stream messages not yet delivered to the consumer
+	AckPending    int    // Delivered and not yet acknowledged; at MaxAckPending the server stops delivering
+	MaxAckPending int    // Effective limit (-1 = unlimited)
+}
+
 // Close closes the consumer subscription and connection
 func (c *Consumer) Close() {
-	// Signal the fetch goroutine to stop
-	if c.stopChan != nil {
-		close(c.stopChan)
+	// Signal the fetch goroutine to stop and wait for it (a fetch waits at most 50ms),
+	// so the subscription is not removed under a running fetch
+	c.StopFetching()
+	select {
+	case <-c.fetchDone:
+	case <-time.After(time.Second):
+		logger.Logger.Warn("Fetch goroutine did not stop in time", zap.String("consumer", c.name))
 	}
 
-	// Wait a bit for goroutine to finish
-	time.Sleep(100 * time.Millisecond)
-
 	if c.sub != nil {
 		c.sub.Unsubscribe()
 		c.sub.Drain()
 	}
+	if c.ledger != nil {
+		c.ledger.Close()
+	}
 	if c.conn != nil {
 		c.conn.Close()
 	}
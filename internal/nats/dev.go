@@ -0,0 +1,278 @@
+package nats
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+)
+
+// defaultDevMaxAckPending is JetStream's default max_ack_pending, applied by the dev queue
+// when none is configured
+const defaultDevMaxAckPending = 1000
+
+// DevQueue is an in-process stand-in for a JetStream stream and its durable consumer, used
+// by -dev to run the ingest → forward pipeline without a NATS server. Like JetStream it
+// sequences messages, redelivers those not acknowledged within ack_wait, honors Nak with
+// a delay and Term, and stops delivering a message after max_deliveries. Nothing is
+// durable: queued messages are lost when the process exits.
+type DevQueue struct {
+	stream string
+	sub    *nats.Subscription // Bound to delivered messages so msg.Metadata works
+
+	mu            sync.Mutex
+	consumer      string
+	ackWait       time.Duration
+	maxDeliveries int // 0 or less = unlimited
+	maxAckPending int
+	seq           uint64                    // Last stream sequence
+	delivered     uint64                    // Last consumer sequence
+	waiting       []*devMessage             // Not delivered yet or due for redelivery
+	pending       map[*nats.Msg]*devMessage // Delivered and not acknowledged yet
+	notify        chan struct{}             // Signalled when a message is queued
+}
+
+// devMessage is a message of a DevQueue
+type devMessage struct {
+	seq        uint64
+	subject    string
+	header     nats.Header
+	data       []byte
+	stored     time.Time
+	deliveries int
+	due        time.Time // Not delivered before (Nak with a delay)
+	deadline   time.Time // Redelivered after, while delivered
+}
+
+// NewDevQueue creates the in-process queue of a stream
+func NewDevQueue(streamName string) *DevQueue {
+	return &DevQueue{
+		stream:        streamName,
+		sub:           &nats.Subscription{},
+		consumer:      "dev",
+		ackWait:       30 * time.Second,
+		maxAckPending: defaultDevMaxAckPending,
+		pending:       make(map[*nats.Msg]*devMessage),
+		notify:        make(chan struct{}, 1),
+	}
+}
+
+// publish stores a message at the next sequence
+func (q *DevQueue) publish(msg *nats.Msg) {
+	q.mu.Lock()
+	q.seq++
+	q.waiting = append(q.waiting, &devMessage{
+		seq:     q.seq,
+		subject: msg.Subject,
+		header:  msg.Header,
+		data:    msg.Data,
+		stored:  time.Now(),
+	})
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next delivers the next message due at now (nil if there is none, or max_ack_pending
+// messages are waiting for an ack). Messages whose ack_wait expired are queued again first.
+func (q *DevQueue) next(now time.Time) *nats.Msg {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for msg, m := range q.pending {
+		if now.After(m.deadline) {
+			delete(q.pending, msg)
+			q.redeliver(m, now)
+		}
+	}
+	if len(q.pending) >= q.maxAckPending {
+		return nil
+	}
+
+	for i, m := range q.waiting {
+		if m.due.After(now) {
+			continue
+		}
+		q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+		m.deliveries++
+		m.deadline = now.Add(q.ackWait)
+		q.delivered++
+
+		msg := &nats.Msg{
+			Subject: m.subject,
+			Header:  m.header,
+			Data:    m.data,
+			Sub:     q.sub,
+			// The reply subject JetStream sets, read by msg.Metadata
+			Reply: fmt.Sprintf("$JS.ACK.%s.%s.%d.%d.%d.%d.%d",
+				q.stream, q.consumer, m.deliveries, m.seq, q.delivered, m.stored.UnixNano(), len(q.waiting)),
+		}
+		q.pending[msg] = m
+		return msg
+	}
+	return nil
+}
+
+// redeliver queues a message again after due, unless it was delivered max_deliveries times
+func (q *DevQueue) redeliver(m *devMessage, due time.Time) {
+	if q.maxDeliveries > 0 && m.deliveries >= q.maxDeliveries {
+		logger.Logger.Warn("Message reached max deliveries, dropping it from the dev queue",
+			zap.String("stream", q.stream),
+			zap.Uint64("sequence", m.seq),
+			zap.Int("deliveries", m.deliveries),
+		)
+		return
+	}
+	m.due = due
+	q.waiting = append(q.waiting, m)
+}
+
+// take removes a delivered message from the messages waiting for an ack
+func (q *DevQueue) take(msg *nats.Msg) (*devMessage, error) {
+	m, ok := q.pending[msg]
+	if !ok {
+		return nil, nats.ErrMsgAlreadyAckd
+	}
+	delete(q.pending, msg)
+	return m, nil
+}
+
+// ack acknowledges a delivered message
+func (q *DevQueue) ack(msg *nats.Msg) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, err := q.take(msg)
+	return err
+}
+
+// nak queues a delivered message for redelivery after delay
+func (q *DevQueue) nak(msg *nats.Msg, delay time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	m, err := q.take(msg)
+	if err != nil {
+		return err
+	}
+	q.redeliver(m, time.Now().Add(delay))
+	return nil
+}
+
+// term drops a delivered message
+func (q *DevQueue) term(msg *nats.Msg) error {
+	return q.ack(msg)
+}
+
+// inProgress resets the ack_wait of a delivered message
+func (q *DevQueue) inProgress(msg *nats.Msg) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	m, ok := q.pending[msg]
+	if !ok {
+		return nats.ErrMsgAlreadyAckd
+	}
+	m.deadline = time.Now().Add(q.ackWait)
+	return nil
+}
+
+// lag returns the queue's backlog
+func (q *DevQueue) lag() ConsumerLag {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return ConsumerLag{
+		Pending:       uint64(len(q.waiting)),
+		AckPending:    len(q.pending),
+		MaxAckPending: q.maxAckPending,
+	}
+}
+
+// oldest returns when the oldest message not yet acknowledged was queued (zero if none)
+func (q *DevQueue) oldest() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var oldest time.Time
+	for _, m := range q.waiting {
+		if oldest.IsZero() || m.stored.Before(oldest) {
+			oldest = m.stored
+		}
+	}
+	for _, m := range q.pending {
+		if oldest.IsZero() || m.stored.Before(oldest) {
+			oldest = m.stored
+		}
+	}
+	return oldest
+}
+
+// NewDevPublisher creates a publisher that queues events in the in-process queue instead
+// of publishing them to JetStream. It has no JetStream context (GetJetStream returns nil).
+func NewDevPublisher(queue *DevQueue, subjectPattern string) *Publisher {
+	return &Publisher{
+		dev:        queue,
+		subject:    publishSubject(subjectPattern),
+		streamName: queue.stream,
+		connected:  true,
+	}
+}
+
+// NewDevConsumer creates the consumer of an in-process queue, with the delivery settings
+// of NewConsumer. The queue has a single consumer.
+func NewDevConsumer(queue *DevQueue, consumerName string, ackWait, maxDeliveries, maxAckPending int) *Consumer {
+	queue.mu.Lock()
+	queue.consumer = consumerName
+	queue.ackWait = time.Duration(ackWait) * time.Second
+	queue.maxDeliveries = maxDeliveries
+	if maxAckPending > 0 {
+		queue.maxAckPending = maxAckPending
+	}
+	queue.mu.Unlock()
+
+	msgChan := make(chan *nats.Msg, 100)
+	stopChan := make(chan struct{})
+	fetchDone := make(chan struct{})
+
+	// Deliver while the buffer has room, like the fetch loop of NewConsumer
+	go func() {
+		defer close(fetchDone)
+		defer close(msgChan)
+		for {
+			select {
+			case <-stopChan:
+				return
+			default:
+			}
+			if len(msgChan) < cap(msgChan) {
+				if msg := queue.next(time.Now()); msg != nil {
+					msgChan <- msg
+					continue
+				}
+			}
+			select {
+			case <-stopChan:
+				return
+			case <-queue.notify:
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+
+	return &Consumer{
+		dev:       queue,
+		stream:    queue.stream,
+		name:      consumerName,
+		msgChan:   msgChan,
+		stopChan:  stopChan,
+		terminate: make(map[uint64]bool),
+
+		fetchFailed: &atomic.Bool{},
+		fetchDone:   fetchDone,
+		maxDeliver:  maxDeliveries,
+	}
+}
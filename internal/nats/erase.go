@@ -0,0 +1,66 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// EraseFromStream securely deletes the stream's messages for which match returns true (match
+// gets the decoded payload), e.g. all events of one call for an erasure request. A temporary
+// consumer reads the whole stream. Returns how many messages were deleted.
+func EraseFromStream(ctx context.Context, js nats.JetStreamContext, streamName, id string, match func(data []byte) bool) (int, error) {
+	erased := 0
+
+	consumerName := "erase-" + id
+	_, err := js.AddConsumer(streamName, &nats.ConsumerConfig{
+		Name:              consumerName,
+		DeliverPolicy:     nats.DeliverAllPolicy,
+		AckPolicy:         nats.AckNonePolicy,
+		MaxDeliver:        1,
+		InactiveThreshold: 5 * time.Minute, // Removed by the server if the erasure dies
+	})
+	if err != nil {
+		return erased, fmt.Errorf("failed to create erase consumer: %w", err)
+	}
+	defer js.DeleteConsumer(streamName, consumerName)
+
+	sub, err := js.PullSubscribe("", consumerName, nats.Bind(streamName, consumerName))
+	if err != nil {
+		return erased, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return erased, err
+		}
+
+		msgs, err := sub.Fetch(replayBatch, nats.MaxWait(2*time.Second))
+		if errors.Is(err, nats.ErrTimeout) {
+			return erased, nil // End of the stream
+		}
+		if err != nil {
+			return erased, fmt.Errorf("failed to fetch messages: %w", err)
+		}
+
+		for _, msg := range msgs {
+			data, err := DecodePayload(msg)
+			if err != nil || !match(data) {
+				continue
+			}
+			metadata, err := msg.Metadata()
+			if err != nil {
+				return erased, fmt.Errorf("failed to read message metadata: %w", err)
+			}
+			err = js.SecureDeleteMsg(streamName, metadata.Sequence.Stream)
+			if err != nil && !errors.Is(err, nats.ErrMsgNotFound) {
+				return erased, fmt.Errorf("failed to delete sequence %d: %w", metadata.Sequence.Stream, err)
+			}
+			erased++
+		}
+	}
+}
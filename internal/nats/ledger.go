@@ -0,0 +1,278 @@
+package nats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+)
+
+// Headers identifying where a message was first stored, so a message keeps its identity
+// when the stream is restored from an export (which assigns new sequences)
+const (
+	OriginHeader    = "Event-Hub-Origin"     // Creation time of the stream the message was first stored in
+	OriginSeqHeader = "Event-Hub-Origin-Seq" // Its sequence in that stream
+)
+
+// DefaultLedgerMaxRanges bounds the sequence ranges kept per origin when no limit is configured
+const DefaultLedgerMaxRanges = 10000
+
+// ledgerFlushInterval is how often recorded sequences are written to the KV bucket
+const ledgerFlushInterval = 5 * time.Second
+
+// streamOrigin identifies one incarnation of a stream: a recreated stream restarts
+// its sequences, so sequences are only comparable within the same origin
+func streamOrigin(info *nats.StreamInfo) string {
+	return info.Created.UTC().Format(time.RFC3339Nano)
+}
+
+// seqRange is an inclusive range of stream sequences, stored as [first, last]
+type seqRange [2]uint64
+
+// seqSet is a sorted list of disjoint, non-adjacent sequence ranges
+type seqSet []seqRange
+
+// contains reports whether seq is in the set
+func (s seqSet) contains(seq uint64) bool {
+	i := sort.Search(len(s), func(i int) bool { return s[i][1] >= seq })
+	return i < len(s) && s[i][0] <= seq
+}
+
+// add inserts seq, merging adjacent ranges
+func (s seqSet) add(seq uint64) seqSet {
+	// First range ending at or after seq-1, i.e. the only ones seq can touch
+	i := sort.Search(len(s), func(i int) bool { return s[i][1]+1 >= seq })
+	switch {
+	case i < len(s) && s[i][0] <= seq && seq <= s[i][1]:
+		return s
+	case i < len(s) && s[i][1]+1 == seq:
+		s[i][1] = seq
+		if i+1 < len(s) && s[i+1][0] == seq+1 {
+			s[i][1] = s[i+1][1]
+			s = append(s[:i+1], s[i+2:]...)
+		}
+		return s
+	case i < len(s) && s[i][0] == seq+1:
+		s[i][0] = seq
+		return s
+	}
+	s = append(s, seqRange{})
+	copy(s[i+1:], s[i:])
+	s[i] = seqRange{seq, seq}
+	return s
+}
+
+// merge returns the union of both sets
+func (s seqSet) merge(other seqSet) seqSet {
+	all := make(seqSet, 0, len(s)+len(other))
+	all = append(all, s...)
+	all = append(all, other...)
+	sort.Slice(all, func(i, j int) bool { return all[i][0] < all[j][0] })
+
+	merged := all[:0]
+	for _, r := range all {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1]+1 {
+			if r[1] > merged[n-1][1] {
+				merged[n-1][1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// ledgerRecord is the JSON value stored per consumer
+type ledgerRecord struct {
+	Origins map[string]seqSet `json:"origins"`
+}
+
+// Ledger is a persistent record of the stream sequences a consumer has acknowledged,
+// kept in a JetStream KV bucket. After disaster recovery (consumer recreated, stream
+// restored from an export) it lets the consumer skip messages it already forwarded.
+// Instances sharing a consumer share its ledger; writes are merged, never overwritten.
+type Ledger struct {
+	kv        nats.KeyValue
+	key       string
+	maxRanges int
+
+	mu      sync.Mutex
+	origins map[string]seqSet
+	version uint64 // Incremented by Record
+	written uint64 // version last written to the bucket
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// openLedger opens (creating the bucket if needed) and loads the ledger stored under key
+func openLedger(js nats.JetStreamContext, bucket, key string, maxRanges int) (*Ledger, error) {
+	if maxRanges <= 0 {
+		maxRanges = DefaultLedgerMaxRanges
+	}
+
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Stream sequences acknowledged by event-hub consumers",
+			History:     1,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger bucket %s: %w", bucket, err)
+	}
+
+	l := &Ledger{
+		kv:        kv,
+		key:       key,
+		maxRanges: maxRanges,
+		origins:   make(map[string]seqSet),
+		stopChan:  make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := l.sync(); err != nil {
+		return nil, err
+	}
+
+	go l.run()
+	return l, nil
+}
+
+// Contains reports whether the message at seq of origin was already acknowledged
+func (l *Ledger) Contains(origin string, seq uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.origins[origin].contains(seq)
+}
+
+// Record marks the message at seq of origin as acknowledged
+func (l *Ledger) Record(origin string, seq uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.origins[origin] = l.origins[origin].add(seq)
+	l.version++
+}
+
+// run writes recorded sequences periodically until Close
+func (l *Ledger) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(ledgerFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stopChan:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			dirty := l.version != l.written
+			l.mu.Unlock()
+			if !dirty {
+				continue
+			}
+			if err := l.sync(); err != nil {
+				logger.Logger.Warn("Failed to write dedup ledger", zap.String("key", l.key), zap.Error(err))
+			}
+		}
+	}
+}
+
+// sync merges the stored record into memory and, if anything was recorded locally, writes
+// the union back. Conflicting writes by other instances are retried with their ranges merged.
+func (l *Ledger) sync() error {
+	for attempt := 0; attempt < 5; attempt++ {
+		var stored ledgerRecord
+		var revision uint64
+		entry, err := l.kv.Get(l.key)
+		switch {
+		case errors.Is(err, nats.ErrKeyNotFound):
+		case err != nil:
+			return fmt.Errorf("failed to read ledger: %w", err)
+		default:
+			revision = entry.Revision()
+			if err := json.Unmarshal(entry.Value(), &stored); err != nil {
+				return fmt.Errorf("invalid ledger record %s: %w", l.key, err)
+			}
+		}
+
+		l.mu.Lock()
+		for origin, set := range stored.Origins {
+			l.origins[origin] = l.origins[origin].merge(set)
+		}
+		for origin, set := range l.origins {
+			if len(set) > l.maxRanges {
+				// Forget the oldest messages first; at worst they are forwarded again
+				l.origins[origin] = set[len(set)-l.maxRanges:]
+			}
+		}
+		version := l.version
+		dirty := version != l.written
+		data, err := json.Marshal(ledgerRecord{Origins: l.origins})
+		l.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if !dirty {
+			return nil
+		}
+
+		if revision == 0 {
+			_, err = l.kv.Create(l.key, data)
+		} else {
+			_, err = l.kv.Update(l.key, data, revision)
+		}
+		if err == nil {
+			l.mu.Lock()
+			l.written = version
+			l.mu.Unlock()
+			return nil
+		}
+		if !errors.Is(err, nats.ErrKeyExists) && !isWrongSequence(err) {
+			return fmt.Errorf("failed to write ledger: %w", err)
+		}
+		// Another instance wrote first - merge its ranges and retry
+	}
+	return fmt.Errorf("failed to write ledger: too many concurrent updates")
+}
+
+// isWrongSequence reports whether a KV update failed because the key changed since it was read
+func isWrongSequence(err error) bool {
+	var apiErr *nats.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence
+}
+
+// Close stops the periodic writes and writes any remaining records
+func (l *Ledger) Close() {
+	l.stopOnce.Do(func() {
+		close(l.stopChan)
+		<-l.done
+		if err := l.sync(); err != nil {
+			logger.Logger.Warn("Failed to write dedup ledger", zap.String("key", l.key), zap.Error(err))
+		}
+	})
+}
+
+// messageOrigin returns the origin and sequence identifying a message across stream restores
+func messageOrigin(msg *nats.Msg, streamOrigin string) (string, uint64, bool) {
+	if msg.Header != nil {
+		if origin := msg.Header.Get(OriginHeader); origin != "" {
+			if seq, err := strconv.ParseUint(msg.Header.Get(OriginSeqHeader), 10, 64); err == nil {
+				return origin, seq, true
+			}
+		}
+	}
+	metadata, err := msg.Metadata()
+	if err != nil || streamOrigin == "" {
+		return "", 0, false
+	}
+	return streamOrigin, metadata.Sequence.Stream, true
+}
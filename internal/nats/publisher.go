@@ -1,6 +1,8 @@
 package nats
 
 import (
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -16,6 +18,26 @@ type Publisher struct {
 	subject    string
 	streamName string
 	connected  bool
+
+	// Payload compression (disabled when compression is empty)
+	compression          string
+	compressionThreshold int
+
+	// Publish latency accumulated since the last backpressure check
+	latencyMu    sync.Mutex
+	latencySum   time.Duration
+	latencyCount int
+
+	// When the connection was lost (zero while connected)
+	downMu    sync.Mutex
+	downSince time.Time
+
+	// Ingested events waiting for NATS (nil = not spooled, see SetSpool)
+	spool     *Spool
+	stopSpool chan struct{}
+
+	// In-process queue replacing JetStream in dev mode (nil = JetStream, see NewDevPublisher)
+	dev *DevQueue
 }
 
 // NewPublisher creates a new NATS publisher
@@ -65,21 +87,10 @@ func NewPublisher(url, streamName, subjectPattern string) (*Publisher, error) {
 		return nil, err
 	}
 
-	// Convert pattern to specific subject for publishing
-	// Pattern "call.signal.*" -> subject "call.signal.events"
-	publishSubject := "call.signal.events"
-	if subjectPattern == "call.signal.*" {
-		publishSubject = "call.signal.events"
-	} else {
-		// For other patterns, try to derive a subject
-		// Replace * with a default value
-		publishSubject = subjectPattern
-	}
-
 	pub := &Publisher{
 		conn:       conn,
 		js:         js,
-		subject:    publishSubject,
+		subject:    publishSubject(subjectPattern),
 		streamName: streamName,
 		connected:  true,
 	}
@@ -90,6 +101,17 @@ func NewPublisher(url, streamName, subjectPattern string) (*Publisher, error) {
 	return pub, nil
 }
 
+// publishSubject converts the stream's subject pattern to the subject events are published to
+func publishSubject(subjectPattern string) string {
+	// Pattern "call.signal.*" -> subject "call.signal.events"
+	if subjectPattern == "call.signal.*" {
+		return "call.signal.events"
+	}
+	// For other patterns, try to derive a subject
+	// Replace * with a default value
+	return strings.Replace(subjectPattern, "*", "events", 1)
+}
+
 // monitorConnection monitors the NATS connection status
 func (p *Publisher) monitorConnection() {
 	for {
@@ -98,29 +120,113 @@ func (p *Publisher) monitorConnection() {
 		} else {
 			p.connected = true
 		}
+		p.downMu.Lock()
+		if p.connected {
+			p.downSince = time.Time{}
+		} else if p.downSince.IsZero() {
+			p.downSince = time.Now()
+		}
+		p.downMu.Unlock()
 		time.Sleep(1 * time.Second)
 	}
 }
 
+// SetCompression enables compression of payloads larger than thresholdBytes
+// using the given algorithm ("gzip" or "snappy"). An empty algorithm disables it.
+func (p *Publisher) SetCompression(algorithm string, thresholdBytes int) {
+	p.compression = algorithm
+	p.compressionThreshold = thresholdBytes
+}
+
 // Publish publishes an event to NATS JetStream
+// Payloads above the compression threshold are compressed and flagged
+// with the Content-Encoding header so consumers can decode them
 func (p *Publisher) Publish(data []byte) error {
-	_, err := p.js.Publish(p.subject, data)
+	msg := nats.NewMsg(p.subject)
+	msg.Data = data
+
+	if p.compression != "" && len(data) > p.compressionThreshold {
+		compressed, err := compressPayload(data, p.compression)
+		if err != nil {
+			return err
+		}
+		msg.Data = compressed
+		msg.Header.Set(EncodingHeader, p.compression)
+	}
+
+	if p.dev != nil {
+		p.dev.publish(msg)
+		return nil
+	}
+
+	start := time.Now()
+	_, err := p.js.PublishMsg(msg)
+	p.recordLatency(time.Since(start))
 	return err
 }
 
+// recordLatency adds a publish to the latency average
+func (p *Publisher) recordLatency(d time.Duration) {
+	p.latencyMu.Lock()
+	p.latencySum += d
+	p.latencyCount++
+	p.latencyMu.Unlock()
+}
+
+// takeLatency returns the average publish latency since the last call (0 if nothing was published)
+func (p *Publisher) takeLatency() time.Duration {
+	p.latencyMu.Lock()
+	defer p.latencyMu.Unlock()
+	if p.latencyCount == 0 {
+		return 0
+	}
+	avg := p.latencySum / time.Duration(p.latencyCount)
+	p.latencySum, p.latencyCount = 0, 0
+	return avg
+}
+
 // IsConnected returns whether the NATS connection is alive
 func (p *Publisher) IsConnected() bool {
+	if p.dev != nil {
+		return true
+	}
 	return p.conn.IsConnected() && p.connected
 }
 
-// Close closes the NATS connection
+// DisconnectedFor returns how long the NATS connection has been down (0 while connected)
+func (p *Publisher) DisconnectedFor() time.Duration {
+	p.downMu.Lock()
+	defer p.downMu.Unlock()
+	if p.downSince.IsZero() {
+		return 0
+	}
+	return time.Since(p.downSince)
+}
+
+// Flush waits until all buffered publishes have been sent to the server
+func (p *Publisher) Flush(timeout time.Duration) error {
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.FlushTimeout(timeout)
+}
+
+// Close closes the NATS connection; events still spooled are published after the next start
 func (p *Publisher) Close() {
+	if p.stopSpool != nil {
+		close(p.stopSpool)
+	}
 	if p.conn != nil {
 		p.conn.Close()
 	}
 }
 
-// GetJetStream returns the JetStream context (for reading messages)
+// Dev returns the in-process queue that replaces JetStream in dev mode (nil otherwise)
+func (p *Publisher) Dev() *DevQueue {
+	return p.dev
+}
+
+// GetJetStream returns the JetStream context (for reading messages); nil in dev mode
 func (p *Publisher) GetJetStream() nats.JetStreamContext {
 	return p.js
 }
@@ -130,3 +236,20 @@ func (p *Publisher) GetStreamName() string {
 	return p.streamName
 }
 
+// ConsumerLag returns the backlog of a durable consumer of the stream, as seen by the
+// server, without consuming from it
+func (p *Publisher) ConsumerLag(consumerName string) (ConsumerLag, error) {
+	if p.dev != nil {
+		return p.dev.lag(), nil
+	}
+	info, err := p.js.ConsumerInfo(p.streamName, consumerName)
+	if err != nil {
+		return ConsumerLag{}, err
+	}
+	return ConsumerLag{
+		Pending:       info.NumPending,
+		AckPending:    info.NumAckPending,
+		MaxAckPending: info.Config.MaxAckPending,
+	}, nil
+}
+
@@ -0,0 +1,125 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ReplayHeader marks messages republished by ReplayStream; the value is the replay's ID
+const ReplayHeader = "Event-Hub-Replay"
+
+// ReplayRange selects the messages to replay by the time they were stored in the stream
+type ReplayRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// ReplayProgress counts the messages a replay has processed so far
+type ReplayProgress struct {
+	Scanned  int `json:"scanned"`  // Messages read from the window
+	Replayed int `json:"replayed"` // Messages published again
+}
+
+// replayBatch is how many messages a replay reads at once
+const replayBatch = 256
+
+// ReplayStream publishes the messages stored in the stream within rng again, in stream order,
+// with ReplayHeader set to id, so the consumers forward them once more. Messages that are
+// replays themselves are skipped, as are those for which match returns false (match gets the
+// decoded payload; nil matches all). A temporary consumer reads the window. progress is
+// called after every batch.
+func ReplayStream(ctx context.Context, js nats.JetStreamContext, streamName, id string, rng ReplayRange, match func(data []byte) bool, progress func(ReplayProgress)) (ReplayProgress, error) {
+	var result ReplayProgress
+
+	consumerName := "replay-" + id
+	from := rng.From
+	_, err := js.AddConsumer(streamName, &nats.ConsumerConfig{
+		Name:              consumerName,
+		DeliverPolicy:     nats.DeliverByStartTimePolicy,
+		OptStartTime:      &from,
+		AckPolicy:         nats.AckNonePolicy,
+		MaxDeliver:        1,
+		InactiveThreshold: 5 * time.Minute, // Removed by the server if the replay dies
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to create replay consumer: %w", err)
+	}
+	defer js.DeleteConsumer(streamName, consumerName)
+
+	sub, err := js.PullSubscribe("", consumerName, nats.Bind(streamName, consumerName))
+	if err != nil {
+		return result, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		msgs, err := sub.Fetch(replayBatch, nats.MaxWait(2*time.Second))
+		if errors.Is(err, nats.ErrTimeout) {
+			return result, nil // End of the stream
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to fetch messages: %w", err)
+		}
+
+		for _, msg := range msgs {
+			metadata, err := msg.Metadata()
+			if err != nil {
+				return result, fmt.Errorf("failed to read message metadata: %w", err)
+			}
+			// Messages are stored in time order; this also stops before our own replays
+			if metadata.Timestamp.After(rng.To) {
+				return result, nil
+			}
+			result.Scanned++
+
+			if msg.Header.Get(ReplayHeader) != "" {
+				continue
+			}
+			if match != nil {
+				data, err := DecodePayload(msg)
+				if err != nil || !match(data) {
+					continue
+				}
+			}
+
+			if err := republish(js, streamName, id, msg, metadata.Sequence.Stream); err != nil {
+				return result, err
+			}
+			result.Replayed++
+		}
+
+		if progress != nil {
+			progress(result)
+		}
+	}
+}
+
+// republish publishes a copy of msg, payload and encoding unchanged, flagged as a replay
+func republish(js nats.JetStreamContext, streamName, id string, msg *nats.Msg, seq uint64) error {
+	replay := nats.NewMsg(msg.Subject)
+	replay.Data = msg.Data
+	for key, values := range msg.Header {
+		switch key {
+		case nats.MsgIdHdr, OriginHeader, OriginSeqHeader:
+			// A copy is a new message: not a duplicate, and not yet forwarded per the ledger
+			continue
+		}
+		for _, value := range values {
+			replay.Header.Add(key, value)
+		}
+	}
+	replay.Header.Set(ReplayHeader, id)
+
+	if _, err := js.PublishMsg(replay, nats.ExpectStream(streamName)); err != nil {
+		return fmt.Errorf("failed to replay sequence %d: %w", seq, err)
+	}
+	return nil
+}
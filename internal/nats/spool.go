@@ -0,0 +1,348 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+)
+
+// spoolDrainInterval is how often spooled events are published once NATS is back
+const spoolDrainInterval = time.Second
+
+// spoolFailedDir is the subdirectory of a spool keeping events the stream refused
+const spoolFailedDir = "failed"
+
+// ErrSpoolFull is returned when an event does not fit in a spool that rejects on overflow
+var ErrSpoolFull = errors.New("ingest spool is full")
+
+// SpoolStats describes the events waiting in a spool
+type SpoolStats struct {
+	Events   int    `json:"events"`
+	Bytes    int64  `json:"bytes"`
+	MaxBytes int64  `json:"max_bytes"`
+	Dropped  uint64 `json:"dropped"`  // Oldest events removed to make room, since startup
+	Rejected uint64 `json:"rejected"` // Events refused because the spool was full, since startup
+	Failed   uint64 `json:"failed"`   // Spooled events the stream refused, moved to the failed directory, since startup
+}
+
+// Spool keeps ingested events that could not be published in files on disk, one file per
+// event named by its sequence, so they survive a restart and are published in order
+type Spool struct {
+	dir        string
+	maxBytes   int64
+	dropOldest bool // Overflow: remove the oldest events instead of refusing new ones
+
+	mu       sync.Mutex
+	files    []spoolFile // Oldest first
+	bytes    int64
+	nextSeq  uint64
+	dropped  uint64
+	rejected uint64
+	failed   uint64
+}
+
+// spoolFile is one spooled event
+type spoolFile struct {
+	name string
+	size int64
+}
+
+// NewSpool opens the spool in dir, creating it if needed; events left by a previous run
+// are published first
+func NewSpool(dir string, maxBytes int64, dropOldest bool) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes, dropOldest: dropOldest, nextSeq: 1}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			// Interrupted write: the event was never acknowledged to the PBX
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 64)
+		if err != nil || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		s.files = append(s.files, spoolFile{name: name, size: info.Size()})
+		s.bytes += info.Size()
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].name < s.files[j].name })
+
+	if len(s.files) > 0 {
+		logger.Logger.Info("Ingest spool holds events from a previous run",
+			zap.String("directory", dir),
+			zap.Int("events", len(s.files)),
+			zap.Int64("bytes", s.bytes),
+		)
+	}
+	return s, nil
+}
+
+// add writes an event at the end of the spool
+func (s *Spool) add(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := int64(len(data))
+	for s.bytes+size > s.maxBytes {
+		if !s.dropOldest || len(s.files) == 0 {
+			s.rejected++
+			return ErrSpoolFull
+		}
+		oldest := s.files[0]
+		os.Remove(filepath.Join(s.dir, oldest.name))
+		s.files = s.files[1:]
+		s.bytes -= oldest.size
+		s.dropped++
+		logger.Logger.Error("Ingest spool full, dropped the oldest spooled event",
+			zap.String("directory", s.dir),
+			zap.String("file", oldest.name),
+		)
+	}
+
+	name := fmt.Sprintf("%020d.json", s.nextSeq)
+	path := filepath.Join(s.dir, name)
+	if err := writeFileSync(path+".tmp", data); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	s.nextSeq++
+	s.files = append(s.files, spoolFile{name: name, size: size})
+	s.bytes += size
+	return nil
+}
+
+// writeFileSync writes data to a new file and flushes it to disk
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// head returns the oldest spooled event ("" if the spool is empty)
+func (s *Spool) head() (string, []byte, error) {
+	s.mu.Lock()
+	if len(s.files) == 0 {
+		s.mu.Unlock()
+		return "", nil, nil
+	}
+	name := s.files[0].name
+	s.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	return name, data, err
+}
+
+// remove deletes a published (or dropped) event; it may already be gone
+func (s *Spool) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.files {
+		if f.name == name {
+			os.Remove(filepath.Join(s.dir, name))
+			s.files = append(s.files[:i], s.files[i+1:]...)
+			s.bytes -= f.size
+			return
+		}
+	}
+}
+
+// fail moves an event the stream refused out of the spool, into its failed directory, so
+// the events behind it are published
+func (s *Spool) fail(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.files {
+		if f.name == name {
+			failedDir := filepath.Join(s.dir, spoolFailedDir)
+			err := os.MkdirAll(failedDir, 0700)
+			if err == nil {
+				err = os.Rename(filepath.Join(s.dir, name), filepath.Join(failedDir, name))
+			}
+			if err != nil {
+				logger.Logger.Error("Failed to move refused spooled event, deleting it", zap.String("file", name), zap.Error(err))
+				os.Remove(filepath.Join(s.dir, name))
+			}
+			s.files = append(s.files[:i], s.files[i+1:]...)
+			s.bytes -= f.size
+			s.failed++
+			return
+		}
+	}
+}
+
+// Len returns the number of spooled events
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files)
+}
+
+// Accepting reports whether a new event would be spooled (the spool drops old events when
+// full, or has room left)
+func (s *Spool) Accepting() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropOldest || s.bytes < s.maxBytes
+}
+
+// Stats returns the spool's size and overflow counters
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SpoolStats{
+		Events:   len(s.files),
+		Bytes:    s.bytes,
+		MaxBytes: s.maxBytes,
+		Dropped:  s.dropped,
+		Rejected: s.rejected,
+		Failed:   s.failed,
+	}
+}
+
+// SetSpool makes Accept spool events while NATS is unavailable, and publishes spooled
+// events in order once it is back
+func (p *Publisher) SetSpool(spool *Spool) {
+	p.spool = spool
+	p.stopSpool = make(chan struct{})
+	go p.drainSpool()
+}
+
+// Spool returns the publisher's spool (nil if ingest is not spooled)
+func (p *Publisher) Spool() *Spool {
+	return p.spool
+}
+
+// Accept publishes an ingested event, or spools it while NATS is unavailable or earlier
+// events are still spooled, so the stream keeps the order events arrived in. Returns
+// whether the event was spooled.
+func (p *Publisher) Accept(data []byte) (bool, error) {
+	if p.spool == nil {
+		return false, p.Publish(data)
+	}
+	if p.IsConnected() && p.spool.Len() == 0 {
+		err := p.Publish(data)
+		if err == nil || !isUnavailable(err) {
+			return false, err
+		}
+		logger.Logger.Warn("Publish failed, spooling ingested events until NATS is back",
+			zap.String("stream", p.streamName),
+			zap.Error(err),
+		)
+	}
+	if err := p.spool.add(data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isUnavailable reports whether a publish failed because NATS or the stream could not be
+// reached, so it may succeed later
+func isUnavailable(err error) bool {
+	for _, target := range []error{
+		nats.ErrTimeout, nats.ErrNoResponders, nats.ErrNoStreamResponse, nats.ErrNoServers,
+		nats.ErrConnectionClosed, nats.ErrConnectionDraining, nats.ErrDisconnected,
+		nats.ErrConnectionReconnecting, context.DeadlineExceeded,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// drainSpool publishes spooled events, oldest first, whenever NATS is connected
+func (p *Publisher) drainSpool() {
+	ticker := time.NewTicker(spoolDrainInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopSpool:
+			return
+		case <-ticker.C:
+		}
+		if !p.IsConnected() {
+			continue
+		}
+
+		published := 0
+		for {
+			name, data, err := p.spool.head()
+			if name == "" {
+				break
+			}
+			if err != nil {
+				// Unreadable file: it can never be published
+				logger.Logger.Error("Dropping unreadable spooled event", zap.String("file", name), zap.Error(err))
+				p.spool.remove(name)
+				continue
+			}
+			if err := p.Publish(data); err != nil {
+				if isUnavailable(err) {
+					logger.Logger.Warn("Failed to publish spooled event, will retry",
+						zap.String("stream", p.streamName),
+						zap.Int("remaining", p.spool.Len()),
+						zap.Error(err),
+					)
+					break
+				}
+				// Refused by the stream (e.g. too large): retrying would block the events
+				// behind it for good
+				logger.Logger.Error("Spooled event refused by the stream, moved to the failed directory",
+					zap.String("stream", p.streamName),
+					zap.String("file", filepath.Join(spoolFailedDir, name)),
+					zap.Error(err),
+				)
+				p.spool.fail(name)
+				continue
+			}
+			p.spool.remove(name)
+			published++
+		}
+		if published > 0 {
+			logger.Logger.Info("Published spooled events",
+				zap.String("stream", p.streamName),
+				zap.Int("published", published),
+				zap.Int("remaining", p.spool.Len()),
+			)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+)
+
+// takeoverPoll is how often a waiting instance tries to take the lock again
+const takeoverPoll = 500 * time.Millisecond
+
+// TakeoverLock is held by the one instance fetching from a durable consumer. It lives in a
+// KV bucket whose entries expire after the lease, and is renewed while held, so the lock of
+// a crashed instance frees itself. Another instance asks for it by writing its ID under
+// "<consumer>.request"; the holder sees the request on Requested.
+type TakeoverLock struct {
+	kv       nats.KeyValue
+	key      string
+	instance string
+	lease    time.Duration
+
+	mu       sync.Mutex
+	revision uint64 // Of the lock entry written by this instance
+
+	requested chan string // IDs of instances asking for the lock
+	watcher   nats.KeyWatcher
+	stopChan  chan struct{}
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+// AcquireTakeover takes the lock on consumerName for instanceID (creating the bucket if
+// needed). While another instance holds it, the holder is asked to hand over and the lock
+// is tried again until ctx is done. instanceID must be unique per process: a lock left by a
+// crashed process is only freed by its lease expiring.
+func AcquireTakeover(ctx context.Context, js nats.JetStreamContext, bucket, consumerName, instanceID string, lease time.Duration) (*TakeoverLock, error) {
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Instances fetching from event-hub consumers",
+			History:     1,
+			TTL:         lease,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open takeover bucket %s: %w", bucket, err)
+	}
+
+	l := &TakeoverLock{
+		kv:        kv,
+		key:       consumerName,
+		instance:  instanceID,
+		lease:     lease,
+		requested: make(chan string, 1),
+		stopChan:  make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	waitingFor := ""
+	for {
+		revision, err := kv.Create(l.key, []byte(instanceID))
+		if err == nil {
+			l.revision = revision
+			break
+		}
+		if !errors.Is(err, nats.ErrKeyExists) {
+			return nil, fmt.Errorf("failed to take consumer lock %s: %w", l.key, err)
+		}
+
+		holder := ""
+		if entry, err := kv.Get(l.key); err == nil {
+			holder = string(entry.Value())
+		}
+		// Asked again on every try: the holder only watches for new requests
+		if _, err := kv.Put(l.requestKey(), []byte(instanceID)); err != nil {
+			return nil, fmt.Errorf("failed to request consumer %s: %w", l.key, err)
+		}
+		if holder != waitingFor {
+			logger.Logger.Info("Waiting for instance to hand over NATS consumer",
+				zap.String("consumer", l.key),
+				zap.String("holder", holder),
+			)
+			waitingFor = holder
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("consumer %s is still held by instance %s: %w", l.key, holder, ctx.Err())
+		case <-time.After(takeoverPoll):
+		}
+	}
+
+	l.watcher, err = kv.Watch(l.requestKey(), nats.UpdatesOnly())
+	if err != nil {
+		kv.Delete(l.key, nats.LastRevision(l.revision))
+		return nil, fmt.Errorf("failed to watch takeover requests for %s: %w", l.key, err)
+	}
+	go l.run()
+
+	logger.Logger.Info("Took NATS consumer lock", zap.String("consumer", l.key), zap.String("instance", instanceID))
+	return l, nil
+}
+
+// requestKey is where other instances ask for the lock
+func (l *TakeoverLock) requestKey() string {
+	return l.key + ".request"
+}
+
+// Requested receives the ID of an instance asking to take over the consumer
+func (l *TakeoverLock) Requested() <-chan string {
+	return l.requested
+}
+
+// run renews the lock and forwards takeover requests until Release
+func (l *TakeoverLock) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stopChan:
+			return
+		case entry, ok := <-l.watcher.Updates():
+			if !ok {
+				return
+			}
+			if entry == nil || entry.Operation() != nats.KeyValuePut || string(entry.Value()) == l.instance {
+				continue
+			}
+			select {
+			case l.requested <- string(entry.Value()):
+			default:
+			}
+		case <-ticker.C:
+			l.mu.Lock()
+			revision, err := l.kv.Update(l.key, []byte(l.instance), l.revision)
+			if err == nil {
+				l.revision = revision
+			}
+			l.mu.Unlock()
+			if err != nil {
+				logger.Logger.Error("Failed to renew NATS consumer lock, another instance may take over", zap.String("consumer", l.key), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Release gives up the lock, so a waiting instance can bind the consumer right away
+func (l *TakeoverLock) Release() {
+	l.stopOnce.Do(func() {
+		close(l.stopChan)
+		<-l.done
+		l.watcher.Stop()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if err := l.kv.Delete(l.key, nats.LastRevision(l.revision)); err != nil {
+			logger.Logger.Warn("Failed to release NATS consumer lock", zap.String("consumer", l.key), zap.Error(err))
+			return
+		}
+		logger.Logger.Info("Released NATS consumer lock", zap.String("consumer", l.key))
+	})
+}
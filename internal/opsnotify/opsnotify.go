@@ -0,0 +1,241 @@
+package opsnotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+	"calleventhub/internal/store"
+)
+
+// Notification types
+const (
+	TypeDeadLetter  = "dead_letter"  // An event failed for good or was quarantined
+	TypeCircuitOpen = "circuit_open" // An endpoint failed too many deliveries in a row
+)
+
+// Notification is the compact message posted to a tenant's ops_url
+type Notification struct {
+	Type       string    `json:"type"`
+	Tenant     string    `json:"tenant"`
+	Domain     string    `json:"domain"`
+	CallID     string    `json:"call_id,omitempty"`
+	Endpoint   string    `json:"endpoint,omitempty"`
+	Reason     string    `json:"reason"`
+	Failures   int       `json:"consecutive_failures,omitempty"` // circuit_open: failed deliveries in a row
+	Suppressed int       `json:"suppressed,omitempty"`           // dead_letter: earlier dead letters of the domain not notified
+	Instance   string    `json:"instance"`                       // Hub instance that saw the failure
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Target is the tenant a domain belongs to and how its notifications are throttled
+type Target struct {
+	Tenant          string
+	URL             string
+	CircuitFailures int           // Consecutive failed deliveries that open an endpoint's circuit
+	MinInterval     time.Duration // At most one dead_letter notification per domain this often
+}
+
+// circuitKey identifies one endpoint of a domain
+type circuitKey struct {
+	domain   string
+	endpoint string
+}
+
+// circuit counts the consecutive failed deliveries to an endpoint
+type circuit struct {
+	failures int
+	open     bool // circuit_open was sent; cleared by the next successful delivery
+}
+
+// deadLetters throttles the dead_letter notifications of a domain
+type deadLetters struct {
+	lastSent   time.Time
+	suppressed int
+}
+
+// pending is a queued notification and where it goes
+type pending struct {
+	url          string
+	notification Notification
+}
+
+// Notifier posts dead_letter and circuit_open notifications to the tenants' ops URLs,
+// so they can fix their receivers before data loss accumulates. Sending is best-effort:
+// notifications are queued and dropped if the queue is full.
+type Notifier struct {
+	instanceID string
+	client     *http.Client
+	queue      chan pending
+	wg         sync.WaitGroup
+
+	mu          sync.Mutex
+	circuits    map[circuitKey]*circuit
+	deadLetters map[string]*deadLetters
+}
+
+// NewNotifier creates a notifier and starts its background sender
+func NewNotifier(instanceID string) *Notifier {
+	n := &Notifier{
+		instanceID: instanceID,
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+		queue:       make(chan pending, 1000),
+		circuits:    make(map[circuitKey]*circuit),
+		deadLetters: make(map[string]*deadLetters),
+	}
+
+	n.wg.Add(1)
+	go n.run()
+
+	return n
+}
+
+// Results records the outcome of a forward attempt for each endpoint and notifies
+// the tenant when an endpoint reaches target.CircuitFailures failed deliveries in a row.
+// The circuit is notified once and re-armed by the endpoint's next successful delivery.
+func (n *Notifier) Results(target Target, domain string, results []store.DeliveryResult) {
+	if target.CircuitFailures <= 0 {
+		return
+	}
+
+	n.mu.Lock()
+	var opened []Notification
+	for _, result := range results {
+		key := circuitKey{domain: domain, endpoint: result.Endpoint}
+		c, ok := n.circuits[key]
+		if result.Status == store.ResultSuccess {
+			if ok {
+				delete(n.circuits, key)
+			}
+			continue
+		}
+		if !ok {
+			c = &circuit{}
+			n.circuits[key] = c
+		}
+		c.failures++
+		if c.open || c.failures < target.CircuitFailures {
+			continue
+		}
+		c.open = true
+		reason := result.ErrorClass
+		if result.Error != "" {
+			reason = result.Error
+		}
+		opened = append(opened, Notification{
+			Type:     TypeCircuitOpen,
+			Tenant:   target.Tenant,
+			Domain:   domain,
+			Endpoint: result.Endpoint,
+			Reason:   reason,
+			Failures: c.failures,
+		})
+	}
+	n.mu.Unlock()
+
+	for _, notification := range opened {
+		n.send(target.URL, notification)
+	}
+}
+
+// DeadLetter notifies the tenant that an event of the domain will not be delivered.
+// Within target.MinInterval of the previous notification of the domain it is only
+// counted, and reported as suppressed with the next one.
+func (n *Notifier) DeadLetter(target Target, domain, callID, reason string) {
+	n.mu.Lock()
+	d, ok := n.deadLetters[domain]
+	if !ok {
+		d = &deadLetters{}
+		n.deadLetters[domain] = d
+	}
+	now := time.Now()
+	if !d.lastSent.IsZero() && now.Sub(d.lastSent) < target.MinInterval {
+		d.suppressed++
+		n.mu.Unlock()
+		return
+	}
+	suppressed := d.suppressed
+	d.lastSent, d.suppressed = now, 0
+	n.mu.Unlock()
+
+	n.send(target.URL, Notification{
+		Type:       TypeDeadLetter,
+		Tenant:     target.Tenant,
+		Domain:     domain,
+		CallID:     callID,
+		Reason:     reason,
+		Suppressed: suppressed,
+	})
+}
+
+// send queues a notification
+func (n *Notifier) send(url string, notification Notification) {
+	notification.Instance = n.instanceID
+	notification.Timestamp = time.Now()
+
+	select {
+	case n.queue <- pending{url: url, notification: notification}:
+	default:
+		logger.Logger.Debug("Ops notification queue full, dropping notification",
+			zap.String("tenant", notification.Tenant),
+			zap.String("domain", notification.Domain),
+			zap.String("type", notification.Type),
+		)
+	}
+}
+
+// Close stops the sender after flushing queued notifications
+func (n *Notifier) Close() {
+	close(n.queue)
+	n.wg.Wait()
+}
+
+// run posts queued notifications
+func (n *Notifier) run() {
+	defer n.wg.Done()
+	for p := range n.queue {
+		if err := n.post(p.url, p.notification); err != nil {
+			logger.Logger.Warn("Failed to send ops notification",
+				zap.String("tenant", p.notification.Tenant),
+				zap.String("domain", p.notification.Domain),
+				zap.String("type", p.notification.Type),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// post sends one notification to an ops URL
+func (n *Notifier) post(url string, notification Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("ops URL returned status %d", resp.StatusCode)
+	}
+	return nil
+}
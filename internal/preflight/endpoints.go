@@ -0,0 +1,107 @@
+package preflight
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/transform"
+)
+
+// defaultPorts are the ports of endpoint URLs that do not set one, by scheme
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"tcp":   "1883",
+	"mqtt":  "1883",
+	"ssl":   "8883",
+	"tls":   "8883",
+	"mqtts": "8883",
+	"redis": "6379",
+	"sftp":  "22",
+}
+
+// probeEndpoints connects to every host of the enabled endpoints of every route. Nothing
+// is sent; an unreachable endpoint is only a warning, since its events wait in the stream
+// until it comes back.
+func probeEndpoints(report *Report, cfg *config.Config, timeout time.Duration) {
+	// scheme://host:port -> domains that send to it; paths and queries may hold secrets
+	domains := make(map[string][]string)
+	for _, route := range cfg.AllRoutes() {
+		for _, endpoint := range route.AllEndpoints() {
+			address := endpoint.Address()
+			if endpoint.Disabled || address == "" || transform.HasExpressions(address) {
+				continue
+			}
+			u, err := url.Parse(address)
+			if err != nil || u.Hostname() == "" {
+				continue // Rejected by config validation
+			}
+			port := u.Port()
+			if port == "" {
+				port = defaultPorts[u.Scheme]
+			}
+			target := u.Scheme + "://" + net.JoinHostPort(u.Hostname(), port)
+			if !containsString(domains[target], route.Domain) {
+				domains[target] = append(domains[target], route.Domain)
+			}
+		}
+	}
+	targets := make([]string, 0, len(domains))
+	for target := range domains {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	results := make([]Result, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			results[i] = probeEndpoint(target, domains[target], cfg.DNS.Overrides, timeout)
+		}(i, target)
+	}
+	wg.Wait()
+	report.Results = append(report.Results, results...)
+}
+
+// probeEndpoint opens and closes a TCP connection to an endpoint host (scheme://host:port)
+func probeEndpoint(target string, domains []string, overrides map[string][]string, timeout time.Duration) Result {
+	result := Result{Check: "endpoint " + target}
+	_, address, _ := strings.Cut(target, "://")
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || port == "" {
+		result.Status, result.Detail = StatusWarn, "no port to probe"
+		return result
+	}
+	if addresses := overrides[host]; len(addresses) > 0 {
+		host = addresses[0]
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), timeout)
+	if err != nil {
+		result.Status = StatusWarn
+		result.Detail = fmt.Sprintf("cannot connect: %v", err)
+		result.Hint = fmt.Sprintf("Events of %s will be retried until the endpoint is reachable; check the URL and firewall", strings.Join(domains, ", "))
+		return result
+	}
+	conn.Close()
+	result.Status, result.Detail = StatusOK, "accepts connections"
+	return result
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package preflight
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"calleventhub/internal/config"
+)
+
+// checkLogsDir checks that log files can be created in dir
+func checkLogsDir(report *Report, dir string) {
+	if dir == "" {
+		report.add("logs directory", StatusOK, "domain logging is disabled", "")
+		return
+	}
+	checkWritableDir(report, "logs directory", dir,
+		fmt.Sprintf("Create %s and make it writable by the service user, or start with -log-file in a writable directory", dir))
+}
+
+// checkWritableDir checks that files can be created in dir, creating it if needed
+func checkWritableDir(report *Report, check, dir, hint string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		report.add(check, StatusFail, fmt.Sprintf("cannot create %s: %v", dir, err), hint)
+		return
+	}
+	probe, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		report.add(check, StatusFail, fmt.Sprintf("cannot write to %s: %v", dir, err), hint)
+		return
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	report.add(check, StatusOK, abs+" is writable", "")
+}
+
+// checkPorts checks that the HTTP listeners can bind their addresses
+func checkPorts(report *Report, server config.ServerConfig) {
+	checkPort(report, "http port", server.Host, server.Port, "server.port")
+	if server.Ingest.Enabled() {
+		checkPort(report, "ingest port", server.Ingest.Host, server.Ingest.Port, "server.ingest.port")
+	}
+}
+
+// checkPort checks that host:port can be listened on
+func checkPort(report *Report, check, host string, port int, setting string) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		report.add(check, StatusFail, fmt.Sprintf("cannot listen on %s: %v", address, err),
+			fmt.Sprintf("Another process (maybe another hub instance) uses the port; stop it or change %s", setting))
+		return
+	}
+	listener.Close()
+	report.add(check, StatusOK, address+" is free", "")
+}
@@ -0,0 +1,101 @@
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// checkNATS checks that the server at natsURL is reachable and that its account can use
+// JetStream, the stream and the consumer
+func checkNATS(report *Report, check, natsURL, streamName, consumerName string, timeout time.Duration) {
+	servers := redactURLs(natsURL)
+
+	// Permission violations are reported asynchronously; JetStream calls then time out
+	var mu sync.Mutex
+	var asyncErr error
+	conn, err := nats.Connect(natsURL,
+		nats.Name("event-hub-preflight"),
+		nats.Timeout(timeout),
+		nats.NoReconnect(),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			mu.Lock()
+			asyncErr = err
+			mu.Unlock()
+		}),
+	)
+	if err != nil {
+		hint := "Check nats.url and that the NATS server is running and reachable from this host (firewall, DNS)"
+		if errors.Is(err, nats.ErrAuthorization) || errors.Is(err, nats.ErrAuthExpired) {
+			hint = "Check the credentials in nats.url"
+		}
+		report.add(check, StatusFail, fmt.Sprintf("cannot connect to %s: %v", servers, err), hint)
+		return
+	}
+	defer conn.Close()
+	report.add(check, StatusOK, "connected to "+conn.ConnectedUrlRedacted(), "")
+
+	// explain adds the permission violation behind a failed JetStream call, if any
+	explain := func(err error) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if asyncErr != nil {
+			return fmt.Sprintf("%v (%v)", err, asyncErr)
+		}
+		return err.Error()
+	}
+	permissionsHint := "The NATS user needs to publish to $JS.API.> and subscribe to _INBOX.>"
+
+	js, err := conn.JetStream(nats.MaxWait(timeout))
+	if err != nil {
+		report.add(check+" jetstream", StatusFail, explain(err), permissionsHint)
+		return
+	}
+	if _, err := js.AccountInfo(); err != nil {
+		hint := permissionsHint
+		if errors.Is(err, nats.ErrJetStreamNotEnabled) || errors.Is(err, nats.ErrJetStreamNotEnabledForAccount) {
+			hint = "Enable JetStream on the NATS server (and for the account of the NATS user)"
+		}
+		report.add(check+" jetstream", StatusFail, explain(err), hint)
+		return
+	}
+	report.add(check+" jetstream", StatusOK, "JetStream is available", "")
+
+	streamCheck := check + " stream " + streamName
+	if _, err := js.StreamInfo(streamName); errors.Is(err, nats.ErrStreamNotFound) {
+		report.add(streamCheck, StatusOK, "does not exist yet; it will be created at startup", "")
+	} else if err != nil {
+		report.add(streamCheck, StatusFail, explain(err), permissionsHint)
+		return
+	} else {
+		report.add(streamCheck, StatusOK, "exists", "")
+	}
+
+	consumerCheck := check + " consumer " + consumerName
+	if _, err := js.ConsumerInfo(streamName, consumerName); errors.Is(err, nats.ErrConsumerNotFound) || errors.Is(err, nats.ErrStreamNotFound) {
+		report.add(consumerCheck, StatusOK, "does not exist yet; it will be created at startup", "")
+	} else if err != nil {
+		report.add(consumerCheck, StatusFail, explain(err), permissionsHint)
+	} else {
+		report.add(consumerCheck, StatusOK, "exists", "")
+	}
+}
+
+// redactURLs returns the comma-separated server URLs without their credentials
+func redactURLs(natsURL string) string {
+	servers := strings.Split(natsURL, ",")
+	for i, server := range servers {
+		server = strings.TrimSpace(server)
+		if u, err := url.Parse(server); err == nil && u.User != nil {
+			u.User = nil
+			server = u.String()
+		}
+		servers[i] = server
+	}
+	return strings.Join(servers, ",")
+}
@@ -0,0 +1,108 @@
+package preflight
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"calleventhub/internal/config"
+)
+
+// Check outcomes
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn" // Worth fixing, but the service can start
+	StatusFail = "fail" // The service would look alive without working; startup is refused
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Check  string `json:"check"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"` // What to do about a warning or failure
+}
+
+// Report is the outcome of every check, in the order they ran
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// add appends a result
+func (r *Report) add(check, status, detail, hint string) {
+	r.Results = append(r.Results, Result{Check: check, Status: status, Detail: detail, Hint: hint})
+}
+
+// Failed reports whether a check failed
+func (r *Report) Failed() bool {
+	return r.count(StatusFail) > 0
+}
+
+// count returns the number of results with the status
+func (r *Report) count(status string) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Summary describes the outcome in one line
+func (r *Report) Summary() string {
+	return fmt.Sprintf("%d checks: %d failed, %d warnings", len(r.Results), r.count(StatusFail), r.count(StatusWarn))
+}
+
+// String formats the report for a terminal, one check per line with hints below
+func (r *Report) String() string {
+	width := 0
+	for _, result := range r.Results {
+		if len(result.Check) > width {
+			width = len(result.Check)
+		}
+	}
+
+	var sb strings.Builder
+	for _, result := range r.Results {
+		fmt.Fprintf(&sb, "%-4s  %-*s  %s\n", strings.ToUpper(result.Status), width, result.Check, result.Detail)
+		if result.Hint != "" && result.Status != StatusOK {
+			fmt.Fprintf(&sb, "      -> %s\n", result.Hint)
+		}
+	}
+	sb.WriteString(r.Summary())
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// Run checks that the service configured by cfg can work on this host: the logs directory
+// (logsDir, "" if not used) and ingest spool are writable, the HTTP ports are free, NATS is reachable with
+// JetStream access to the streams and consumers, and, if preflight.probe_endpoints is set,
+// that every endpoint accepts connections
+func Run(cfg *config.Config, logsDir string) *Report {
+	report := &Report{}
+	timeout := time.Duration(cfg.Preflight.TimeoutSeconds) * time.Second
+
+	checkLogsDir(report, logsDir)
+	if cfg.Server.Spool.Enabled {
+		checkWritableDir(report, "spool directory", cfg.Server.Spool.Directory,
+			fmt.Sprintf("Create %s and make it writable by the service user, or change server.spool.directory", cfg.Server.Spool.Directory))
+	}
+	checkPorts(report, cfg.Server)
+
+	checkNATS(report, "nats", cfg.NATS.URL, cfg.NATS.StreamName, "event-hub-consumer", timeout)
+	if cfg.Isolation.Enabled {
+		for _, tenant := range cfg.Isolation.Tenants {
+			natsURL := cfg.NATS.URL
+			if tenant.NATSURL != "" {
+				natsURL = tenant.NATSURL
+			}
+			checkNATS(report, "nats tenant "+tenant.Name, natsURL, tenant.StreamName(cfg.NATS.StreamName), "event-hub-consumer-"+tenant.Name, timeout)
+		}
+	}
+
+	if cfg.Preflight.ProbeEndpoints {
+		probeEndpoints(report, cfg, timeout)
+	}
+	return report
+}
@@ -0,0 +1,95 @@
+package receipts
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+	"calleventhub/internal/store"
+)
+
+// Receipt is the outcome of one forward attempt of an event to one endpoint
+type Receipt struct {
+	CallID          string    `json:"call_id"`
+	HubEventID      string    `json:"hub_event_id,omitempty"` // ID given at ingest
+	Domain          string    `json:"domain"`
+	DeliveryAttempt int       `json:"delivery_attempt"`
+	Final           bool      `json:"final"`            // Delivered, or no redelivery will follow
+	Replay          string    `json:"replay,omitempty"` // ID of the stream replay that forwarded the event
+	Instance        string    `json:"instance"`         // Hub instance that made the attempt
+	Timestamp       time.Time `json:"timestamp"`
+	store.DeliveryResult
+}
+
+// Publisher publishes delivery receipts to a core NATS subject, so other systems
+// (billing, SLA tracking) can follow delivery outcomes without polling the API.
+// Publishing is best-effort: receipts are queued and dropped if the queue is full.
+type Publisher struct {
+	conn    *nats.Conn
+	subject string
+	queue   chan Receipt
+	wg      sync.WaitGroup
+}
+
+// NewPublisher connects to NATS and starts the background sender
+func NewPublisher(natsURL, subject string) (*Publisher, error) {
+	conn, err := nats.Connect(natsURL,
+		nats.Name("event-hub-receipts"),
+		nats.ReconnectWait(2*time.Second),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect receipts to NATS: %w", err)
+	}
+
+	p := &Publisher{
+		conn:    conn,
+		subject: subject,
+		queue:   make(chan Receipt, 1000),
+	}
+
+	p.wg.Add(1)
+	go p.run()
+
+	return p, nil
+}
+
+// Publish queues a receipt
+func (p *Publisher) Publish(receipt Receipt) {
+	select {
+	case p.queue <- receipt:
+	default:
+		logger.Logger.Debug("Receipt queue full, dropping receipt",
+			zap.String("domain", receipt.Domain),
+			zap.String("call_id", receipt.CallID),
+			zap.String("endpoint", receipt.Endpoint),
+		)
+	}
+}
+
+// Close stops the sender after flushing queued receipts
+func (p *Publisher) Close() {
+	close(p.queue)
+	p.wg.Wait()
+	p.conn.Flush()
+	p.conn.Close()
+}
+
+// run publishes queued receipts
+func (p *Publisher) run() {
+	defer p.wg.Done()
+	for receipt := range p.queue {
+		data, err := json.Marshal(receipt)
+		if err != nil {
+			continue
+		}
+		if err := p.conn.Publish(p.subject, data); err != nil {
+			logger.Logger.Debug("Failed to publish receipt", zap.String("subject", p.subject), zap.Error(err))
+		}
+	}
+}
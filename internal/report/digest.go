@@ -0,0 +1,138 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+	"calleventhub/internal/store"
+)
+
+// Digest is the summary of one domain's events on one day, as counted by one hub
+// instance. Reporting systems add up the digests of every instance.
+type Digest struct {
+	Domain         string                  `json:"domain"`
+	Day            string                  `json:"day"` // 2006-01-02, local time of the instance
+	Instance       string                  `json:"instance,omitempty"`
+	Complete       bool                    `json:"complete"` // The day is over
+	GeneratedAt    time.Time               `json:"generated_at"`
+	Counts         DigestCounts            `json:"counts"`
+	FailureReasons map[string]int64        `json:"failure_reasons"` // Failed endpoint deliveries by error class
+	TopEndpoints   []store.EndpointLatency `json:"top_endpoints"`   // Slowest by average latency
+}
+
+// DigestCounts are a digest's event totals
+type DigestCounts struct {
+	Forwarded   int64 `json:"forwarded"`
+	Stale       int64 `json:"stale"`
+	Skipped     int64 `json:"skipped"`
+	Failed      int64 `json:"failed"`
+	Dropped     int64 `json:"dropped"`
+	Retried     int64 `json:"retried"`
+	Quarantined int64 `json:"quarantined"`
+}
+
+// Digests builds the digest of day (2006-01-02) of every domain accepted by include that
+// has a route or had events that day, ordered by domain
+func Digests(eventStore *store.Store, cfg *config.Config, day string, include func(domain string) bool, now time.Time) []Digest {
+	byDomain := make(map[string]store.DailyStats)
+	for _, stats := range eventStore.GetDailyStats(day, include) {
+		byDomain[stats.Domain] = stats
+	}
+	for _, route := range cfg.Routes {
+		if _, ok := byDomain[route.Domain]; !ok && include(route.Domain) {
+			byDomain[route.Domain] = store.DailyStats{Domain: route.Domain}
+		}
+	}
+
+	digests := make([]Digest, 0, len(byDomain))
+	for domain, stats := range byDomain {
+		digest := Digest{
+			Domain:      domain,
+			Day:         day,
+			Instance:    eventStore.Instance(),
+			Complete:    day < now.Format("2006-01-02"),
+			GeneratedAt: now,
+			Counts: DigestCounts{
+				Forwarded:   stats.Forwarded,
+				Stale:       stats.Stale,
+				Skipped:     stats.Skipped,
+				Failed:      stats.Failed,
+				Dropped:     stats.Dropped,
+				Retried:     stats.Retried,
+				Quarantined: stats.Quarantined,
+			},
+			FailureReasons: stats.FailureReasons,
+			TopEndpoints:   make([]store.EndpointLatency, 0, len(stats.Endpoints)),
+		}
+		if digest.FailureReasons == nil {
+			digest.FailureReasons = make(map[string]int64)
+		}
+		for _, endpoint := range stats.Endpoints {
+			digest.TopEndpoints = append(digest.TopEndpoints, *endpoint)
+		}
+		sort.Slice(digest.TopEndpoints, func(i, j int) bool {
+			a, b := digest.TopEndpoints[i], digest.TopEndpoints[j]
+			if a.AvgLatencyMs != b.AvgLatencyMs {
+				return a.AvgLatencyMs > b.AvgLatencyMs
+			}
+			return a.Endpoint < b.Endpoint
+		})
+		if len(digest.TopEndpoints) > cfg.Reports.Digest.TopEndpoints {
+			digest.TopEndpoints = digest.TopEndpoints[:cfg.Reports.Digest.TopEndpoints]
+		}
+		digests = append(digests, digest)
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i].Domain < digests[j].Domain })
+	return digests
+}
+
+// DigestSubject returns the subject a domain's digest is published to. Characters NATS
+// does not allow in a subject token are replaced.
+func DigestSubject(prefix, domain string) string {
+	token := strings.NewReplacer(" ", "_", "*", "_", ">", "_").Replace(domain)
+	return prefix + "." + token
+}
+
+// PublishDigests publishes the digests of the day starting at day to
+// <subject_prefix>.<domain> over a short-lived connection to cfg's NATS server
+func (s *Scheduler) PublishDigests(cfg *config.Config, day time.Time) error {
+	digests := Digests(s.store, cfg, day.Format("2006-01-02"), func(string) bool { return true }, s.clock.Now())
+	if len(digests) == 0 {
+		return nil
+	}
+
+	conn, err := nats.Connect(cfg.NATS.URL, nats.Name("event-hub-digest"), nats.Timeout(10*time.Second))
+	if err != nil {
+		return fmt.Errorf("failed to connect digests to NATS: %w", err)
+	}
+	defer conn.Close()
+
+	for _, digest := range digests {
+		data, err := json.Marshal(digest)
+		if err != nil {
+			return err
+		}
+		subject := DigestSubject(cfg.Reports.Digest.SubjectPrefix, digest.Domain)
+		if err := conn.Publish(subject, data); err != nil {
+			return fmt.Errorf("failed to publish digest to %s: %w", subject, err)
+		}
+	}
+	if err := conn.FlushTimeout(10 * time.Second); err != nil {
+		return fmt.Errorf("failed to flush digests: %w", err)
+	}
+
+	logger.Logger.Info("Daily digests published",
+		zap.String("day", day.Format("2006-01-02")),
+		zap.String("subject_prefix", cfg.Reports.Digest.SubjectPrefix),
+		zap.Int("domains", len(digests)),
+	)
+	return nil
+}
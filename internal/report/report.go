@@ -0,0 +1,271 @@
+package report
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/clock"
+	"calleventhub/internal/config"
+	"calleventhub/internal/logger"
+	"calleventhub/internal/store"
+)
+
+// Outcomes of the events listed in a failed-events report
+const (
+	OutcomeFailed      = "failed"      // Out of deliveries
+	OutcomeDropped     = "dropped"     // Failed on an at_most_once route
+	OutcomeQuarantined = "quarantined" // Payload did not match the route's schema
+)
+
+// Row is one event of a failed-events report
+type Row struct {
+	Time            time.Time
+	Outcome         string
+	CallID          string
+	State           string
+	Status          string
+	DeliveryAttempt int
+	Endpoints       []string
+	Errors          []string
+}
+
+// Scheduler emails each route's contacts a daily CSV of the events of their domain that
+// failed for good the previous day, and publishes each domain's digest of the previous day
+// to NATS. Reports are built from the in-memory event store.
+type Scheduler struct {
+	store         *store.Store
+	getConfig     func() *config.Config
+	clock         clock.Clock
+	lastSent      string // Day (2006-01-02) of the last report sent
+	lastPublished string // Day (2006-01-02) of the last digests published
+	stopChan      chan struct{}
+}
+
+// NewScheduler creates a report scheduler; getConfig returns the current configuration,
+// so schedule, SMTP settings and contacts follow config reloads
+func NewScheduler(eventStore *store.Store, getConfig func() *config.Config) *Scheduler {
+	s := &Scheduler{
+		store:     eventStore,
+		getConfig: getConfig,
+		stopChan:  make(chan struct{}),
+	}
+	s.SetClock(clock.Real)
+	return s
+}
+
+// SetClock sets the time source of the schedule (the system clock by default); call it
+// before Start. Reports already due at the clock's current time are not sent.
+func (s *Scheduler) SetClock(c clock.Clock) {
+	s.clock = c
+	yesterday := c.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	s.lastSent, s.lastPublished = yesterday, yesterday
+}
+
+// Start checks every minute whether the report is due, until Stop is called
+func (s *Scheduler) Start() {
+	ticker := s.clock.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C():
+			s.check(now)
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// Stop stops the scheduler
+func (s *Scheduler) Stop() {
+	close(s.stopChan)
+}
+
+// check sends the report and publishes the digests of the previous day once their
+// configured time has passed
+func (s *Scheduler) check(now time.Time) {
+	cfg := s.getConfig()
+	if cfg == nil {
+		return
+	}
+	today := now.Format("2006-01-02")
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	if cfg.Reports.FailedEvents.Enabled && s.lastSent != today && isPast(now, cfg.Reports.FailedEvents.Time) {
+		s.lastSent = today
+		s.SendFailedEvents(cfg, midnight.AddDate(0, 0, -1))
+	}
+
+	if cfg.Reports.Digest.Enabled && s.lastPublished != today && isPast(now, cfg.Reports.Digest.Time) {
+		s.lastPublished = today
+		if err := s.PublishDigests(cfg, midnight.AddDate(0, 0, -1)); err != nil {
+			logger.Logger.Error("Failed to publish daily digests", zap.Error(err))
+		}
+	}
+}
+
+// isPast reports whether the time of day at ("15:04") has passed at now
+func isPast(now time.Time, at string) bool {
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return false
+	}
+	return now.Hour()*60+now.Minute() >= t.Hour()*60+t.Minute()
+}
+
+// SendFailedEvents emails the failed-events report of the day starting at day to the
+// contacts of every route. Errors are logged per domain.
+func (s *Scheduler) SendFailedEvents(cfg *config.Config, day time.Time) {
+	from, to := day, day.AddDate(0, 0, 1)
+	for _, route := range cfg.Routes {
+		if len(route.Contacts) == 0 {
+			continue
+		}
+		rows := FailedEventRows(s.store, route.Domain, from, to)
+		if len(rows) == 0 && !cfg.Reports.FailedEvents.SendEmpty {
+			continue
+		}
+
+		err := sendReport(cfg.Reports.SMTP, route.Contacts, route.Domain, day, rows)
+		if err != nil {
+			logger.Logger.Error("Failed to send failed-events report",
+				zap.String("domain", route.Domain),
+				zap.Strings("contacts", route.Contacts),
+				zap.Error(err),
+			)
+			continue
+		}
+		logger.Logger.Info("Failed-events report sent",
+			zap.String("domain", route.Domain),
+			zap.String("day", day.Format("2006-01-02")),
+			zap.Int("events", len(rows)),
+			zap.Int("contacts", len(route.Contacts)),
+		)
+	}
+}
+
+// FailedEventRows returns the domain's events that failed for good or were quarantined
+// in [from, to), oldest first. Failed attempts that were redelivered are not included.
+func FailedEventRows(eventStore *store.Store, domain string, from, to time.Time) []Row {
+	within := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+
+	var rows []Row
+	for _, event := range eventStore.GetFailedEventsByDomainFiltered(domain) {
+		if event.WillRetry || !within(event.FailedAt) {
+			continue
+		}
+		outcome := OutcomeFailed
+		if event.AtMostOnce {
+			outcome = OutcomeDropped
+		}
+		rows = append(rows, Row{
+			Time:            event.FailedAt,
+			Outcome:         outcome,
+			CallID:          event.CallID,
+			State:           event.State,
+			Status:          event.Status,
+			DeliveryAttempt: event.DeliveryAttempt,
+			Endpoints:       event.Endpoints,
+			Errors:          event.ErrorMessages,
+		})
+	}
+
+	quarantined := eventStore.GetQuarantinedEvents(func(d string) bool { return d == domain })
+	for _, event := range quarantined {
+		if !within(event.QuarantinedAt) {
+			continue
+		}
+		errors := append([]string{event.Reason}, event.Violations...)
+		rows = append(rows, Row{
+			Time:            event.QuarantinedAt,
+			Outcome:         OutcomeQuarantined,
+			CallID:          event.CallID,
+			DeliveryAttempt: event.DeliveryAttempt,
+			Errors:          errors,
+		})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Time.Before(rows[j].Time) })
+	return rows
+}
+
+// CSV renders report rows with a header line
+func CSV(rows []Row) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"time", "outcome", "call_id", "state", "status", "delivery_attempt", "endpoints", "errors"})
+	for _, row := range rows {
+		w.Write([]string{
+			row.Time.Format(time.RFC3339),
+			row.Outcome,
+			row.CallID,
+			row.State,
+			row.Status,
+			strconv.Itoa(row.DeliveryAttempt),
+			strings.Join(row.Endpoints, " "),
+			strings.Join(row.Errors, "; "),
+		})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// sendReport emails the CSV of a domain's report as an attachment
+func sendReport(smtpCfg config.SMTPConfig, contacts []string, domain string, day time.Time, rows []Row) error {
+	date := day.Format("2006-01-02")
+	subject := fmt.Sprintf("Failed events for %s on %s", domain, date)
+	text := fmt.Sprintf("%d event(s) of %s failed for good or were quarantined on %s. Details are in the attached CSV.\r\n", len(rows), domain, date)
+	if len(rows) == 0 {
+		text = fmt.Sprintf("No events of %s failed on %s.\r\n", domain, date)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n",
+		smtpCfg.From, strings.Join(contacts, ", "), mime.QEncoding.Encode("utf-8", subject),
+		time.Now().Format(time.RFC1123Z), mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return err
+	}
+	part.Write([]byte(text))
+
+	filename := fmt.Sprintf("failed-events-%s-%s.csv", domain, date)
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/csv; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", filename)},
+	})
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(CSV(rows))
+	for len(encoded) > 76 {
+		part.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	part.Write([]byte(encoded + "\r\n"))
+	mw.Close()
+
+	var auth smtp.Auth
+	if smtpCfg.Username != "" {
+		auth = smtp.PlainAuth("", smtpCfg.Username, smtpCfg.Password, smtpCfg.Host)
+	}
+	addr := net.JoinHostPort(smtpCfg.Host, strconv.Itoa(smtpCfg.Port))
+	return smtp.SendMail(addr, auth, smtpCfg.From, contacts, append([]byte(header), body.Bytes()...))
+}
@@ -0,0 +1,608 @@
+// Package schema validates JSON documents against a JSON Schema.
+//
+// It implements the validation keywords commonly used to describe webhook
+// payloads (draft-07 / 2019-09): type, enum, const, properties, required,
+// additionalProperties, items, min/maxItems, min/maxLength, pattern, format
+// (date-time, date, email, uri), minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, multipleOf, allOf, anyOf, oneOf, not and local $ref
+// ("#/definitions/..." or "#/$defs/..."). Other keywords are ignored.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxErrors limits how many violations are reported for one document
+const maxErrors = 10
+
+// Schema is a compiled JSON Schema
+type Schema struct {
+	root *node
+	refs map[string]*node
+}
+
+// ValidationError lists the violations found in a document
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "schema validation failed: " + strings.Join(e.Violations, "; ")
+}
+
+// node is a compiled (sub)schema
+type node struct {
+	always *bool // Boolean schema: true accepts everything, false nothing
+
+	types      []string
+	enum       []interface{}
+	constValue interface{}
+	hasConst   bool
+
+	properties    map[string]*node
+	required      []string
+	additional    *node
+	minProperties *int
+	maxProperties *int
+
+	items    *node
+	minItems *int
+	maxItems *int
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+	format    string
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*node
+	anyOf []*node
+	oneOf []*node
+	not   *node
+
+	ref string // Key of the referenced schema in Schema.refs
+}
+
+// compiler builds nodes and resolves local references
+type compiler struct {
+	document interface{}
+	refs     map[string]*node
+}
+
+// Compile parses and compiles a JSON Schema document
+func Compile(data []byte) (*Schema, error) {
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	c := &compiler{document: document, refs: make(map[string]*node)}
+	root, err := c.compile(document, "#")
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root: root, refs: c.refs}, nil
+}
+
+func (c *compiler) compile(value interface{}, path string) (*node, error) {
+	switch v := value.(type) {
+	case bool:
+		return &node{always: &v}, nil
+	case map[string]interface{}:
+		return c.compileObject(v, path)
+	default:
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", path)
+	}
+}
+
+func (c *compiler) compileObject(m map[string]interface{}, path string) (*node, error) {
+	n := &node{}
+	var err error
+
+	if ref, ok := m["$ref"].(string); ok {
+		if err := c.resolve(ref); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		n.ref = ref
+	}
+
+	switch t := m["type"].(type) {
+	case nil:
+	case string:
+		n.types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/type: must be a string or array of strings", path)
+			}
+			n.types = append(n.types, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s/type: must be a string or array of strings", path)
+	}
+	for _, t := range n.types {
+		switch t {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("%s/type: unknown type %q", path, t)
+		}
+	}
+
+	if enum, ok := m["enum"]; ok {
+		values, ok := enum.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/enum: must be an array", path)
+		}
+		n.enum = values
+	}
+	if value, ok := m["const"]; ok {
+		n.constValue, n.hasConst = value, true
+	}
+
+	if props, ok := m["properties"]; ok {
+		pm, ok := props.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/properties: must be an object", path)
+		}
+		n.properties = make(map[string]*node, len(pm))
+		for name, sub := range pm {
+			if n.properties[name], err = c.compile(sub, path+"/properties/"+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if req, ok := m["required"]; ok {
+		list, ok := req.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/required: must be an array of strings", path)
+		}
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/required: must be an array of strings", path)
+			}
+			n.required = append(n.required, s)
+		}
+	}
+	if sub, ok := m["additionalProperties"]; ok {
+		if n.additional, err = c.compile(sub, path+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+	if sub, ok := m["items"]; ok {
+		if n.items, err = c.compile(sub, path+"/items"); err != nil {
+			return nil, err
+		}
+	}
+	if n.not, err = c.optionalSchema(m, "not", path); err != nil {
+		return nil, err
+	}
+	for keyword, target := range map[string]*[]*node{"allOf": &n.allOf, "anyOf": &n.anyOf, "oneOf": &n.oneOf} {
+		if *target, err = c.schemaList(m, keyword, path); err != nil {
+			return nil, err
+		}
+	}
+
+	for keyword, target := range map[string]**int{
+		"minLength": &n.minLength, "maxLength": &n.maxLength,
+		"minItems": &n.minItems, "maxItems": &n.maxItems,
+		"minProperties": &n.minProperties, "maxProperties": &n.maxProperties,
+	} {
+		if *target, err = nonNegativeInt(m, keyword, path); err != nil {
+			return nil, err
+		}
+	}
+	for keyword, target := range map[string]**float64{
+		"minimum": &n.minimum, "maximum": &n.maximum,
+		"exclusiveMinimum": &n.exclusiveMinimum, "exclusiveMaximum": &n.exclusiveMaximum,
+		"multipleOf": &n.multipleOf,
+	} {
+		if *target, err = number(m, keyword, path); err != nil {
+			return nil, err
+		}
+	}
+	if n.multipleOf != nil && *n.multipleOf <= 0 {
+		return nil, fmt.Errorf("%s/multipleOf: must be greater than 0", path)
+	}
+
+	if p, ok := m["pattern"]; ok {
+		s, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/pattern: must be a string", path)
+		}
+		if n.pattern, err = regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %w", path, err)
+		}
+	}
+	if f, ok := m["format"].(string); ok {
+		n.format = f
+	}
+
+	return n, nil
+}
+
+// resolve compiles the target of a local reference once
+func (c *compiler) resolve(ref string) error {
+	if _, ok := c.refs[ref]; ok {
+		return nil
+	}
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return fmt.Errorf("only local $ref values (#/...) are supported, got %q", ref)
+	}
+	target := c.document
+	if ref != "#" {
+		for _, token := range strings.Split(ref[2:], "/") {
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			if unescaped, err := url.PathUnescape(token); err == nil {
+				token = unescaped
+			}
+			obj, ok := target.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("unresolved $ref %q", ref)
+			}
+			if target, ok = obj[token]; !ok {
+				return fmt.Errorf("unresolved $ref %q", ref)
+			}
+		}
+	}
+	// Register first so recursive references terminate
+	c.refs[ref] = nil
+	n, err := c.compile(target, ref)
+	if err != nil {
+		return err
+	}
+	c.refs[ref] = n
+	return nil
+}
+
+func (c *compiler) optionalSchema(m map[string]interface{}, keyword, path string) (*node, error) {
+	sub, ok := m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	return c.compile(sub, path+"/"+keyword)
+}
+
+func (c *compiler) schemaList(m map[string]interface{}, keyword, path string) ([]*node, error) {
+	raw, ok := m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%s/%s: must be a non-empty array", path, keyword)
+	}
+	nodes := make([]*node, len(list))
+	for i, sub := range list {
+		var err error
+		if nodes[i], err = c.compile(sub, fmt.Sprintf("%s/%s/%d", path, keyword, i)); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+func nonNegativeInt(m map[string]interface{}, keyword, path string) (*int, error) {
+	raw, ok := m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := raw.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("%s/%s: must be a non-negative integer", path, keyword)
+	}
+	i := int(f)
+	return &i, nil
+}
+
+func number(m map[string]interface{}, keyword, path string) (*float64, error) {
+	raw, ok := m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := raw.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: must be a number", path, keyword)
+	}
+	return &f, nil
+}
+
+// Validate checks a decoded JSON document (as produced by encoding/json into an
+// interface{}) and returns a *ValidationError listing the violations
+func (s *Schema) Validate(document interface{}) error {
+	v := &validator{refs: s.refs}
+	v.validate(s.root, document, "")
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: v.violations}
+}
+
+// ValidateJSON decodes and validates a JSON document
+func (s *Schema) ValidateJSON(data []byte) error {
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return s.Validate(document)
+}
+
+type validator struct {
+	refs       map[string]*node
+	violations []string
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	if len(v.violations) >= maxErrors {
+		return
+	}
+	if path == "" {
+		path = "/"
+	}
+	v.violations = append(v.violations, path+": "+fmt.Sprintf(format, args...))
+}
+
+// valid reports whether value matches n without recording violations
+func (v *validator) valid(n *node, value interface{}, path string) bool {
+	probe := &validator{refs: v.refs}
+	probe.validate(n, value, path)
+	return len(probe.violations) == 0
+}
+
+func (v *validator) validate(n *node, value interface{}, path string) {
+	if n.always != nil {
+		if !*n.always {
+			v.fail(path, "no value is allowed here")
+		}
+		return
+	}
+	if n.ref != "" {
+		v.validate(v.refs[n.ref], value, path)
+	}
+
+	if len(n.types) > 0 && !matchesType(n.types, value) {
+		v.fail(path, "expected %s, got %s", strings.Join(n.types, " or "), typeName(value))
+		return
+	}
+	if n.enum != nil && !containsValue(n.enum, value) {
+		v.fail(path, "value %s is not one of %s", encode(value), encode(n.enum))
+	}
+	if n.hasConst && !equal(n.constValue, value) {
+		v.fail(path, "value %s must be %s", encode(value), encode(n.constValue))
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(n, val, path)
+	case []interface{}:
+		v.validateArray(n, val, path)
+	case string:
+		v.validateString(n, val, path)
+	case float64:
+		v.validateNumber(n, val, path)
+	}
+
+	for _, sub := range n.allOf {
+		v.validate(sub, value, path)
+	}
+	if n.anyOf != nil {
+		matched := false
+		for _, sub := range n.anyOf {
+			if v.valid(sub, value, path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "value does not match any of the anyOf schemas")
+		}
+	}
+	if n.oneOf != nil {
+		count := 0
+		for _, sub := range n.oneOf {
+			if v.valid(sub, value, path) {
+				count++
+			}
+		}
+		if count != 1 {
+			v.fail(path, "value matches %d of the oneOf schemas, expected exactly 1", count)
+		}
+	}
+	if n.not != nil && v.valid(n.not, value, path) {
+		v.fail(path, "value must not match the \"not\" schema")
+	}
+}
+
+func (v *validator) validateObject(n *node, obj map[string]interface{}, path string) {
+	for _, name := range n.required {
+		if _, ok := obj[name]; !ok {
+			v.fail(path, "missing required property %q", name)
+		}
+	}
+	if n.minProperties != nil && len(obj) < *n.minProperties {
+		v.fail(path, "has %d properties, minimum is %d", len(obj), *n.minProperties)
+	}
+	if n.maxProperties != nil && len(obj) > *n.maxProperties {
+		v.fail(path, "has %d properties, maximum is %d", len(obj), *n.maxProperties)
+	}
+
+	// Sorted so violations are reported in a stable order
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		childPath := path + "/" + name
+		if sub, ok := n.properties[name]; ok {
+			v.validate(sub, obj[name], childPath)
+		} else if n.additional != nil {
+			if n.additional.always != nil && !*n.additional.always {
+				v.fail(childPath, "additional property is not allowed")
+			} else {
+				v.validate(n.additional, obj[name], childPath)
+			}
+		}
+	}
+}
+
+func (v *validator) validateArray(n *node, arr []interface{}, path string) {
+	if n.minItems != nil && len(arr) < *n.minItems {
+		v.fail(path, "has %d items, minimum is %d", len(arr), *n.minItems)
+	}
+	if n.maxItems != nil && len(arr) > *n.maxItems {
+		v.fail(path, "has %d items, maximum is %d", len(arr), *n.maxItems)
+	}
+	if n.items != nil {
+		for i, item := range arr {
+			v.validate(n.items, item, path+"/"+strconv.Itoa(i))
+		}
+	}
+}
+
+func (v *validator) validateString(n *node, s string, path string) {
+	length := utf8.RuneCountInString(s)
+	if n.minLength != nil && length < *n.minLength {
+		v.fail(path, "string is %d characters, minimum is %d", length, *n.minLength)
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		v.fail(path, "string is %d characters, maximum is %d", length, *n.maxLength)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(s) {
+		v.fail(path, "%q does not match pattern %q", s, n.pattern.String())
+	}
+	if n.format != "" && !matchesFormat(n.format, s) {
+		v.fail(path, "%q is not a valid %s", s, n.format)
+	}
+}
+
+func (v *validator) validateNumber(n *node, f float64, path string) {
+	if n.minimum != nil && f < *n.minimum {
+		v.fail(path, "%v is less than minimum %v", f, *n.minimum)
+	}
+	if n.maximum != nil && f > *n.maximum {
+		v.fail(path, "%v is greater than maximum %v", f, *n.maximum)
+	}
+	if n.exclusiveMinimum != nil && f <= *n.exclusiveMinimum {
+		v.fail(path, "%v must be greater than %v", f, *n.exclusiveMinimum)
+	}
+	if n.exclusiveMaximum != nil && f >= *n.exclusiveMaximum {
+		v.fail(path, "%v must be less than %v", f, *n.exclusiveMaximum)
+	}
+	if n.multipleOf != nil {
+		if q := f / *n.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "%v is not a multiple of %v", f, *n.multipleOf)
+		}
+	}
+}
+
+func matchesType(types []string, value interface{}) bool {
+	for _, t := range types {
+		switch val := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && val == math.Trunc(val)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeName(value interface{}) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func matchesFormat(format, s string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	case "uri":
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != ""
+	default:
+		// Unknown formats are annotations only
+		return true
+	}
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if equal(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func encode(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
@@ -0,0 +1,29 @@
+// Package service integrates the process with the host init system:
+// sd_notify on Linux (systemd Type=notify) and the Service Control Manager
+// on Windows. On other platforms, or when not started by an init system,
+// every function is a no-op.
+package service
+
+// DefaultName is the service name used for SCM registration
+const DefaultName = "telephony-forwarder"
+
+// Ready reports that the service has finished starting up
+func Ready() {
+	ready()
+}
+
+// Stopping reports that the service has begun shutting down
+func Stopping() {
+	stopping()
+}
+
+// Stopped reports that shutdown is complete; call it right before exiting
+func Stopped() {
+	stopped()
+}
+
+// StopRequests returns a channel that is closed when the init system asks
+// the service to stop. It is nil (never ready) when there is no such source.
+func StopRequests() <-chan struct{} {
+	return stopRequests()
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+)
+
+// Init is a no-op on Linux; systemd is reached through NOTIFY_SOCKET
+func Init(name string) error {
+	return nil
+}
+
+// Install is only supported on Windows
+func Install(name string, args []string) error {
+	return fmt.Errorf("service install is only supported on windows, use a systemd unit instead")
+}
+
+// Uninstall is only supported on Windows
+func Uninstall(name string) error {
+	return fmt.Errorf("service uninstall is only supported on windows")
+}
+
+func ready() {
+	sdNotify("READY=1")
+}
+
+func stopping() {
+	sdNotify("STOPPING=1")
+}
+
+func stopped() {}
+
+func stopRequests() <-chan struct{} {
+	return nil
+}
+
+// sdNotify sends a state update to systemd if NOTIFY_SOCKET is set
+func sdNotify(state string) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		logger.Logger.Warn("Failed to connect to systemd notify socket", zap.String("socket", socketPath), zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		logger.Logger.Warn("Failed to send systemd notification", zap.String("state", state), zap.Error(err))
+	}
+}
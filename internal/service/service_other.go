@@ -0,0 +1,30 @@
+//go:build !linux && !windows
+
+package service
+
+import "fmt"
+
+// Init is a no-op on this platform
+func Init(name string) error {
+	return nil
+}
+
+// Install is only supported on Windows
+func Install(name string, args []string) error {
+	return fmt.Errorf("service install is only supported on windows")
+}
+
+// Uninstall is only supported on Windows
+func Uninstall(name string) error {
+	return fmt.Errorf("service uninstall is only supported on windows")
+}
+
+func ready() {}
+
+func stopping() {}
+
+func stopped() {}
+
+func stopRequests() <-chan struct{} {
+	return nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"calleventhub/internal/logger"
+)
+
+var (
+	isService bool
+
+	readyCh    = make(chan struct{})
+	stoppingCh = make(chan struct{})
+	stopCh     = make(chan struct{})
+	doneCh     = make(chan struct{})
+	exitedCh   = make(chan struct{})
+
+	readyOnce    sync.Once
+	stoppingOnce sync.Once
+	stopOnce     sync.Once
+	doneOnce     sync.Once
+)
+
+// Init starts the SCM dispatcher when the process was launched as a Windows service
+func Init(name string) error {
+	is, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("failed to detect windows service: %w", err)
+	}
+	if !is {
+		return nil
+	}
+	isService = true
+
+	go func() {
+		defer close(exitedCh)
+		if err := svc.Run(name, &handler{}); err != nil {
+			logger.Logger.Error("Windows service dispatcher failed", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Install registers the current executable with the SCM, passing args on start
+func Install(name string, args []string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to resolve executable path: %w", err)
+	}
+	exePath, err = filepath.Abs(exePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve executable path: %w", err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", name)
+	}
+
+	s, err := m.CreateService(name, exePath, mgr.Config{
+		DisplayName: "Telephony Event Forwarder",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	return nil
+}
+
+// Uninstall removes the service registration from the SCM
+func Uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", name, err)
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+
+	return nil
+}
+
+func ready() {
+	readyOnce.Do(func() { close(readyCh) })
+}
+
+func stopping() {
+	stoppingOnce.Do(func() { close(stoppingCh) })
+}
+
+// stopped lets the SCM handler report Stopped and waits briefly for it,
+// so the SCM does not treat the exit as a crash
+func stopped() {
+	if !isService {
+		return
+	}
+	doneOnce.Do(func() { close(doneCh) })
+	select {
+	case <-exitedCh:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func stopRequests() <-chan struct{} {
+	if !isService {
+		return nil
+	}
+	return stopCh
+}
+
+// handler implements svc.Handler and bridges SCM requests to the channels above
+type handler struct{}
+
+// Execute is called by the SCM dispatcher for the lifetime of the service
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.StartPending}
+
+	ready := readyCh
+	stopping := stoppingCh
+	for {
+		select {
+		case <-ready:
+			status <- svc.Status{State: svc.Running, Accepts: accepted}
+			ready = nil
+		case <-stopping:
+			status <- svc.Status{State: svc.StopPending}
+			stopping = nil
+		case <-doneCh:
+			status <- svc.Status{State: svc.Stopped}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				stopOnce.Do(func() { close(stopCh) })
+			}
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Package sla keeps persistent per-domain delivery counts and builds the monthly delivery
+// guarantee report from them
+package sla
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"calleventhub/internal/logger"
+)
+
+// flushInterval is how often counted outcomes are written to the KV bucket
+const flushInterval = 10 * time.Second
+
+// Outcome is what became of an event, as counted by the report
+type Outcome int
+
+const (
+	Accepted     Outcome = iota // Ingested and stored in the stream (or spooled)
+	Delivered                   // Forwarded to all the endpoints it was routed to
+	DeadLettered                // Failed on its last delivery, or quarantined
+	Skipped                     // Not forwarded by configuration (route disabled, or stale without stale_endpoints)
+)
+
+// Counts are the events of one domain per outcome
+type Counts struct {
+	Accepted     int64 `json:"accepted"`
+	Delivered    int64 `json:"delivered"`
+	DeadLettered int64 `json:"dead_lettered"`
+	Skipped      int64 `json:"skipped"`
+}
+
+// add adds other to c
+func (c *Counts) add(other Counts) {
+	c.Accepted += other.Accepted
+	c.Delivered += other.Delivered
+	c.DeadLettered += other.DeadLettered
+	c.Skipped += other.Skipped
+}
+
+// record counts one event with outcome
+func (c *Counts) record(outcome Outcome) {
+	switch outcome {
+	case Accepted:
+		c.Accepted++
+	case Delivered:
+		c.Delivered++
+	case DeadLettered:
+		c.DeadLettered++
+	case Skipped:
+		c.Skipped++
+	}
+}
+
+// monthCounts are the counts of one month, by domain and day (2006-01-02)
+type monthCounts map[string]map[string]*Counts
+
+// add adds the counts of other to m
+func (m monthCounts) add(other monthCounts) {
+	for domain, days := range other {
+		for day, c := range days {
+			m.counts(domain, day).add(*c)
+		}
+	}
+}
+
+// counts returns the counts of a domain's day, creating them if needed
+func (m monthCounts) counts(domain, day string) *Counts {
+	days, ok := m[domain]
+	if !ok {
+		days = make(map[string]*Counts)
+		m[domain] = days
+	}
+	c, ok := days[day]
+	if !ok {
+		c = &Counts{}
+		days[day] = c
+	}
+	return c
+}
+
+// invalidKeyChars are the characters an instance ID cannot have in a KV key
+var invalidKeyChars = regexp.MustCompile(`[^-_=a-zA-Z0-9]`)
+
+// Counters counts event outcomes per domain and day in a JetStream KV bucket. Each instance
+// writes its own key per month ("2006-01.<instance>"), so instances never overwrite each
+// other's counts; the report adds them up.
+type Counters struct {
+	kv       nats.KeyValue
+	instance string // Instance part of the keys
+
+	mu      sync.Mutex
+	pending map[string]monthCounts // Counted but not yet written, by month
+
+	stopChan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Open opens (creating the bucket if needed) the counters of an instance. Counts are kept
+// for retention after their month was last written.
+func Open(js nats.JetStreamContext, bucket, instanceID string, retention time.Duration) (*Counters, error) {
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Per-domain daily delivery counts of event-hub instances",
+			History:     1,
+			TTL:         retention,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open delivery counters bucket %s: %w", bucket, err)
+	}
+
+	c := &Counters{
+		kv:       kv,
+		instance: invalidKeyChars.ReplaceAllString(instanceID, "_"),
+		pending:  make(map[string]monthCounts),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+// Record counts one event of domain with outcome at the (local) day of at
+func (c *Counters) Record(domain string, outcome Outcome, at time.Time) {
+	month := at.Format("2006-01")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.pending[month]
+	if !ok {
+		m = make(monthCounts)
+		c.pending[month] = m
+	}
+	m.counts(domain, at.Format("2006-01-02")).record(outcome)
+}
+
+// run writes counted outcomes periodically until Close
+func (c *Counters) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			if err := c.flush(); err != nil {
+				logger.Logger.Warn("Failed to write delivery counters", zap.Error(err))
+			}
+		}
+	}
+}
+
+// flush adds the pending counts of each month to the instance's stored counts. Counts that
+// could not be written stay pending and are retried at the next flush.
+func (c *Counters) flush() error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[string]monthCounts)
+	c.mu.Unlock()
+
+	var failed error
+	for month, counts := range pending {
+		if err := c.write(month, counts); err != nil {
+			failed = err
+			c.mu.Lock()
+			if m, ok := c.pending[month]; ok {
+				counts.add(m)
+			}
+			c.pending[month] = counts
+			c.mu.Unlock()
+		}
+	}
+	return failed
+}
+
+// write adds counts to the stored counts of a month
+func (c *Counters) write(month string, counts monthCounts) error {
+	key := month + "." + c.instance
+	for attempt := 0; attempt < 5; attempt++ {
+		stored := make(monthCounts)
+		var revision uint64
+		entry, err := c.kv.Get(key)
+		switch {
+		case errors.Is(err, nats.ErrKeyNotFound):
+		case err != nil:
+			return fmt.Errorf("failed to read delivery counters %s: %w", key, err)
+		default:
+			revision = entry.Revision()
+			if err := json.Unmarshal(entry.Value(), &stored); err != nil {
+				return fmt.Errorf("invalid delivery counters %s: %w", key, err)
+			}
+		}
+
+		stored.add(counts)
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		if revision == 0 {
+			_, err = c.kv.Create(key, data)
+		} else {
+			_, err = c.kv.Update(key, data, revision)
+		}
+		if err == nil {
+			return nil
+		}
+		var apiErr *nats.APIError
+		if !errors.Is(err, nats.ErrKeyExists) && !(errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence) {
+			return fmt.Errorf("failed to write delivery counters %s: %w", key, err)
+		}
+		// Written meanwhile (another process with the same instance ID) - read again and retry
+	}
+	return fmt.Errorf("failed to write delivery counters %s: too many concurrent updates", key)
+}
+
+// Month returns the counts of every instance for a month (2006-01), by domain and day,
+// including those of this instance not written yet
+func (c *Counters) Month(ctx context.Context, month string) (map[string]map[string]Counts, error) {
+	total := make(monthCounts)
+
+	watcher, err := c.kv.Watch(month+".>", nats.IgnoreDeletes(), nats.Context(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delivery counters: %w", err)
+	}
+	defer watcher.Stop()
+	for {
+		var entry nats.KeyValueEntry
+		select {
+		case entry = <-watcher.Updates():
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to read delivery counters: %w", ctx.Err())
+		}
+		if entry == nil {
+			break // All stored values received
+		}
+		stored := make(monthCounts)
+		if err := json.Unmarshal(entry.Value(), &stored); err != nil {
+			logger.Logger.Warn("Ignoring invalid delivery counters", zap.String("key", entry.Key()), zap.Error(err))
+			continue
+		}
+		total.add(stored)
+	}
+
+	c.mu.Lock()
+	if pending, ok := c.pending[month]; ok {
+		total.add(pending)
+	}
+	c.mu.Unlock()
+
+	result := make(map[string]map[string]Counts, len(total))
+	for domain, days := range total {
+		result[domain] = make(map[string]Counts, len(days))
+		for day, counts := range days {
+			result[domain][day] = *counts
+		}
+	}
+	return result, nil
+}
+
+// Close stops the periodic writes and writes any remaining counts
+func (c *Counters) Close() {
+	c.stopOnce.Do(func() {
+		close(c.stopChan)
+		<-c.done
+		if err := c.flush(); err != nil {
+			logger.Logger.Warn("Failed to write delivery counters", zap.Error(err))
+		}
+	})
+}
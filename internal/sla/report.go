@@ -0,0 +1,104 @@
+package sla
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Day are the counts of one day
+type Day struct {
+	Day string `json:"day"` // 2006-01-02
+	Counts
+}
+
+// DomainReport is the delivery report of one domain for a month
+type DomainReport struct {
+	Domain string `json:"domain"`
+	Days   []Day  `json:"days"` // Every day of the month up to the report's day, in order
+	Total  Counts `json:"total"`
+	// Delivered events among the delivered and dead-lettered ones (100 if there were none)
+	DeliveredPercent float64 `json:"delivered_percent"`
+}
+
+// Report is the delivery guarantee report of a month: the events accepted, delivered and
+// dead-lettered per domain and day, over all instances
+type Report struct {
+	Month       string         `json:"month"` // 2006-01
+	Complete    bool           `json:"complete"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Domains     []DomainReport `json:"domains"` // Sorted by domain
+}
+
+// Build builds the report of a month (2006-01) as of now, for the domains include accepts
+func Build(ctx context.Context, counters *Counters, month string, include func(domain string) bool, now time.Time) (*Report, error) {
+	start, err := time.ParseInLocation("2006-01", month, now.Location())
+	if err != nil {
+		return nil, fmt.Errorf("month must be YYYY-MM")
+	}
+	counts, err := counters.Month(ctx, month)
+	if err != nil {
+		return nil, err
+	}
+
+	// Days of the month, up to today for the current month
+	end := start.AddDate(0, 1, 0)
+	complete := !now.Before(end)
+	if !complete {
+		end = now
+	}
+	var days []string
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		days = append(days, d.Format("2006-01-02"))
+	}
+
+	report := &Report{Month: month, Complete: complete, GeneratedAt: now, Domains: []DomainReport{}}
+	for domain, byDay := range counts {
+		if !include(domain) {
+			continue
+		}
+		dr := DomainReport{Domain: domain, Days: make([]Day, 0, len(days))}
+		for _, day := range days {
+			c := byDay[day]
+			dr.Days = append(dr.Days, Day{Day: day, Counts: c})
+			dr.Total.add(c)
+		}
+		dr.DeliveredPercent = 100
+		if finished := dr.Total.Delivered + dr.Total.DeadLettered; finished > 0 {
+			dr.DeliveredPercent = float64(dr.Total.Delivered) * 100 / float64(finished)
+		}
+		report.Domains = append(report.Domains, dr)
+	}
+	sort.Slice(report.Domains, func(i, j int) bool {
+		return report.Domains[i].Domain < report.Domains[j].Domain
+	})
+	return report, nil
+}
+
+// CSV renders the report as CSV: one row per domain and day, then the domain's total
+func (r *Report) CSV() []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"domain", "day", "accepted", "delivered", "dead_lettered", "skipped", "delivered_percent"})
+	row := func(domain, day string, c Counts, percent string) {
+		w.Write([]string{domain, day,
+			strconv.FormatInt(c.Accepted, 10),
+			strconv.FormatInt(c.Delivered, 10),
+			strconv.FormatInt(c.DeadLettered, 10),
+			strconv.FormatInt(c.Skipped, 10),
+			percent,
+		})
+	}
+	for _, dr := range r.Domains {
+		for _, day := range dr.Days {
+			row(dr.Domain, day.Day, day.Counts, "")
+		}
+		row(dr.Domain, "total", dr.Total, strconv.FormatFloat(dr.DeliveredPercent, 'f', 3, 64))
+	}
+	w.Flush()
+	return buf.Bytes()
+}
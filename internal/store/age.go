@@ -0,0 +1,68 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// AgeBuckets are the upper bounds (seconds) of the event age histogram
+var AgeBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600}
+
+// AgeMetrics is the distribution of how old a domain's events were (since they were
+// stored in the stream) when they were forwarded successfully. Like SinkMetrics they are
+// never evicted, so they can be exported as a histogram.
+type AgeMetrics struct {
+	Domain     string  `json:"domain"`
+	Count      int64   `json:"count"`
+	AvgSeconds float64 `json:"avg_seconds"`
+	MaxSeconds float64 `json:"max_seconds"`
+	SumSeconds float64 `json:"-"`
+	Counts     []int64 `json:"-"` // Per AgeBuckets entry, plus one for +Inf (not cumulative)
+}
+
+// recordAge adds the age of a forwarded event to its domain's histogram (events with an
+// unknown publish time are not counted); caller must hold the write lock
+func (s *Store) recordAge(domain string, delivery Delivery, now time.Time) {
+	if delivery.PublishedAt.IsZero() {
+		return
+	}
+	m, ok := s.ageMetrics[domain]
+	if !ok {
+		m = &AgeMetrics{Domain: domain, Counts: make([]int64, len(AgeBuckets)+1)}
+		s.ageMetrics[domain] = m
+	}
+
+	seconds := delivery.elapsed(now)
+	if seconds < 0 {
+		seconds = 0 // Clock skew between the NATS server and this instance
+	}
+	m.Count++
+	m.SumSeconds += seconds
+	if seconds > m.MaxSeconds {
+		m.MaxSeconds = seconds
+	}
+	m.Counts[sort.SearchFloat64s(AgeBuckets, seconds)]++
+}
+
+// GetAgeMetrics returns a copy of the event age histogram of every domain accepted by
+// include, ordered by domain
+func (s *Store) GetAgeMetrics(include func(domain string) bool) []AgeMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]AgeMetrics, 0, len(s.ageMetrics))
+	for domain, m := range s.ageMetrics {
+		if !include(domain) {
+			continue
+		}
+		c := *m
+		c.Counts = append([]int64(nil), m.Counts...)
+		if c.Count > 0 {
+			c.AvgSeconds = c.SumSeconds / float64(c.Count)
+		}
+		result = append(result, c)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Domain < result[j].Domain })
+	return result
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// maxAnnotations bounds the annotations kept; the oldest are dropped beyond it
+const maxAnnotations = 1000
+
+// Annotation is an operator note about an incident or change (a deploy, a backend outage),
+// returned with stats and event queries so failure spikes can be lined up with known causes
+type Annotation struct {
+	ID          uint64     `json:"id"`
+	Start       time.Time  `json:"start"`
+	End         *time.Time `json:"end,omitempty"`     // nil while ongoing
+	Domains     []string   `json:"domains,omitempty"` // Affected domains (empty = all)
+	Description string     `json:"description"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// overlaps reports whether the annotation covers part of the window (zero bounds are open)
+func (a *Annotation) overlaps(since, until time.Time) bool {
+	if !until.IsZero() && a.Start.After(until) {
+		return false
+	}
+	return since.IsZero() || a.End == nil || !a.End.Before(since)
+}
+
+// Visible returns the annotation with only the domains accepted by include, and false if
+// it names domains but none of them is accepted. Annotations of all domains are always visible.
+func (a Annotation) Visible(include func(domain string) bool) (Annotation, bool) {
+	if len(a.Domains) == 0 {
+		return a, true
+	}
+	domains := make([]string, 0, len(a.Domains))
+	for _, domain := range a.Domains {
+		if include(domain) {
+			domains = append(domains, domain)
+		}
+	}
+	a.Domains = domains
+	return a, len(domains) > 0
+}
+
+// AddAnnotation stores an annotation and returns it with its ID and timestamps set
+func (s *Store) AddAnnotation(a Annotation) Annotation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastAnnotationID++
+	a.ID = s.lastAnnotationID
+	a.CreatedAt = s.clock.Now()
+	a.UpdatedAt = a.CreatedAt
+	s.annotations = append(s.annotations, a)
+	if len(s.annotations) > maxAnnotations {
+		s.annotations = append([]Annotation(nil), s.annotations[len(s.annotations)-maxAnnotations:]...)
+	}
+	return a
+}
+
+// UpdateAnnotation replaces the start, end, domains and description of an annotation;
+// ok is false if no annotation has the ID
+func (s *Store) UpdateAnnotation(id uint64, a Annotation) (Annotation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.annotations {
+		existing := &s.annotations[i]
+		if existing.ID != id {
+			continue
+		}
+		existing.Start, existing.End = a.Start, a.End
+		existing.Domains, existing.Description = a.Domains, a.Description
+		existing.UpdatedAt = s.clock.Now()
+		return *existing, true
+	}
+	return Annotation{}, false
+}
+
+// DeleteAnnotation removes an annotation; it returns false if no annotation has the ID
+func (s *Store) DeleteAnnotation(id uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.annotations {
+		if s.annotations[i].ID == id {
+			s.annotations = append(s.annotations[:i], s.annotations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// GetAnnotation returns the annotation with the ID
+func (s *Store) GetAnnotation(id uint64) (Annotation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, a := range s.annotations {
+		if a.ID == id {
+			return a, true
+		}
+	}
+	return Annotation{}, false
+}
+
+// GetAnnotations returns the annotations overlapping the window (zero bounds are open)
+// that concern all domains or a domain accepted by include, oldest start first.
+// Their domains are restricted to the accepted ones.
+func (s *Store) GetAnnotations(since, until time.Time, include func(domain string) bool) []Annotation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Annotation, 0)
+	for _, a := range s.annotations {
+		if !a.overlaps(since, until) {
+			continue
+		}
+		if a, ok := a.Visible(include); ok {
+			result = append(result, a)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	return result
+}
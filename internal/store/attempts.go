@@ -0,0 +1,56 @@
+package store
+
+import "time"
+
+// FailedAttempt is one failed delivery attempt of a stream message
+type FailedAttempt struct {
+	Attempt       int              `json:"attempt"` // JetStream delivery count
+	FailedAt      time.Time        `json:"failed_at"`
+	Endpoints     []string         `json:"endpoints"`
+	ErrorMessages []string         `json:"error_messages"`
+	Results       []DeliveryResult `json:"results,omitempty"`
+	Instance      string           `json:"instance,omitempty"`
+}
+
+// sameMessage reports whether a stored failure is an earlier attempt of the message being
+// recorded: same domain, call and stream publish time, within the same replay (or none)
+func (e *FailedEvent) sameMessage(domain, callID string, delivery Delivery) bool {
+	return !delivery.PublishedAt.IsZero() &&
+		e.PublishedAt.Equal(delivery.PublishedAt) &&
+		e.CallID == callID &&
+		e.Domain == domain &&
+		e.Replay == delivery.Replay
+}
+
+// takeFailedAttempts removes the stored failure of an earlier attempt of the message, and
+// returns its attempts and ID (0 if there is none); caller must hold the write lock
+func (s *Store) takeFailedAttempts(domain, callID string, delivery Delivery) ([]FailedAttempt, uint64) {
+	for i := len(s.failedEvents) - 1; i >= 0; i-- {
+		e := &s.failedEvents[i]
+		if !e.sameMessage(domain, callID, delivery) {
+			continue
+		}
+		attempts, id := e.Attempts, e.ID
+		s.release(e.Event, e.packed, e.rawSize)
+		copy(s.failedEvents[i:], s.failedEvents[i+1:])
+		s.failedEvents[len(s.failedEvents)-1] = FailedEvent{}
+		s.failedEvents = s.failedEvents[:len(s.failedEvents)-1]
+		return attempts, id
+	}
+	return nil, 0
+}
+
+// attemptedEndpoints returns every endpoint tried across the attempts, in first-tried order
+func attemptedEndpoints(attempts []FailedAttempt) []string {
+	seen := make(map[string]bool)
+	var endpoints []string
+	for _, attempt := range attempts {
+		for _, endpoint := range attempt.Endpoints {
+			if !seen[endpoint] {
+				seen[endpoint] = true
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	}
+	return endpoints
+}
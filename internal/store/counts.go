@@ -0,0 +1,68 @@
+package store
+
+// Counts are the event counts of GetStats, in a form that adds up across instances
+type Counts struct {
+	Successful         int            `json:"total_successful"`
+	Failed             int            `json:"total_failed"`
+	Retrying           int            `json:"retry_count"`   // Failed events that will be redelivered
+	Dropped            int            `json:"dropped_count"` // Failed events of at-most-once routes, not retried
+	SuccessfulByDomain map[string]int `json:"successful_domain_count"`
+	FailedByDomain     map[string]int `json:"failed_domain_count"`
+	EvictedForMemory   int64          `json:"evicted_for_memory"`
+	EvictedForQuota    int64          `json:"evicted_for_quota"`
+}
+
+// GetCounts returns the counts of the stored events
+func (s *Store) GetCounts() Counts {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.counts()
+}
+
+// counts counts the stored events; caller must hold the lock
+func (s *Store) counts() Counts {
+	c := Counts{
+		Successful:         len(s.successfulEvents),
+		Failed:             len(s.failedEvents),
+		SuccessfulByDomain: make(map[string]int),
+		FailedByDomain:     make(map[string]int),
+		EvictedForMemory:   s.evictedForMemory,
+		EvictedForQuota:    s.evictedForQuota,
+	}
+	for _, event := range s.successfulEvents {
+		c.SuccessfulByDomain[event.Domain]++
+	}
+	// Count retry attempts, and failures of at-most-once routes that are not retried
+	for _, event := range s.failedEvents {
+		c.FailedByDomain[event.Domain]++
+		if event.WillRetry {
+			c.Retrying++
+		}
+		if event.AtMostOnce {
+			c.Dropped++
+		}
+	}
+	return c
+}
+
+// Add adds the counts of another instance
+func (c *Counts) Add(other Counts) {
+	c.Successful += other.Successful
+	c.Failed += other.Failed
+	c.Retrying += other.Retrying
+	c.Dropped += other.Dropped
+	c.EvictedForMemory += other.EvictedForMemory
+	c.EvictedForQuota += other.EvictedForQuota
+	if c.SuccessfulByDomain == nil {
+		c.SuccessfulByDomain = make(map[string]int)
+	}
+	if c.FailedByDomain == nil {
+		c.FailedByDomain = make(map[string]int)
+	}
+	for domain, n := range other.SuccessfulByDomain {
+		c.SuccessfulByDomain[domain] += n
+	}
+	for domain, n := range other.FailedByDomain {
+		c.FailedByDomain[domain] += n
+	}
+}
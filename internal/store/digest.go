@@ -0,0 +1,122 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// DigestDays is how many days of per-domain daily counters are kept, today included
+const DigestDays = 8
+
+// DailyStats counts the outcomes of one domain's events on one (local) day. Unlike the
+// stored events they are not evicted by the store limits, so end-of-day digests are exact
+// for this instance even on busy days.
+type DailyStats struct {
+	Domain         string                      `json:"domain"`
+	Day            string                      `json:"day"`             // 2006-01-02
+	Forwarded      int64                       `json:"forwarded"`       // Delivered to the route's endpoints
+	Stale          int64                       `json:"stale"`           // Too old, sent to stale_endpoints (or nowhere)
+	Skipped        int64                       `json:"skipped"`         // Route disabled, not forwarded
+	Failed         int64                       `json:"failed"`          // Out of deliveries
+	Dropped        int64                       `json:"dropped"`         // Failed on an at_most_once route
+	Retried        int64                       `json:"retried"`         // Failed attempts that were redelivered
+	Quarantined    int64                       `json:"quarantined"`     // Payload did not match the route's schema
+	FailureReasons map[string]int64            `json:"failure_reasons"` // Failed endpoint deliveries by error class
+	Endpoints      map[string]*EndpointLatency `json:"-"`
+}
+
+// EndpointLatency sums the delivery latency of one endpoint
+type EndpointLatency struct {
+	Endpoint     string  `json:"endpoint"`
+	SinkType     string  `json:"sink_type"`
+	Deliveries   int64   `json:"deliveries"`
+	Failures     int64   `json:"failures"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	MaxLatencyMs float64 `json:"max_latency_ms"`
+	SumLatencyMs float64 `json:"-"`
+}
+
+// dayKey identifies the counters of a domain on a day
+type dayKey struct {
+	domain string
+	day    string
+}
+
+// dailyStats returns the counters of the domain for now's day, creating them (and
+// dropping days older than DigestDays) as needed; caller must hold the write lock
+func (s *Store) dailyStats(domain string, now time.Time) *DailyStats {
+	day := now.Format("2006-01-02")
+	if day != s.digestDay {
+		s.digestDay = day
+		oldest := now.AddDate(0, 0, 1-DigestDays).Format("2006-01-02")
+		for key := range s.daily {
+			if key.day < oldest {
+				delete(s.daily, key)
+			}
+		}
+	}
+
+	key := dayKey{domain: domain, day: day}
+	d, ok := s.daily[key]
+	if !ok {
+		d = &DailyStats{
+			Domain:         domain,
+			Day:            day,
+			FailureReasons: make(map[string]int64),
+			Endpoints:      make(map[string]*EndpointLatency),
+		}
+		s.daily[key] = d
+	}
+	return d
+}
+
+// recordResults adds per-endpoint outcomes to the day's counters; caller must hold the
+// store's write lock
+func (d *DailyStats) recordResults(results []DeliveryResult) {
+	for _, result := range results {
+		e, ok := d.Endpoints[result.Endpoint]
+		if !ok {
+			e = &EndpointLatency{Endpoint: result.Endpoint, SinkType: result.SinkType}
+			d.Endpoints[result.Endpoint] = e
+		}
+		e.Deliveries++
+		e.SumLatencyMs += result.LatencyMs
+		if result.LatencyMs > e.MaxLatencyMs {
+			e.MaxLatencyMs = result.LatencyMs
+		}
+		if result.Status != ResultSuccess {
+			e.Failures++
+			d.FailureReasons[result.ErrorClass]++
+		}
+	}
+}
+
+// GetDailyStats returns a copy of the counters of every domain accepted by include on
+// day (2006-01-02), ordered by domain
+func (s *Store) GetDailyStats(day string, include func(domain string) bool) []DailyStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []DailyStats
+	for key, d := range s.daily {
+		if key.day != day || !include(key.domain) {
+			continue
+		}
+		c := *d
+		c.FailureReasons = make(map[string]int64, len(d.FailureReasons))
+		for class, n := range d.FailureReasons {
+			c.FailureReasons[class] = n
+		}
+		c.Endpoints = make(map[string]*EndpointLatency, len(d.Endpoints))
+		for endpoint, e := range d.Endpoints {
+			ec := *e
+			if ec.Deliveries > 0 {
+				ec.AvgLatencyMs = ec.SumLatencyMs / float64(ec.Deliveries)
+			}
+			c.Endpoints[endpoint] = &ec
+		}
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Domain < result[j].Domain })
+	return result
+}
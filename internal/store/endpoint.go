@@ -0,0 +1,173 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// endpointSweepInterval is how many indexed events pass between sweeps of evicted IDs
+// from the endpoint index
+const endpointSweepInterval = 10000
+
+// indexEndpoints records that the event with the given ID was sent (or attempted) to
+// endpoints; caller must hold the write lock
+func (s *Store) indexEndpoints(id uint64, endpoints []string) {
+	if s.byEndpoint == nil {
+		s.byEndpoint = make(map[string][]uint64)
+	}
+	for _, endpoint := range endpoints {
+		s.byEndpoint[endpoint] = append(s.byEndpoint[endpoint], id)
+	}
+	s.indexedSinceSweep++
+	if s.indexedSinceSweep >= endpointSweepInterval {
+		s.sweepEndpointIndex()
+		s.indexedSinceSweep = 0
+	}
+}
+
+// sweepEndpointIndex drops the IDs of evicted events, and endpoints left without any;
+// caller must hold the write lock
+func (s *Store) sweepEndpointIndex() {
+	for endpoint, ids := range s.byEndpoint {
+		live := ids[:0]
+		for _, id := range ids {
+			if s.successfulIndex(id) >= 0 || s.failedIndex(id) >= 0 {
+				live = append(live, id)
+			}
+		}
+		if len(live) == 0 {
+			delete(s.byEndpoint, endpoint)
+			continue
+		}
+		s.byEndpoint[endpoint] = append([]uint64(nil), live...)
+	}
+}
+
+// successfulIndex returns the position of the forwarded event with the given ID (-1 if
+// it is not stored); IDs are ascending. Caller must hold the lock.
+func (s *Store) successfulIndex(id uint64) int {
+	i := sort.Search(len(s.successfulEvents), func(i int) bool { return s.successfulEvents[i].ID >= id })
+	if i < len(s.successfulEvents) && s.successfulEvents[i].ID == id {
+		return i
+	}
+	return -1
+}
+
+// failedIndex returns the position of the failed event with the given ID (-1 if it is
+// not stored); caller must hold the lock
+func (s *Store) failedIndex(id uint64) int {
+	i := sort.Search(len(s.failedEvents), func(i int) bool { return s.failedEvents[i].ID >= id })
+	if i < len(s.failedEvents) && s.failedEvents[i].ID == id {
+		return i
+	}
+	return -1
+}
+
+// GetEventsByEndpoint returns the forwarded and failed events that were sent to the endpoint
+// (by endpoint name, e.g. its URL) and whose domains are accepted by include, oldest first.
+// A failed event's results tell whether this endpoint was the one that failed.
+func (s *Store) GetEventsByEndpoint(endpoint string, include func(domain string) bool) ([]ForwardedEvent, []FailedEvent) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]ForwardedEvent, 0)
+	failed := make([]FailedEvent, 0)
+	for _, id := range s.byEndpoint[endpoint] {
+		if i := s.successfulIndex(id); i >= 0 {
+			if event := s.successfulEvents[i]; include(event.Domain) {
+				events = append(events, event.unpacked())
+			}
+		} else if i := s.failedIndex(id); i >= 0 {
+			if event := s.failedEvents[i]; include(event.Domain) {
+				failed = append(failed, event.unpacked())
+			}
+		}
+	}
+	return events, failed
+}
+
+// GetEndpointFailures returns the events that failed against the endpoint between since and
+// until (by failed_at) and were delivered to every other endpoint: the endpoint never
+// accepted them, every other endpoint they were sent to did in some attempt, and they are
+// not awaiting a redelivery. Each event is returned once (its record of failed attempts),
+// oldest first, for domains accepted by include.
+func (s *Store) GetEndpointFailures(endpoint string, since, until time.Time, include func(domain string) bool) []FailedEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// The attempts of one stream message share its domain, call and publish time
+	type message struct {
+		latest    int             // Index of its failed record (-1 if none)
+		inWindow  bool            // An attempt failed against the endpoint within the window
+		delivered bool            // The endpoint accepted it in some attempt
+		others    map[string]bool // Other endpoints, true once they accepted it
+	}
+	messages := make(map[string]*message)
+	order := make([]string, 0)
+	get := func(id uint64, domain, callID string, publishedAt time.Time) *message {
+		key := fmt.Sprintf("%s|%s|%d", domain, callID, publishedAt.UnixNano())
+		if publishedAt.IsZero() {
+			key = fmt.Sprintf("#%d", id) // Attempts cannot be matched
+		}
+		m, ok := messages[key]
+		if !ok {
+			m = &message{latest: -1, others: make(map[string]bool)}
+			messages[key] = m
+			order = append(order, key)
+		}
+		return m
+	}
+	note := func(m *message, results []DeliveryResult) {
+		for _, result := range results {
+			succeeded := result.Status == ResultSuccess
+			if result.Endpoint == endpoint {
+				m.delivered = m.delivered || succeeded
+			} else {
+				m.others[result.Endpoint] = m.others[result.Endpoint] || succeeded
+			}
+		}
+	}
+
+	for _, id := range s.byEndpoint[endpoint] {
+		if i := s.successfulIndex(id); i >= 0 {
+			event := s.successfulEvents[i]
+			if include(event.Domain) {
+				note(get(id, event.Domain, event.CallID, event.PublishedAt), event.Results)
+			}
+		} else if i := s.failedIndex(id); i >= 0 {
+			event := s.failedEvents[i]
+			if !include(event.Domain) {
+				continue
+			}
+			m := get(id, event.Domain, event.CallID, event.PublishedAt)
+			m.latest = i
+			for _, attempt := range event.Attempts {
+				note(m, attempt.Results)
+				for _, result := range attempt.Results {
+					if result.Endpoint == endpoint && result.Status != ResultSuccess &&
+						!attempt.FailedAt.Before(since) && !attempt.FailedAt.After(until) {
+						m.inWindow = true
+					}
+				}
+			}
+		}
+	}
+
+	failed := make([]FailedEvent, 0)
+	for _, key := range order {
+		m := messages[key]
+		if m.latest < 0 || !m.inWindow || m.delivered || s.failedEvents[m.latest].WillRetry {
+			continue
+		}
+		othersDelivered := true
+		for _, ok := range m.others {
+			othersDelivered = othersDelivered && ok
+		}
+		if othersDelivered {
+			failed = append(failed, s.failedEvents[m.latest].unpacked())
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].ID < failed[j].ID })
+	return failed
+}
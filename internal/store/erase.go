@@ -0,0 +1,78 @@
+package store
+
+// Erasure counts the stored events removed for a call
+type Erasure struct {
+	Forwarded   int `json:"forwarded"`
+	Failed      int `json:"failed"`
+	Quarantined int `json:"quarantined"`
+}
+
+// EraseCall removes every stored event of the call whose domain is accepted by include
+// (right-to-erasure requests). Delta clients holding an older cursor are told to reload,
+// so copies they cached are dropped too.
+func (s *Store) EraseCall(callID string, include func(domain string) bool) Erasure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var erased Erasure
+	var highest uint64
+
+	forwarded := s.successfulEvents[:0]
+	for _, e := range s.successfulEvents {
+		if e.CallID == callID && include(e.Domain) {
+			s.release(e.Event, e.packed, e.rawSize)
+			highest = maxID(highest, e.ID)
+			erased.Forwarded++
+			continue
+		}
+		forwarded = append(forwarded, e)
+	}
+	for i := len(forwarded); i < len(s.successfulEvents); i++ {
+		s.successfulEvents[i] = ForwardedEvent{}
+	}
+	s.successfulEvents = forwarded
+
+	failed := s.failedEvents[:0]
+	for _, e := range s.failedEvents {
+		if e.CallID == callID && include(e.Domain) {
+			s.release(e.Event, e.packed, e.rawSize)
+			highest = maxID(highest, e.ID)
+			erased.Failed++
+			continue
+		}
+		failed = append(failed, e)
+	}
+	for i := len(failed); i < len(s.failedEvents); i++ {
+		s.failedEvents[i] = FailedEvent{}
+	}
+	s.failedEvents = failed
+
+	quarantined := s.quarantined[:0]
+	for _, e := range s.quarantined {
+		if e.CallID == callID && include(e.Domain) {
+			s.release(e.Event, e.packed, e.rawSize)
+			s.release(e.Payload, e.packedPayload, 0)
+			erased.Quarantined++
+			continue
+		}
+		quarantined = append(quarantined, e)
+	}
+	for i := len(quarantined); i < len(s.quarantined); i++ {
+		s.quarantined[i] = QuarantinedEvent{}
+	}
+	s.quarantined = quarantined
+
+	// Erased IDs stay in the endpoint index until the next sweep; lookups skip them
+	if highest > 0 {
+		s.markEvicted(highest)
+	}
+	return erased
+}
+
+// maxID returns the larger of two event IDs
+func maxID(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// DefaultCompressThreshold is the body size above which bodies are compressed when no threshold is configured
+const DefaultCompressThreshold = 512
+
+// MemoryUsage is the size of the event bodies retained by the store
+type MemoryUsage struct {
+	Bytes            int64 `json:"bytes"`              // As kept in memory (after compression)
+	RawBytes         int64 `json:"raw_bytes"`          // Uncompressed
+	MaxBytes         int64 `json:"max_bytes"`          // 0 = no limit
+	Compressed       bool  `json:"compressed"`         // Bodies above the threshold are compressed
+	EvictedForMemory int64 `json:"evicted_for_memory"` // Events removed early to stay under MaxBytes, since startup
+	EvictedForQuota  int64 `json:"evicted_for_quota"`  // Events removed early to stay under their domain's max_stored_events, since startup
+}
+
+// SetMemoryLimit evicts the oldest events (forwarded, failed or quarantined) whenever their
+// bodies take more than maxBytes (0 = no limit)
+func (s *Store) SetMemoryLimit(maxBytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxBytes = maxBytes
+	s.enforceMemoryLimit()
+}
+
+// SetCompression keeps bodies larger than thresholdBytes snappy-compressed in memory; they
+// are decompressed when read. Only events added afterwards are affected.
+func (s *Store) SetCompression(enabled bool, thresholdBytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if thresholdBytes <= 0 {
+		thresholdBytes = DefaultCompressThreshold
+	}
+	s.compress = enabled
+	s.compressThreshold = thresholdBytes
+}
+
+// GetMemoryUsage returns the size of the retained event bodies
+func (s *Store) GetMemoryUsage() MemoryUsage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return MemoryUsage{
+		Bytes:            s.bytes,
+		RawBytes:         s.rawBytes,
+		MaxBytes:         s.maxBytes,
+		Compressed:       s.compress,
+		EvictedForMemory: s.evictedForMemory,
+		EvictedForQuota:  s.evictedForQuota,
+	}
+}
+
+// pack returns the body to keep: as is, or compressed (then the plain body is nil).
+// Caller must hold the write lock.
+func (s *Store) pack(body json.RawMessage) (json.RawMessage, []byte) {
+	s.rawBytes += int64(len(body))
+	if !s.compress || len(body) <= s.compressThreshold {
+		s.bytes += int64(len(body))
+		return body, nil
+	}
+	packed := s2.EncodeSnappy(nil, body)
+	if len(packed) >= len(body) {
+		s.bytes += int64(len(body))
+		return body, nil
+	}
+	s.bytes += int64(len(packed))
+	return nil, packed
+}
+
+// unpack returns the original body of a packed one
+func unpack(body json.RawMessage, packed []byte) json.RawMessage {
+	if packed == nil {
+		return body
+	}
+	data, err := s2.Decode(nil, packed)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return data
+}
+
+// release subtracts a removed body from the accounting; caller must hold the write lock
+func (s *Store) release(body json.RawMessage, packed []byte, rawSize int) {
+	s.bytes -= int64(len(body) + len(packed))
+	s.rawBytes -= int64(rawSize)
+}
+
+// unpacked returns the event with its body decompressed
+func (e ForwardedEvent) unpacked() ForwardedEvent {
+	e.Event, e.packed = unpack(e.Event, e.packed), nil
+	return e
+}
+
+// unpacked returns the event with its body decompressed
+func (e FailedEvent) unpacked() FailedEvent {
+	e.Event, e.packed = unpack(e.Event, e.packed), nil
+	return e
+}
+
+// unpacked returns the event with its bodies decompressed
+func (e QuarantinedEvent) unpacked() QuarantinedEvent {
+	e.Event, e.packed = unpack(e.Event, e.packed), nil
+	e.Payload, e.packedPayload = unpack(e.Payload, e.packedPayload), nil
+	return e
+}
+
+// evictSuccessful removes the n oldest forwarded events, clearing them so their bodies can be
+// garbage collected; caller must hold the write lock
+func (s *Store) evictSuccessful(n int) {
+	for i := 0; i < n; i++ {
+		e := &s.successfulEvents[i]
+		s.release(e.Event, e.packed, e.rawSize)
+		s.markEvicted(e.ID)
+		*e = ForwardedEvent{}
+	}
+	s.successfulEvents = s.successfulEvents[n:]
+}
+
+// evictFailed removes the n oldest failed events; caller must hold the write lock
+func (s *Store) evictFailed(n int) {
+	for i := 0; i < n; i++ {
+		e := &s.failedEvents[i]
+		s.release(e.Event, e.packed, e.rawSize)
+		s.markEvicted(e.ID)
+		*e = FailedEvent{}
+	}
+	s.failedEvents = s.failedEvents[n:]
+}
+
+// evictQuarantined removes the n oldest quarantined events; caller must hold the write lock
+func (s *Store) evictQuarantined(n int) {
+	for i := 0; i < n; i++ {
+		e := &s.quarantined[i]
+		s.release(e.Event, e.packed, e.rawSize)
+		s.release(e.Payload, e.packedPayload, 0)
+		*e = QuarantinedEvent{}
+	}
+	s.quarantined = s.quarantined[n:]
+}
+
+// enforceMemoryLimit evicts the oldest events, whatever their kind, until the bodies fit
+// in maxBytes (the newest event is always kept); caller must hold the write lock
+func (s *Store) enforceMemoryLimit() {
+	if s.maxBytes <= 0 {
+		return
+	}
+	for s.bytes > s.maxBytes && len(s.successfulEvents)+len(s.failedEvents)+len(s.quarantined) > 1 {
+		// Oldest head of the three lists, by ID
+		var oldest uint64
+		evict := func() {}
+		if len(s.successfulEvents) > 0 {
+			oldest, evict = s.successfulEvents[0].ID, func() { s.evictSuccessful(1) }
+		}
+		if len(s.failedEvents) > 0 && (oldest == 0 || s.failedEvents[0].ID < oldest) {
+			oldest, evict = s.failedEvents[0].ID, func() { s.evictFailed(1) }
+		}
+		if len(s.quarantined) > 0 && (oldest == 0 || s.quarantined[0].ID < oldest) {
+			oldest, evict = s.quarantined[0].ID, func() { s.evictQuarantined(1) }
+		}
+		if oldest == 0 {
+			return
+		}
+		evict()
+		s.evictedForMemory++
+	}
+}
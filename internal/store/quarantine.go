@@ -0,0 +1,73 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// QuarantinedEvent is an event set aside instead of forwarded because redelivering
+// it can never succeed (e.g. its transformed payload does not match the route's schema)
+type QuarantinedEvent struct {
+	ID              uint64          `json:"id"`
+	Event           json.RawMessage `json:"event"`             // As received
+	Payload         json.RawMessage `json:"payload,omitempty"` // What would have been sent, after transforms
+	Domain          string          `json:"domain"`
+	CallID          string          `json:"call_id"`
+	HubEventID      string          `json:"hub_event_id,omitempty"` // ID given at ingest
+	QuarantinedAt   time.Time       `json:"quarantined_at"`
+	DeliveryAttempt int             `json:"delivery_attempt"`
+	Reason          string          `json:"reason"`
+	Violations      []string        `json:"violations,omitempty"`
+
+	packed        []byte // Compressed Event when Event is nil (see SetCompression)
+	packedPayload []byte // Compressed Payload when Payload is nil
+	rawSize       int    // Uncompressed size of Event and Payload
+}
+
+// AddQuarantinedEvent adds a quarantined event to the store
+func (s *Store) AddQuarantinedEvent(event, payload json.RawMessage, domain, callID string, deliveryAttempt int, reason string, violations []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	body, packed := s.pack(event)
+	payloadBody, packedPayload := s.pack(payload)
+	now := s.clock.Now()
+	quarantined := QuarantinedEvent{
+		ID:              s.lastID,
+		Event:           body,
+		Payload:         payloadBody,
+		Domain:          domain,
+		CallID:          callID,
+		QuarantinedAt:   now,
+		DeliveryAttempt: deliveryAttempt,
+		Reason:          reason,
+		Violations:      violations,
+		packed:          packed,
+		packedPayload:   packedPayload,
+		rawSize:         len(event) + len(payload),
+	}
+	_, _, quarantined.HubEventID = extractEventFields(event)
+	s.quarantined = append(s.quarantined, quarantined)
+	s.dailyStats(domain, now).Quarantined++
+
+	// Limit size if maxSize is set
+	if s.maxSize > 0 && len(s.quarantined) > s.maxSize {
+		s.evictQuarantined(len(s.quarantined) - s.maxSize)
+	}
+	s.enforceMemoryLimit()
+}
+
+// GetQuarantinedEvents returns the quarantined events of the domains accepted by include, oldest first
+func (s *Store) GetQuarantinedEvents(include func(domain string) bool) []QuarantinedEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]QuarantinedEvent, 0)
+	for _, event := range s.quarantined {
+		if include(event.Domain) {
+			result = append(result, event.unpacked())
+		}
+	}
+	return result
+}
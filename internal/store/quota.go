@@ -0,0 +1,75 @@
+package store
+
+// SetDomainLimits limits the forwarded and the failed events kept for each domain in limits
+// (on top of the store's size and memory limits); the oldest events of a domain over its
+// limit are removed, now and whenever it gets a new event. Other domains are not limited.
+func (s *Store) SetDomainLimits(limits map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.domainLimits = limits
+	for domain, limit := range limits {
+		s.trimDomain(domain, limit)
+	}
+}
+
+// enforceDomainLimit trims the domain to its limit, if it has one; caller must hold the write lock
+func (s *Store) enforceDomainLimit(domain string) {
+	if limit, ok := s.domainLimits[domain]; ok {
+		s.trimDomain(domain, limit)
+	}
+}
+
+// trimDomain removes the oldest forwarded and failed events of the domain beyond the newest
+// limit of each. Delta clients are not told to reload: they never see the removed events
+// they had not fetched yet, as with any other eviction. Caller must hold the write lock.
+func (s *Store) trimDomain(domain string, limit int) {
+	if limit <= 0 {
+		return
+	}
+
+	excess := -limit
+	for i := range s.successfulEvents {
+		if s.successfulEvents[i].Domain == domain {
+			excess++
+		}
+	}
+	if excess > 0 {
+		kept := s.successfulEvents[:0]
+		for _, e := range s.successfulEvents {
+			if excess > 0 && e.Domain == domain {
+				s.release(e.Event, e.packed, e.rawSize)
+				s.evictedForQuota++
+				excess--
+				continue
+			}
+			kept = append(kept, e)
+		}
+		for i := len(kept); i < len(s.successfulEvents); i++ {
+			s.successfulEvents[i] = ForwardedEvent{}
+		}
+		s.successfulEvents = kept
+	}
+
+	excess = -limit
+	for i := range s.failedEvents {
+		if s.failedEvents[i].Domain == domain {
+			excess++
+		}
+	}
+	if excess > 0 {
+		kept := s.failedEvents[:0]
+		for _, e := range s.failedEvents {
+			if excess > 0 && e.Domain == domain {
+				s.release(e.Event, e.packed, e.rawSize)
+				s.evictedForQuota++
+				excess--
+				continue
+			}
+			kept = append(kept, e)
+		}
+		for i := len(kept); i < len(s.failedEvents); i++ {
+			s.failedEvents[i] = FailedEvent{}
+		}
+		s.failedEvents = kept
+	}
+}
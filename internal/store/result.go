@@ -0,0 +1,139 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// Delivery result statuses
+const (
+	ResultSuccess = "success"
+	ResultFailed  = "failed"
+)
+
+// LatencyBuckets are the upper bounds (seconds) of the delivery latency histogram
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Delivery is the JetStream delivery an event was received in
+type Delivery struct {
+	Attempt     int       // NumDelivered: 1 on the first delivery
+	NumPending  uint64    // Messages left for the consumer at delivery
+	PublishedAt time.Time // When the event was stored in the stream (zero if unknown)
+	Replay      string    // ID of the replay that published the event again (empty if original)
+	AtMostOnce  bool      // Acknowledged before forwarding: a failure is not retried
+	Endpoint    string    // Only forward to this endpoint of the route (endpoint replays; empty = the route's endpoints)
+
+	MaxDeliveries int // Deliveries the consumer allows, if below the route's max_deliveries (0 = the route's)
+}
+
+// elapsed returns the seconds from publishing to t (0 if the publish time is unknown)
+func (d Delivery) elapsed(t time.Time) float64 {
+	if d.PublishedAt.IsZero() {
+		return 0
+	}
+	return t.Sub(d.PublishedAt).Seconds()
+}
+
+// DeliveryResult is the outcome of delivering an event to one endpoint.
+// Every sink type (HTTP, MQTT, Event Hubs, Redis, file) reports the same shape.
+type DeliveryResult struct {
+	Endpoint   string  `json:"endpoint"`
+	SinkType   string  `json:"sink_type"`
+	Status     string  `json:"status"`                // ResultSuccess or ResultFailed
+	StatusCode int     `json:"status_code,omitempty"` // HTTP status of failed HTTP-based deliveries
+	LatencyMs  float64 `json:"latency_ms"`
+	Retryable  bool    `json:"retryable,omitempty"`   // A redelivery may succeed (timeouts, 5xx, throttling)
+	ErrorClass string  `json:"error_class,omitempty"` // e.g. timeout, connection, throttled, client_error
+	Error      string  `json:"error,omitempty"`
+}
+
+// SinkMetrics are cumulative delivery counters for one endpoint of a domain.
+// Unlike the stored events they are never evicted, so they can be exported as counters.
+type SinkMetrics struct {
+	Domain            string           `json:"domain"`
+	SinkType          string           `json:"sink_type"`
+	Endpoint          string           `json:"endpoint"`
+	Successes         int64            `json:"successes"`
+	Failures          int64            `json:"failures"`
+	RetryableFailures int64            `json:"retryable_failures"`
+	ErrorClasses      map[string]int64 `json:"error_classes"`
+	AvgLatencyMs      float64          `json:"avg_latency_ms"`
+	LatencySumSeconds float64          `json:"-"`
+	LatencyCounts     []int64          `json:"-"`           // Per LatencyBuckets entry, plus one for +Inf (not cumulative)
+	LastStatus        string           `json:"last_status"` // Status of the most recent delivery
+	LastResultAt      time.Time        `json:"last_result_at"`
+}
+
+// sinkKey identifies the metrics of one endpoint of a domain
+type sinkKey struct {
+	domain   string
+	endpoint string
+}
+
+// recordResults adds delivery results to the sink metrics; caller must hold the write lock
+func (s *Store) recordResults(domain string, results []DeliveryResult) {
+	for _, result := range results {
+		key := sinkKey{domain: domain, endpoint: result.Endpoint}
+		m, ok := s.sinkMetrics[key]
+		if !ok {
+			m = &SinkMetrics{
+				Domain:        domain,
+				SinkType:      result.SinkType,
+				Endpoint:      result.Endpoint,
+				ErrorClasses:  make(map[string]int64),
+				LatencyCounts: make([]int64, len(LatencyBuckets)+1),
+			}
+			s.sinkMetrics[key] = m
+		}
+
+		if result.Status == ResultSuccess {
+			m.Successes++
+		} else {
+			m.Failures++
+			if result.Retryable {
+				m.RetryableFailures++
+			}
+			m.ErrorClasses[result.ErrorClass]++
+		}
+
+		m.LastStatus = result.Status
+		m.LastResultAt = s.clock.Now()
+
+		seconds := result.LatencyMs / float64(time.Second/time.Millisecond)
+		m.LatencySumSeconds += seconds
+		bucket := sort.SearchFloat64s(LatencyBuckets, seconds)
+		m.LatencyCounts[bucket]++
+	}
+}
+
+// GetSinkMetrics returns a copy of the metrics of every endpoint of the domains accepted by include,
+// ordered by domain and endpoint
+func (s *Store) GetSinkMetrics(include func(domain string) bool) []SinkMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]SinkMetrics, 0, len(s.sinkMetrics))
+	for key, m := range s.sinkMetrics {
+		if !include(key.domain) {
+			continue
+		}
+		c := *m
+		c.ErrorClasses = make(map[string]int64, len(m.ErrorClasses))
+		for class, count := range m.ErrorClasses {
+			c.ErrorClasses[class] = count
+		}
+		c.LatencyCounts = append([]int64(nil), m.LatencyCounts...)
+		if total := c.Successes + c.Failures; total > 0 {
+			c.AvgLatencyMs = c.LatencySumSeconds * 1000 / float64(total)
+		}
+		result = append(result, c)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Domain != result[j].Domain {
+			return result[i].Domain < result[j].Domain
+		}
+		return result[i].Endpoint < result[j].Endpoint
+	})
+	return result
+}
@@ -2,31 +2,83 @@ package store
 
 import (
 	"encoding/json"
+	"sort"
 	"sync"
 	"time"
+
+	"calleventhub/event"
+	"calleventhub/internal/clock"
 )
 
 // ForwardedEvent represents an event that has been successfully forwarded
 type ForwardedEvent struct {
+	ID            uint64          `json:"id"` // Monotonic store sequence, used as delta cursor
 	Event         json.RawMessage `json:"event"`
 	Domain        string          `json:"domain"`
 	CallID        string          `json:"call_id"`
+	HubEventID    string          `json:"hub_event_id,omitempty"` // ID given at ingest (see forwarder.EventIDField)
 	ForwardedAt   time.Time       `json:"forwarded_at"`
 	DeliveryAttempt int           `json:"delivery_attempt"`
 	Endpoints     []string        `json:"endpoints"`
+	Results       []DeliveryResult `json:"results,omitempty"` // Per-endpoint outcome
+	State         string          `json:"state,omitempty"`
+	Status        string          `json:"status,omitempty"`
+	Disposition   string          `json:"disposition,omitempty"` // DispositionStale or DispositionSkipped if not sent to the route's endpoints
+	NumPending    uint64          `json:"num_pending"`              // Messages left for the consumer when this attempt was delivered
+	PublishedAt   time.Time       `json:"published_at"`             // When the event was stored in the stream
+	ElapsedSeconds float64        `json:"elapsed_seconds,omitempty"` // From published_at to forwarded_at, across all attempts
+	Replay        string          `json:"replay,omitempty"`          // ID of the replay that sent the event again
+	AtMostOnce    bool            `json:"at_most_once,omitempty"`    // The route's delivery is at_most_once
+	Instance      string          `json:"instance,omitempty"`        // Hub instance that forwarded the event
+
+	packed  []byte // Compressed Event when Event is nil (see SetCompression)
+	rawSize int    // Uncompressed size of Event
 }
 
+// DispositionStale marks events older than their route's max_event_age_seconds, which were
+// sent to the route's stale_endpoints (or nowhere) instead of its endpoints
+const DispositionStale = "stale"
+
+// DispositionSkipped marks events of a disabled route, which were acknowledged without
+// being forwarded
+const DispositionSkipped = "skipped"
+
 // FailedEvent represents an event that failed to forward
 type FailedEvent struct {
+	ID            uint64          `json:"id"` // Monotonic store sequence, used as delta cursor
 	Event         json.RawMessage `json:"event"`
 	Domain        string          `json:"domain"`
 	CallID        string          `json:"call_id"`
+	HubEventID    string          `json:"hub_event_id,omitempty"` // ID given at ingest (see forwarder.EventIDField)
 	FailedAt      time.Time       `json:"failed_at"`
 	DeliveryAttempt int           `json:"delivery_attempt"`
 	MaxDeliveries int            `json:"max_deliveries"`
 	Endpoints     []string        `json:"endpoints"`
 	ErrorMessages []string        `json:"error_messages"`
-	WillRetry     bool            `json:"will_retry"` // true if delivery_attempt < max_deliveries
+	Results       []DeliveryResult `json:"results,omitempty"` // Per-endpoint outcome (empty if nothing was sent)
+	WillRetry     bool            `json:"will_retry"` // true if delivery_attempt < max_deliveries (never for at_most_once)
+	State         string          `json:"state,omitempty"`
+	Status        string          `json:"status,omitempty"`
+	NumPending    uint64          `json:"num_pending"`              // Messages left for the consumer when this attempt was delivered
+	PublishedAt   time.Time       `json:"published_at"`             // When the event was stored in the stream
+	ElapsedSeconds float64        `json:"elapsed_seconds,omitempty"` // From published_at to failed_at, across all attempts
+	Replay        string          `json:"replay,omitempty"`          // ID of the replay that sent the event again
+	AtMostOnce    bool            `json:"at_most_once,omitempty"`    // Dropped: the route's delivery is at_most_once, so it is not retried
+	Instance      string          `json:"instance,omitempty"`        // Hub instance that attempted the forward
+	Attempts      []FailedAttempt `json:"attempts"`                  // Every failed attempt of the message, oldest first; the fields above describe the latest
+	Supersedes    uint64          `json:"supersedes,omitempty"`      // ID of the record of the previous attempts, which this one replaces
+
+	packed  []byte // Compressed Event when Event is nil (see SetCompression)
+	rawSize int    // Uncompressed size of Event
+}
+
+// DomainBreakdown counts events of one domain by event state and status
+// Successful and failed forwards are counted separately
+type DomainBreakdown struct {
+	States         map[string]int `json:"states"`
+	Statuses       map[string]int `json:"statuses"`
+	FailedStates   map[string]int `json:"failed_states"`
+	FailedStatuses map[string]int `json:"failed_statuses"`
 }
 
 // Store holds forwarded events in memory
@@ -35,6 +87,44 @@ type Store struct {
 	failedEvents     []FailedEvent
 	mu               sync.RWMutex
 	maxSize          int // Maximum number of events to keep (0 = unlimited)
+	lastID           uint64 // Last ID assigned to an event
+	evictedUpTo      uint64 // Highest ID removed by the size limit
+	sinkMetrics      map[sinkKey]*SinkMetrics
+	ageMetrics       map[string]*AgeMetrics // By domain (see age.go)
+	daily            map[dayKey]*DailyStats // Per domain and day (see digest.go)
+	digestDay        string                 // Day of the last counted event
+	quarantined      []QuarantinedEvent
+	instance         string // Hub instance recorded with every event
+	clock            clock.Clock
+
+	// IDs of the forwarded and failed events sent to each endpoint (see endpoint.go)
+	byEndpoint        map[string][]uint64
+	indexedSinceSweep int
+
+	// Operator notes about incidents (see annotation.go)
+	annotations      []Annotation
+	lastAnnotationID uint64
+
+	// Size of the retained event bodies (see memory.go)
+	bytes             int64
+	rawBytes          int64
+	maxBytes          int64 // Evict the oldest events beyond this (0 = no limit)
+	evictedForMemory  int64
+	compress          bool
+	compressThreshold int
+
+	// Events kept per domain (see quota.go)
+	domainLimits    map[string]int
+	evictedForQuota int64
+}
+
+// Delta holds events added after a cursor, oldest first
+type Delta struct {
+	Events       []ForwardedEvent `json:"events"`
+	FailedEvents []FailedEvent    `json:"failed_events"`
+	Cursor       uint64           `json:"cursor"`    // Pass as cursor on the next call
+	HasMore      bool             `json:"has_more"`  // More events are available past Cursor
+	Truncated    bool             `json:"truncated"` // Cursor is no longer valid (events evicted or store restarted); do a full reload
 }
 
 // NewStore creates a new event store
@@ -43,60 +133,232 @@ func NewStore(maxSize int) *Store {
 		successfulEvents: make([]ForwardedEvent, 0),
 		failedEvents:     make([]FailedEvent, 0),
 		maxSize:          maxSize,
+		sinkMetrics:      make(map[sinkKey]*SinkMetrics),
+		ageMetrics:       make(map[string]*AgeMetrics),
+		daily:            make(map[dayKey]*DailyStats),
+		clock:            clock.Real,
 	}
 }
 
+// SetInstance sets the hub instance ID recorded with events added afterwards
+func (s *Store) SetInstance(instanceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instance = instanceID
+}
+
+// SetClock sets the time source of event timestamps and daily counters (the system clock
+// by default)
+func (s *Store) SetClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = c
+}
+
+// Instance returns the hub instance ID recorded with events
+func (s *Store) Instance() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.instance
+}
+
 // AddEvent adds a successfully forwarded event to the store
-func (s *Store) AddEvent(event json.RawMessage, domain, callID string, deliveryAttempt int, endpoints []string) {
+func (s *Store) AddEvent(event json.RawMessage, domain, callID string, delivery Delivery, endpoints []string, results []DeliveryResult) {
+	s.addEvent(event, domain, callID, delivery, endpoints, results, "")
+}
+
+// AddStaleEvent adds an event that was diverted because it was too old (endpoints may be empty)
+func (s *Store) AddStaleEvent(event json.RawMessage, domain, callID string, delivery Delivery, endpoints []string, results []DeliveryResult) {
+	s.addEvent(event, domain, callID, delivery, endpoints, results, DispositionStale)
+}
+
+// AddSkippedEvent adds an event that was not forwarded because its route is disabled
+func (s *Store) AddSkippedEvent(event json.RawMessage, domain, callID string, delivery Delivery) {
+	s.addEvent(event, domain, callID, delivery, nil, nil, DispositionSkipped)
+}
+
+func (s *Store) addEvent(event json.RawMessage, domain, callID string, delivery Delivery, endpoints []string, results []DeliveryResult, disposition string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.lastID++
+	body, packed := s.pack(event)
+	now := s.clock.Now()
 	forwardedEvent := ForwardedEvent{
-		Event:          event,
+		ID:             s.lastID,
+		Event:          body,
 		Domain:         domain,
 		CallID:         callID,
-		ForwardedAt:    time.Now(),
-		DeliveryAttempt: deliveryAttempt,
+		ForwardedAt:    now,
+		DeliveryAttempt: delivery.Attempt,
+		NumPending:     delivery.NumPending,
+		PublishedAt:    delivery.PublishedAt,
+		ElapsedSeconds: delivery.elapsed(now),
+		Replay:         delivery.Replay,
+		AtMostOnce:     delivery.AtMostOnce,
+		Instance:       s.instance,
 		Endpoints:      endpoints,
+		Results:        results,
+		Disposition:    disposition,
+		packed:         packed,
+		rawSize:        len(event),
 	}
+	forwardedEvent.State, forwardedEvent.Status, forwardedEvent.HubEventID = extractEventFields(event)
 
 	s.successfulEvents = append(s.successfulEvents, forwardedEvent)
+	s.recordResults(domain, results)
+	s.recordAge(domain, delivery, now)
+	s.indexEndpoints(forwardedEvent.ID, endpoints)
+
+	daily := s.dailyStats(domain, now)
+	switch disposition {
+	case DispositionStale:
+		daily.Stale++
+	case DispositionSkipped:
+		daily.Skipped++
+	default:
+		daily.Forwarded++
+	}
+	daily.recordResults(results)
 
 	// Limit size if maxSize is set
 	if s.maxSize > 0 && len(s.successfulEvents) > s.maxSize {
 		// Remove oldest events
-		removeCount := len(s.successfulEvents) - s.maxSize
-		s.successfulEvents = s.successfulEvents[removeCount:]
+		s.evictSuccessful(len(s.successfulEvents) - s.maxSize)
 	}
+	s.enforceDomainLimit(domain)
+	s.enforceMemoryLimit()
 }
 
-// AddFailedEvent adds a failed event to the store
-func (s *Store) AddFailedEvent(event json.RawMessage, domain, callID string, deliveryAttempt, maxDeliveries int, endpoints []string, errorMessages []string) {
+// AddFailedEvent adds a failed delivery attempt to the store. The attempts of one stream
+// message are kept as a single record: a redelivery that fails again replaces the record
+// of the earlier attempts with a new one (new ID, so delta clients receive it) listing them all.
+func (s *Store) AddFailedEvent(event json.RawMessage, domain, callID string, delivery Delivery, maxDeliveries int, endpoints []string, errorMessages []string, results []DeliveryResult) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	attempts, supersedes := s.takeFailedAttempts(domain, callID, delivery)
+	s.lastID++
+	body, packed := s.pack(event)
+	now := s.clock.Now()
 	failedEvent := FailedEvent{
-		Event:          event,
+		ID:             s.lastID,
+		Event:          body,
 		Domain:         domain,
 		CallID:         callID,
-		FailedAt:       time.Now(),
-		DeliveryAttempt: deliveryAttempt,
+		FailedAt:       now,
+		DeliveryAttempt: delivery.Attempt,
 		MaxDeliveries:  maxDeliveries,
 		Endpoints:      endpoints,
 		ErrorMessages:  errorMessages,
-		WillRetry:      deliveryAttempt < maxDeliveries,
+		Results:        results,
+		WillRetry:      !delivery.AtMostOnce && delivery.Attempt < maxDeliveries,
+		NumPending:     delivery.NumPending,
+		PublishedAt:    delivery.PublishedAt,
+		ElapsedSeconds: delivery.elapsed(now),
+		Replay:         delivery.Replay,
+		AtMostOnce:     delivery.AtMostOnce,
+		Instance:       s.instance,
+		Supersedes:     supersedes,
+		packed:         packed,
+		rawSize:        len(event),
 	}
+	failedEvent.State, failedEvent.Status, failedEvent.HubEventID = extractEventFields(event)
+	failedEvent.Attempts = append(attempts, FailedAttempt{
+		Attempt:       delivery.Attempt,
+		FailedAt:      now,
+		Endpoints:     endpoints,
+		ErrorMessages: errorMessages,
+		Results:       results,
+		Instance:      s.instance,
+	})
 
 	s.failedEvents = append(s.failedEvents, failedEvent)
+	s.recordResults(domain, results)
+	s.indexEndpoints(failedEvent.ID, attemptedEndpoints(failedEvent.Attempts))
+
+	daily := s.dailyStats(domain, now)
+	switch {
+	case failedEvent.WillRetry:
+		daily.Retried++
+	case failedEvent.AtMostOnce:
+		daily.Dropped++
+	default:
+		daily.Failed++
+	}
+	daily.recordResults(results)
 
 	// Limit size if maxSize is set
 	if s.maxSize > 0 && len(s.failedEvents) > s.maxSize {
 		// Remove oldest events
-		removeCount := len(s.failedEvents) - s.maxSize
-		s.failedEvents = s.failedEvents[removeCount:]
+		s.evictFailed(len(s.failedEvents) - s.maxSize)
+	}
+	s.enforceDomainLimit(domain)
+	s.enforceMemoryLimit()
+}
+
+// markEvicted records the highest evicted ID; caller must hold the write lock
+func (s *Store) markEvicted(id uint64) {
+	if id > s.evictedUpTo {
+		s.evictedUpTo = id
 	}
 }
 
+// LatestCursor returns the ID of the most recently added event
+func (s *Store) LatestCursor() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastID
+}
+
+// GetEventsSince returns up to limit events with ID greater than cursor whose
+// domain is accepted by include, oldest first
+func (s *Store) GetEventsSince(cursor uint64, limit int, include func(domain string) bool) Delta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	delta := Delta{
+		Events:       []ForwardedEvent{},
+		FailedEvents: []FailedEvent{},
+		Cursor:       cursor,
+		// A cursor ahead of the store (e.g. from before a restart) is also unusable
+		Truncated: cursor < s.evictedUpTo || cursor > s.lastID,
+	}
+
+	// Both slices are ordered by ID; find the first entry after the cursor in each
+	i := sort.Search(len(s.successfulEvents), func(n int) bool { return s.successfulEvents[n].ID > cursor })
+	j := sort.Search(len(s.failedEvents), func(n int) bool { return s.failedEvents[n].ID > cursor })
+
+	// Merge in ID order so the returned cursor never skips events
+	count := 0
+	for i < len(s.successfulEvents) || j < len(s.failedEvents) {
+		if count >= limit {
+			delta.HasMore = true
+			break
+		}
+
+		if j >= len(s.failedEvents) || (i < len(s.successfulEvents) && s.successfulEvents[i].ID < s.failedEvents[j].ID) {
+			event := s.successfulEvents[i]
+			i++
+			delta.Cursor = event.ID
+			if include(event.Domain) {
+				delta.Events = append(delta.Events, event.unpacked())
+				count++
+			}
+		} else {
+			event := s.failedEvents[j]
+			j++
+			delta.Cursor = event.ID
+			if include(event.Domain) {
+				delta.FailedEvents = append(delta.FailedEvents, event.unpacked())
+				count++
+			}
+		}
+	}
+
+	return delta
+}
+
 // GetEventsByDomain returns all successful events grouped by domain
 func (s *Store) GetEventsByDomain() map[string][]ForwardedEvent {
 	s.mu.RLock()
@@ -104,7 +366,7 @@ func (s *Store) GetEventsByDomain() map[string][]ForwardedEvent {
 
 	result := make(map[string][]ForwardedEvent)
 	for _, event := range s.successfulEvents {
-		result[event.Domain] = append(result[event.Domain], event)
+		result[event.Domain] = append(result[event.Domain], event.unpacked())
 	}
 
 	return result
@@ -117,7 +379,7 @@ func (s *Store) GetFailedEventsByDomain() map[string][]FailedEvent {
 
 	result := make(map[string][]FailedEvent)
 	for _, event := range s.failedEvents {
-		result[event.Domain] = append(result[event.Domain], event)
+		result[event.Domain] = append(result[event.Domain], event.unpacked())
 	}
 
 	return result
@@ -130,7 +392,9 @@ func (s *Store) GetEvents() []ForwardedEvent {
 
 	// Return a copy to avoid race conditions
 	result := make([]ForwardedEvent, len(s.successfulEvents))
-	copy(result, s.successfulEvents)
+	for i, event := range s.successfulEvents {
+		result[i] = event.unpacked()
+	}
 	return result
 }
 
@@ -141,7 +405,9 @@ func (s *Store) GetFailedEvents() []FailedEvent {
 
 	// Return a copy to avoid race conditions
 	result := make([]FailedEvent, len(s.failedEvents))
-	copy(result, s.failedEvents)
+	for i, event := range s.failedEvents {
+		result[i] = event.unpacked()
+	}
 	return result
 }
 
@@ -153,7 +419,7 @@ func (s *Store) GetEventsByDomainFiltered(domain string) []ForwardedEvent {
 	var result []ForwardedEvent
 	for _, event := range s.successfulEvents {
 		if event.Domain == domain {
-			result = append(result, event)
+			result = append(result, event.unpacked())
 		}
 	}
 	return result
@@ -167,46 +433,62 @@ func (s *Store) GetFailedEventsByDomainFiltered(domain string) []FailedEvent {
 	var result []FailedEvent
 	for _, event := range s.failedEvents {
 		if event.Domain == domain {
-			result = append(result, event)
+			result = append(result, event.unpacked())
 		}
 	}
 	return result
 }
 
-// GetStats returns statistics about forwarded events
-func (s *Store) GetStats() map[string]interface{} {
+// GetEventsByCallIDs returns the successful and failed events of the given calls whose
+// domains are accepted by include, oldest first
+func (s *Store) GetEventsByCallIDs(callIDs []string, include func(domain string) bool) ([]ForwardedEvent, []FailedEvent) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	successfulDomainCount := make(map[string]int)
-	failedDomainCount := make(map[string]int)
-	totalSuccessful := len(s.successfulEvents)
-	totalFailed := len(s.failedEvents)
+	wanted := make(map[string]bool, len(callIDs))
+	for _, callID := range callIDs {
+		wanted[callID] = true
+	}
 
+	events := make([]ForwardedEvent, 0)
 	for _, event := range s.successfulEvents {
-		successfulDomainCount[event.Domain]++
+		if wanted[event.CallID] && include(event.Domain) {
+			events = append(events, event.unpacked())
+		}
 	}
-
+	failed := make([]FailedEvent, 0)
 	for _, event := range s.failedEvents {
-		failedDomainCount[event.Domain]++
-	}
-
-	// Count retry attempts
-	retryCount := 0
-	for _, event := range s.failedEvents {
-		if event.WillRetry {
-			retryCount++
+		if wanted[event.CallID] && include(event.Domain) {
+			failed = append(failed, event.unpacked())
 		}
 	}
+	return events, failed
+}
+
+// GetStats returns statistics about forwarded events
+func (s *Store) GetStats() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
+	counts := s.counts()
 	return map[string]interface{}{
-		"total_successful":      totalSuccessful,
-		"total_failed":           totalFailed,
-		"total_events":           totalSuccessful + totalFailed,
-		"retry_count":            retryCount,
-		"successful_domain_count": successfulDomainCount,
-		"failed_domain_count":    failedDomainCount,
-		"domains":               len(successfulDomainCount) + len(failedDomainCount),
+		"total_successful":      counts.Successful,
+		"total_failed":           counts.Failed,
+		"total_events":           counts.Successful + counts.Failed,
+		"retry_count":            counts.Retrying,
+		"dropped_count":          counts.Dropped,
+		"successful_domain_count": counts.SuccessfulByDomain,
+		"failed_domain_count":    counts.FailedByDomain,
+		"domains":               len(counts.SuccessfulByDomain) + len(counts.FailedByDomain),
+		"breakdown":             s.breakdown(func(string) bool { return true }),
+		"memory": MemoryUsage{
+			Bytes:            s.bytes,
+			RawBytes:         s.rawBytes,
+			MaxBytes:         s.maxBytes,
+			Compressed:       s.compress,
+			EvictedForMemory: s.evictedForMemory,
+			EvictedForQuota:  s.evictedForQuota,
+		},
 	}
 }
 
@@ -218,6 +500,7 @@ func (s *Store) GetStatsByDomain(domain string) map[string]interface{} {
 	var totalSuccessful int
 	var totalFailed int
 	var retryCount int
+	var droppedCount int
 
 	for _, event := range s.successfulEvents {
 		if event.Domain == domain {
@@ -231,6 +514,9 @@ func (s *Store) GetStatsByDomain(domain string) map[string]interface{} {
 			if event.WillRetry {
 				retryCount++
 			}
+			if event.AtMostOnce {
+				droppedCount++
+			}
 		}
 	}
 
@@ -239,7 +525,114 @@ func (s *Store) GetStatsByDomain(domain string) map[string]interface{} {
 		"total_failed":     totalFailed,
 		"total_events":     totalSuccessful + totalFailed,
 		"retry_count":      retryCount,
+		"dropped_count":    droppedCount,
 		"domains":          1,
+		"breakdown":        s.breakdown(func(d string) bool { return d == domain }),
 	}
 }
 
+
+// GetStatsForDomains returns statistics restricted to the given set of domains
+// The result has the same shape as GetStats
+func (s *Store) GetStatsForDomains(domains []string) map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	allowed := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		allowed[domain] = true
+	}
+
+	successfulDomainCount := make(map[string]int)
+	failedDomainCount := make(map[string]int)
+	totalSuccessful := 0
+	totalFailed := 0
+	retryCount := 0
+	droppedCount := 0
+
+	for _, event := range s.successfulEvents {
+		if allowed[event.Domain] {
+			successfulDomainCount[event.Domain]++
+			totalSuccessful++
+		}
+	}
+
+	for _, event := range s.failedEvents {
+		if allowed[event.Domain] {
+			failedDomainCount[event.Domain]++
+			totalFailed++
+			if event.WillRetry {
+				retryCount++
+			}
+			if event.AtMostOnce {
+				droppedCount++
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"total_successful":        totalSuccessful,
+		"total_failed":            totalFailed,
+		"total_events":            totalSuccessful + totalFailed,
+		"retry_count":             retryCount,
+		"dropped_count":           droppedCount,
+		"successful_domain_count": successfulDomainCount,
+		"failed_domain_count":     failedDomainCount,
+		"domains":                 len(successfulDomainCount) + len(failedDomainCount),
+		"breakdown":               s.breakdown(func(d string) bool { return allowed[d] }),
+	}
+}
+
+// breakdown counts events by state and status for each domain accepted by include
+// Caller must hold the read lock
+func (s *Store) breakdown(include func(domain string) bool) map[string]*DomainBreakdown {
+	result := make(map[string]*DomainBreakdown)
+	get := func(domain string) *DomainBreakdown {
+		b, ok := result[domain]
+		if !ok {
+			b = &DomainBreakdown{
+				States:         make(map[string]int),
+				Statuses:       make(map[string]int),
+				FailedStates:   make(map[string]int),
+				FailedStatuses: make(map[string]int),
+			}
+			result[domain] = b
+		}
+		return b
+	}
+
+	for _, event := range s.successfulEvents {
+		if include(event.Domain) {
+			b := get(event.Domain)
+			b.States[valueOrUnknown(event.State)]++
+			b.Statuses[valueOrUnknown(event.Status)]++
+		}
+	}
+
+	for _, event := range s.failedEvents {
+		if include(event.Domain) {
+			b := get(event.Domain)
+			b.FailedStates[valueOrUnknown(event.State)]++
+			b.FailedStatuses[valueOrUnknown(event.Status)]++
+		}
+	}
+
+	return result
+}
+
+// extractEventFields reads the state, status and hub_event_id fields from an event payload
+func extractEventFields(data json.RawMessage) (string, string, string) {
+	ev, err := event.Parse(data)
+	if err != nil {
+		return "", "", ""
+	}
+	return ev.Text("state"), ev.Text("status"), ev.HubEventID
+}
+
+// valueOrUnknown maps empty values to "unknown" for breakdown keys
+func valueOrUnknown(v string) string {
+	if v == "" {
+		return "unknown"
+	}
+	return v
+}
@@ -0,0 +1,314 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // tz must work on hosts without a zoneinfo database (Windows)
+	"unicode"
+)
+
+// function is a template function applied to the piped value
+type function struct {
+	minArgs int
+	maxArgs int
+	call    func(value interface{}, args []interface{}) (interface{}, error)
+	check   func(args []arg) error // Validates literal arguments when the template is parsed
+}
+
+// functions is the function library available in templates
+var functions = map[string]function{
+	// Strings
+	"upper":   {call: stringFunc(strings.ToUpper)},
+	"lower":   {call: stringFunc(strings.ToLower)},
+	"title":   {call: stringFunc(title)},
+	"trim":    {call: stringFunc(strings.TrimSpace)},
+	"digits":  {call: stringFunc(digitsOnly)},
+	"replace": {minArgs: 2, maxArgs: 2, call: replace},
+
+	// Conditional defaults
+	"default": {minArgs: 1, maxArgs: 1, call: defaultValue},
+
+	// Numbers
+	"add":   {minArgs: 1, maxArgs: 1, call: arithmetic(func(a, b float64) (float64, error) { return a + b, nil })},
+	"sub":   {minArgs: 1, maxArgs: 1, call: arithmetic(func(a, b float64) (float64, error) { return a - b, nil })},
+	"mul":   {minArgs: 1, maxArgs: 1, call: arithmetic(func(a, b float64) (float64, error) { return a * b, nil })},
+	"div":   {minArgs: 1, maxArgs: 1, call: arithmetic(divide)},
+	"round": {minArgs: 0, maxArgs: 1, call: round},
+
+	// Dates
+	"date":       {minArgs: 1, maxArgs: 1, call: formatDate},
+	"parse_date": {minArgs: 1, maxArgs: 1, call: parseDate},
+	"tz":         {minArgs: 1, maxArgs: 1, call: inZone, check: checkZone},
+	"unix":       {call: unixSeconds},
+
+	// Phone numbers
+	"e164": {minArgs: 1, maxArgs: 1, call: e164},
+}
+
+// namedLayouts are shorthands accepted by date
+var namedLayouts = map[string]string{
+	"rfc3339":  time.RFC3339,
+	"date":     "2006-01-02",
+	"time":     "15:04:05",
+	"datetime": "2006-01-02 15:04:05",
+}
+
+// inputLayouts are the time formats recognized in event fields (zone-less times are UTC)
+var inputLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// zones caches loaded time zones
+var zones sync.Map
+
+func stringFunc(fn func(string) string) func(interface{}, []interface{}) (interface{}, error) {
+	return func(value interface{}, _ []interface{}) (interface{}, error) {
+		if value == nil {
+			return nil, nil
+		}
+		return fn(ToString(value)), nil
+	}
+}
+
+func title(s string) string {
+	upperNext := true
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' || r == '_' {
+			upperNext = true
+			return r
+		}
+		if upperNext {
+			upperNext = false
+			return unicode.ToUpper(r)
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func replace(value interface{}, args []interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return strings.ReplaceAll(ToString(value), ToString(args[0]), ToString(args[1])), nil
+}
+
+// defaultValue returns the argument when the value is missing or blank
+func defaultValue(value interface{}, args []interface{}) (interface{}, error) {
+	if value == nil {
+		return args[0], nil
+	}
+	if s, ok := value.(string); ok && strings.TrimSpace(s) == "" {
+		return args[0], nil
+	}
+	return value, nil
+}
+
+func arithmetic(op func(a, b float64) (float64, error)) func(interface{}, []interface{}) (interface{}, error) {
+	return func(value interface{}, args []interface{}) (interface{}, error) {
+		a, err := toNumber(value)
+		if err != nil {
+			return nil, err
+		}
+		b, err := toNumber(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("argument: %w", err)
+		}
+		return op(a, b)
+	}
+}
+
+func divide(a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return a / b, nil
+}
+
+// round rounds to the given number of decimal places (default 0)
+func round(value interface{}, args []interface{}) (interface{}, error) {
+	n, err := toNumber(value)
+	if err != nil {
+		return nil, err
+	}
+	places := 0.0
+	if len(args) > 0 {
+		if places, err = toNumber(args[0]); err != nil {
+			return nil, fmt.Errorf("argument: %w", err)
+		}
+	}
+	scale := math.Pow(10, math.Trunc(places))
+	return math.Round(n*scale) / scale, nil
+}
+
+// toNumber converts numbers and numeric strings
+func toNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return n, nil
+	case nil:
+		return 0, fmt.Errorf("value is missing")
+	default:
+		return 0, fmt.Errorf("%s is not a number", ToString(v))
+	}
+}
+
+// formatDate formats a time with a Go layout or one of the named layouts
+func formatDate(value interface{}, args []interface{}) (interface{}, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return nil, err
+	}
+	layout := ToString(args[0])
+	if named, ok := namedLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout), nil
+}
+
+// parseDate parses a string with an explicit Go layout (zone-less times are UTC)
+func parseDate(value interface{}, args []interface{}) (interface{}, error) {
+	s := ToString(value)
+	t, err := time.Parse(ToString(args[0]), s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q with layout %q", s, ToString(args[0]))
+	}
+	return t, nil
+}
+
+// inZone converts a time to the named IANA time zone
+func inZone(value interface{}, args []interface{}) (interface{}, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := loadZone(ToString(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return t.In(loc), nil
+}
+
+func checkZone(args []arg) error {
+	if s, ok := args[0].literal.(string); ok {
+		_, err := loadZone(s)
+		return err
+	}
+	return nil
+}
+
+func loadZone(name string) (*time.Location, error) {
+	if loc, ok := zones.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	zones.Store(name, loc)
+	return loc, nil
+}
+
+func unixSeconds(value interface{}, _ []interface{}) (interface{}, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.Unix()), nil
+}
+
+// toTime converts times, Unix timestamps (seconds, or milliseconds when too large
+// for seconds) and strings in one of the inputLayouts
+func toTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case float64:
+		return fromUnix(v), nil
+	case string:
+		s := strings.TrimSpace(v)
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return fromUnix(n), nil
+		}
+		for _, layout := range inputLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse %q as a time", v)
+	case nil:
+		return time.Time{}, fmt.Errorf("value is missing")
+	default:
+		return time.Time{}, fmt.Errorf("%s is not a time", ToString(v))
+	}
+}
+
+func fromUnix(n float64) time.Time {
+	if math.Abs(n) >= 1e12 {
+		return time.UnixMilli(int64(n)).UTC()
+	}
+	sec, frac := math.Modf(n)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
+
+// e164 normalizes a phone number to E.164 ("+<country code><number>") using the given
+// country code for national numbers ("0912345678" with 84 becomes "+84912345678")
+func e164(value interface{}, args []interface{}) (interface{}, error) {
+	raw := strings.TrimSpace(ToString(value))
+	if raw == "" {
+		return nil, fmt.Errorf("value is missing")
+	}
+	countryCode := digitsOnly(ToString(args[0]))
+	if countryCode == "" {
+		return nil, fmt.Errorf("invalid country code %q", ToString(args[0]))
+	}
+
+	for _, r := range raw {
+		if !(r >= '0' && r <= '9' || strings.ContainsRune("+ -.()/", r)) {
+			return nil, fmt.Errorf("%q is not a phone number", raw)
+		}
+	}
+	digits := digitsOnly(raw)
+
+	var number string
+	switch {
+	case strings.HasPrefix(raw, "+"):
+		number = digits
+	case strings.HasPrefix(digits, "00"):
+		number = digits[2:]
+	case strings.HasPrefix(digits, "0"):
+		number = countryCode + digits[1:]
+	case strings.HasPrefix(digits, countryCode) && len(digits) >= len(countryCode)+8:
+		number = digits
+	default:
+		number = countryCode + digits
+	}
+
+	// E.164 numbers have at most 15 digits; anything under 8 is an extension or short code
+	if len(number) < 8 || len(number) > 15 {
+		return nil, fmt.Errorf("%q is not a valid E.164 number", raw)
+	}
+	return "+" + number, nil
+}
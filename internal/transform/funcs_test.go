@@ -0,0 +1,121 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+)
+
+// event is the event the function tests render templates against
+var event = map[string]interface{}{
+	"national":      "0912345678",
+	"international": "0084912345678",
+	"plus":          "+84 91 234 5678",
+	"with_country":  "84912345678",
+	"subscriber":    "912345678",
+	"formatted":     "(091) 234-5678",
+	"numeric":       float64(912345678),
+	"short_country": "8412345",
+	"short":         "1234",
+	"shortest":      "+12345678",
+	"longest":       "+123456789012345",
+	"too_long":      "+1234567890123456",
+	"letters":       "09abc",
+
+	"billsec":   float64(125),
+	"ten":       "10",
+	"pi":        3.14159,
+	"half":      2.5,
+	"minus":     -2.5,
+	"started":   "2024-05-01T10:30:00Z",
+	"local":     "2024-05-01 10:30:00",
+	"seconds":   float64(1714559400),
+	"millis":    float64(1714559400000),
+	"day_first": "01/05/2024",
+	"zone":      "Asia/Ho_Chi_Minh",
+	"bad_zone":  "Nowhere/Atlantis",
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []struct {
+		template string
+		want     interface{}
+	}{
+		// e164: national, 00 and + prefixes, numbers already including the country code
+		{`{national | e164 "84"}`, "+84912345678"},
+		{`{international | e164 "84"}`, "+84912345678"},
+		{`{plus | e164 "1"}`, "+84912345678"},
+		{`{with_country | e164 "84"}`, "+84912345678"},
+		{`{subscriber | e164 "84"}`, "+84912345678"},
+		{`{formatted | e164 "+84"}`, "+84912345678"},
+		{`{numeric | e164 "84"}`, "+84912345678"},
+		{`{short_country | e164 "84"}`, "+848412345"}, // Too short to include the country code
+		// e164: 8 to 15 digits
+		{`{shortest | e164 "84"}`, "+12345678"},
+		{`{longest | e164 "84"}`, "+123456789012345"},
+
+		// Numbers
+		{`{billsec | div 60 | round 1}`, 2.1},
+		{`{ten | div 4}`, 2.5},
+		{`{billsec | sub 5 | mul 2 | add 1}`, float64(241)},
+		{`{pi | round 2}`, 3.14},
+		{`{half | round}`, float64(3)},
+		{`{minus | round}`, float64(-3)},
+
+		// Dates
+		{`{started | date "date"}`, "2024-05-01"},
+		{`{started | date "15:04"}`, "10:30"},
+		{`{local | date "rfc3339"}`, "2024-05-01T10:30:00Z"},
+		{`{started | tz "Asia/Ho_Chi_Minh" | date "2006-01-02 15:04"}`, "2024-05-01 17:30"},
+		{`{started | tz zone}`, "2024-05-01T17:30:00+07:00"},
+		{`{day_first | parse_date "02/01/2006" | date "date"}`, "2024-05-01"},
+		{`{seconds | date "datetime"}`, "2024-05-01 10:30:00"},
+		{`{millis | date "datetime"}`, "2024-05-01 10:30:00"},
+		{`{started | unix}`, float64(1714559400)},
+		{`{local | tz "Asia/Ho_Chi_Minh" | unix}`, float64(1714559400)},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(tt.template)
+		if err != nil {
+			t.Errorf("%s: %v", tt.template, err)
+			continue
+		}
+		got, err := tmpl.Value(FieldLookup(event))
+		if err != nil {
+			t.Errorf("%s: %v", tt.template, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %#v, want %#v", tt.template, got, tt.want)
+		}
+	}
+}
+
+// Errors of functions applied to an event name the template, the expression and the function
+func TestFunctionErrors(t *testing.T) {
+	tests := []struct {
+		template string
+		err      string
+	}{
+		{`{short | e164 "84"}`, `template "{short | e164 \"84\"}": {short | e164 "84"}: e164: "1234" is not a valid E.164 number`},
+		{`{too_long | e164 "84"}`, `"+1234567890123456" is not a valid E.164 number`},
+		{`{letters | e164 "84"}`, `"09abc" is not a phone number`},
+		{`{missing | e164 "84"}`, "e164: value is missing"},
+		{`{national | e164 "x"}`, `invalid country code "x"`},
+		{`{billsec | div 0}`, "div: division by zero"},
+		{`{billsec | div "x"}`, `div: argument: "x" is not a number`},
+		{`{started | round}`, `round: "2024-05-01T10:30:00Z" is not a number`},
+		{`{missing | add 1}`, "add: value is missing"},
+		{`{missing | date "date"}`, "date: value is missing"},
+		{`{day_first | date "date"}`, `date: cannot parse "01/05/2024" as a time`},
+		{`{started | parse_date "02/01/2006"}`, `parse_date: cannot parse "2024-05-01T10:30:00Z" with layout "02/01/2006"`},
+		{`{started | tz bad_zone}`, `tz: unknown time zone "Nowhere/Atlantis"`},
+		{`{letters | unix}`, `unix: cannot parse "09abc" as a time`},
+		{`/calls/{billsec | div 0}`, `template "/calls/{billsec | div 0}": {billsec | div 0}: div: division by zero`},
+	}
+	for _, tt := range tests {
+		_, err := Expand(tt.template, FieldLookup(event), nil)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.template, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+// Package transform implements the template language used in endpoint URLs,
+// header values, payload transforms and sink names.
+//
+// A template is text with "{...}" expressions. An expression names an event
+// field (or a quoted literal) and may pipe it through functions:
+//
+//	{domain}
+//	{to_number | e164 "84"}
+//	{time_started | tz "Asia/Ho_Chi_Minh" | date "2006-01-02 15:04"}
+//	{billsec | div 60 | round 1}
+//	{agent_name | default "unassigned" | upper}
+//
+// Function arguments are quoted strings, numbers, or field names (resolved
+// against the event like the piped value).
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lookup resolves a field name to its value (nil when the field is missing)
+type Lookup func(name string) interface{}
+
+// Template is a parsed template
+type Template struct {
+	source string
+	parts  []part
+}
+
+// part is literal text, or an expression when pipe is set
+type part struct {
+	text string
+	pipe *pipeline
+}
+
+// pipeline is an operand passed through a chain of function calls
+type pipeline struct {
+	source  string
+	operand arg
+	calls   []call
+}
+
+type call struct {
+	name string
+	fn   function
+	args []arg
+}
+
+// arg is a literal (string or float64) or a field reference
+type arg struct {
+	literal interface{}
+	field   string
+}
+
+// cache holds parsed templates by source; templates only come from configuration
+var cache sync.Map
+
+// Parse parses a template, reporting syntax errors and unknown functions
+func Parse(source string) (*Template, error) {
+	t := &Template{source: source}
+	rest := source
+	for rest != "" {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			t.parts = append(t.parts, part{text: rest})
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, part{text: rest[:start]})
+		}
+		end := closingBrace(rest[start:])
+		if end < 0 {
+			return nil, fmt.Errorf("template %q: unterminated expression %q", source, rest[start:])
+		}
+		expr := rest[start+1 : start+end]
+		pipe, err := parsePipeline(expr)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: {%s}: %w", source, expr, err)
+		}
+		t.parts = append(t.parts, part{pipe: pipe})
+		rest = rest[start+end+1:]
+	}
+	return t, nil
+}
+
+// Cached returns the parsed template for source, parsing it on first use
+func Cached(source string) (*Template, error) {
+	if t, ok := cache.Load(source); ok {
+		return t.(*Template), nil
+	}
+	t, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(source, t)
+	return t, nil
+}
+
+// Expand parses (cached) and executes a template
+func Expand(source string, lookup Lookup, escape func(string) string) (string, error) {
+	t, err := Cached(source)
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(lookup, escape)
+}
+
+// HasExpressions reports whether source contains any "{...}" expression
+func HasExpressions(source string) bool {
+	return strings.IndexByte(source, '{') >= 0
+}
+
+// Placeholder renders the template with every expression replaced by s, e.g. to
+// check the static parts of a URL template
+func (t *Template) Placeholder(s string) string {
+	var sb strings.Builder
+	for _, p := range t.parts {
+		if p.pipe == nil {
+			sb.WriteString(p.text)
+		} else {
+			sb.WriteString(s)
+		}
+	}
+	return sb.String()
+}
+
+// String returns the template source
+func (t *Template) String() string {
+	return t.source
+}
+
+// Execute renders the template, passing each expression result through escape if set
+func (t *Template) Execute(lookup Lookup, escape func(string) string) (string, error) {
+	var sb strings.Builder
+	for _, p := range t.parts {
+		if p.pipe == nil {
+			sb.WriteString(p.text)
+			continue
+		}
+		value, err := p.pipe.eval(lookup)
+		if err != nil {
+			return "", fmt.Errorf("template %q: %w", t.source, err)
+		}
+		s := ToString(value)
+		if escape != nil {
+			s = escape(s)
+		}
+		sb.WriteString(s)
+	}
+	return sb.String(), nil
+}
+
+// Value renders the template like Execute, except that a template consisting of a single
+// expression returns the expression's value with its type (e.g. a number stays a number)
+func (t *Template) Value(lookup Lookup) (interface{}, error) {
+	if len(t.parts) == 1 && t.parts[0].pipe != nil {
+		value, err := t.parts[0].pipe.eval(lookup)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", t.source, err)
+		}
+		if tm, ok := value.(time.Time); ok {
+			return ToString(tm), nil
+		}
+		return value, nil
+	}
+	return t.Execute(lookup, nil)
+}
+
+// eval resolves the operand and applies the function calls in order
+func (p *pipeline) eval(lookup Lookup) (interface{}, error) {
+	value := p.operand.resolve(lookup)
+	for _, c := range p.calls {
+		args := make([]interface{}, len(c.args))
+		for i, a := range c.args {
+			args[i] = a.resolve(lookup)
+		}
+		var err error
+		if value, err = c.fn.call(value, args); err != nil {
+			return nil, fmt.Errorf("{%s}: %s: %w", p.source, c.name, err)
+		}
+	}
+	return value, nil
+}
+
+func (a arg) resolve(lookup Lookup) interface{} {
+	if a.field == "" {
+		return a.literal
+	}
+	if lookup == nil {
+		return nil
+	}
+	return lookup(a.field)
+}
+
+// closingBrace returns the index of the brace closing the expression that starts s, skipping quoted strings
+func closingBrace(s string) int {
+	inQuote := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && s[i] == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// parsePipeline parses "operand | func arg... | func arg..."
+func parsePipeline(expr string) (*pipeline, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var stages [][]string
+	current := []string{}
+	for _, token := range tokens {
+		if token == "|" {
+			stages = append(stages, current)
+			current = []string{}
+			continue
+		}
+		current = append(current, token)
+	}
+	stages = append(stages, current)
+
+	if len(stages[0]) != 1 {
+		return nil, fmt.Errorf("expected a single field name or literal before the first |")
+	}
+	operand, err := parseArg(stages[0][0])
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pipeline{source: strings.TrimSpace(expr), operand: operand}
+	for _, stage := range stages[1:] {
+		if len(stage) == 0 {
+			return nil, fmt.Errorf("missing function name after |")
+		}
+		name := stage[0]
+		fn, ok := functions[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown function %q", name)
+		}
+		args := make([]arg, 0, len(stage)-1)
+		for _, token := range stage[1:] {
+			a, err := parseArg(token)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, a)
+		}
+		if len(args) < fn.minArgs || len(args) > fn.maxArgs {
+			return nil, fmt.Errorf("%s: expected %s, got %d", name, arity(fn), len(args))
+		}
+		if fn.check != nil {
+			if err := fn.check(args); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		p.calls = append(p.calls, call{name: name, fn: fn, args: args})
+	}
+	return p, nil
+}
+
+// tokenize splits an expression into quoted strings (kept quoted), "|" and bare words
+func tokenize(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '|':
+			tokens = append(tokens, "|")
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(expr) && expr[j] != '"'; j++ {
+				if expr[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, expr[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(expr) && expr[j] != ' ' && expr[j] != '\t' && expr[j] != '|' && expr[j] != '"' {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	return tokens, nil
+}
+
+// parseArg parses a quoted string, a number or a field name
+func parseArg(token string) (arg, error) {
+	if strings.HasPrefix(token, `"`) {
+		s, err := strconv.Unquote(token)
+		if err != nil {
+			return arg{}, fmt.Errorf("invalid string %s", token)
+		}
+		return arg{literal: s}, nil
+	}
+	if n, err := strconv.ParseFloat(token, 64); err == nil {
+		return arg{literal: n}, nil
+	}
+	for _, r := range token {
+		if !(r == '_' || r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return arg{}, fmt.Errorf("invalid field name %q", token)
+		}
+	}
+	return arg{field: token}, nil
+}
+
+func arity(fn function) string {
+	switch {
+	case fn.minArgs == fn.maxArgs && fn.minArgs == 1:
+		return "1 argument"
+	case fn.minArgs == fn.maxArgs:
+		return fmt.Sprintf("%d arguments", fn.minArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", fn.minArgs, fn.maxArgs)
+	}
+}
+
+// ToString converts a value to its template text: strings as-is, numbers without
+// trailing zeros, times as RFC 3339, missing values as "" and anything else as JSON
+func ToString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(encoded)
+	}
+}
+
+// FieldLookup returns a Lookup over a parsed JSON object; dotted names address nested objects
+func FieldLookup(fields map[string]interface{}) Lookup {
+	return func(name string) interface{} {
+		if value, ok := fields[name]; ok {
+			return value
+		}
+		var current interface{} = fields
+		for _, key := range strings.Split(name, ".") {
+			m, ok := current.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			current = m[key]
+		}
+		return current
+	}
+}
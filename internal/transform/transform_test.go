@@ -0,0 +1,70 @@
+package transform
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	fields := map[string]interface{}{
+		"domain":     "tenant1.example.com",
+		"agent_name": "  ",
+		"call":       map[string]interface{}{"id": "c 1", "legs": float64(2)},
+		"answered":   true,
+	}
+	tests := []struct {
+		template string
+		escape   func(string) string
+		want     string
+	}{
+		{"https://hooks.example.com/static", url.PathEscape, "https://hooks.example.com/static"},
+		{"https://{domain}/events", url.PathEscape, "https://tenant1.example.com/events"},
+		{"/calls/{call.id}", url.PathEscape, "/calls/c%201"},
+		{"{call.legs} legs, answered {answered}", nil, "2 legs, answered true"},
+		{`{agent_name | default "unassigned" | upper}`, nil, "UNASSIGNED"},
+		{`{missing | default domain}`, nil, "tenant1.example.com"},
+		{`{"a|b}" | replace "|" "/"}`, nil, "a/b}"},
+		{"{missing}", nil, ""},
+		{"{call}", nil, `{"id":"c 1","legs":2}`},
+	}
+	for _, tt := range tests {
+		got, err := Expand(tt.template, FieldLookup(fields), tt.escape)
+		if err != nil {
+			t.Errorf("%s: %v", tt.template, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+// Syntax errors, unknown functions and wrong arguments are reported when the template is
+// parsed, with the template and the expression
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		template string
+		err      string
+	}{
+		{"https://{domain/events", `template "https://{domain/events": unterminated expression "{domain/events"`},
+		{"{}", "{}: empty expression"},
+		{"{ | upper}", "expected a single field name or literal before the first |"},
+		{"{domain domain}", "expected a single field name or literal before the first |"},
+		{"{domain |}", "missing function name after |"},
+		{"{domain | shout}", `unknown function "shout"`},
+		{"{domain | upper 1}", "upper: expected 0 arguments, got 1"},
+		{"{billsec | div}", "div: expected 1 argument, got 0"},
+		{"{billsec | round 1 2}", "round: expected 0 to 1 arguments, got 2"},
+		{`{domain | replace "a"}`, "replace: expected 2 arguments, got 1"},
+		{`{time_started | tz "Mars/Olympus"}`, `tz: unknown time zone "Mars/Olympus"`},
+		{`{domain | default "open}`, "unterminated"},
+		{"{call/id}", `invalid field name "call/id"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.template)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.template, err, tt.err)
+		}
+	}
+}